@@ -0,0 +1,337 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package alert
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/utils"
+	log "github.com/ChrIgiSta/go-utils/logger"
+	"github.com/Knetic/govaluate"
+)
+
+type Severity string
+
+const (
+	Info     Severity = "info"
+	Warning  Severity = "warning"
+	Critical Severity = "critical"
+)
+
+// an alert condition on decoded values. the expressions refer to signals
+// by name, e.g. [Battery Voltage] < 11.8, and to the constants of the
+// parser, e.g. [Engine State] == ENGINE_OFF
+type Rule struct {
+	Name      string
+	Condition string
+	// the condition has to hold this long to trigger
+	For time.Duration
+	// the rule applies only while this holds, e.g. [Speed] > 5. an active
+	// alert is cleared when it does not hold anymore
+	While string
+	// hysteresis: the alert clears when this holds, e.g. [Battery Voltage] > 12.2,
+	// instead of when the condition does not hold anymore
+	Clear string
+	// the clear condition has to hold this long to clear
+	ClearFor time.Duration
+	Severity Severity
+	Message  string
+}
+
+type Kind string
+
+const (
+	Triggered Kind = "triggered"
+	Cleared   Kind = "cleared"
+)
+
+// an alert triggered or cleared
+type Event struct {
+	Kind     Kind     `json:"kind"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message,omitempty"`
+	// the signals of the rule
+	Values map[string]interface{} `json:"values"`
+	// triggered: the condition holds since, cleared: triggered at
+	Since     time.Time `json:"since"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// a parsed rule and its state
+type rule struct {
+	Rule
+	condition *govaluate.EvaluableExpression
+	while     *govaluate.EvaluableExpression
+	clear     *govaluate.EvaluableExpression
+	inputs    []string
+
+	active    bool
+	triggered time.Time
+	pending   time.Time // the condition holds since, not yet triggered
+	clearing  time.Time // the clear condition holds since
+	leaving   bool      // while does not hold anymore
+	err       error     // of the last evaluation
+}
+
+// evaluates rules on the decoded values of all buses of a car. safe for
+// concurrent use
+type Engine struct {
+	mutex     sync.Mutex
+	rules     []*rule
+	constants map[string]float64
+	values    map[string]interface{}
+	channels  []chan Event
+}
+
+// parses the rules, their signals and constants have to be known by the parser
+func NewEngine(def *cancoder.CancoderDef, rules []Rule) (*Engine, error) {
+	names := make(map[string]bool)
+	for _, coder := range def.Cancoders {
+		for _, mapping := range coder.Map {
+			names[string(mapping.CanValueDef.Name)] = true
+		}
+	}
+	e := &Engine{
+		constants: def.Constants,
+		values:    make(map[string]interface{}),
+	}
+	for _, r := range rules {
+		parsed := &rule{Rule: r}
+		var err error
+		parsed.condition, err = e.parse(parsed, r.Condition, names)
+		if err == nil && strings.TrimSpace(r.While) != "" {
+			parsed.while, err = e.parse(parsed, r.While, names)
+		}
+		if err == nil && strings.TrimSpace(r.Clear) != "" {
+			parsed.clear, err = e.parse(parsed, r.Clear, names)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		e.rules = append(e.rules, parsed)
+	}
+	return e, nil
+}
+
+func (e *Engine) parse(r *rule, expression string, names map[string]bool) (*govaluate.EvaluableExpression, error) {
+	parsed, err := govaluate.NewEvaluableExpression(utils.ReplaceHexWithDecimal(expression))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range parsed.Vars() {
+		if _, ok := e.constants[name]; ok {
+			continue
+		}
+		if !names[name] {
+			return nil, fmt.Errorf("unknown signal or constant %q", name)
+		}
+		known := false
+		for _, input := range r.inputs {
+			known = known || input == name
+		}
+		if !known {
+			r.inputs = append(r.inputs, name)
+		}
+	}
+	return parsed, nil
+}
+
+func (e *Engine) GetEventChannel() <-chan Event {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	events := make(chan Event, cancoder.EventChannelBufferSize)
+	e.channels = append(e.channels, events)
+	return events
+}
+
+// adds a decoded value and evaluates the rules using it
+func (e *Engine) Add(value *cancoder.CanValueMap) []Event {
+	if value.CanValueDef.Value == nil {
+		return nil
+	}
+	name := string(value.CanValueDef.Name)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.values[name] = value.CanValueDef.Value
+	var events []Event
+	for _, r := range e.rules {
+		if r.uses(name) {
+			events = e.evaluate(r, value.Timestamp, events)
+		}
+	}
+	return events
+}
+
+// a timed out value is not used anymore, the rules using it keep their state
+// until it is received again
+func (e *Engine) State(event cancoder.StateEvent) {
+	if event.Kind != cancoder.EventTimeout {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(e.values, string(event.Value.CanValueDef.Name))
+}
+
+// triggers and clears alerts whose conditions held for their durations.
+// should be called periodically, e.g. every cancoder.CheckInterval, as the
+// values of a condition may not change
+func (e *Engine) Check(now time.Time) []Event {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var events []Event
+	for _, r := range e.rules {
+		events = e.advance(r, now, events)
+	}
+	return events
+}
+
+// the triggered alerts, which are not cleared yet
+func (e *Engine) Active() []Event {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var events []Event
+	for _, r := range e.rules {
+		if r.active {
+			events = append(events, e.event(r, Triggered, r.triggered, r.triggered))
+		}
+	}
+	return events
+}
+
+func (r *rule) uses(name string) bool {
+	for _, input := range r.inputs {
+		if input == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) evaluate(r *rule, now time.Time, events []Event) []Event {
+	parameters := make(map[string]interface{}, len(r.inputs)+len(e.constants))
+	for name, value := range e.constants {
+		parameters[name] = value
+	}
+	for _, name := range r.inputs {
+		value, ok := e.values[name]
+		if !ok {
+			return events
+		}
+		parameters[name] = value
+	}
+
+	holds := func(expression *govaluate.EvaluableExpression) bool {
+		result, err := expression.Evaluate(parameters)
+		if err == nil {
+			if _, ok := result.(bool); !ok {
+				err = fmt.Errorf("%q is not a condition", expression.String())
+			}
+		}
+		if err != nil && (r.err == nil || r.err.Error() != err.Error()) {
+			log.Warn("alert", "rule %q: %v", r.Name, err)
+		}
+		r.err = err
+		fulfilled, _ := result.(bool)
+		return err == nil && fulfilled
+	}
+
+	applies := r.while == nil || holds(r.while)
+	condition := applies && holds(r.condition)
+	if !r.active {
+		if !condition {
+			r.pending = time.Time{}
+		} else if r.pending.IsZero() {
+			r.pending = now
+		}
+	} else {
+		r.leaving = !applies
+		clear := !condition
+		if r.clear != nil {
+			clear = holds(r.clear)
+		}
+		if !clear && applies {
+			r.clearing = time.Time{}
+		} else if r.clearing.IsZero() {
+			r.clearing = now
+		}
+	}
+	return e.advance(r, now, events)
+}
+
+func (e *Engine) advance(r *rule, now time.Time, events []Event) []Event {
+	switch {
+	case !r.active && !r.pending.IsZero() && now.Sub(r.pending) >= r.For:
+		r.active, r.triggered = true, now
+		events = e.emit(events, e.event(r, Triggered, r.pending, now))
+		r.pending = time.Time{}
+	case r.active && !r.clearing.IsZero() && (r.leaving || now.Sub(r.clearing) >= r.ClearFor):
+		r.active, r.leaving = false, false
+		r.clearing = time.Time{}
+		events = e.emit(events, e.event(r, Cleared, r.triggered, now))
+	}
+	return events
+}
+
+func (e *Engine) event(r *rule, kind Kind, since time.Time, now time.Time) Event {
+	event := Event{
+		Kind:      kind,
+		Rule:      r.Name,
+		Severity:  r.Severity,
+		Message:   r.Message,
+		Values:    make(map[string]interface{}, len(r.inputs)),
+		Since:     since,
+		Timestamp: now,
+	}
+	for _, name := range r.inputs {
+		if value, ok := e.values[name]; ok {
+			event.Values[name] = value
+		}
+	}
+	return event
+}
+
+func (e *Engine) emit(events []Event, event Event) []Event {
+	for _, eventCh := range e.channels {
+		select {
+		case eventCh <- event:
+		default:
+			log.Warn("alert", "event channel full. you need to process faster ;)")
+		}
+	}
+	return append(events, event)
+}
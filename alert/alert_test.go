@@ -0,0 +1,173 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func value(name cancoder.CanVars, v float64, at time.Duration) *cancoder.CanValueMap {
+	return &cancoder.CanValueMap{
+		CanValueDef: cancoder.CanValueDef{Name: name, Value: v},
+		Timestamp:   start.Add(at),
+	}
+}
+
+func TestEngine(t *testing.T) {
+	if _, err := NewEngine(&cancoder.OpelAstraHOpc2006, []Rule{{Name: "x", Condition: "[Speeed] > 5"}}); err == nil {
+		t.Error("expected an error for an unknown signal")
+	}
+	engine, err := NewEngine(&cancoder.OpelAstraHOpc2006, OpelAstraHOpc2006Rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := engine.GetEventChannel()
+	expect := func(got []Event, kind Kind, rule string) {
+		t.Helper()
+		if len(got) != 1 || got[0].Kind != kind || got[0].Rule != rule {
+			t.Fatalf("events %+v, expected %s %s", got, rule, kind)
+		}
+		if sent := <-events; sent.Kind != kind || sent.Rule != rule {
+			t.Fatalf("sent %+v, expected %s %s", sent, rule, kind)
+		}
+	}
+
+	// low battery: 30s with the engine off, cleared above 12.2 V for 10s
+	engine.Add(value(cancoder.EngineRunningState, cancoder.ENGINE_OFF, 0))
+	if got := engine.Add(value(cancoder.BatteryVoltage, 11.5, 0)); len(got) != 0 {
+		t.Fatalf("triggered without duration: %+v", got)
+	}
+	if got := engine.Check(start.Add(29 * time.Second)); len(got) != 0 {
+		t.Fatalf("triggered early: %+v", got)
+	}
+	expect(engine.Check(start.Add(30*time.Second)), Triggered, "low battery")
+	if active := engine.Active(); len(active) != 1 || active[0].Values["Battery Voltage"] != 11.5 {
+		t.Errorf("active %+v", active)
+	}
+	// within the hysteresis
+	engine.Add(value(cancoder.BatteryVoltage, 12, 40*time.Second))
+	if got := engine.Check(start.Add(time.Minute)); len(got) != 0 {
+		t.Fatalf("cleared within the hysteresis: %+v", got)
+	}
+	engine.Add(value(cancoder.BatteryVoltage, 12.5, time.Minute))
+	expect(engine.Check(start.Add(70*time.Second)), Cleared, "low battery")
+
+	// door open: only while driving, cleared by stopping
+	if got := engine.Add(value(cancoder.DoorState, cancoder.DOOR_STATE_TRUNK_OPEN, 0)); len(got) != 0 {
+		t.Fatalf("triggered without speed: %+v", got)
+	}
+	engine.Add(value(cancoder.VehicleSpeed, 3, time.Second))
+	expect(engine.Add(value(cancoder.VehicleSpeed, 20, 2*time.Second)), Triggered, "door open")
+	expect(engine.Add(value(cancoder.VehicleSpeed, 0, 3*time.Second)), Cleared, "door open")
+
+	// a timed out value is not evaluated
+	engine.State(cancoder.StateEvent{Kind: cancoder.EventTimeout, Value: *value(cancoder.DoorState, 0, 0)})
+	if got := engine.Add(value(cancoder.VehicleSpeed, 20, 4*time.Second)); len(got) != 0 {
+		t.Fatalf("evaluated without door state: %+v", got)
+	}
+
+	// the constants of the parser
+	expect(engine.Add(value(cancoder.RangeWarning, cancoder.RANGE_WARNING_ON, 0)), Triggered, "range warning")
+	expect(engine.Add(value(cancoder.RangeWarning, cancoder.RANGE_WARNING_OFF, 0)), Cleared, "range warning")
+}
+
+type publisher map[string][]byte
+
+func (p publisher) Publish(topic string, payload []byte) error {
+	p[topic] = payload
+	return nil
+}
+
+type notifier chan Event
+
+func (n notifier) Notify(event Event) error {
+	n <- event
+	return nil
+}
+
+func TestNotifiers(t *testing.T) {
+	event := Event{Kind: Triggered, Rule: "coolant overheating", Severity: Critical,
+		Values: map[string]interface{}{"Coolant Temperature": 112.0}, Since: start, Timestamp: start}
+
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	if err := NewWebhookNotifier(server.URL).Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	if received.Rule != event.Rule || received.Values["Coolant Temperature"] != 112.0 {
+		t.Errorf("webhook received %+v", received)
+	}
+	if err := NewWebhookNotifier(server.URL + "/%zz").Notify(event); err == nil {
+		t.Error("expected an error for an invalid url")
+	}
+
+	published := publisher{}
+	if err := NewMqttNotifier(published, "car/alerts").Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	event.Rule = "Oil/Level #2+"
+	if err := NewMqttNotifier(published, "car/alerts").Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"car/alerts/coolant_overheating", "car/alerts/oil_level__2_"} {
+		if _, ok := published[topic]; !ok {
+			t.Errorf("%s not in published %v", topic, published)
+		}
+	}
+
+	// the events until done is closed
+	events := make(chan Event, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	notified := make(notifier)
+	go func() {
+		Notify(events, done, notified)
+		close(stopped)
+	}()
+	events <- event
+	if n := <-notified; n.Rule != event.Rule {
+		t.Errorf("notified %+v", n)
+	}
+	close(done)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("notify not stopped by done")
+	}
+}
@@ -0,0 +1,156 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const WebhookTimeout = 5 * time.Second
+
+// gets the triggered and cleared alerts, e.g. to forward them
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// notifies the notifiers of the events until the channel or done is closed,
+// failed notifications are logged
+func Notify(events <-chan Event, done <-chan struct{}, notifiers ...Notifier) {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			for _, notifier := range notifiers {
+				if err := notifier.Notify(event); err != nil {
+					log.Error("alert", "notify %s %s: %v", event.Rule, event.Kind, err)
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// logs the alerts, triggered ones as warning or error by their severity
+type LogNotifier struct {
+	module string
+}
+
+func NewLogNotifier(module string) *LogNotifier {
+	return &LogNotifier{module: module}
+}
+
+func (n *LogNotifier) Notify(event Event) error {
+	text := event.Rule
+	if event.Message != "" {
+		text += ": " + event.Message
+	}
+	switch {
+	case event.Kind == Cleared:
+		log.Info(n.module, "alert cleared %s, values %v", text, event.Values)
+	case event.Severity == Critical:
+		log.Error(n.module, "alert %s, values %v", text, event.Values)
+	case event.Severity == Warning:
+		log.Warn(n.module, "alert %s, values %v", text, event.Values)
+	default:
+		log.Info(n.module, "alert %s, values %v", text, event.Values)
+	}
+	return nil
+}
+
+// posts the alerts as json to an http endpoint, e.g. a local home automation
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: WebhookTimeout},
+	}
+}
+
+func (n *WebhookNotifier) Notify(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	response, err := n.client.Post(n.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", n.url, response.Status)
+	}
+	return nil
+}
+
+// publishes a message on a topic. implemented by an adapter of the mqtt
+// client in use, none is bundled
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+// publishes the alerts as json on topic/<rule>, the rule name in lowercase
+// with spaces, level separators and wildcards as _, e.g. alerts/low_battery
+type MqttNotifier struct {
+	publisher Publisher
+	topic     string
+}
+
+func NewMqttNotifier(publisher Publisher, topic string) *MqttNotifier {
+	return &MqttNotifier{publisher: publisher, topic: topic}
+}
+
+func (n *MqttNotifier) Notify(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return n.publisher.Publish(n.topic+"/"+topicLevel(event.Rule), payload)
+}
+
+func topicLevel(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '/', '+', '#':
+			return '_'
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
@@ -0,0 +1,62 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package alert
+
+import "time"
+
+var OpelAstraHOpc2006Rules = []Rule{
+	{
+		Name:      "low battery",
+		Condition: "[Battery Voltage] < 11.8",
+		For:       30 * time.Second,
+		While:     "[Engine State] == ENGINE_OFF",
+		Clear:     "[Battery Voltage] > 12.2",
+		ClearFor:  10 * time.Second,
+		Severity:  Warning,
+		Message:   "battery below 11.8 V with the engine off",
+	},
+	{
+		Name:      "door open",
+		Condition: "[Door State] != 0",
+		While:     "[Speed] > 5",
+		Severity:  Critical,
+		Message:   "door open while driving",
+	},
+	{
+		Name:      "coolant overheating",
+		Condition: "[Coolant Temperature] > 110",
+		For:       5 * time.Second,
+		Clear:     "[Coolant Temperature] < 105",
+		Severity:  Critical,
+		Message:   "coolant above 110 °C",
+	},
+	{
+		Name:      "range warning",
+		Condition: "[Range Warning] == RANGE_WARNING_ON",
+		Severity:  Info,
+		Message:   "low fuel",
+	},
+}
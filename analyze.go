@@ -0,0 +1,98 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ChrIgiSta/go-can-coder/analyzer"
+)
+
+// analyze subcommand: classifies the bytes of each id of a recorded trace.
+// the report goes to stdout without -o, the draft definition to -draft
+func analyzeCli(args []string) int {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	output := flags.String("o", "", "write the report to this file instead of stdout")
+	draft := flags.String("draft", "", "write a draft definition (go source) to this file")
+	pkg := flags.String("package", "cancoder", "package of the draft")
+	name := flags.String("name", "Draft", "name of the drafted definition")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: can-coder analyze [options] <trace (.asc, .blf, .trc, .csv, .mf4 or candump log)>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	reader, err := openTrace(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+		return 1
+	}
+	messages, err := analyzer.Analyze(reader)
+	reader.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+		return 1
+	}
+
+	report := os.Stdout
+	if *output != "" {
+		report, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+			return 1
+		}
+		defer report.Close()
+	}
+	if err = analyzer.WriteReport(report, messages); err != nil {
+		fmt.Fprintf(os.Stderr, "analyze: write report: %v\n", err)
+		return 1
+	}
+
+	if *draft != "" {
+		file, err := os.Create(*draft)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+			return 1
+		}
+		err = analyzer.WriteDraft(file, *pkg, *name, messages)
+		if cErr := file.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "analyze: write draft: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d ids analyzed\n", len(messages))
+	return 0
+}
@@ -0,0 +1,213 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package analyzer classifies the bytes of recorded frames per arbitration
+// id as constant, counter, checksum, enum or continuous value and measures
+// the period of each id. a report and a draft cancoder definition help to
+// reverse engineer a bus.
+package analyzer
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+)
+
+const (
+	// frames kept per id, later frames are only counted
+	MaxFrames = 100000
+	// fewer distinct values are an enum
+	MaxEnumValues = 16
+	// share of steps, which have to match for a counter
+	CounterMatch = 0.95
+	// distinct frames needed to trust a checksum
+	MinChecksumFrames = 16
+)
+
+type Kind string
+
+const (
+	Constant   Kind = "constant"
+	Counter    Kind = "counter"
+	Checksum   Kind = "checksum"
+	Enum       Kind = "enum"
+	Continuous Kind = "continuous"
+)
+
+// a classified part of the data. multi byte fields are continuous values
+type Field struct {
+	Kind      Kind
+	Byte      int  // first byte
+	Bytes     int  // 1, 2 for 16 bit values
+	Mask      byte // bits of the byte: 0xff, 0x0f or 0xf0 for nibbles
+	BigEndian bool // of 16 bit values
+
+	Value     uint64   // constant
+	Modulus   int      // counter, 0 if it did not wrap
+	Step      int      // counter
+	Algorithm string   // checksum, e.g. "xor", "crc8 poly 0x1d init 0xff xor 0xff"
+	Values    []uint64 // enum
+	Min       uint64   // continuous
+	Max       uint64   // continuous
+	Changing  byte     // bits, which changed
+}
+
+// the analysis of an arbitration id
+type Message struct {
+	Interface string
+	ID        uint32 // without flags
+	Extended  bool
+	Count     int // frames, also beyond MaxFrames
+	Length    int // longest data
+	Period    time.Duration
+	Jitter    time.Duration // standard deviation of the intervals
+	Periodic  bool          // else sent on events
+	Fields    []Field
+}
+
+type key struct {
+	iface string
+	id    uint32
+}
+
+type frames struct {
+	times []time.Time
+	data  [][]byte
+	count int
+}
+
+// collects frames. not safe for concurrent use
+type Analyzer struct {
+	ids   map[key]*frames
+	order []key
+}
+
+func New() *Analyzer {
+	return &Analyzer{ids: make(map[key]*frames)}
+}
+
+// data frames are analyzed, remote and error frames skipped
+func (a *Analyzer) Add(record *canbus.TraceRecord) {
+	if record.IsRemote() || record.IsError() {
+		return
+	}
+	k := key{iface: record.Interface, id: record.ArbitrationID &^ canbus.CanRtrFlag}
+	f := a.ids[k]
+	if f == nil {
+		f = &frames{}
+		a.ids[k] = f
+		a.order = append(a.order, k)
+	}
+	f.count++
+	if len(f.data) < MaxFrames {
+		f.times = append(f.times, record.Timestamp)
+		f.data = append(f.data, append([]byte{}, record.Data...))
+	}
+}
+
+// analyzes a whole trace
+func Analyze(reader canbus.TraceReader) ([]*Message, error) {
+	a := New()
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return a.Messages(), nil
+		} else if err != nil {
+			return nil, err
+		}
+		a.Add(record)
+	}
+}
+
+// the messages sorted by interface and id
+func (a *Analyzer) Messages() []*Message {
+	keys := append([]key{}, a.order...)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].iface != keys[j].iface {
+			return keys[i].iface < keys[j].iface
+		}
+		return keys[i].id&canbus.CanEffMask < keys[j].id&canbus.CanEffMask
+	})
+
+	messages := []*Message{}
+	for _, k := range keys {
+		f := a.ids[k]
+		message := &Message{
+			Interface: k.iface,
+			ID:        stripID(k.id),
+			Extended:  canbus.IsExtendedID(k.id),
+			Count:     f.count,
+		}
+		for _, data := range f.data {
+			if len(data) > message.Length {
+				message.Length = len(data)
+			}
+		}
+		message.timing(f.times)
+		message.Fields = classify(f.data, message.Length)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// the id without flags
+func stripID(id uint32) uint32 {
+	if canbus.IsExtendedID(id) {
+		return id & canbus.CanEffMask
+	}
+	return id & canbus.CanSffMask
+}
+
+// period is the median interval. ids with intervals varying more than
+// half the period are sent on events
+func (m *Message) timing(times []time.Time) {
+	if len(times) < 2 {
+		return
+	}
+	intervals := make([]float64, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		intervals = append(intervals, float64(times[i].Sub(times[i-1])))
+	}
+	mean := 0.0
+	for _, interval := range intervals {
+		mean += interval
+	}
+	mean /= float64(len(intervals))
+	variance := 0.0
+	for _, interval := range intervals {
+		variance += (interval - mean) * (interval - mean)
+	}
+	jitter := math.Sqrt(variance / float64(len(intervals)))
+
+	sorted := append([]float64{}, intervals...)
+	sort.Float64s(sorted)
+	m.Period = time.Duration(sorted[len(sorted)/2])
+	m.Jitter = time.Duration(jitter)
+	m.Periodic = m.Period > 0 && jitter < float64(m.Period)/2
+}
@@ -0,0 +1,217 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/utils"
+	"github.com/Knetic/govaluate"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// 0x108 every 20 ms: constant, 16 bit value, enum, nibble counter and
+// sae j1850 crc. 0x200 extended every 100 ms with a sum and a counter
+func testAnalyzer() *Analyzer {
+	a := New()
+	random := uint32(1)
+	for i := 0; i < 500; i++ {
+		ts := start.Add(time.Duration(i) * 20 * time.Millisecond)
+		if i%2 == 1 {
+			ts = ts.Add(200 * time.Microsecond)
+		}
+		value := 3000 + int(2000*math.Sin(float64(i)/40))
+		data := []byte{0x13, byte(value >> 8), byte(value), []byte{0x00, 0x40, 0x80}[i*i%3], 0, 0, 0xa0 | byte(i%16)}
+		data = append(data, crc8(data, 0x1d, 0xff)^0xff)
+		a.Add(&canbus.TraceRecord{Timestamp: ts, Interface: "can1", ArbitrationID: 0x108, DLC: 8, Data: data})
+
+		if i%5 == 0 {
+			random = random*1103515245 + 12345
+			data = []byte{0, byte(i / 5), byte(random >> 16), byte(random >> 24)}
+			data[0] = data[1] + data[2] + data[3] + 0x11
+			a.Add(&canbus.TraceRecord{Timestamp: ts, Interface: "can1", ArbitrationID: 0x18daf110 | canbus.CanEffFlag,
+				DLC: 4, Data: data})
+		}
+	}
+	a.Add(&canbus.TraceRecord{Timestamp: start, Interface: "can1", ArbitrationID: 0x300 | canbus.CanRtrFlag})
+	return a
+}
+
+func TestAnalyze(t *testing.T) {
+	messages := testAnalyzer().Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 ids, got %d", len(messages))
+	}
+
+	m := messages[0]
+	if m.ID != 0x108 || m.Count != 500 || m.Length != 8 || !m.Periodic {
+		t.Fatalf("unexpected message %+v", m)
+	}
+	if m.Period < 19*time.Millisecond || m.Period > 21*time.Millisecond || m.Jitter > time.Millisecond {
+		t.Errorf("unexpected timing %v %v", m.Period, m.Jitter)
+	}
+	expected := []string{
+		"byte 0: constant 0x13",
+		"bytes 1-2: continuous 16 bit big endian 1001..4999",
+		"byte 3: enum 0x00 0x40 (bits 0x40 change)",
+		"byte 4: constant 0x00",
+		"byte 5: constant 0x00",
+		"byte 6 bits 0-3: counter step 1 modulus 16",
+		"byte 6 bits 4-7: constant 0x0A",
+		"byte 7: checksum crc8 poly 0x1d init 0xff xor 0xff",
+	}
+	if len(m.Fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %v", len(expected), m.Fields)
+	}
+	for i, field := range m.Fields {
+		if s := field.Location() + ": " + field.String(); s != expected[i] {
+			t.Errorf("field %d: expected %q, got %q", i, expected[i], s)
+		}
+	}
+
+	m = messages[1]
+	if m.ID != 0x18daf110 || !m.Extended || m.Count != 100 {
+		t.Fatalf("unexpected message %+v", m)
+	}
+	if m.Fields[0].Kind != Checksum || m.Fields[0].Algorithm != "sum + 0x11" {
+		t.Errorf("expected sum checksum, got %v", m.Fields[0])
+	}
+	if m.Fields[1].Kind != Counter || m.Fields[1].Step != 1 || m.Fields[1].Modulus != 0 {
+		t.Errorf("expected counter without wrap, got %v", m.Fields[1])
+	}
+}
+
+func TestDraft(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteDraft(buf, "main", "Draft", testAnalyzer().Messages()); err != nil {
+		t.Fatal(err)
+	}
+	draft := buf.String()
+	for _, s := range []string{
+		"import \"github.com/ChrIgiSta/go-can-coder/cancoder\"",
+		"var DraftCan1 []cancoder.CanValueMap",
+		"ArbitrationID: 0x108,",
+		"Calculation: \"${1}*256 + ${2}\"",
+		"ArbitrationID: 0x18DAF110 | 0x80000000,",
+		"// byte 7: checksum crc8 poly 0x1d init 0xff xor 0xff",
+		"Map:    DraftCan1,",
+	} {
+		if !strings.Contains(draft, s) {
+			t.Errorf("draft misses %q:\n%s", s, draft)
+		}
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	// rpm * 4 big endian in bytes 1-2 of 0x108, sampled by the reference at 50 ms
+	reference := &Series{}
+	for i := 0; i < 200; i++ {
+		value := 3000 + int(2000*math.Sin(float64(i*50)/800))
+		reference.Add(start.Add(time.Duration(i)*50*time.Millisecond), float64(value)/4)
+	}
+	c := NewCorrelator(reference, CorrelateOptions{})
+	a := testAnalyzer()
+	for _, k := range a.order {
+		for i, data := range a.ids[k].data {
+			c.Add(&canbus.TraceRecord{Timestamp: a.ids[k].times[i], Interface: k.iface, ArbitrationID: k.id, Data: data})
+		}
+	}
+	results := c.Results()
+	if len(results) == 0 {
+		t.Fatal("no correlation")
+	}
+	best := results[0]
+	expected := BitField{Start: 15, Length: 16, BigEndian: true}
+	if best.ID != 0x108 || best.Field != expected || best.Coefficient < 0.999 {
+		t.Fatalf("unexpected best correlation %+v", best)
+	}
+	if math.Abs(best.Factor-0.25) > 0.01 || math.Abs(best.Offset) > 1 {
+		t.Errorf("unexpected fit %v %v", best.Factor, best.Offset)
+	}
+	if s := best.Field.String(); s != "bits 1.7-2.0 (16) big endian unsigned" {
+		t.Errorf("unexpected field %q", s)
+	}
+}
+
+// the decoder expressions of the fields, substituted as by the decoder,
+// equal their extracted values
+func TestBitFields(t *testing.T) {
+	data := []byte{0x13, 0xa5, 0x5a, 0xff, 0x01, 0x80, 0x7e, 0xc3}
+	fields := BitFields(len(data), []int{3, 8, 12, 16, 32})
+	for _, field := range fields {
+		extracted, ok := field.Extract(data)
+		if !ok {
+			t.Fatalf("%v: not extracted", field)
+		}
+		if field.Signed {
+			continue
+		}
+		equation := field.Expression()
+		for i, d := range data {
+			equation = strings.ReplaceAll(equation, fmt.Sprintf("${%d}", i), fmt.Sprint(d))
+		}
+		expression, err := govaluate.NewEvaluableExpression(utils.ReplaceHexWithDecimal(equation))
+		if err != nil {
+			t.Fatalf("%v: %s: %v", field, field.Expression(), err)
+		}
+		value, err := expression.Evaluate(nil)
+		if err != nil || value.(float64) != extracted {
+			t.Errorf("%v: %s = %v, extracted %v", field, field.Expression(), value, extracted)
+		}
+	}
+
+	field := BitField{Start: 12, Length: 8, Signed: true}
+	if value, _ := field.Extract(data); value != -86 {
+		t.Errorf("expected -86, got %v", value)
+	}
+}
+
+func TestReadCsvSeries(t *testing.T) {
+	csv := "time,rpm,speed\n" +
+		"2024-03-01T12:00:00.000000Z,800,0\n" +
+		"2024-03-01T12:00:01.000000Z,,1\n" +
+		"1709294402.5,1000,2\n"
+	series, err := ReadCsvSeries(strings.NewReader(csv), "", "rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series.Len() != 2 {
+		t.Fatalf("expected 2 samples, got %d", series.Len())
+	}
+	if value, ok := series.At(start.Add(1250*time.Millisecond), 0); !ok || value != 900 {
+		t.Errorf("expected 900, got %v %v", value, ok)
+	}
+	if _, ok := series.At(start.Add(time.Second), time.Second); ok {
+		t.Error("expected no value across the gap")
+	}
+}
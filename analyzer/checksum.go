@@ -0,0 +1,140 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package analyzer
+
+import "fmt"
+
+// crc-8 polynomials of automotive and common protocols (sae j1850, autosar, ...)
+var crc8Polynomials = []byte{0x07, 0x1d, 0x2f, 0x31, 0x9b, 0xd5}
+
+type checksumFunc struct {
+	name string
+	calc func(data []byte) byte
+	sum  bool // the constant is added, else xored
+}
+
+func checksumFuncs() []checksumFunc {
+	funcs := []checksumFunc{
+		{name: "xor", calc: func(data []byte) byte {
+			c := byte(0)
+			for _, d := range data {
+				c ^= d
+			}
+			return c
+		}},
+		{name: "sum", sum: true, calc: func(data []byte) byte {
+			c := byte(0)
+			for _, d := range data {
+				c += d
+			}
+			return c
+		}},
+	}
+	for _, poly := range crc8Polynomials {
+		for _, init := range []byte{0xff, 0x00} {
+			poly, init := poly, init
+			funcs = append(funcs, checksumFunc{
+				name: fmt.Sprintf("crc8 poly 0x%02x init 0x%02x", poly, init),
+				calc: func(data []byte) byte { return crc8(data, poly, init) },
+			})
+		}
+	}
+	return funcs
+}
+
+func crc8(data []byte, poly byte, init byte) byte {
+	crc := init
+	for _, d := range data {
+		crc ^= d
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// tests, if byte b is a checksum of the other bytes. the algorithm may xor
+// (add for sums) a constant, e.g. the final xor of a crc
+func checksum(data [][]byte, b int) (string, bool) {
+	others := [][]byte{}
+	distinct := map[string]bool{}
+	varying := map[int]bool{}
+	for _, d := range data {
+		if b >= len(d) {
+			continue
+		}
+		other := append(append([]byte{}, d[:b]...), d[b+1:]...)
+		if len(others) > 0 {
+			previous := others[len(others)-1]
+			for i := range other {
+				if i < len(previous) && other[i] != previous[i] {
+					varying[i] = true
+				}
+			}
+		}
+		others = append(others, other)
+		distinct[string(d)] = true
+	}
+	// too little variation would match by chance
+	if len(distinct) < MinChecksumFrames || len(varying) < 2 {
+		return "", false
+	}
+
+	values := column(data, b, 0xff)
+	for _, f := range checksumFuncs() {
+		constant := byte(0)
+		match := true
+		for i, other := range others {
+			c := f.calc(other)
+			k := values[i] ^ c
+			if f.sum {
+				k = values[i] - c
+			}
+			if i == 0 {
+				constant = k
+			} else if k != constant {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		switch {
+		case constant == 0:
+			return f.name, true
+		case f.sum:
+			return fmt.Sprintf("%s + 0x%02x", f.name, constant), true
+		default:
+			return fmt.Sprintf("%s xor 0x%02x", f.name, constant), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,279 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the values of a byte in the frames, which are long enough
+func column(data [][]byte, b int, mask byte) []byte {
+	values := make([]byte, 0, len(data))
+	shift := 0
+	if mask == 0xf0 {
+		shift = 4
+	}
+	for _, d := range data {
+		if b < len(d) {
+			values = append(values, d[b]&mask>>shift)
+		}
+	}
+	return values
+}
+
+func classify(data [][]byte, length int) []Field {
+	fields := []Field{}
+	for b := 0; b < length; b++ {
+		values := column(data, b, 0xff)
+		if len(values) == 0 {
+			continue
+		}
+		field := classifyValues(values, b, 0xff)
+		if field.Kind != Constant && field.Kind != Counter {
+			if algorithm, ok := checksum(data, b); ok {
+				field = Field{Kind: Checksum, Byte: b, Bytes: 1, Mask: 0xff, Algorithm: algorithm,
+					Changing: field.Changing}
+			}
+		}
+		// a counter in a nibble, e.g. the alive counter in the low nibble
+		if field.Kind == Enum || field.Kind == Continuous {
+			low := classifyValues(column(data, b, 0x0f), b, 0x0f)
+			high := classifyValues(column(data, b, 0xf0), b, 0xf0)
+			if low.Kind == Counter || high.Kind == Counter {
+				fields = append(fields, low, high)
+				continue
+			}
+		}
+		fields = append(fields, field)
+	}
+	return mergeWords(data, fields)
+}
+
+func classifyValues(values []byte, b int, mask byte) Field {
+	field := Field{Byte: b, Bytes: 1, Mask: mask}
+
+	distinct := map[byte]bool{}
+	for i, v := range values {
+		distinct[v] = true
+		if i > 0 {
+			field.Changing |= v ^ values[i-1]
+		}
+	}
+	if mask == 0xf0 {
+		field.Changing <<= 4
+	}
+
+	switch {
+	case len(distinct) == 1:
+		field.Kind = Constant
+		field.Value = uint64(values[0])
+	case counter(values, mask, &field):
+		field.Kind = Counter
+	case len(distinct) <= MaxEnumValues:
+		field.Kind = Enum
+		for v := range distinct {
+			field.Values = append(field.Values, uint64(v))
+		}
+		sort.Slice(field.Values, func(i, j int) bool { return field.Values[i] < field.Values[j] })
+	default:
+		field.Kind = Continuous
+		field.Min, field.Max = 255, 0
+		for v := range distinct {
+			if uint64(v) < field.Min {
+				field.Min = uint64(v)
+			}
+			if uint64(v) > field.Max {
+				field.Max = uint64(v)
+			}
+		}
+	}
+	return field
+}
+
+// a counter steps by the same amount from frame to frame. the modulus is
+// known, if it wrapped
+func counter(values []byte, mask byte, field *Field) bool {
+	if len(values) < 4 {
+		return false
+	}
+	high := 0
+	for _, v := range values {
+		if int(v) > high {
+			high = int(v)
+		}
+	}
+	modulus := high + 1
+	steps := map[int]int{}
+	for i := 1; i < len(values); i++ {
+		steps[(int(values[i])-int(values[i-1])+modulus)%modulus]++
+	}
+	step, count := 0, 0
+	for s, n := range steps {
+		if n > count || (n == count && s < step) {
+			step, count = s, n
+		}
+	}
+	if step == 0 || float64(count) < CounterMatch*float64(len(values)-1) {
+		return false
+	}
+	// at least a few distinct values, a toggling bit is no counter
+	if modulus/gcd(step, modulus) < 3 {
+		return false
+	}
+
+	field.Step = step
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			field.Modulus = modulus
+			break
+		}
+	}
+	return true
+}
+
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// 16 bit values: the high byte changes, when the low byte wraps. a low byte
+// looking like a counter is the ramp of a wider value then
+func mergeWords(data [][]byte, fields []Field) []Field {
+	merged := []Field{}
+	for i := 0; i < len(fields); i++ {
+		if i+1 < len(fields) && fields[i].Mask == 0xff && fields[i+1].Mask == 0xff &&
+			fields[i+1].Byte == fields[i].Byte+1 {
+			first, second := fields[i], fields[i+1]
+			b := first.Byte
+			if isValue(first) && isLow(second) && carries(column(data, b, 0xff), column(data, b+1, 0xff)) {
+				merged = append(merged, word(data, b, true))
+				i++
+				continue
+			}
+			if isValue(second) && isLow(first) && carries(column(data, b+1, 0xff), column(data, b, 0xff)) {
+				merged = append(merged, word(data, b, false))
+				i++
+				continue
+			}
+		}
+		merged = append(merged, fields[i])
+	}
+	return merged
+}
+
+func isValue(field Field) bool {
+	return field.Kind == Enum || field.Kind == Continuous
+}
+
+func isLow(field Field) bool {
+	return field.Kind == Continuous || field.Kind == Counter
+}
+
+// most changes of high happen while low wraps around
+func carries(high []byte, low []byte) bool {
+	if len(high) != len(low) {
+		return false
+	}
+	changes, carried := 0, 0
+	for i := 1; i < len(high); i++ {
+		if high[i] == high[i-1] {
+			continue
+		}
+		changes++
+		jump := int(low[i]) - int(low[i-1])
+		if jump > 128 || jump < -128 {
+			carried++
+		}
+	}
+	return changes > 0 && float64(carried) >= 0.8*float64(changes)
+}
+
+func word(data [][]byte, b int, bigEndian bool) Field {
+	field := Field{Kind: Continuous, Byte: b, Bytes: 2, Mask: 0xff, BigEndian: bigEndian, Min: 0xffff}
+	for _, d := range data {
+		if b+1 >= len(d) {
+			continue
+		}
+		v := uint64(d[b])<<8 | uint64(d[b+1])
+		if !bigEndian {
+			v = uint64(d[b+1])<<8 | uint64(d[b])
+		}
+		if v < field.Min {
+			field.Min = v
+		}
+		if v > field.Max {
+			field.Max = v
+		}
+	}
+	return field
+}
+
+func (f Field) String() string {
+	switch f.Kind {
+	case Constant:
+		return fmt.Sprintf("constant 0x%02X", f.Value)
+	case Counter:
+		if f.Modulus > 0 {
+			return fmt.Sprintf("counter step %d modulus %d", f.Step, f.Modulus)
+		}
+		return fmt.Sprintf("counter step %d", f.Step)
+	case Checksum:
+		return "checksum " + f.Algorithm
+	case Enum:
+		values := ""
+		for i, v := range f.Values {
+			if i > 0 {
+				values += " "
+			}
+			values += fmt.Sprintf("0x%02X", v)
+		}
+		return fmt.Sprintf("enum %s (bits 0x%02X change)", values, f.Changing)
+	}
+	if f.Bytes == 2 {
+		order := "little endian"
+		if f.BigEndian {
+			order = "big endian"
+		}
+		return fmt.Sprintf("continuous 16 bit %s %d..%d", order, f.Min, f.Max)
+	}
+	return fmt.Sprintf("continuous %d..%d", f.Min, f.Max)
+}
+
+// the bytes and bits of the field, e.g. "byte 2", "bytes 2-3", "byte 7 bits 0-3"
+func (f Field) Location() string {
+	switch {
+	case f.Bytes == 2:
+		return fmt.Sprintf("bytes %d-%d", f.Byte, f.Byte+1)
+	case f.Mask == 0x0f:
+		return fmt.Sprintf("byte %d bits 0-3", f.Byte)
+	case f.Mask == 0xf0:
+		return fmt.Sprintf("byte %d bits 4-7", f.Byte)
+	}
+	return fmt.Sprintf("byte %d", f.Byte)
+}
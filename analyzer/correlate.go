@@ -0,0 +1,404 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+)
+
+const (
+	// reference samples further apart are not interpolated
+	DefaultMaxGap = 2 * time.Second
+	// fewer aligned frames are not ranked
+	DefaultMinSamples = 20
+	// coefficients closer are ranked as equal
+	CorrelationTie = 1e-9
+)
+
+// field lengths tested by default
+var DefaultLengths = []int{4, 8, 10, 12, 16, 24, 32}
+
+type CorrelateOptions struct {
+	Lengths    []int // bits, at most 32
+	MaxGap     time.Duration
+	MinSamples int
+}
+
+// a field of the frame data. bits are numbered as in the sniffer: bit i is
+// bit i%8 (lsb = 0) of byte i/8. start is the lsb of little endian (intel)
+// and the msb of big endian (motorola) fields
+type BitField struct {
+	Start     int
+	Length    int
+	BigEndian bool
+	Signed    bool
+}
+
+// a field correlated with the reference: reference ~ factor * field + offset
+type Correlation struct {
+	Interface   string
+	ID          uint32 // without flags
+	Extended    bool
+	Field       BitField
+	Coefficient float64 // pearson, -1..1
+	Factor      float64
+	Offset      float64
+	Samples     int
+
+	padding int // constant msb bits
+}
+
+// streaming sums, relative to the first sample for precision
+type accumulator struct {
+	field    BitField
+	n        int
+	x0, y0   float64
+	sx, sy   float64
+	sxx, syy float64
+	sxy      float64
+	negative bool
+	first    uint64 // raw value
+	changed  uint64 // raw bits
+}
+
+type correlatorID struct {
+	extended bool
+	fields   []*accumulator
+}
+
+// correlates the fields of all ids with a reference. not safe for
+// concurrent use
+type Correlator struct {
+	reference *Series
+	options   CorrelateOptions
+	ids       map[key]*correlatorID
+	order     []key
+}
+
+func NewCorrelator(reference *Series, options CorrelateOptions) *Correlator {
+	if len(options.Lengths) == 0 {
+		options.Lengths = DefaultLengths
+	}
+	if options.MaxGap == 0 {
+		options.MaxGap = DefaultMaxGap
+	}
+	if options.MinSamples == 0 {
+		options.MinSamples = DefaultMinSamples
+	}
+	return &Correlator{
+		reference: reference,
+		options:   options,
+		ids:       make(map[key]*correlatorID),
+	}
+}
+
+// data frames within the reference are correlated. the fields of an id are
+// laid out by the length of its first frame
+func (c *Correlator) Add(record *canbus.TraceRecord) {
+	if record.IsRemote() || record.IsError() || len(record.Data) == 0 {
+		return
+	}
+	y, ok := c.reference.At(record.Timestamp, c.options.MaxGap)
+	if !ok {
+		return
+	}
+	k := key{iface: record.Interface, id: record.ArbitrationID}
+	id := c.ids[k]
+	if id == nil {
+		id = &correlatorID{extended: record.IsExtended()}
+		for _, field := range BitFields(len(record.Data), c.options.Lengths) {
+			id.fields = append(id.fields, &accumulator{field: field})
+		}
+		c.ids[k] = id
+		c.order = append(c.order, k)
+	}
+	for _, acc := range id.fields {
+		raw, ok := acc.field.extractRaw(record.Data)
+		if !ok {
+			continue
+		}
+		if acc.n == 0 {
+			acc.first = raw
+		}
+		acc.changed |= raw ^ acc.first
+		acc.add(acc.field.value(raw), y)
+	}
+}
+
+func (a *accumulator) add(x float64, y float64) {
+	if a.n == 0 {
+		a.x0, a.y0 = x, y
+	}
+	if x < 0 {
+		a.negative = true
+	}
+	x -= a.x0
+	y -= a.y0
+	a.n++
+	a.sx += x
+	a.sy += y
+	a.sxx += x * x
+	a.syy += y * y
+	a.sxy += x * y
+}
+
+// fields with a varying value, ordered by the strength of the correlation.
+// of equally correlated fields the one with the lsb at a byte boundary and
+// then the one with less constant msb bits comes first
+func (c *Correlator) Results() []Correlation {
+	results := []Correlation{}
+	for _, k := range c.order {
+		id := c.ids[k]
+		for _, acc := range id.fields {
+			// a signed field without negative values equals the unsigned one
+			if acc.n < c.options.MinSamples || (acc.field.Signed && !acc.negative) {
+				continue
+			}
+			n := float64(acc.n)
+			covariance := acc.sxy - acc.sx*acc.sy/n
+			varianceX := acc.sxx - acc.sx*acc.sx/n
+			varianceY := acc.syy - acc.sy*acc.sy/n
+			if varianceX <= 0 || varianceY <= 0 {
+				continue
+			}
+			factor := covariance / varianceX
+			results = append(results, Correlation{
+				Interface:   k.iface,
+				ID:          stripID(k.id),
+				Extended:    id.extended,
+				Field:       acc.field,
+				Coefficient: math.Max(-1, math.Min(1, covariance/math.Sqrt(varianceX*varianceY))),
+				Factor:      factor,
+				Offset:      acc.y0 + acc.sy/n - factor*(acc.x0+acc.sx/n),
+				Samples:     acc.n,
+				padding:     acc.field.Length - bits.Len64(acc.changed),
+			})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		ri, rj := math.Abs(results[i].Coefficient), math.Abs(results[j].Coefficient)
+		if math.Abs(ri-rj) > CorrelationTie {
+			return ri > rj
+		}
+		if ai, aj := results[i].Field.aligned(), results[j].Field.aligned(); ai != aj {
+			return ai
+		}
+		return results[i].padding < results[j].padding
+	})
+	return results
+}
+
+// correlates a whole trace with the reference
+func Correlate(reader canbus.TraceReader, reference *Series, options CorrelateOptions) ([]Correlation, error) {
+	c := NewCorrelator(reference, options)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return c.Results(), nil
+		} else if err != nil {
+			return nil, err
+		}
+		c.Add(record)
+	}
+}
+
+// all fields of data with size bytes: little endian at every bit, big endian
+// if they cross a byte (else they equal the little endian one), each
+// unsigned and signed
+func BitFields(size int, lengths []int) []BitField {
+	fields := []BitField{}
+	bits := size * 8
+	for _, length := range lengths {
+		if length < 1 || length > 32 || length > bits {
+			continue
+		}
+		for start := 0; start+length <= bits; start++ {
+			fields = append(fields, BitField{Start: start, Length: length})
+		}
+		for position := 0; position+length <= bits; position++ {
+			if position%8+length <= 8 {
+				continue
+			}
+			// position counts msb first, the start bit is the msb in sniffer numbering
+			start := position/8*8 + 7 - position%8
+			fields = append(fields, BitField{Start: start, Length: length, BigEndian: true})
+		}
+	}
+	for i, n := 0, len(fields); i < n; i++ {
+		if fields[i].Length > 1 {
+			signed := fields[i]
+			signed.Signed = true
+			fields = append(fields, signed)
+		}
+	}
+	return fields
+}
+
+// the value of the field, false if data is too short
+func (f BitField) Extract(data []byte) (float64, bool) {
+	raw, ok := f.extractRaw(data)
+	if !ok {
+		return 0, false
+	}
+	return f.value(raw), true
+}
+
+func (f BitField) extractRaw(data []byte) (uint64, bool) {
+	var raw uint64
+	if f.BigEndian {
+		position := f.Start/8*8 + 7 - f.Start%8
+		if position+f.Length > len(data)*8 {
+			return 0, false
+		}
+		var u uint64
+		for i := 0; i < 8; i++ {
+			u <<= 8
+			if b := position/8 + i; b < len(data) {
+				u |= uint64(data[b])
+			}
+		}
+		raw = u << (position % 8) >> (64 - f.Length)
+	} else {
+		if f.Start+f.Length > len(data)*8 {
+			return 0, false
+		}
+		var u uint64
+		for i := 7; i >= 0; i-- {
+			u <<= 8
+			if b := f.Start/8 + i; b < len(data) {
+				u |= uint64(data[b])
+			}
+		}
+		raw = u >> (f.Start % 8) & (1<<f.Length - 1)
+	}
+	return raw, true
+}
+
+func (f BitField) value(raw uint64) float64 {
+	if f.Signed && raw&(1<<(f.Length-1)) != 0 {
+		return float64(int64(raw) - 1<<f.Length)
+	}
+	return float64(raw)
+}
+
+// the lsb is bit 0 of a byte
+func (f BitField) aligned() bool {
+	return f.lsb()%8 == 0
+}
+
+// the lsb in sniffer numbering
+func (f BitField) lsb() int {
+	if !f.BigEndian {
+		return f.Start
+	}
+	position := f.Start/8*8 + 7 - f.Start%8 + f.Length - 1
+	return position/8*8 + 7 - position%8
+}
+
+// e.g. "bits 1.7-2.0 (16) big endian unsigned"
+func (f BitField) String() string {
+	end := f.Start + f.Length - 1
+	if f.BigEndian {
+		end = f.lsb()
+	}
+	order, sign := "little endian", "unsigned"
+	if f.BigEndian {
+		order = "big endian"
+	}
+	if f.Signed {
+		sign = "signed"
+	}
+	return fmt.Sprintf("bits %d.%d-%d.%d (%d) %s %s", f.Start/8, f.Start%8, end/8, end%8, f.Length, order, sign)
+}
+
+// the expression of the unsigned field for the decoder, e.g. "${1}*256 + ${2}".
+// empty for signed fields
+func (f BitField) Expression() string {
+	if f.Signed {
+		return ""
+	}
+	first, shift := f.Start/8, f.Start%8
+	if f.BigEndian {
+		position := f.Start/8*8 + 7 - f.Start%8
+		first = position / 8
+		shift = (8 - (position%8+f.Length)%8) % 8
+	}
+	count := (shift + f.Length + 7) / 8
+	terms := []string{}
+	for i := 0; i < count; i++ {
+		b := first + i
+		weight := i
+		if f.BigEndian {
+			weight = count - 1 - i
+		}
+		if weight == 0 {
+			terms = append(terms, fmt.Sprintf("${%d}", b))
+		} else {
+			terms = append(terms, fmt.Sprintf("${%d}*%d", b, 1<<(8*weight)))
+		}
+	}
+	if !f.BigEndian {
+		// most significant byte first
+		for i, j := 0, len(terms)-1; i < j; i, j = i+1, j-1 {
+			terms[i], terms[j] = terms[j], terms[i]
+		}
+	}
+	expression := strings.Join(terms, " + ")
+	if shift > 0 {
+		expression = fmt.Sprintf("(%s) >> %d", expression, shift)
+	}
+	if shift+f.Length < count*8 {
+		if len(terms) > 1 || shift > 0 {
+			expression = "(" + expression + ")"
+		}
+		expression = fmt.Sprintf("%s & 0x%x", expression, 1<<f.Length-1)
+	}
+	return expression
+}
+
+// the expression scaled to the reference, empty for signed fields
+func (c Correlation) Calculation() string {
+	expression := c.Field.Expression()
+	if expression == "" {
+		return ""
+	}
+	switch {
+	case c.Offset > 0:
+		return fmt.Sprintf("(%s)*%.6g + %.6g", expression, c.Factor, c.Offset)
+	case c.Offset < 0:
+		return fmt.Sprintf("(%s)*%.6g - %.6g", expression, c.Factor, -c.Offset)
+	}
+	return fmt.Sprintf("(%s)*%.6g", expression, c.Factor)
+}
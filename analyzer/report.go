@@ -0,0 +1,194 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package analyzer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// writes one block per id with its timing and the fields
+func WriteReport(w io.Writer, messages []*Message) error {
+	for _, m := range messages {
+		if _, err := fmt.Fprintf(w, "%s\n", m.heading()); err != nil {
+			return err
+		}
+		for _, field := range m.Fields {
+			if _, err := fmt.Fprintf(w, "  %-16s %s\n", field.Location(), field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Message) heading() string {
+	iface := m.Interface
+	if iface == "" {
+		iface = "-"
+	}
+	timing := "single frame"
+	switch {
+	case m.Count < 2:
+	case m.Periodic:
+		timing = fmt.Sprintf("period %v jitter %v", round(m.Period), round(m.Jitter))
+	default:
+		timing = fmt.Sprintf("event, median interval %v", round(m.Period))
+	}
+	return fmt.Sprintf("%s %s  %d frames, length %d, %s", iface, m.FormatID(), m.Count, m.Length, timing)
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+func (m *Message) FormatID() string {
+	if m.Extended {
+		return fmt.Sprintf("0x%08X", m.ID)
+	}
+	return fmt.Sprintf("0x%03X", m.ID)
+}
+
+// writes go source of the cancoder package with a value map per interface
+// and a definition of them. constants, counters and checksums are listed in
+// comments, enums and continuous values are drafted as signals
+func WriteDraft(w io.Writer, pkg string, name string, messages []*Message) error {
+	ifaces := []string{}
+	byIface := map[string][]*Message{}
+	for _, m := range messages {
+		if _, ok := byIface[m.Interface]; !ok {
+			ifaces = append(ifaces, m.Interface)
+		}
+		byIface[m.Interface] = append(byIface[m.Interface], m)
+	}
+
+	qualifier := ""
+	if pkg != "cancoder" {
+		qualifier = "cancoder."
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "// draft of can-coder analyze. review names, units and calculations\n\n")
+	fmt.Fprintf(b, "package %s\n\n", pkg)
+	if qualifier != "" {
+		fmt.Fprintf(b, "import \"github.com/ChrIgiSta/go-can-coder/cancoder\"\n\n")
+	}
+
+	for i, iface := range ifaces {
+		device := iface
+		if device == "" {
+			device = fmt.Sprintf("can%d", i)
+		}
+		fmt.Fprintf(b, "var %s []%sCanValueMap = []%sCanValueMap{\n", mapName(name, device), qualifier, qualifier)
+		for _, m := range byIface[iface] {
+			fmt.Fprintf(b, "\t// %s\n", m.heading())
+			for _, field := range m.Fields {
+				if !isValue(field) {
+					fmt.Fprintf(b, "\t// %s: %s\n", field.Location(), field)
+				}
+			}
+			for _, field := range m.Fields {
+				if !isValue(field) {
+					continue
+				}
+				id := m.FormatID()
+				if m.Extended {
+					// the decoder compares the id with the extended frame flag
+					id += " | 0x80000000"
+				}
+				fmt.Fprintf(b, "\t{\n")
+				fmt.Fprintf(b, "\t\tArbitrationID: %s,\n", id)
+				fmt.Fprintf(b, "\t\tCanValueDef: %sCanValueDef{\n", qualifier)
+				fmt.Fprintf(b, "\t\t\tUnit:        \"\",\n")
+				fmt.Fprintf(b, "\t\t\tCalculation: %q, // %s\n", field.Calculation(), field)
+				fmt.Fprintf(b, "\t\t\tCondition:   \"1 == 1\",\n")
+				fmt.Fprintf(b, "\t\t\tName:        %q,\n", fmt.Sprintf("%s %s %s", device, m.FormatID(), field.Location()))
+				fmt.Fprintf(b, "\t\t},\n")
+				fmt.Fprintf(b, "\t\tTriggerEvent: true,\n")
+				fmt.Fprintf(b, "\t},\n")
+			}
+		}
+		fmt.Fprintf(b, "}\n\n")
+	}
+
+	fmt.Fprintf(b, "var %s %sCancoderDef = %sCancoderDef{\n", name, qualifier, qualifier)
+	fmt.Fprintf(b, "\tName: %q,\n", name)
+	fmt.Fprintf(b, "\tCancoders: %sCancoders{\n", qualifier)
+	for i, iface := range ifaces {
+		device := iface
+		if device == "" {
+			device = fmt.Sprintf("can%d", i)
+		}
+		fmt.Fprintf(b, "\t\t{\n\t\t\tMap:    %s,\n\t\t\tDevice: %q,\n\t\t},\n", mapName(name, device), device)
+	}
+	fmt.Fprintf(b, "\t},\n}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// the expression of the field for the decoder
+func (f Field) Calculation() string {
+	switch {
+	case f.Bytes == 2 && f.BigEndian:
+		return fmt.Sprintf("${%d}*256 + ${%d}", f.Byte, f.Byte+1)
+	case f.Bytes == 2:
+		return fmt.Sprintf("${%d}*256 + ${%d}", f.Byte+1, f.Byte)
+	case f.Mask == 0x0f:
+		return fmt.Sprintf("${%d} & 0x0f", f.Byte)
+	case f.Mask == 0xf0:
+		return fmt.Sprintf("${%d} >> 4", f.Byte)
+	}
+	return fmt.Sprintf("${%d}", f.Byte)
+}
+
+// e.g. DraftCan1 of Draft and can1
+func mapName(name string, device string) string {
+	b := strings.Builder{}
+	b.WriteString(name)
+	upper := true
+	for _, r := range device {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package analyzer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a reference signal to correlate frames with
+type Series struct {
+	Times  []time.Time
+	Values []float64
+}
+
+func (s *Series) Add(timestamp time.Time, value float64) {
+	s.Times = append(s.Times, timestamp)
+	s.Values = append(s.Values, value)
+}
+
+func (s *Series) Len() int {
+	return len(s.Times)
+}
+
+func (s *Series) Less(i int, j int) bool {
+	return s.Times[i].Before(s.Times[j])
+}
+
+func (s *Series) Swap(i int, j int) {
+	s.Times[i], s.Times[j] = s.Times[j], s.Times[i]
+	s.Values[i], s.Values[j] = s.Values[j], s.Values[i]
+}
+
+// moves the series in time, e.g. to match the clock of an external logger
+func (s *Series) Shift(offset time.Duration) {
+	for i := range s.Times {
+		s.Times[i] = s.Times[i].Add(offset)
+	}
+}
+
+// the value at timestamp, interpolated linearly between the samples around
+// it. false outside of the series or if the samples are more than maxGap apart
+func (s *Series) At(timestamp time.Time, maxGap time.Duration) (float64, bool) {
+	i := sort.Search(len(s.Times), func(i int) bool { return !s.Times[i].Before(timestamp) })
+	if i == len(s.Times) {
+		return 0, false
+	}
+	if s.Times[i].Equal(timestamp) {
+		return s.Values[i], true
+	}
+	if i == 0 {
+		return 0, false
+	}
+	gap := s.Times[i].Sub(s.Times[i-1])
+	if maxGap > 0 && gap > maxGap {
+		return 0, false
+	}
+	f := float64(timestamp.Sub(s.Times[i-1])) / float64(gap)
+	return s.Values[i-1] + f*(s.Values[i]-s.Values[i-1]), true
+}
+
+// reads a column of a csv file with header, e.g. a table of the decode
+// subcommand or obd readings. the time column holds timestamps (RFC 3339)
+// or unix seconds, empty time column means the first one. empty and non
+// numeric cells are skipped
+func ReadCsvSeries(r io.Reader, timeColumn string, valueColumn string) (*Series, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	timeIndex, valueIndex := -1, -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == timeColumn {
+			timeIndex = i
+		}
+		if name == valueColumn {
+			valueIndex = i
+		}
+	}
+	if timeColumn == "" {
+		timeIndex = 0
+	}
+	if timeIndex < 0 {
+		return nil, fmt.Errorf("no column %q", timeColumn)
+	}
+	if valueIndex < 0 {
+		return nil, fmt.Errorf("no column %q", valueColumn)
+	}
+
+	series := &Series{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if timeIndex >= len(row) || valueIndex >= len(row) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(row[valueIndex]), 64)
+		if err != nil {
+			continue
+		}
+		timestamp, err := parseTime(strings.TrimSpace(row[timeIndex]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		series.Add(timestamp, value)
+	}
+	sort.Stable(series)
+	return series, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,428 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vector ascii trace (CANalyzer/CANoe .asc)
+
+const (
+	ascDateLayout = "Mon Jan 2 03:04:05.000 pm 2006"
+
+	ascFdEDL = 0x1000
+	ascFdBRS = 0x2000
+	ascFdESI = 0x4000
+)
+
+var ascDateLayouts = []string{
+	ascDateLayout,
+	"Mon Jan 2 03:04:05 pm 2006",
+	"Mon Jan 2 15:04:05.000 2006",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+type AscReader struct {
+	scanner      *bufio.Scanner
+	closer       io.Closer
+	line         int
+	start        time.Time
+	base         int
+	relative     bool
+	lastRelative float64
+}
+
+func NewAscReader(r io.Reader) *AscReader {
+	reader := &AscReader{
+		scanner: bufio.NewScanner(r),
+		base:    16,
+		start:   time.Unix(0, 0),
+	}
+	if closer, ok := r.(io.Closer); ok {
+		reader.closer = closer
+	}
+	return reader
+}
+
+func OpenAsc(path string) (*AscReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewAscReader(file), nil
+}
+
+// replays an asc trace. only frames of iface (can<channel-1>) are replayed, an empty iface replays all
+func NewAscReplay(path string, iface string, speed float64) *Replay {
+	return NewReplay(func() (TraceReader, error) {
+		return OpenAsc(path)
+	}, iface, speed)
+}
+
+func (r *AscReader) Next() (*TraceRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "date":
+			if err := r.parseDate(fields[1:]); err != nil {
+				return nil, fmt.Errorf("asc line %d: %v", r.line, err)
+			}
+			continue
+		case "base":
+			r.parseBase(fields)
+			continue
+		case "begin", "end", "internal", "no":
+			continue
+		}
+
+		offset, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			// unknown header line
+			continue
+		}
+		if r.relative {
+			offset += r.lastRelative
+			r.lastRelative = offset
+		}
+
+		record, err := r.parseEvent(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("asc line %d: %v", r.line, err)
+		}
+		if record == nil {
+			// not a can event
+			continue
+		}
+		record.Timestamp = r.start.Add(time.Duration(math.Round(offset*1e6)) * time.Microsecond)
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *AscReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// the layouts take am/pm in lowercase only, python-can writes them uppercase
+func (r *AscReader) parseDate(fields []string) error {
+	for i, field := range fields {
+		if strings.EqualFold(field, "am") || strings.EqualFold(field, "pm") {
+			fields[i] = strings.ToLower(field)
+		}
+	}
+	date := strings.Join(fields, " ")
+	for _, layout := range ascDateLayouts {
+		t, err := time.ParseInLocation(layout, date, time.Local)
+		if err == nil {
+			r.start = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown date %q", date)
+}
+
+// base hex|dec  timestamps absolute|relative
+func (r *AscReader) parseBase(fields []string) {
+	for i, field := range fields {
+		switch strings.ToLower(field) {
+		case "dec":
+			r.base = 10
+		case "hex":
+			r.base = 16
+		case "relative":
+			r.relative = i > 0 && strings.ToLower(fields[i-1]) == "timestamps"
+		}
+	}
+}
+
+func (r *AscReader) parseID(id string) (uint32, error) {
+	extended := strings.HasSuffix(id, "x") || strings.HasSuffix(id, "X")
+	id = strings.TrimRight(id, "xX")
+	raw, err := strconv.ParseUint(id, r.base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("arbitration id %q: %v", id, err)
+	}
+	if extended {
+		return uint32(raw)&CanEffMask | CanEffFlag, nil
+	}
+	return uint32(raw), nil
+}
+
+// fields after the timestamp
+func (r *AscReader) parseEvent(fields []string) (*TraceRecord, error) {
+	if len(fields) < 2 {
+		return nil, nil
+	}
+	if strings.EqualFold(fields[0], "CANFD") {
+		return r.parseFdEvent(fields[1:])
+	}
+
+	channel, err := strconv.Atoi(fields[0])
+	if err != nil {
+		// other bus systems or events
+		return nil, nil
+	}
+	record := &TraceRecord{
+		Interface: ChannelInterface(channel),
+	}
+
+	if strings.EqualFold(fields[1], "ErrorFrame") {
+		record.ArbitrationID = CanErrFlag
+		return record, nil
+	}
+	if len(fields) < 4 {
+		return nil, nil
+	}
+
+	record.ArbitrationID, err = r.parseID(fields[1])
+	if err != nil {
+		// e.g. "Statistic:" or "SV:" events
+		return nil, nil
+	}
+	record.Tx = strings.EqualFold(fields[2], "Tx")
+
+	switch strings.ToLower(fields[3]) {
+	case "r":
+		record.ArbitrationID |= CanRtrFlag
+		if len(fields) > 4 {
+			dlc, err := strconv.ParseUint(fields[4], 16, 8)
+			if err == nil {
+				record.DLC = uint8(dlc)
+			}
+		}
+		return record, nil
+	case "d":
+	default:
+		return nil, fmt.Errorf("unknown frame type %q", fields[3])
+	}
+
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("missing dlc")
+	}
+	dlc, err := strconv.ParseUint(fields[4], 16, 8)
+	if err != nil || dlc > 8 {
+		return nil, fmt.Errorf("dlc %q", fields[4])
+	}
+	if len(fields) < 5+int(dlc) {
+		return nil, fmt.Errorf("expected %d data bytes", dlc)
+	}
+	record.Data, err = hex.DecodeString(strings.Join(fields[5:5+dlc], ""))
+	if err != nil {
+		return nil, fmt.Errorf("data: %v", err)
+	}
+	record.DLC = uint8(dlc)
+	return record, nil
+}
+
+// CANFD <channel> <dir> <id> [symbolic name] <brs> <esi> <dlc> <data length> <data> ...
+func (r *AscReader) parseFdEvent(fields []string) (*TraceRecord, error) {
+	if len(fields) < 3 {
+		return nil, nil
+	}
+	channel, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("can fd channel %q", fields[0])
+	}
+	record := &TraceRecord{
+		Interface: ChannelInterface(channel),
+		Tx:        strings.EqualFold(fields[1], "Tx"),
+		FD:        true,
+	}
+	if strings.EqualFold(fields[2], "ErrorFrame") {
+		record.ArbitrationID = CanErrFlag
+		record.FD = false
+		return record, nil
+	}
+	record.ArbitrationID, err = r.parseID(fields[2])
+	if err != nil {
+		return nil, nil
+	}
+
+	rest := fields[3:]
+	// optional symbolic message name
+	if len(rest) > 0 && rest[0] != "0" && rest[0] != "1" {
+		rest = rest[1:]
+	}
+	if len(rest) < 4 {
+		return nil, fmt.Errorf("can fd event too short")
+	}
+	record.BitRateSwitch = rest[0] == "1"
+	record.ErrorStateIndicator = rest[1] == "1"
+	dlc, err := strconv.ParseUint(rest[2], 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("can fd dlc %q", rest[2])
+	}
+	length, err := strconv.Atoi(rest[3])
+	if err != nil || length > 64 || len(rest) < 4+length {
+		return nil, fmt.Errorf("can fd data length %q", rest[3])
+	}
+	if length == 0 && dlc > 0 {
+		// remote frame
+		record.ArbitrationID |= CanRtrFlag
+		record.DLC = uint8(dlc)
+		record.FD = false
+		return record, nil
+	}
+	record.Data, err = hex.DecodeString(strings.Join(rest[4:4+length], ""))
+	if err != nil {
+		return nil, fmt.Errorf("can fd data: %v", err)
+	}
+	record.DLC = uint8(length)
+	return record, nil
+}
+
+type AscWriter struct {
+	writer   *bufio.Writer
+	closer   io.Closer
+	start    time.Time
+	started  bool
+	channels map[string]int
+}
+
+func NewAscWriter(w io.Writer) *AscWriter {
+	writer := &AscWriter{
+		writer:   bufio.NewWriter(w),
+		channels: make(map[string]int),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	return writer
+}
+
+func CreateAsc(path string) (*AscWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewAscWriter(file), nil
+}
+
+// the header is written with the first record, which defines the measurement start
+func (w *AscWriter) writeHeader(start time.Time) error {
+	// the date has millisecond resolution
+	w.start = start.Truncate(time.Millisecond)
+	w.started = true
+
+	date := start.In(time.Local).Format(ascDateLayout)
+	_, err := fmt.Fprintf(w.writer, "date %s\nbase hex  timestamps absolute\ninternal events logged\n"+
+		"// version 9.0.0\nBegin Triggerblock %s\n%12.6f Start of measurement\n", date, date, 0.0)
+	return err
+}
+
+func (w *AscWriter) Write(record *TraceRecord) error {
+	if !w.started {
+		if err := w.writeHeader(record.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	offset := record.Timestamp.Sub(w.start).Seconds()
+	channel := InterfaceChannel(record.Interface, w.channels)
+	direction := "Rx"
+	if record.Tx {
+		direction = "Tx"
+	}
+
+	id := fmt.Sprintf("%X", record.ID())
+	if record.IsExtended() {
+		id += "x"
+	}
+
+	var err error
+	switch {
+	case record.IsError():
+		_, err = fmt.Fprintf(w.writer, "%12.6f %d  ErrorFrame\n", offset, channel)
+	case record.FD:
+		flags := ascFdEDL
+		brs, esi := 0, 0
+		if record.BitRateSwitch {
+			brs = 1
+			flags |= ascFdBRS
+		}
+		if record.ErrorStateIndicator {
+			esi = 1
+			flags |= ascFdESI
+		}
+		_, err = fmt.Fprintf(w.writer, "%12.6f CANFD %3d %-4s %8s  %32s %d %d %x %2d %s %8d %4d %8X %8d %8d %8d %8d %8d\n",
+			offset, channel, direction, id, "", brs, esi, CanFdLenToDlc(len(record.Data)), len(record.Data),
+			ascData(record.Data), 0, 0, flags, 0, 0, 0, 0, 0)
+	case record.IsRemote():
+		_, err = fmt.Fprintf(w.writer, "%12.6f %d  %-15s %-4s r %x\n", offset, channel, id, direction, record.DLC)
+	default:
+		_, err = fmt.Fprintf(w.writer, "%12.6f %d  %-15s %-4s d %x %s\n", offset, channel, id, direction,
+			len(record.Data), ascData(record.Data))
+	}
+	return err
+}
+
+func ascData(data []byte) string {
+	bytes := make([]string, len(data))
+	for i, b := range data {
+		bytes[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(bytes, " ")
+}
+
+func (w *AscWriter) Close() error {
+	var err error
+	if !w.started {
+		err = w.writeHeader(time.Now())
+	}
+	if err == nil {
+		_, err = w.writer.WriteString("End TriggerBlock\n")
+	}
+	if fErr := w.writer.Flush(); fErr != nil && err == nil {
+		err = fErr
+	}
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
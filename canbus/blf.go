@@ -0,0 +1,646 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// vector binary logging format (.blf). little endian, objects are stored
+// in (zlib compressed) log containers.
+
+const (
+	blfFileHeaderSize    = 144
+	blfObjHeaderBaseSize = 16
+	blfObjHeaderV1Size   = 16
+	blfObjHeaderV2Size   = 24
+	blfLogContainerSize  = 16
+	blfMaxContainerSize  = 128 * 1024
+
+	blfCompressionNone = 0
+	blfCompressionZlib = 2
+
+	blfTimeTenMics = 0x00000001
+	blfTimeOneNans = 0x00000002
+)
+
+// object types
+const (
+	blfCanMessage      = 1
+	blfCanError        = 2
+	blfLogContainer    = 10
+	blfCanErrorExt     = 73
+	blfCanMessage2     = 86
+	blfCanFdMessage    = 100
+	blfCanFdMessage64  = 101
+	blfCanMsgExt       = 0x80000000
+	blfCanMsgFlagTx    = 0x01
+	blfCanMsgFlagRtr   = 0x80
+	blfCanFdFlagEDL    = 0x01
+	blfCanFdFlagBRS    = 0x02
+	blfCanFdFlagESI    = 0x04
+	blfCanFd64FlagRtr  = 0x0010
+	blfCanFd64FlagEDL  = 0x1000
+	blfCanFd64FlagBRS  = 0x2000
+	blfCanFd64FlagESI  = 0x4000
+	blfCanFd64Size     = 40
+	blfCanMessageSize  = 16
+	blfCanErrorExtSize = 32
+)
+
+var (
+	blfFileSignature   = []byte("LOGG")
+	blfObjectSignature = []byte("LOBJ")
+)
+
+type BlfReader struct {
+	reader  *bufio.Reader
+	closer  io.Closer
+	start   time.Time
+	pending []byte // uncompressed container data
+	records []*TraceRecord
+}
+
+func NewBlfReader(r io.Reader) (*BlfReader, error) {
+	reader := &BlfReader{
+		reader: bufio.NewReader(r),
+	}
+	if closer, ok := r.(io.Closer); ok {
+		reader.closer = closer
+	}
+
+	header := make([]byte, blfFileHeaderSize)
+	if _, err := io.ReadFull(reader.reader, header[:8]); err != nil {
+		return nil, fmt.Errorf("blf header: %v", err)
+	}
+	if !bytes.Equal(header[:4], blfFileSignature) {
+		return nil, errors.New("blf: not a blf file")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(header[4:8]))
+	if headerSize < 72 {
+		return nil, fmt.Errorf("blf: invalid header size %d", headerSize)
+	}
+	if headerSize > len(header) {
+		header = append(header, make([]byte, headerSize-len(header))...)
+	}
+	if _, err := io.ReadFull(reader.reader, header[8:headerSize]); err != nil {
+		return nil, fmt.Errorf("blf header: %v", err)
+	}
+	reader.start = blfSystemTime(header[40:56])
+
+	return reader, nil
+}
+
+func OpenBlf(path string) (*BlfReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewBlfReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// replays a blf trace. only frames of iface (can<channel-1>) are replayed, an empty iface replays all
+func NewBlfReplay(path string, iface string, speed float64) *Replay {
+	return NewReplay(func() (TraceReader, error) {
+		return OpenBlf(path)
+	}, iface, speed)
+}
+
+// start of the measurement
+func (r *BlfReader) Start() time.Time {
+	return r.start
+}
+
+func (r *BlfReader) Next() (*TraceRecord, error) {
+	for len(r.records) == 0 {
+		err := r.readObject()
+		if err != nil {
+			return nil, err
+		}
+	}
+	record := r.records[0]
+	r.records = r.records[1:]
+	return record, nil
+}
+
+func (r *BlfReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// reads the next top level object
+func (r *BlfReader) readObject() error {
+	base := make([]byte, blfObjHeaderBaseSize)
+	if _, err := io.ReadFull(r.reader, base); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return err
+	}
+	if !bytes.Equal(base[:4], blfObjectSignature) {
+		return errors.New("blf: object signature not found")
+	}
+	objSize := int(binary.LittleEndian.Uint32(base[8:12]))
+	objType := binary.LittleEndian.Uint32(base[12:16])
+	if objSize < blfObjHeaderBaseSize {
+		return fmt.Errorf("blf: invalid object size %d", objSize)
+	}
+
+	body := make([]byte, objSize-blfObjHeaderBaseSize)
+	if _, err := io.ReadFull(r.reader, body); err != nil {
+		return fmt.Errorf("blf: object: %v", err)
+	}
+	// padding
+	if _, err := r.reader.Discard(objSize % 4); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if objType != blfLogContainer {
+		record, err := r.parseObject(append(base, body...))
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			r.records = append(r.records, record)
+		}
+		return nil
+	}
+
+	if len(body) < blfLogContainerSize {
+		return errors.New("blf: log container too short")
+	}
+	method := binary.LittleEndian.Uint16(body[0:2])
+	data := body[blfLogContainerSize:]
+	switch method {
+	case blfCompressionNone:
+	case blfCompressionZlib:
+		z, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("blf: container: %v", err)
+		}
+		data, err = io.ReadAll(z)
+		if err != nil {
+			return fmt.Errorf("blf: container: %v", err)
+		}
+	default:
+		return fmt.Errorf("blf: unknown compression %d", method)
+	}
+
+	// objects may span containers
+	r.pending = append(r.pending, data...)
+	return r.parseContainerData()
+}
+
+func (r *BlfReader) parseContainerData() error {
+	pos := 0
+	for {
+		// skip padding up to the next object
+		next := bytes.Index(r.pending[pos:minInt(pos+8, len(r.pending))], blfObjectSignature)
+		if next < 0 {
+			if len(r.pending)-pos >= 8 {
+				return errors.New("blf: object signature not found in container")
+			}
+			break
+		}
+		pos += next
+		if len(r.pending)-pos < blfObjHeaderBaseSize {
+			break
+		}
+		objSize := int(binary.LittleEndian.Uint32(r.pending[pos+8 : pos+12]))
+		if objSize < blfObjHeaderBaseSize {
+			return fmt.Errorf("blf: invalid object size %d", objSize)
+		}
+		if len(r.pending)-pos < objSize {
+			break
+		}
+
+		record, err := r.parseObject(r.pending[pos : pos+objSize])
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			r.records = append(r.records, record)
+		}
+		pos += objSize
+	}
+	r.pending = append([]byte{}, r.pending[pos:]...)
+	return nil
+}
+
+// a complete object including the base header
+func (r *BlfReader) parseObject(obj []byte) (*TraceRecord, error) {
+	headerSize := int(binary.LittleEndian.Uint16(obj[4:6]))
+	headerVersion := binary.LittleEndian.Uint16(obj[6:8])
+	objType := binary.LittleEndian.Uint32(obj[12:16])
+	if headerSize > len(obj) || headerSize < blfObjHeaderBaseSize+blfObjHeaderV1Size {
+		return nil, fmt.Errorf("blf: invalid header size %d", headerSize)
+	}
+
+	flags := binary.LittleEndian.Uint32(obj[16:20])
+	var ticks uint64
+	switch headerVersion {
+	case 1:
+		ticks = binary.LittleEndian.Uint64(obj[24:32])
+	case 2:
+		if headerSize < blfObjHeaderBaseSize+blfObjHeaderV2Size {
+			return nil, fmt.Errorf("blf: invalid v2 header size %d", headerSize)
+		}
+		ticks = binary.LittleEndian.Uint64(obj[24:32])
+	default:
+		return nil, nil
+	}
+	offset := time.Duration(ticks) * 10 * time.Microsecond
+	if flags&blfTimeOneNans != 0 {
+		offset = time.Duration(ticks)
+	}
+
+	data := obj[headerSize:]
+	record := &TraceRecord{
+		Timestamp: r.start.Add(offset),
+	}
+
+	switch objType {
+	case blfCanMessage, blfCanMessage2:
+		if len(data) < blfCanMessageSize {
+			return nil, errors.New("blf: can message too short")
+		}
+		channel := int(binary.LittleEndian.Uint16(data[0:2]))
+		msgFlags := data[2]
+		dlc := data[3]
+		id := binary.LittleEndian.Uint32(data[4:8])
+
+		record.Interface = ChannelInterface(channel)
+		record.ArbitrationID = blfID(id)
+		record.Tx = msgFlags&blfCanMsgFlagTx != 0
+		record.DLC = uint8(minInt(int(dlc), 8))
+		if msgFlags&blfCanMsgFlagRtr != 0 {
+			record.ArbitrationID |= CanRtrFlag
+		} else {
+			record.Data = append([]byte{}, data[8:8+record.DLC]...)
+		}
+
+	case blfCanFdMessage:
+		if len(data) < 20 {
+			return nil, errors.New("blf: can fd message too short")
+		}
+		channel := int(binary.LittleEndian.Uint16(data[0:2]))
+		msgFlags := data[2]
+		dlc := data[3]
+		id := binary.LittleEndian.Uint32(data[4:8])
+		fdFlags := data[13]
+		valid := int(data[14])
+
+		record.Interface = ChannelInterface(channel)
+		record.ArbitrationID = blfID(id)
+		record.Tx = msgFlags&blfCanMsgFlagTx != 0
+		record.FD = fdFlags&blfCanFdFlagEDL != 0
+		record.BitRateSwitch = fdFlags&blfCanFdFlagBRS != 0
+		record.ErrorStateIndicator = fdFlags&blfCanFdFlagESI != 0
+		if msgFlags&blfCanMsgFlagRtr != 0 {
+			record.ArbitrationID |= CanRtrFlag
+			record.DLC = dlc
+			break
+		}
+		length := minInt(CanFdDlcToLen(dlc), valid, len(data)-20)
+		record.Data = append([]byte{}, data[20:20+length]...)
+		record.DLC = uint8(length)
+
+	case blfCanFdMessage64:
+		if len(data) < blfCanFd64Size {
+			return nil, errors.New("blf: can fd 64 message too short")
+		}
+		channel := int(data[0])
+		dlc := data[1]
+		valid := int(data[2])
+		id := binary.LittleEndian.Uint32(data[4:8])
+		fdFlags := binary.LittleEndian.Uint32(data[12:16])
+		direction := data[34]
+		extOffset := int(data[35])
+
+		record.Interface = ChannelInterface(channel)
+		record.ArbitrationID = blfID(id)
+		record.Tx = direction == 1
+		record.FD = fdFlags&blfCanFd64FlagEDL != 0
+		record.BitRateSwitch = fdFlags&blfCanFd64FlagBRS != 0
+		record.ErrorStateIndicator = fdFlags&blfCanFd64FlagESI != 0
+		if fdFlags&blfCanFd64FlagRtr != 0 {
+			record.ArbitrationID |= CanRtrFlag
+			record.DLC = dlc
+			break
+		}
+		end := blfCanFd64Size + valid
+		if extOffset != 0 && extOffset < end {
+			end = extOffset
+		}
+		end = minInt(end, len(data))
+		record.Data = append([]byte{}, data[blfCanFd64Size:end]...)
+		record.DLC = uint8(len(record.Data))
+
+	case blfCanError:
+		if len(data) < 2 {
+			return nil, errors.New("blf: can error too short")
+		}
+		record.Interface = ChannelInterface(int(binary.LittleEndian.Uint16(data[0:2])))
+		record.ArbitrationID = CanErrFlag
+
+	case blfCanErrorExt:
+		if len(data) < blfCanErrorExtSize {
+			return nil, errors.New("blf: can error ext too short")
+		}
+		record.Interface = ChannelInterface(int(binary.LittleEndian.Uint16(data[0:2])))
+		record.ArbitrationID = CanErrFlag
+		dlc := uint8(minInt(int(data[10]), 8))
+		record.Data = append([]byte{}, data[24:24+dlc]...)
+		record.DLC = dlc
+
+	default:
+		// other objects (markers, statistics, other buses)
+		return nil, nil
+	}
+
+	return record, nil
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func blfID(id uint32) uint32 {
+	if id&blfCanMsgExt != 0 {
+		return id&CanEffMask | CanEffFlag
+	}
+	return id & CanSffMask
+}
+
+// SYSTEMTIME: year, month, day of week, day, hour, minute, second, milliseconds
+func blfSystemTime(raw []byte) time.Time {
+	v := func(i int) int {
+		return int(binary.LittleEndian.Uint16(raw[i*2:]))
+	}
+	if v(0) == 0 {
+		return time.Unix(0, 0)
+	}
+	return time.Date(v(0), time.Month(v(1)), v(3), v(4), v(5), v(6), v(7)*int(time.Millisecond), time.Local)
+}
+
+func putBlfSystemTime(raw []byte, t time.Time) {
+	t = t.In(time.Local)
+	for i, v := range []int{t.Year(), int(t.Month()), int(t.Weekday()), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond() / int(time.Millisecond)} {
+		binary.LittleEndian.PutUint16(raw[i*2:], uint16(v))
+	}
+}
+
+type BlfWriter struct {
+	file             io.WriteSeeker
+	closer           io.Closer
+	channels         map[string]int
+	start            time.Time
+	stop             time.Time
+	started          bool
+	container        bytes.Buffer
+	objectCount      uint32
+	uncompressedSize uint64
+	fileSize         uint64
+}
+
+// the header is rewritten on Close, therefore the writer needs to seek
+func NewBlfWriter(w io.WriteSeeker) (*BlfWriter, error) {
+	writer := &BlfWriter{
+		file:     w,
+		channels: make(map[string]int),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	// placeholder
+	err := writer.writeFileHeader()
+	if err != nil {
+		return nil, err
+	}
+	writer.fileSize = blfFileHeaderSize
+	writer.uncompressedSize = blfFileHeaderSize
+	return writer, nil
+}
+
+func CreateBlf(path string) (*BlfWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewBlfWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *BlfWriter) writeFileHeader() error {
+	header := make([]byte, blfFileHeaderSize)
+	copy(header, blfFileSignature)
+	binary.LittleEndian.PutUint32(header[4:], blfFileHeaderSize)
+	header[8] = 5 // application id: can-coder is no vector tool
+	// bin log version
+	header[12], header[13], header[14], header[15] = 2, 6, 8, 1
+	binary.LittleEndian.PutUint64(header[16:], w.fileSize)
+	binary.LittleEndian.PutUint64(header[24:], w.uncompressedSize)
+	binary.LittleEndian.PutUint32(header[32:], w.objectCount)
+	if w.started {
+		putBlfSystemTime(header[40:56], w.start)
+		putBlfSystemTime(header[56:72], w.stop)
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.file.Write(header)
+	return err
+}
+
+func (w *BlfWriter) Write(record *TraceRecord) error {
+	if !w.started {
+		// the file header has millisecond resolution
+		w.start = record.Timestamp.Truncate(time.Millisecond)
+		w.started = true
+	}
+	if record.Timestamp.After(w.stop) {
+		w.stop = record.Timestamp
+	}
+
+	channel := InterfaceChannel(record.Interface, w.channels)
+	id := record.ID()
+	if record.IsExtended() {
+		id |= blfCanMsgExt
+	}
+
+	var (
+		objType uint32
+		data    []byte
+	)
+	switch {
+	case record.IsError():
+		objType = blfCanErrorExt
+		data = make([]byte, blfCanErrorExtSize)
+		binary.LittleEndian.PutUint16(data[0:], uint16(channel))
+		data[10] = uint8(minInt(len(record.Data), 8))
+		copy(data[24:], record.Data)
+	case record.FD:
+		objType = blfCanFdMessage64
+		data = make([]byte, blfCanFd64Size, blfCanFd64Size+len(record.Data))
+		data[0] = uint8(channel)
+		data[1] = CanFdLenToDlc(len(record.Data))
+		data[2] = uint8(len(record.Data))
+		binary.LittleEndian.PutUint32(data[4:], id)
+		flags := uint32(blfCanFd64FlagEDL)
+		if record.BitRateSwitch {
+			flags |= blfCanFd64FlagBRS
+		}
+		if record.ErrorStateIndicator {
+			flags |= blfCanFd64FlagESI
+		}
+		binary.LittleEndian.PutUint32(data[12:], flags)
+		if record.Tx {
+			data[34] = 1
+		}
+		data = append(data, record.Data...)
+	default:
+		objType = blfCanMessage
+		data = make([]byte, blfCanMessageSize)
+		binary.LittleEndian.PutUint16(data[0:], uint16(channel))
+		if record.Tx {
+			data[2] |= blfCanMsgFlagTx
+		}
+		data[3] = uint8(len(record.Data))
+		if record.IsRemote() {
+			data[2] |= blfCanMsgFlagRtr
+			data[3] = record.DLC
+		}
+		binary.LittleEndian.PutUint32(data[4:], id)
+		copy(data[8:], record.Data)
+	}
+
+	offset := record.Timestamp.Sub(w.start)
+	if offset < 0 {
+		offset = 0
+	}
+
+	headerSize := blfObjHeaderBaseSize + blfObjHeaderV1Size
+	objSize := headerSize + len(data)
+	obj := make([]byte, headerSize, objSize+4)
+	copy(obj, blfObjectSignature)
+	binary.LittleEndian.PutUint16(obj[4:], uint16(headerSize))
+	binary.LittleEndian.PutUint16(obj[6:], 1)
+	binary.LittleEndian.PutUint32(obj[8:], uint32(objSize))
+	binary.LittleEndian.PutUint32(obj[12:], objType)
+	binary.LittleEndian.PutUint32(obj[16:], blfTimeOneNans)
+	binary.LittleEndian.PutUint64(obj[24:], uint64(offset))
+	obj = append(obj, data...)
+	obj = append(obj, make([]byte, len(data)%4)...)
+
+	w.container.Write(obj)
+	w.objectCount++
+
+	if w.container.Len() >= blfMaxContainerSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// writes the collected objects as compressed log container
+func (w *BlfWriter) flush() error {
+	if w.container.Len() == 0 {
+		return nil
+	}
+	uncompressed := w.container.Bytes()
+
+	var compressed bytes.Buffer
+	z := zlib.NewWriter(&compressed)
+	if _, err := z.Write(uncompressed); err != nil {
+		return err
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+
+	objSize := blfObjHeaderBaseSize + blfLogContainerSize + compressed.Len()
+	header := make([]byte, blfObjHeaderBaseSize+blfLogContainerSize)
+	copy(header, blfObjectSignature)
+	binary.LittleEndian.PutUint16(header[4:], blfObjHeaderBaseSize)
+	binary.LittleEndian.PutUint16(header[6:], 1)
+	binary.LittleEndian.PutUint32(header[8:], uint32(objSize))
+	binary.LittleEndian.PutUint32(header[12:], blfLogContainer)
+	binary.LittleEndian.PutUint16(header[16:], blfCompressionZlib)
+	binary.LittleEndian.PutUint32(header[24:], uint32(len(uncompressed)))
+
+	if _, err := w.file.Seek(int64(w.fileSize), io.SeekStart); err != nil {
+		return err
+	}
+	for _, part := range [][]byte{header, compressed.Bytes(), make([]byte, objSize%4)} {
+		if _, err := w.file.Write(part); err != nil {
+			return err
+		}
+	}
+
+	w.fileSize += uint64(objSize + objSize%4)
+	w.uncompressedSize += uint64(len(header) + len(uncompressed))
+	w.container.Reset()
+	return nil
+}
+
+func (w *BlfWriter) Close() error {
+	err := w.flush()
+	if err == nil {
+		err = w.writeFileHeader()
+	}
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,283 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linux can-utils `candump -l` log format:
+// (1436509052.249713) can0 123#DEADBEEF
+// (1436509052.249713) can0 12345678#R
+// (1436509052.249713) can0 123##1DEADBEEF  (can fd with flags)
+
+const (
+	candumpFdBRS = 0x01
+	candumpFdESI = 0x02
+)
+
+type CandumpReader struct {
+	scanner *bufio.Scanner
+	closer  io.Closer
+	line    int
+}
+
+func NewCandumpReader(r io.Reader) *CandumpReader {
+	reader := &CandumpReader{
+		scanner: bufio.NewScanner(r),
+	}
+	if closer, ok := r.(io.Closer); ok {
+		reader.closer = closer
+	}
+	return reader
+}
+
+func OpenCandump(path string) (*CandumpReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCandumpReader(file), nil
+}
+
+// replays a candump log file. only frames of iface are replayed, an empty iface replays all
+func NewCandumpReplay(path string, iface string, speed float64) *Replay {
+	return NewReplay(func() (TraceReader, error) {
+		return OpenCandump(path)
+	}, iface, speed)
+}
+
+func (r *CandumpReader) Next() (*TraceRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		record, err := ParseCandumpLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("candump line %d: %v", r.line, err)
+		}
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *CandumpReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func ParseCandumpLine(line string) (*TraceRecord, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid line %q", line)
+	}
+
+	stamp := strings.TrimSuffix(strings.TrimPrefix(fields[0], "("), ")")
+	secs, fraction, _ := strings.Cut(stamp, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp %q: %v", fields[0], err)
+	}
+	nsec := int64(0)
+	if fraction != "" {
+		fraction = (fraction + "000000000")[:9]
+		nsec, err = strconv.ParseInt(fraction, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("timestamp %q: %v", fields[0], err)
+		}
+	}
+
+	record, err := ParseCanFrameString(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	record.Timestamp = time.Unix(sec, nsec)
+	record.Interface = fields[1]
+	if len(fields) > 3 && fields[3] == "T" {
+		record.Tx = true
+	}
+	return record, nil
+}
+
+// cansend / candump frame notation: <id>#<data>, <id>#R[len], <id>##<flags><data>
+func ParseCanFrameString(frame string) (*TraceRecord, error) {
+	id, payload, found := strings.Cut(frame, "#")
+	if !found {
+		return nil, fmt.Errorf("invalid frame %q", frame)
+	}
+
+	rawID, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("arbitration id %q: %v", id, err)
+	}
+	record := &TraceRecord{}
+	switch len(id) {
+	case 3:
+		record.ArbitrationID = uint32(rawID) & CanSffMask
+	case 8:
+		if uint32(rawID)&CanErrFlag != 0 {
+			record.ArbitrationID = uint32(rawID)
+		} else {
+			record.ArbitrationID = uint32(rawID)&CanEffMask | CanEffFlag
+		}
+	default:
+		return nil, fmt.Errorf("arbitration id %q: invalid length", id)
+	}
+
+	switch {
+	case strings.HasPrefix(payload, "#"):
+		if len(payload) < 2 {
+			return nil, fmt.Errorf("can fd frame %q without flags", frame)
+		}
+		flags, err := strconv.ParseUint(payload[1:2], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("can fd flags %q: %v", frame, err)
+		}
+		record.FD = true
+		record.BitRateSwitch = flags&candumpFdBRS != 0
+		record.ErrorStateIndicator = flags&candumpFdESI != 0
+		payload = payload[2:]
+	case strings.HasPrefix(payload, "R") || strings.HasPrefix(payload, "r"):
+		record.ArbitrationID |= CanRtrFlag
+		if len(payload) > 1 {
+			dlc, err := strconv.ParseUint(payload[1:2], 10, 8)
+			if err != nil || dlc > 8 {
+				return nil, fmt.Errorf("remote frame length %q", frame)
+			}
+			record.DLC = uint8(dlc)
+		}
+		return record, nil
+	}
+
+	record.Data, err = hex.DecodeString(strings.ReplaceAll(payload, ".", ""))
+	if err != nil {
+		return nil, fmt.Errorf("data %q: %v", payload, err)
+	}
+	if (!record.FD && len(record.Data) > 8) || len(record.Data) > 64 {
+		return nil, fmt.Errorf("data %q too long", payload)
+	}
+	record.DLC = uint8(len(record.Data))
+	return record, nil
+}
+
+func FormatCanFrameString(record *TraceRecord) string {
+	var sb strings.Builder
+
+	switch {
+	case record.IsError():
+		fmt.Fprintf(&sb, "%08X#", record.ArbitrationID&(CanErrFlag|CanEffMask))
+	case record.IsExtended():
+		fmt.Fprintf(&sb, "%08X#", record.ID())
+	default:
+		fmt.Fprintf(&sb, "%03X#", record.ID())
+	}
+
+	if record.IsRemote() {
+		sb.WriteString("R")
+		if record.DLC > 0 && record.DLC <= 8 {
+			sb.WriteString(strconv.Itoa(int(record.DLC)))
+		}
+		return sb.String()
+	}
+	if record.FD {
+		flags := 0
+		if record.BitRateSwitch {
+			flags |= candumpFdBRS
+		}
+		if record.ErrorStateIndicator {
+			flags |= candumpFdESI
+		}
+		fmt.Fprintf(&sb, "#%X", flags)
+	}
+	sb.WriteString(strings.ToUpper(hex.EncodeToString(record.Data)))
+	return sb.String()
+}
+
+func FormatCandumpLine(record *TraceRecord) string {
+	iface := record.Interface
+	if iface == "" {
+		iface = CanInterfaceDefaultName
+	}
+	return fmt.Sprintf("(%010d.%06d) %s %s",
+		record.Timestamp.Unix(), record.Timestamp.Nanosecond()/1000,
+		iface, FormatCanFrameString(record))
+}
+
+type CandumpWriter struct {
+	writer *bufio.Writer
+	closer io.Closer
+}
+
+func NewCandumpWriter(w io.Writer) *CandumpWriter {
+	writer := &CandumpWriter{
+		writer: bufio.NewWriter(w),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	return writer
+}
+
+func CreateCandump(path string) (*CandumpWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCandumpWriter(file), nil
+}
+
+func (w *CandumpWriter) Write(record *TraceRecord) error {
+	_, err := w.writer.WriteString(FormatCandumpLine(record) + "\n")
+	return err
+}
+
+func (w *CandumpWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+func (w *CandumpWriter) Close() error {
+	err := w.writer.Flush()
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
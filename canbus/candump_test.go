@@ -0,0 +1,139 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+const candumpLog = `(1436509052.249713) can1 108#130CF30004E50000
+(1436509052.250000) can0 180#4601170A5D1227FF
+(1436509052.349713) can1 18DAF110#0102
+(1436509052.449713) can1 500#R
+(1436509052.549713) can1 123##3DEADBEEF
+(1436509052.649713) can1 20000080#0000000000000000
+`
+
+func TestCandumpRoundTrip(t *testing.T) {
+	reader := NewCandumpReader(bytes.NewBufferString(candumpLog))
+	var out bytes.Buffer
+	writer := NewCandumpWriter(&out)
+
+	for {
+		record, err := reader.Next()
+		if err != nil {
+			break
+		}
+		if err = writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = writer.Close()
+
+	if out.String() != candumpLog {
+		t.Errorf("round trip differs:\n%s", out.String())
+	}
+
+	record, err := ParseCandumpLine("(1436509052.349713) can1 18DAF110#0102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.IsExtended() || record.ID() != 0x18daf110 || len(record.Data) != 2 {
+		t.Errorf("extended frame: %+v", record)
+	}
+	record, _ = ParseCandumpLine("(1436509052.549713) can1 123##3DEADBEEF")
+	if !record.FD || !record.BitRateSwitch || !record.ErrorStateIndicator {
+		t.Errorf("fd frame: %+v", record)
+	}
+}
+
+func TestCandumpReplaySplitsInterfaces(t *testing.T) {
+	var wg sync.WaitGroup
+
+	path := filepath.Join(t.TempDir(), "drive.log")
+	if err := os.WriteFile(path, []byte(candumpLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewCandumpReplay(path, "can0", ReplayAsFastAsPossible)
+	wg.Add(1)
+	rx, err := replay.Connect(&wg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []*Frame{}
+	for frame := range rx {
+		frames = append(frames, frame)
+	}
+	wg.Wait()
+
+	if len(frames) != 1 || frames[0].ArbitrationID != 0x180 {
+		t.Fatalf("expected the can0 frame only: %v", frames)
+	}
+	if frames[0].Timestamp.Unix() != 1436509052 {
+		t.Errorf("replayed frame keeps recorded time: %v", frames[0].Timestamp)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var wg sync.WaitGroup
+	var out bytes.Buffer
+
+	bus := newMemoryBus()
+	recorder := NewRecorder(bus, NewCandumpWriter(&out), "vcan0")
+	wg.Add(1)
+	rx, err := recorder.Connect(&wg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.rx <- &can.Frame{ArbitrationID: 0x108, DLC: 2, Data: [8]byte{0xab, 0xcd}}
+	select {
+	case <-rx:
+	case <-time.After(time.Second):
+		t.Fatal("frame not passed through")
+	}
+	_ = recorder.Disconnect()
+	for range rx {
+	}
+	wg.Wait()
+
+	record, err := ParseCandumpLine(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Interface != "vcan0" || record.ID() != 0x108 || !bytes.Equal(record.Data, []byte{0xab, 0xcd}) {
+		t.Errorf("recorded %q", out.String())
+	}
+}
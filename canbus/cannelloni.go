@@ -0,0 +1,381 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+// cannelloni udp protocol, see https://github.com/mguentner/cannelloni
+const (
+	CannelloniNetworkType         = "udp"
+	CannelloniDefaultPort         = 20000
+	CannelloniDefaultBatchTimeout = 2 * time.Millisecond
+
+	CannelloniVersion   = 2
+	CannelloniOpData    = 0
+	CannelloniHeaderLen = 5
+
+	cannelloniMaxPacketLen = 1200 // stay below common MTUs
+	cannelloniFdFlag       = 0x80
+)
+
+type CannelloniStats struct {
+	PacketsRx  uint64 `json:"packetsRx"`
+	PacketsTx  uint64 `json:"packetsTx"`
+	FramesRx   uint64 `json:"framesRx"`
+	FramesTx   uint64 `json:"framesTx"`
+	Lost       uint64 `json:"lost"`
+	OutOfOrder uint64 `json:"outOfOrder"`
+	Malformed  uint64 `json:"malformed"`
+}
+
+type Cannelloni struct {
+	localPort    uint16
+	remote       string
+	batchTimeout time.Duration
+
+	conn     *net.UDPConn
+	peer     *net.UDPAddr
+	tx       chan *can.Frame
+	sent     chan struct{} // closed, when the sender flushed its last batch
+	txSeq    uint8
+	closed   bool
+	sequence cannelloniSequence
+	filter   softwareFilter
+	stats    CannelloniStats
+	mutex    sync.Mutex
+}
+
+func NewCannelloni(localPort uint16, remoteAddress string, remotePort uint16) *Cannelloni {
+	return &Cannelloni{
+		localPort:    localPort,
+		remote:       net.JoinHostPort(remoteAddress, strconv.Itoa(int(remotePort))),
+		batchTimeout: CannelloniDefaultBatchTimeout,
+	}
+}
+
+// frames are collected for this time before they are sent in one packet.
+// 0 sends every frame in its own packet. must be set before Connect
+func (c *Cannelloni) SetBatchTimeout(timeout time.Duration) {
+	c.batchTimeout = timeout
+}
+
+func (c *Cannelloni) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
+	var err error
+
+	c.peer, err = net.ResolveUDPAddr(CannelloniNetworkType, c.remote)
+	if err != nil {
+		return nil, err
+	}
+	c.conn, err = net.ListenUDP(CannelloniNetworkType, &net.UDPAddr{Port: int(c.localPort)})
+	if err != nil {
+		return nil, err
+	}
+
+	// a reconnect starts new sequences
+	c.mutex.Lock()
+	c.tx = make(chan *can.Frame, CanbusBufferSize)
+	c.sent = make(chan struct{})
+	c.closed = false
+	c.txSeq = 0
+	c.sequence = cannelloniSequence{}
+	c.mutex.Unlock()
+
+	wg.Add(1)
+	go c.sender(wg)
+
+	rxCh := make(chan *Frame, CanbusBufferSize)
+
+	go func() {
+		defer wg.Done()
+		defer close(rxCh)
+
+		buffer := make([]byte, 65535)
+		for {
+			n, _, err := c.conn.ReadFromUDP(buffer)
+			if errors.Is(err, net.ErrClosed) {
+				log.Debug("cannelloni", "disconnected")
+				return
+			} else if err != nil {
+				log.Error("cannelloni", "read udp: %v", err)
+				return
+			}
+			timestamp := time.Now()
+
+			seq, frames, err := UnmarshalCannelloni(buffer[:n])
+			c.mutex.Lock()
+			if err != nil {
+				c.stats.Malformed++
+				c.mutex.Unlock()
+				log.Warn("cannelloni", "%v", err)
+				continue
+			}
+			lost, outOfOrder := c.sequence.next(seq)
+			c.stats.PacketsRx++
+			c.stats.FramesRx += uint64(len(frames))
+			c.stats.Lost += uint64(lost)
+			if outOfOrder {
+				c.stats.OutOfOrder++
+			}
+			c.mutex.Unlock()
+
+			if lost > 0 {
+				log.Warn("cannelloni", "lost %d packet(s) before seq %d", lost, seq)
+			} else if outOfOrder {
+				log.Warn("cannelloni", "out of order packet seq %d", seq)
+			}
+
+			for _, frame := range frames {
+				if !c.filter.match(frame.ArbitrationID) {
+					continue
+				}
+				select {
+				// do not block, if the rx channel is full
+				case rxCh <- &Frame{Frame: *frame, Timestamp: timestamp}:
+				default:
+					log.Warn("cannelloni", "full rx channel")
+				}
+			}
+		}
+	}()
+
+	return rxCh, nil
+}
+
+func (c *Cannelloni) Disconnect() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.tx)
+	}
+	c.mutex.Unlock()
+
+	// the last batch is sent before the socket closes
+	<-c.sent
+	return c.conn.Close()
+}
+
+func (c *Cannelloni) Send(message *can.Frame) error {
+	if message == nil {
+		return errors.New("frame <nil>")
+	}
+	if int(message.DLC) > len(message.Data) {
+		return fmt.Errorf("invalid dlc %d", message.DLC)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tx == nil || c.closed {
+		return errors.New("cannelloni not connected")
+	}
+
+	select {
+	case c.tx <- message:
+		return nil
+	default:
+		return errors.New("cannelloni tx channel full")
+	}
+}
+
+// filters are applied in software
+func (c *Cannelloni) SetFilters(filters CanFilters) error {
+	return c.filter.SetFilters(filters)
+}
+
+func (c *Cannelloni) Stats() CannelloniStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.stats
+}
+
+// batches frames until the timeout or the max packet size is reached
+func (c *Cannelloni) sender(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(c.sent)
+
+	var (
+		batch   []*can.Frame
+		size    int = CannelloniHeaderLen
+		timeout <-chan time.Time
+	)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		packet := MarshalCannelloni(c.txSeq, batch)
+		c.txSeq++
+		_, err := c.conn.WriteToUDP(packet, c.peer)
+		if err != nil {
+			log.Error("cannelloni", "send udp: %v", err)
+		} else {
+			c.mutex.Lock()
+			c.stats.PacketsTx++
+			c.stats.FramesTx += uint64(len(batch))
+			c.mutex.Unlock()
+		}
+		batch = batch[:0]
+		size = CannelloniHeaderLen
+		timeout = nil
+	}
+
+	for {
+		select {
+		case frame, ok := <-c.tx:
+			if !ok {
+				flush()
+				return
+			}
+			frameLen := 5 + int(frame.DLC)
+			if size+frameLen > cannelloniMaxPacketLen {
+				flush()
+			}
+			batch = append(batch, frame)
+			size += frameLen
+			if c.batchTimeout <= 0 {
+				flush()
+			} else if timeout == nil {
+				timeout = time.After(c.batchTimeout)
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+// version | op code | seq no | count (BE16) | frames
+// frame: can id (BE32, socketcan flags) | len | data
+func MarshalCannelloni(seq uint8, frames []*can.Frame) []byte {
+	packet := make([]byte, CannelloniHeaderLen, cannelloniMaxPacketLen)
+	packet[0] = CannelloniVersion
+	packet[1] = CannelloniOpData
+	packet[2] = seq
+	binary.BigEndian.PutUint16(packet[3:5], uint16(len(frames)))
+
+	for _, frame := range frames {
+		id := frame.ArbitrationID
+		if IsExtendedID(id) {
+			id = id&CanEffMask | CanEffFlag | id&(CanRtrFlag|CanErrFlag)
+		}
+		packet = binary.BigEndian.AppendUint32(packet, id)
+		packet = append(packet, frame.DLC)
+		if id&CanRtrFlag == 0 {
+			packet = append(packet, frame.GetData()...)
+		}
+	}
+	return packet
+}
+
+func UnmarshalCannelloni(packet []byte) (seq uint8, frames []*can.Frame, err error) {
+	if len(packet) < CannelloniHeaderLen {
+		return 0, nil, fmt.Errorf("cannelloni: packet too short (%d)", len(packet))
+	}
+	if packet[0] != CannelloniVersion || packet[1] != CannelloniOpData {
+		return 0, nil, fmt.Errorf("cannelloni: unsupported version %d / op %d", packet[0], packet[1])
+	}
+	seq = packet[2]
+	count := int(binary.BigEndian.Uint16(packet[3:5]))
+
+	pos := CannelloniHeaderLen
+	for i := 0; i < count; i++ {
+		if len(packet) < pos+5 {
+			return seq, nil, fmt.Errorf("cannelloni: truncated frame %d of %d", i, count)
+		}
+		id := binary.BigEndian.Uint32(packet[pos:])
+		length := int(packet[pos+4])
+		pos += 5
+		if length&cannelloniFdFlag != 0 {
+			// can fd: flags byte follows, payload does not fit into can.Frame
+			length &^= cannelloniFdFlag
+			pos++
+			if len(packet) < pos+length {
+				return seq, nil, fmt.Errorf("cannelloni: truncated fd frame %d", i)
+			}
+			pos += length
+			log.Warn("cannelloni", "skip can fd frame 0x%x", id)
+			continue
+		}
+		if length > 8 {
+			return seq, nil, fmt.Errorf("cannelloni: invalid length %d", length)
+		}
+
+		frame := &can.Frame{
+			ArbitrationID: id,
+			DLC:           uint8(length),
+		}
+		if id&CanRtrFlag == 0 {
+			if len(packet) < pos+length {
+				return seq, nil, fmt.Errorf("cannelloni: truncated frame %d of %d", i, count)
+			}
+			copy(frame.Data[:], packet[pos:pos+length])
+			pos += length
+		}
+		frames = append(frames, frame)
+	}
+
+	return seq, frames, nil
+}
+
+// detects lost and out of order packets by the 8 bit sequence number
+type cannelloniSequence struct {
+	started bool
+	last    uint8
+}
+
+func (s *cannelloniSequence) next(seq uint8) (lost int, outOfOrder bool) {
+	if !s.started {
+		s.started = true
+		s.last = seq
+		return 0, false
+	}
+
+	diff := int(seq - s.last) // mod 256
+	switch {
+	case diff == 0 || diff >= 128:
+		// duplicate or older than the last one
+		return 0, true
+	default:
+		s.last = seq
+		return diff - 1, false
+	}
+}
@@ -0,0 +1,190 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+func freeUdpPort(t *testing.T) uint16 {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestCannelloniLoopback(t *testing.T) {
+	var wg sync.WaitGroup
+
+	portA, portB := freeUdpPort(t), freeUdpPort(t)
+	a := NewCannelloni(portA, "127.0.0.1", portB)
+	b := NewCannelloni(portB, "127.0.0.1", portA)
+
+	wg.Add(2)
+	_, err := a.Connect(&wg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rxB, err := b.Connect(&wg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []*can.Frame{
+		{ArbitrationID: 0x108, DLC: 8, Data: [8]byte{0x13, 0x0c, 0xf3, 0x00, 0x04, 0xe5}},
+		{ArbitrationID: 0x1abcdef | CanEffFlag, DLC: 2, Data: [8]byte{0xca, 0xfe}},
+		{ArbitrationID: 0x500, DLC: 0},
+	}
+	for _, f := range frames {
+		if err := a.Send(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Send(&can.Frame{ArbitrationID: 0x100, DLC: 9}); err == nil {
+		t.Error("expected an error for dlc 9")
+	}
+
+	for _, expected := range frames {
+		select {
+		case rx := <-rxB:
+			if rx.ArbitrationID != expected.ArbitrationID || rx.DLC != expected.DLC || rx.Data != expected.Data {
+				t.Errorf("expected %+v, got %+v", expected, rx)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("frame not received")
+		}
+	}
+
+	if stats := b.Stats(); stats.PacketsRx != 1 || stats.FramesRx != 3 || stats.Lost != 0 {
+		t.Errorf("frames should be batched into one packet: %+v", stats)
+	}
+
+	_ = a.Disconnect()
+	_ = b.Disconnect()
+	wg.Wait()
+}
+
+func TestCannelloniReconnect(t *testing.T) {
+	var wg sync.WaitGroup
+
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	port := freeUdpPort(t)
+	c := NewCannelloni(port, "127.0.0.1", uint16(peer.LocalAddr().(*net.UDPAddr).Port))
+	c.SetBatchTimeout(0)
+
+	// the sequence numbers the peer receives
+	received := func(frames int) []uint8 {
+		var seqs []uint8
+		buffer := make([]byte, 1500)
+		for i := 0; i < frames; i++ {
+			if err := c.Send(&can.Frame{ArbitrationID: 0x100, DLC: 1}); err != nil {
+				t.Fatal(err)
+			}
+			_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := peer.ReadFromUDP(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seq, _, err := UnmarshalCannelloni(buffer[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, seq)
+		}
+		return seqs
+	}
+	// a packet of the peer to the connection
+	send := func(seq uint8, rx <-chan *Frame) {
+		packet := MarshalCannelloni(seq, []*can.Frame{{ArbitrationID: 0x200, DLC: 1}})
+		if _, err := peer.WriteToUDP(packet, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-rx:
+		case <-time.After(time.Second):
+			t.Fatal("frame not received")
+		}
+	}
+
+	for connection := 0; connection < 2; connection++ {
+		wg.Add(1)
+		rx, err := c.Connect(&wg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seqs := received(2); seqs[0] != 0 || seqs[1] != 1 {
+			t.Errorf("connection %d: sent seq %v", connection, seqs)
+		}
+		// the restarted peer starts at 0 again
+		send(uint8(5*(1-connection)), rx)
+		if err := c.Disconnect(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+	}
+
+	if stats := c.Stats(); stats.PacketsTx != 4 || stats.PacketsRx != 2 || stats.Lost != 0 || stats.OutOfOrder != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestCannelloniSequence(t *testing.T) {
+	var seq cannelloniSequence
+
+	for _, step := range []struct {
+		seq        uint8
+		lost       int
+		outOfOrder bool
+	}{
+		{254, 0, false},
+		{255, 0, false},
+		{2, 2, false}, // wrap around, lost 0 and 1
+		{1, 0, true},
+		{3, 0, false},
+		{3, 0, true},
+	} {
+		lost, outOfOrder := seq.next(step.seq)
+		if lost != step.lost || outOfOrder != step.outOfOrder {
+			t.Errorf("seq %d: lost %d, out of order %v", step.seq, lost, outOfOrder)
+		}
+	}
+
+	_, _, err := UnmarshalCannelloni([]byte{CannelloniVersion, CannelloniOpData, 0, 0, 1, 0, 0})
+	if err == nil {
+		t.Error("truncated packet accepted")
+	}
+}
@@ -0,0 +1,146 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"fmt"
+	"sync"
+)
+
+// acceptance filter with socketcan semantics:
+// a frame matches, if <received id> & Mask == ID & Mask.
+// ID and Mask may contain CanEffFlag/CanRtrFlag to distinguish frame types.
+type CanFilter struct {
+	ID       uint32 `json:"id"`
+	Mask     uint32 `json:"mask"`
+	Inverted bool   `json:"inverted"` // matches all frames, the filter would not match
+}
+
+// frames pass, if any filter matches. no filters let all frames pass
+type CanFilters []CanFilter
+
+// implemented by backends, which can filter received frames
+// (in the kernel or in software)
+type FilterableBus interface {
+	SetFilters(filters CanFilters) error
+}
+
+// matches exactly one (standard or extended) arbitration id
+func FilterID(arbitrationID uint32) CanFilter {
+	if IsExtendedID(arbitrationID) {
+		return CanFilter{
+			ID:   arbitrationID&CanEffMask | CanEffFlag,
+			Mask: CanEffMask | CanEffFlag,
+		}
+	}
+	return CanFilter{
+		ID:   arbitrationID & CanSffMask,
+		Mask: CanSffMask | CanEffFlag,
+	}
+}
+
+func FilterIDs(arbitrationIDs ...uint32) CanFilters {
+	filters := make(CanFilters, 0, len(arbitrationIDs))
+	for _, id := range arbitrationIDs {
+		filters = append(filters, FilterID(id))
+	}
+	return filters
+}
+
+// matches the ids from..to (inclusive). the range is split into id/mask pairs,
+// which also works in the kernel
+func FilterRange(from uint32, to uint32, extended bool) (CanFilters, error) {
+	idMask := uint32(CanSffMask)
+	flag := uint32(0)
+	if extended {
+		idMask = CanEffMask
+		flag = CanEffFlag
+	}
+	if from > to || to > idMask {
+		return nil, fmt.Errorf("invalid filter range 0x%x..0x%x", from, to)
+	}
+
+	var filters CanFilters
+	for start := uint64(from); start <= uint64(to); {
+		// biggest aligned block starting at start, which fits into the range
+		size := uint64(1)
+		for start%(size*2) == 0 && start+size*2-1 <= uint64(to) {
+			size *= 2
+		}
+		filters = append(filters, CanFilter{
+			ID:   uint32(start) | flag,
+			Mask: (idMask &^ uint32(size-1)) | CanEffFlag,
+		})
+		start += size
+	}
+	return filters, nil
+}
+
+func (f CanFilter) Invert() CanFilter {
+	f.Inverted = !f.Inverted
+	return f
+}
+
+func (f CanFilter) Match(arbitrationID uint32) bool {
+	if IsExtendedID(arbitrationID) {
+		arbitrationID |= CanEffFlag
+	}
+	match := arbitrationID&f.Mask == f.ID&f.Mask
+	return match != f.Inverted
+}
+
+func (f CanFilters) Match(arbitrationID uint32) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, filter := range f {
+		if filter.Match(arbitrationID) {
+			return true
+		}
+	}
+	return false
+}
+
+// filters applied in software by backends without hardware support
+type softwareFilter struct {
+	filters CanFilters
+	mutex   sync.RWMutex
+}
+
+func (s *softwareFilter) SetFilters(filters CanFilters) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.filters = append(CanFilters{}, filters...)
+	return nil
+}
+
+func (s *softwareFilter) match(arbitrationID uint32) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.filters.Match(arbitrationID)
+}
@@ -0,0 +1,72 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import "testing"
+
+func TestFilterRange(t *testing.T) {
+	filters, err := FilterRange(0x100, 0x17f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 || filters[0].Mask != 0x780|CanEffFlag {
+		t.Errorf("aligned range should be one filter: %+v", filters)
+	}
+
+	filters, err = FilterRange(0x103, 0x211, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(0); id <= CanSffMask; id++ {
+		expected := id >= 0x103 && id <= 0x211
+		if filters.Match(id) != expected {
+			t.Fatalf("0x%x: expected match %v", id, expected)
+		}
+	}
+	if filters.Match(0x150 | CanEffFlag) {
+		t.Error("standard range matches extended frame")
+	}
+
+	if _, err = FilterRange(0x200, 0x100, false); err == nil {
+		t.Error("invalid range accepted")
+	}
+}
+
+func TestFilterInverted(t *testing.T) {
+	filters := CanFilters{FilterID(0x108).Invert()}
+	if filters.Match(0x108) || !filters.Match(0x500) {
+		t.Error("inverted filter")
+	}
+
+	extended := CanFilters{FilterID(0x18daf110)}
+	if !extended.Match(0x18daf110) || !extended.Match(0x18daf110|CanEffFlag) || extended.Match(0x110) {
+		t.Error("extended filter")
+	}
+
+	if !(CanFilters{}).Match(0x123) {
+		t.Error("no filters should pass all frames")
+	}
+}
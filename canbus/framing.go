@@ -0,0 +1,312 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const (
+	FramingDefaultDelimiter   = '\n'
+	FramingDefaultMaxFrameLen = 256
+)
+
+// Framer cuts complete frames out of a byte stream.
+// Frame returns the number of bytes to consume from buf, the complete frame
+// (nil if more data is needed) and how many of the consumed bytes were garbage.
+type Framer interface {
+	Frame(buf []byte) (advance int, frame []byte, discarded int)
+}
+
+// FramedParser is implemented by parsers which know how their frames are
+// delimited in a stream. Parsers without it are framed by line.
+type FramedParser interface {
+	Framer() Framer
+}
+
+// FrameLengther is implemented by parsers, which can tell the length of the
+// next frame from its first bytes (e.g. binary protocols with a header).
+// FrameLength returns 0 if more data is needed and an error if buf does not
+// start with a valid frame.
+type FrameLengther interface {
+	FrameLength(buf []byte) (n int, err error)
+}
+
+func FramerFor(parser CanFrameParser) Framer {
+	if fp, ok := parser.(FramedParser); ok {
+		return fp.Framer()
+	}
+	if fl, ok := parser.(FrameLengther); ok {
+		return NewParserFramer(fl, FramingDefaultMaxFrameLen)
+	}
+	return NewDelimiterFramer(FramingDefaultDelimiter, FramingDefaultMaxFrameLen)
+}
+
+// frames terminated by a delimiter. e.g. line based ascii protocols
+type DelimiterFramer struct {
+	delimiter   byte
+	maxFrameLen int
+}
+
+func NewDelimiterFramer(delimiter byte, maxFrameLen int) *DelimiterFramer {
+	return &DelimiterFramer{
+		delimiter:   delimiter,
+		maxFrameLen: maxFrameLen,
+	}
+}
+
+func (f *DelimiterFramer) Frame(buf []byte) (advance int, frame []byte, discarded int) {
+	i := bytes.IndexByte(buf, f.delimiter)
+	if i < 0 {
+		if f.maxFrameLen > 0 && len(buf) > f.maxFrameLen {
+			// no delimiter in sight, drop the garbage
+			return len(buf), nil, len(buf)
+		}
+		return 0, nil, 0
+	}
+	if f.maxFrameLen > 0 && i > f.maxFrameLen {
+		return i + 1, nil, i + 1
+	}
+
+	frame = buf[:i]
+	if f.delimiter == '\n' {
+		frame = bytes.TrimSuffix(frame, []byte{'\r'})
+	}
+	if len(frame) == 0 {
+		// empty line
+		return i + 1, nil, 0
+	}
+
+	return i + 1, frame, 0
+}
+
+// frames with a (optional) sync pattern followed by a big endian length field.
+// the length counts the payload only and the returned frame is the payload.
+type LengthPrefixFramer struct {
+	sync        []byte
+	lengthBytes int
+	maxFrameLen int
+}
+
+func NewLengthPrefixFramer(sync []byte, lengthBytes int, maxFrameLen int) *LengthPrefixFramer {
+	return &LengthPrefixFramer{
+		sync:        sync,
+		lengthBytes: lengthBytes,
+		maxFrameLen: maxFrameLen,
+	}
+}
+
+func (f *LengthPrefixFramer) Frame(buf []byte) (advance int, frame []byte, discarded int) {
+	if len(f.sync) > 0 {
+		i := bytes.Index(buf, f.sync)
+		if i < 0 {
+			// keep a possible partial sync pattern at the end
+			keep := len(f.sync) - 1
+			if len(buf) > keep {
+				return len(buf) - keep, nil, len(buf) - keep
+			}
+			return 0, nil, 0
+		}
+		if i > 0 {
+			return i, nil, i
+		}
+	}
+
+	header := len(f.sync) + f.lengthBytes
+	if len(buf) < header {
+		return 0, nil, 0
+	}
+
+	length := 0
+	for _, b := range buf[len(f.sync):header] {
+		length = length<<8 | int(b)
+	}
+	if f.maxFrameLen > 0 && length > f.maxFrameLen {
+		// resync on the next byte
+		return 1, nil, 1
+	}
+	if len(buf) < header+length {
+		return 0, nil, 0
+	}
+
+	return header + length, buf[header : header+length], 0
+}
+
+// frames, where the parser knows the length
+type ParserFramer struct {
+	parser      FrameLengther
+	maxFrameLen int
+}
+
+func NewParserFramer(parser FrameLengther, maxFrameLen int) *ParserFramer {
+	return &ParserFramer{
+		parser:      parser,
+		maxFrameLen: maxFrameLen,
+	}
+}
+
+func (f *ParserFramer) Frame(buf []byte) (advance int, frame []byte, discarded int) {
+	if len(buf) == 0 {
+		return 0, nil, 0
+	}
+	n, err := f.parser.FrameLength(buf)
+	if err != nil || (f.maxFrameLen > 0 && n > f.maxFrameLen) {
+		// resync on the next byte
+		return 1, nil, 1
+	}
+	if n <= 0 || len(buf) < n {
+		return 0, nil, 0
+	}
+	return n, buf[:n], 0
+}
+
+type FramingStats struct {
+	Frames         uint64 `json:"frames"`
+	DiscardedBytes uint64 `json:"discardedBytes"`
+	ParseErrors    uint64 `json:"parseErrors"`
+	Dropped        uint64 `json:"dropped"` // frames lost on a full rx channel
+}
+
+// FrameBuffer accumulates stream data across reads and hands out complete frames
+type FrameBuffer struct {
+	framer Framer
+	buffer []byte
+	stats  FramingStats
+	mutex  sync.Mutex
+}
+
+func NewFrameBuffer(framer Framer) *FrameBuffer {
+	return &FrameBuffer{
+		framer: framer,
+		buffer: make([]byte, 0, CanbusBufferSize),
+	}
+}
+
+func (b *FrameBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.buffer = append(b.buffer, p...)
+	return len(p), nil
+}
+
+// Next returns the next complete frame or nil. The frame is only valid until
+// the next call to Write.
+func (b *FrameBuffer) Next() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for len(b.buffer) > 0 {
+		advance, frame, discarded := b.framer.Frame(b.buffer)
+		b.stats.DiscardedBytes += uint64(discarded)
+		if advance <= 0 {
+			return nil
+		}
+
+		if frame != nil {
+			b.stats.Frames++
+			frame = append([]byte{}, frame...)
+		}
+		b.buffer = b.buffer[advance:]
+
+		if frame != nil {
+			return frame
+		}
+	}
+	return nil
+}
+
+func (b *FrameBuffer) CountParseError() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats.ParseErrors++
+}
+
+// counts a frame lost on a full rx channel, returns the total
+func (b *FrameBuffer) CountDropped() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats.Dropped++
+	return b.stats.Dropped
+}
+
+// discards a partial frame, e.g. of the previous connection
+func (b *FrameBuffer) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats.DiscardedBytes += uint64(len(b.buffer))
+	b.buffer = b.buffer[:0]
+}
+
+func (b *FrameBuffer) Stats() FramingStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+// reads the stream until it fails and sends every parsable frame to rxCh
+func readFrames(module string, r io.Reader, frames *FrameBuffer,
+	parser CanFrameParser, filter *softwareFilter, rxCh chan<- *Frame) error {
+
+	buffer := make([]byte, CanbusBufferSize)
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			_, _ = frames.Write(buffer[:n])
+			for raw := frames.Next(); raw != nil; raw = frames.Next() {
+				canFrame := parser.Unmarshal(raw)
+				if canFrame == nil {
+					frames.CountParseError()
+					continue
+				}
+				if !filter.match(canFrame.ArbitrationID) {
+					continue
+				}
+				select {
+				// do not block, if the rx channel is full
+				case rxCh <- NewFrame(canFrame):
+				default:
+					log.Warn(module, "full rx channel, %d frames dropped", frames.CountDropped())
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
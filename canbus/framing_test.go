@@ -0,0 +1,120 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+// lines to frames with the line length as id
+type lineParser struct{}
+
+func (lineParser) Unmarshal(in []byte) *can.Frame {
+	return &can.Frame{ArbitrationID: uint32(len(in))}
+}
+
+func (lineParser) Marshal(*can.Frame) []byte {
+	return nil
+}
+
+func TestDelimiterFramerSplitReads(t *testing.T) {
+	frames := NewFrameBuffer(NewDelimiterFramer('\n', 32))
+
+	_, _ = frames.Write([]byte("\x00123,0,0,01"))
+	if frames.Next() != nil {
+		t.Error("incomplete frame returned")
+	}
+	_, _ = frames.Write([]byte("02\r\n\x00456,0,0,ff\n"))
+
+	first := frames.Next()
+	if string(first) != "\x00123,0,0,0102" {
+		t.Errorf("first frame: %q", first)
+	}
+	second := frames.Next()
+	if string(second) != "\x00456,0,0,ff" {
+		t.Errorf("second frame: %q", second)
+	}
+
+	_, _ = frames.Write(bytes.Repeat([]byte{'x'}, 40))
+	if frames.Next() != nil {
+		t.Error("garbage returned as frame")
+	}
+	stats := frames.Stats()
+	if stats.Frames != 2 || stats.DiscardedBytes != 40 {
+		t.Errorf("stats: %+v", stats)
+	}
+}
+
+func TestLengthPrefixFramerResync(t *testing.T) {
+	frames := NewFrameBuffer(NewLengthPrefixFramer([]byte{0xaa, 0x55}, 1, 16))
+
+	_, _ = frames.Write([]byte{0x01, 0x02, 0xaa})
+	if frames.Next() != nil {
+		t.Error("incomplete frame returned")
+	}
+	_, _ = frames.Write([]byte{0x55, 0x03, 0x10, 0x20})
+	if frames.Next() != nil {
+		t.Error("incomplete frame returned")
+	}
+	_, _ = frames.Write([]byte{0x30, 0xaa, 0x55, 0x00})
+
+	frame := frames.Next()
+	if !bytes.Equal(frame, []byte{0x10, 0x20, 0x30}) {
+		t.Errorf("frame: %x", frame)
+	}
+	if empty := frames.Next(); empty == nil || len(empty) != 0 {
+		t.Errorf("empty payload: %x", empty)
+	}
+	if stats := frames.Stats(); stats.DiscardedBytes != 2 {
+		t.Errorf("stats: %+v", stats)
+	}
+}
+
+// a partial frame does not survive a reconnect, frames of a full channel are counted
+func TestFrameBufferResetAndDrops(t *testing.T) {
+	frames := NewFrameBuffer(FramerFor(lineParser{}))
+	_, _ = frames.Write([]byte("stale"))
+	frames.Reset()
+	_, _ = frames.Write([]byte("abc\n"))
+	if frame := frames.Next(); string(frame) != "abc" {
+		t.Errorf("frame after reset: %q", frame)
+	}
+
+	rxCh := make(chan *Frame, 1)
+	err := readFrames("test", bytes.NewReader([]byte("a\nbb\nccc\n")), frames, lineParser{}, &softwareFilter{}, rxCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx := <-rxCh; rx.ArbitrationID != 1 {
+		t.Errorf("first frame %+v", rx)
+	}
+	if stats := frames.Stats(); stats.Dropped != 2 || stats.DiscardedBytes != 5 {
+		t.Errorf("stats: %+v", stats)
+	}
+}
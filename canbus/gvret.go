@@ -0,0 +1,272 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// savvycan gvret csv export:
+// Time Stamp,ID,Extended,Dir,Bus,LEN,D1,D2,D3,D4,D5,D6,D7,D8
+// the time stamp is in microseconds, the bus counts from 0. the format has no
+// remote and error flags, remote frames are written with their length but without data.
+// frames with more than 8 bytes are can fd.
+
+const gvretHeader = "Time Stamp,ID,Extended,Dir,Bus,LEN,D1,D2,D3,D4,D5,D6,D7,D8"
+
+type GvretReader struct {
+	reader  *csv.Reader
+	closer  io.Closer
+	columns map[string]int
+	data    int
+}
+
+func NewGvretReader(r io.Reader) *GvretReader {
+	reader := &GvretReader{
+		reader: csv.NewReader(r),
+	}
+	reader.reader.FieldsPerRecord = -1
+	reader.reader.TrimLeadingSpace = true
+	if closer, ok := r.(io.Closer); ok {
+		reader.closer = closer
+	}
+	return reader
+}
+
+func OpenGvret(path string) (*GvretReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGvretReader(file), nil
+}
+
+// replays a gvret csv trace. only frames of iface (can<bus>) are replayed, an empty iface replays all
+func NewGvretReplay(path string, iface string, speed float64) *Replay {
+	return NewReplay(func() (TraceReader, error) {
+		return OpenGvret(path)
+	}, iface, speed)
+}
+
+func (r *GvretReader) Next() (*TraceRecord, error) {
+	for {
+		fields, err := r.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.reader.FieldPos(0)
+
+		if r.columns == nil {
+			err = r.parseHeader(fields)
+			if err != nil {
+				return nil, fmt.Errorf("gvret line %d: %v", line, err)
+			}
+			continue
+		}
+		record, err := r.parseRecord(fields)
+		if err != nil {
+			return nil, fmt.Errorf("gvret line %d: %v", line, err)
+		}
+		return record, nil
+	}
+}
+
+func (r *GvretReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// older exports have no Dir column, the columns are located by name
+func (r *GvretReader) parseHeader(fields []string) error {
+	r.columns = make(map[string]int)
+	for i, field := range fields {
+		name := strings.ToLower(strings.TrimSpace(field))
+		r.columns[name] = i
+		if name == "d1" {
+			r.data = i
+		}
+	}
+	for _, required := range []string{"time stamp", "id", "len", "d1"} {
+		if _, ok := r.columns[required]; !ok {
+			return fmt.Errorf("missing column %q", required)
+		}
+	}
+	return nil
+}
+
+func (r *GvretReader) field(fields []string, name string) string {
+	i, ok := r.columns[name]
+	if !ok || i >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[i])
+}
+
+func (r *GvretReader) parseRecord(fields []string) (*TraceRecord, error) {
+	micros, err := strconv.ParseInt(r.field(fields, "time stamp"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("time stamp: %v", err)
+	}
+	record := &TraceRecord{
+		Timestamp: time.UnixMicro(micros),
+		Tx:        strings.EqualFold(r.field(fields, "dir"), "Tx"),
+	}
+
+	if bus := r.field(fields, "bus"); bus != "" {
+		n, err := strconv.Atoi(bus)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bus %q", bus)
+		}
+		record.Interface = ChannelInterface(n + 1)
+	}
+
+	id, err := strconv.ParseUint(r.field(fields, "id"), 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("arbitration id: %v", err)
+	}
+	record.ArbitrationID = uint32(id)
+	if strings.EqualFold(r.field(fields, "extended"), "true") {
+		record.ArbitrationID = uint32(id)&CanEffMask | CanEffFlag
+	}
+
+	length, err := strconv.Atoi(r.field(fields, "len"))
+	if err != nil || length < 0 || length > 64 {
+		return nil, fmt.Errorf("length %q", r.field(fields, "len"))
+	}
+
+	data := []byte{}
+	for i := r.data; i < len(fields) && len(data) < length; i++ {
+		value := strings.TrimSpace(fields[i])
+		if value == "" {
+			break
+		}
+		b, err := strconv.ParseUint(value, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("data byte %q", value)
+		}
+		data = append(data, uint8(b))
+	}
+
+	switch {
+	case length > 0 && len(data) == 0:
+		record.ArbitrationID |= CanRtrFlag
+		record.DLC = uint8(length)
+	case len(data) < length:
+		return nil, fmt.Errorf("expected %d data bytes", length)
+	default:
+		record.Data = data
+		record.DLC = uint8(length)
+		record.FD = length > 8
+	}
+	return record, nil
+}
+
+type GvretWriter struct {
+	writer   *bufio.Writer
+	closer   io.Closer
+	started  bool
+	channels map[string]int
+}
+
+func NewGvretWriter(w io.Writer) *GvretWriter {
+	writer := &GvretWriter{
+		writer:   bufio.NewWriter(w),
+		channels: make(map[string]int),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	return writer
+}
+
+func CreateGvret(path string) (*GvretWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGvretWriter(file), nil
+}
+
+func (w *GvretWriter) writeHeader() error {
+	w.started = true
+	_, err := w.writer.WriteString(gvretHeader + "\n")
+	return err
+}
+
+func (w *GvretWriter) Write(record *TraceRecord) error {
+	if record.IsError() {
+		return errors.New("gvret csv does not support error frames")
+	}
+	if !w.started {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	direction := "Rx"
+	if record.Tx {
+		direction = "Tx"
+	}
+	length := len(record.Data)
+	if record.IsRemote() {
+		length = int(record.DLC)
+	}
+
+	// like savvycan, every data byte is followed by a comma
+	line := fmt.Sprintf("%d,%08X,%t,%s,%d,%d,", record.Timestamp.UnixMicro(), record.ID(),
+		record.IsExtended(), direction, InterfaceChannel(record.Interface, w.channels)-1, length)
+	for _, b := range record.Data {
+		line += fmt.Sprintf("%02X,", b)
+	}
+	_, err := w.writer.WriteString(line + "\n")
+	return err
+}
+
+func (w *GvretWriter) Close() error {
+	var err error
+	if !w.started {
+		err = w.writeHeader()
+	}
+	if fErr := w.writer.Flush(); fErr != nil && err == nil {
+		err = fErr
+	}
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestGvret(t *testing.T) {
+	reader, err := OpenGvret("testdata/savvycan_gvret.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readRecords(t, reader)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	if records[0].ID() != 0x108 || records[0].Interface != "can0" || len(records[0].Data) != 8 {
+		t.Errorf("first record %+v", records[0])
+	}
+	if !records[1].IsExtended() || records[1].Interface != "can1" || !records[1].Tx {
+		t.Errorf("extended record %+v", records[1])
+	}
+	if !records[2].IsRemote() || records[2].DLC != 8 {
+		t.Errorf("remote record %+v", records[2])
+	}
+	if records[3].Timestamp.Sub(records[0].Timestamp).Microseconds() != 1012300 {
+		t.Errorf("timestamps %v %v", records[0].Timestamp, records[3].Timestamp)
+	}
+
+	trace := roundTrip(t, records, func(w io.Writer) TraceWriter {
+		return NewGvretWriter(w)
+	}, func(r io.Reader) TraceReader {
+		return NewGvretReader(r)
+	})
+
+	// the sample is a savvycan export, our export looks the same
+	sample, err := os.ReadFile("testdata/savvycan_gvret.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace != string(sample) {
+		t.Errorf("export differs from savvycan:\n%s", trace)
+	}
+}
@@ -27,14 +27,41 @@ package canbus
 
 import (
 	"sync"
+	"time"
 
 	"github.com/angelodlfrtr/go-can"
 )
 
 const CanbusBufferSize = 2048
 
+// socketcan conventions for the arbitration id
+const (
+	CanEffFlag = 0x80000000 // extended frame format
+	CanRtrFlag = 0x40000000 // remote transmission request
+	CanErrFlag = 0x20000000 // error frame
+
+	CanSffMask = 0x000007FF
+	CanEffMask = 0x1FFFFFFF
+)
+
+// a received can frame.
+// Timestamp is the kernel receive time where the backend supports it,
+// otherwise the (monotonic) time the frame was read.
+type Frame struct {
+	can.Frame
+	Timestamp time.Time
+}
+
+// stamps the frame with the current time
+func NewFrame(frame *can.Frame) *Frame {
+	return &Frame{
+		Frame:     *frame,
+		Timestamp: time.Now(),
+	}
+}
+
 type CanBus interface {
-	Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error)
+	Connect(wg *sync.WaitGroup) (<-chan *Frame, error)
 	Disconnect() error
 	Send(message *can.Frame) error
 }
@@ -43,3 +70,8 @@ type CanFrameParser interface {
 	Unmarshal(in []byte) *can.Frame
 	Marshal(*can.Frame) []byte
 }
+
+// an extended id is either flagged or does not fit in 11 bits
+func IsExtendedID(arbitrationID uint32) bool {
+	return arbitrationID&CanEffFlag != 0 || arbitrationID&CanEffMask > CanSffMask
+}
@@ -26,12 +26,12 @@
 package canbus
 
 import (
+	"errors"
 	"sync"
 
 	log "github.com/ChrIgiSta/go-utils/logger"
 
 	"github.com/angelodlfrtr/go-can"
-	"github.com/angelodlfrtr/go-can/transports"
 )
 
 const (
@@ -39,33 +39,41 @@ const (
 )
 
 type NetworkIf struct {
-	bus *can.Bus
+	iface   string
+	socket  *socketCan
+	filters CanFilters
 }
 
 func NewIface(iface string) *NetworkIf {
 	return &NetworkIf{
-		bus: can.NewBus(&transports.SocketCan{
-			Interface: iface,
-		}),
+		iface: iface,
 	}
 }
 
-func (i *NetworkIf) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
+func (i *NetworkIf) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
+	var err error
 
-	err := i.bus.Open()
+	i.socket, err = openSocketCan(i.iface)
 	if err != nil {
 		return nil, err
 	}
+	if i.filters != nil {
+		err = i.socket.setFilters(i.filters)
+		if err != nil {
+			_ = i.socket.close()
+			return nil, err
+		}
+	}
 
-	rxCh := make(chan *can.Frame, CanbusBufferSize)
+	rxCh := make(chan *Frame, CanbusBufferSize)
 
 	go func() {
 		defer wg.Done()
 		defer close(rxCh)
 
 		for {
-			canFrame, ok := <-i.bus.ReadChan()
-			if !ok {
+			canFrame, err := i.socket.read()
+			if err != nil {
 				log.Error("can", "read can iface: %v", err)
 				return
 			}
@@ -81,10 +89,25 @@ func (i *NetworkIf) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 	return rxCh, err
 }
 
+// filters are applied in the kernel (CAN_RAW_FILTER). can be set before or after Connect
+func (i *NetworkIf) SetFilters(filters CanFilters) error {
+	i.filters = append(CanFilters{}, filters...)
+	if i.socket == nil {
+		return nil
+	}
+	return i.socket.setFilters(i.filters)
+}
+
 func (i *NetworkIf) Disconnect() error {
-	return i.bus.Close()
+	if i.socket == nil {
+		return nil
+	}
+	return i.socket.close()
 }
 
 func (i *NetworkIf) Send(message *can.Frame) error {
-	return i.bus.Write(message)
+	if i.socket == nil {
+		return errors.New("can iface not connected")
+	}
+	return i.socket.write(message)
 }
@@ -48,6 +48,8 @@ type Serial struct {
 	bus             *can.Bus
 	useCustomParser bool
 	customParser    CanFrameParser
+	frames          *FrameBuffer
+	filter          softwareFilter
 	port            string
 	baudrate        int
 	com             serial.Port
@@ -71,12 +73,13 @@ func NewSerialCustomParser(port string, baudrate int, parser CanFrameParser) *Se
 		bus:             nil,
 		useCustomParser: true,
 		customParser:    parser,
+		frames:          NewFrameBuffer(FramerFor(parser)),
 		port:            port,
 		baudrate:        baudrate,
 	}
 }
 
-func (s *Serial) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
+func (s *Serial) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
 
 	var err error
 
@@ -89,7 +92,7 @@ func (s *Serial) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 		return nil, err
 	}
 
-	rxCh := make(chan *can.Frame, CanbusBufferSize)
+	rxCh := make(chan *Frame, CanbusBufferSize)
 
 	go func() {
 		defer wg.Done()
@@ -101,10 +104,13 @@ func (s *Serial) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 				log.Error("serial can", "read can iface: %v", err)
 				return
 			}
+			if !s.filter.match(canFrame.ArbitrationID) {
+				continue
+			}
 
 			// do not block on full rx channel
 			select {
-			case rxCh <- canFrame:
+			case rxCh <- NewFrame(canFrame):
 			default:
 				log.Warn("serial can", "full rx channel")
 			}
@@ -114,7 +120,7 @@ func (s *Serial) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 	return rxCh, err
 }
 
-func (s *Serial) connectNative(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
+func (s *Serial) connectNative(wg *sync.WaitGroup) (<-chan *Frame, error) {
 	var err error
 
 	s.com, err = serial.Open(s.port, &serial.Mode{
@@ -128,26 +134,36 @@ func (s *Serial) connectNative(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 		return nil, err
 	}
 
-	rxCh := make(chan *can.Frame, CanbusBufferSize)
+	// bytes of the last connection would be stitched to the first frame
+	s.frames.Reset()
+	rxCh := make(chan *Frame, CanbusBufferSize)
 
 	go func() {
 		defer wg.Done()
 		defer close(rxCh)
 
-		buffer := make([]byte, CanbusBufferSize)
-		for {
-			n, err := s.com.Read(buffer)
-			if err != nil {
-				log.Error("serial can", "reading serial, %v", err)
-				return
-			}
-			rxCh <- s.customParser.Unmarshal(buffer[:n])
+		err := readFrames("serial can", s.com, s.frames, s.customParser, &s.filter, rxCh)
+		if err != nil {
+			log.Error("serial can", "reading serial, %v", err)
 		}
 	}()
 
 	return rxCh, err
 }
 
+// filters are applied in software
+func (s *Serial) SetFilters(filters CanFilters) error {
+	return s.filter.SetFilters(filters)
+}
+
+// statistics of the stream framing. only available with a custom parser
+func (s *Serial) FramingStats() FramingStats {
+	if s.frames == nil {
+		return FramingStats{}
+	}
+	return s.frames.Stats()
+}
+
 func (s *Serial) Disconnect() error {
 	if s.useCustomParser {
 		return s.com.Close()
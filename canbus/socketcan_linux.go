@@ -0,0 +1,200 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/angelodlfrtr/go-can"
+	"golang.org/x/sys/unix"
+)
+
+// struct can_frame of linux/can.h
+type socketCanFrame struct {
+	ID   uint32
+	Len  uint8
+	Pad  uint8
+	Res0 uint8
+	Res1 uint8
+	Data [8]byte
+}
+
+const socketCanFrameSize = int(unsafe.Sizeof(socketCanFrame{}))
+
+// raw socketcan socket with kernel receive timestamps
+type socketCan struct {
+	iface string
+	file  *os.File
+}
+
+func openSocketCan(iface string) (*socketCan, error) {
+	netIf, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("socketcan %s: %v", iface, err)
+	}
+
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW, unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("socketcan %s: socket: %v", iface, err)
+	}
+
+	err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMP, 1)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("socketcan %s: timestamps: %v", iface, err)
+	}
+
+	err = unix.Bind(fd, &unix.SockaddrCAN{Ifindex: netIf.Index})
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("socketcan %s: bind: %v", iface, err)
+	}
+
+	// non blocking to let the runtime poller unblock reads on close
+	err = unix.SetNonblock(fd, true)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("socketcan %s: %v", iface, err)
+	}
+
+	return &socketCan{
+		iface: iface,
+		file:  os.NewFile(uintptr(fd), iface),
+	}, nil
+}
+
+func (s *socketCan) read() (*Frame, error) {
+	var (
+		buffer  [socketCanFrameSize]byte
+		oob     [64]byte
+		n, oobn int
+		readErr error
+	)
+
+	rawConn, err := s.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	err = rawConn.Read(func(fd uintptr) bool {
+		n, oobn, _, _, readErr = unix.Recvmsg(int(fd), buffer[:], oob[:], 0)
+		return !errors.Is(readErr, unix.EAGAIN)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if n != socketCanFrameSize {
+		return nil, fmt.Errorf("socketcan %s: unexpected frame size %d", s.iface, n)
+	}
+
+	raw := (*socketCanFrame)(unsafe.Pointer(&buffer[0]))
+	frame := &Frame{
+		Frame: can.Frame{
+			ArbitrationID: raw.ID,
+			DLC:           raw.Len,
+			Data:          raw.Data,
+		},
+		Timestamp: time.Now(),
+	}
+
+	messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err == nil {
+		for _, msg := range messages {
+			if msg.Header.Level == unix.SOL_SOCKET && msg.Header.Type == unix.SCM_TIMESTAMP &&
+				len(msg.Data) >= int(unsafe.Sizeof(unix.Timeval{})) {
+
+				tv := (*unix.Timeval)(unsafe.Pointer(&msg.Data[0]))
+				frame.Timestamp = time.Unix(tv.Unix())
+			}
+		}
+	}
+
+	return frame, nil
+}
+
+func (s *socketCan) write(frame *can.Frame) error {
+	raw := socketCanFrame{
+		ID:   frame.ArbitrationID,
+		Len:  frame.DLC,
+		Data: frame.Data,
+	}
+	if IsExtendedID(raw.ID) {
+		raw.ID |= CanEffFlag
+	}
+
+	buffer := (*[socketCanFrameSize]byte)(unsafe.Pointer(&raw))
+	_, err := s.file.Write(buffer[:])
+	return err
+}
+
+func (s *socketCan) setFilters(filters CanFilters) error {
+	if len(filters) > unix.CAN_RAW_FILTER_MAX {
+		return fmt.Errorf("socketcan %s: too many filters (%d)", s.iface, len(filters))
+	}
+
+	kernelFilters := make([]unix.CanFilter, 0, len(filters))
+	for _, f := range filters {
+		kf := unix.CanFilter{
+			Id:   f.ID,
+			Mask: f.Mask,
+		}
+		if f.Inverted {
+			kf.Id |= unix.CAN_INV_FILTER
+		}
+		kernelFilters = append(kernelFilters, kf)
+	}
+	if len(kernelFilters) == 0 {
+		// an empty list would drop everything
+		kernelFilters = append(kernelFilters, unix.CanFilter{Id: 0, Mask: 0})
+	}
+
+	rawConn, err := s.file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptCanRawFilter(int(fd), unix.SOL_CAN_RAW, unix.CAN_RAW_FILTER, kernelFilters)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("socketcan %s: set filters: %v", s.iface, sockErr)
+	}
+	return nil
+}
+
+func (s *socketCan) close() error {
+	return s.file.Close()
+}
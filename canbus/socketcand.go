@@ -0,0 +1,341 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+// socketcand ascii protocol, see https://github.com/linux-can/socketcand/blob/master/doc/protocol.md
+const (
+	SocketcandDefaultPort      = 29536
+	SocketcandHandshakeTimeout = 5 * time.Second
+
+	socketcandMaxElementLen = 512
+)
+
+type Socketcand struct {
+	address    string
+	port       uint16
+	busName    string
+	conn       net.Conn
+	elements   *FrameBuffer
+	filter     softwareFilter
+	writeMutex sync.Mutex
+}
+
+func NewSocketcand(address string, port uint16, busName string) *Socketcand {
+	return &Socketcand{
+		address:  address,
+		port:     port,
+		busName:  busName,
+		elements: NewFrameBuffer(NewDelimiterFramer('>', socketcandMaxElementLen)),
+	}
+}
+
+func (c *Socketcand) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
+	var err error
+
+	c.conn, err = net.Dial(TcpCanNetworkType, net.JoinHostPort(c.address, strconv.Itoa(int(c.port))))
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.handshake()
+	if err != nil {
+		_ = c.conn.Close()
+		return nil, err
+	}
+
+	rxCh := make(chan *Frame, CanbusBufferSize)
+
+	go func() {
+		defer wg.Done()
+		defer close(rxCh)
+
+		for {
+			cmd, args, err := c.nextElement()
+			if errors.Is(err, net.ErrClosed) {
+				log.Debug("socketcand", "disconnected")
+				return
+			} else if err != nil {
+				log.Error("socketcand", "read: %v", err)
+				return
+			}
+
+			switch cmd {
+			case "frame":
+				// the server's timestamp is taken with a foreign clock
+				canFrame, _, err := ParseSocketcandFrame(args)
+				if err != nil {
+					c.elements.CountParseError()
+					log.Warn("socketcand", "parse frame: %v", err)
+					continue
+				}
+				if !c.filter.match(canFrame.ArbitrationID) {
+					continue
+				}
+				select {
+				// do not block, if the rx channel is full
+				case rxCh <- NewFrame(canFrame):
+				default:
+					log.Warn("socketcand", "full rx channel")
+				}
+			case "error":
+				log.Warn("socketcand", "server error: %s", strings.Join(args, " "))
+			default:
+				_ = log.Fine("socketcand", "ignore <%s %v>", cmd, args)
+			}
+		}
+	}()
+
+	return rxCh, nil
+}
+
+func (c *Socketcand) handshake() error {
+	err := c.conn.SetDeadline(time.Now().Add(SocketcandHandshakeTimeout))
+	if err != nil {
+		return err
+	}
+
+	if err = c.expect("hi"); err != nil {
+		return err
+	}
+	if err = c.write(SocketcandElement("open", c.busName)); err != nil {
+		return err
+	}
+	if err = c.expect("ok"); err != nil {
+		return err
+	}
+	if err = c.write(SocketcandElement("rawmode")); err != nil {
+		return err
+	}
+	if err = c.expect("ok"); err != nil {
+		return err
+	}
+
+	return c.conn.SetDeadline(time.Time{})
+}
+
+func (c *Socketcand) expect(expected string) error {
+	cmd, args, err := c.nextElement()
+	if err != nil {
+		return err
+	}
+	if cmd != expected {
+		return fmt.Errorf("socketcand: expected <%s>, got <%s %s>",
+			expected, cmd, strings.Join(args, " "))
+	}
+	return nil
+}
+
+func (c *Socketcand) nextElement() (cmd string, args []string, err error) {
+	buffer := make([]byte, CanbusBufferSize)
+	for {
+		raw := c.elements.Next()
+		if raw != nil {
+			cmd, args, err = ParseSocketcandElement(raw)
+			if err != nil {
+				c.elements.CountParseError()
+				log.Warn("socketcand", "%v", err)
+				continue
+			}
+			return cmd, args, nil
+		}
+
+		n, err := c.conn.Read(buffer)
+		if err != nil {
+			return "", nil, err
+		}
+		_, _ = c.elements.Write(buffer[:n])
+	}
+}
+
+func (c *Socketcand) write(element string) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_, err := c.conn.Write([]byte(element))
+	return err
+}
+
+// filters are applied in software
+func (c *Socketcand) SetFilters(filters CanFilters) error {
+	return c.filter.SetFilters(filters)
+}
+
+// statistics of the element framing
+func (c *Socketcand) FramingStats() FramingStats {
+	return c.elements.Stats()
+}
+
+func (c *Socketcand) Disconnect() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *Socketcand) Send(message *can.Frame) error {
+	if message == nil {
+		return errors.New("frame <nil>")
+	}
+	return c.write(SocketcandSend(message))
+}
+
+// < cmd arg1 arg2 >
+func SocketcandElement(cmd string, args ...string) string {
+	if len(args) == 0 {
+		return "< " + cmd + " >"
+	}
+	return "< " + cmd + " " + strings.Join(args, " ") + " >"
+}
+
+// parses an element without the closing '>'
+func ParseSocketcandElement(raw []byte) (cmd string, args []string, err error) {
+	element := strings.TrimSpace(string(raw))
+	element = strings.TrimSuffix(element, ">")
+	if !strings.HasPrefix(element, "<") {
+		return "", nil, fmt.Errorf("socketcand: invalid element %q", element)
+	}
+
+	fields := strings.Fields(element[1:])
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("socketcand: empty element")
+	}
+	return fields[0], fields[1:], nil
+}
+
+func socketcandID(arbitrationID uint32) string {
+	if IsExtendedID(arbitrationID) {
+		return fmt.Sprintf("%08X", arbitrationID&CanEffMask)
+	}
+	return fmt.Sprintf("%03X", arbitrationID&CanSffMask)
+}
+
+func parseSocketcandID(id string) (uint32, error) {
+	arbitrationID, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("socketcand: arbitration id %q: %v", id, err)
+	}
+	if len(id) > 3 {
+		return uint32(arbitrationID)&CanEffMask | CanEffFlag, nil
+	}
+	return uint32(arbitrationID) & CanSffMask, nil
+}
+
+// < send can_id can_dlc [data]* >
+func SocketcandSend(frame *can.Frame) string {
+	args := []string{socketcandID(frame.ArbitrationID), strconv.Itoa(int(frame.DLC))}
+	for _, b := range frame.GetData() {
+		args = append(args, fmt.Sprintf("%02X", b))
+	}
+	return SocketcandElement("send", args...)
+}
+
+// arguments of < send can_id can_dlc [data]* >
+func ParseSocketcandSend(args []string) (*can.Frame, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("socketcand: send needs id and dlc, got %v", args)
+	}
+	arbitrationID, err := parseSocketcandID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	dlc, err := strconv.Atoi(args[1])
+	if err != nil || dlc < 0 || dlc > 8 || len(args)-2 != dlc {
+		return nil, fmt.Errorf("socketcand: invalid dlc in send %v", args)
+	}
+
+	frame := &can.Frame{
+		ArbitrationID: arbitrationID,
+		DLC:           uint8(dlc),
+	}
+	for i, b := range args[2:] {
+		v, err := strconv.ParseUint(b, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("socketcand: data byte %q: %v", b, err)
+		}
+		frame.Data[i] = byte(v)
+	}
+	return frame, nil
+}
+
+// < frame can_id seconds.useconds [data]* >
+func SocketcandFrame(frame *can.Frame, timestamp time.Time) string {
+	return SocketcandElement("frame",
+		socketcandID(frame.ArbitrationID),
+		fmt.Sprintf("%d.%06d", timestamp.Unix(), timestamp.Nanosecond()/1000),
+		strings.ToUpper(hex.EncodeToString(frame.GetData())))
+}
+
+// arguments of < frame can_id seconds.useconds [data]* >
+func ParseSocketcandFrame(args []string) (*can.Frame, time.Time, error) {
+	var timestamp time.Time
+
+	if len(args) < 2 || len(args) > 3 {
+		return nil, timestamp, fmt.Errorf("socketcand: invalid frame %v", args)
+	}
+	arbitrationID, err := parseSocketcandID(args[0])
+	if err != nil {
+		return nil, timestamp, err
+	}
+
+	secs, usecs, _ := strings.Cut(args[1], ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return nil, timestamp, fmt.Errorf("socketcand: timestamp %q: %v", args[1], err)
+	}
+	usec, _ := strconv.ParseInt(usecs, 10, 64)
+	timestamp = time.Unix(sec, usec*1000)
+
+	var data []byte
+	if len(args) == 3 {
+		data, err = hex.DecodeString(args[2])
+		if err != nil || len(data) > 8 {
+			return nil, timestamp, fmt.Errorf("socketcand: frame data %q", args[2])
+		}
+	}
+
+	frame := &can.Frame{
+		ArbitrationID: arbitrationID,
+		DLC:           uint8(len(data)),
+	}
+	copy(frame.Data[:], data)
+
+	return frame, timestamp, nil
+}
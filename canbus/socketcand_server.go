@@ -0,0 +1,243 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const socketcandClientBufferSize = 1024
+
+// exposes CanBus implementations over the socketcand raw mode
+type SocketcandServer struct {
+	host     string
+	port     uint16
+	buses    map[string]CanBus
+	listener net.Listener
+	clients  map[*socketcandClient]struct{}
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+type socketcandClient struct {
+	conn    net.Conn
+	busName string
+	rawMode bool
+	tx      chan string
+	mutex   sync.Mutex
+}
+
+// buses by their name, which the clients use to < open > them
+func NewSocketcandServer(host string, port uint16, buses map[string]CanBus) *SocketcandServer {
+	return &SocketcandServer{
+		host:    host,
+		port:    port,
+		buses:   buses,
+		clients: make(map[*socketcandClient]struct{}),
+	}
+}
+
+// connects all buses and accepts clients until Stop is called
+func (s *SocketcandServer) ListenAndServe() error {
+	listener, err := net.Listen(TcpCanNetworkType, net.JoinHostPort(s.host, strconv.Itoa(int(s.port))))
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.listener = listener
+	s.mutex.Unlock()
+
+	for name, bus := range s.buses {
+		s.wg.Add(1)
+		rx, err := bus.Connect(&s.wg)
+		if err != nil {
+			s.wg.Done()
+			_ = listener.Close()
+			return err
+		}
+		s.wg.Add(1)
+		go s.distribute(name, rx)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Info("socketcand server", "stop accepting: %v", err)
+			return nil
+		}
+		client := &socketcandClient{
+			conn: conn,
+			tx:   make(chan string, socketcandClientBufferSize),
+		}
+		s.mutex.Lock()
+		s.clients[client] = struct{}{}
+		s.mutex.Unlock()
+
+		s.wg.Add(2)
+		go s.clientWriter(client)
+		go s.clientHandler(client)
+	}
+}
+
+func (s *SocketcandServer) Stop() {
+	s.mutex.Lock()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	for client := range s.clients {
+		_ = client.conn.Close()
+	}
+	s.mutex.Unlock()
+
+	for name, bus := range s.buses {
+		if err := bus.Disconnect(); err != nil {
+			log.Warn("socketcand server", "disconnect %s: %v", name, err)
+		}
+	}
+
+	s.wg.Wait()
+}
+
+func (s *SocketcandServer) distribute(busName string, rx <-chan *Frame) {
+	defer s.wg.Done()
+
+	for frame := range rx {
+		element := SocketcandFrame(&frame.Frame, frame.Timestamp)
+
+		s.mutex.Lock()
+		for client := range s.clients {
+			client.mutex.Lock()
+			if client.rawMode && client.busName == busName {
+				client.send(element)
+			}
+			client.mutex.Unlock()
+		}
+		s.mutex.Unlock()
+	}
+	// the buses close on Stop, while the clients are served
+	log.Debug("socketcand server", "bus %s closed", busName)
+}
+
+func (s *SocketcandServer) clientHandler(client *socketcandClient) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.clients, client)
+		s.mutex.Unlock()
+		close(client.tx)
+		_ = client.conn.Close()
+	}()
+
+	elements := NewFrameBuffer(NewDelimiterFramer('>', socketcandMaxElementLen))
+	buffer := make([]byte, CanbusBufferSize)
+
+	client.send(SocketcandElement("hi"))
+
+	for {
+		n, err := client.conn.Read(buffer)
+		if err != nil {
+			_ = log.Fine("socketcand server", "client %s: %v", client.conn.RemoteAddr(), err)
+			return
+		}
+		_, _ = elements.Write(buffer[:n])
+
+		for raw := elements.Next(); raw != nil; raw = elements.Next() {
+			cmd, args, err := ParseSocketcandElement(raw)
+			if err != nil {
+				elements.CountParseError()
+				client.send(SocketcandElement("error", "parse"))
+				continue
+			}
+			s.processCommand(client, cmd, args)
+		}
+	}
+}
+
+func (s *SocketcandServer) processCommand(client *socketcandClient, cmd string, args []string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	switch cmd {
+	case "open":
+		if len(args) != 1 || s.buses[args[0]] == nil {
+			client.send(SocketcandElement("error", "could not open bus"))
+			return
+		}
+		client.busName = args[0]
+		client.send(SocketcandElement("ok"))
+	case "rawmode":
+		if client.busName == "" {
+			client.send(SocketcandElement("error", "no bus opened"))
+			return
+		}
+		client.rawMode = true
+		client.send(SocketcandElement("ok"))
+	case "send":
+		if !client.rawMode {
+			client.send(SocketcandElement("error", "not in rawmode"))
+			return
+		}
+		frame, err := ParseSocketcandSend(args)
+		if err != nil {
+			client.send(SocketcandElement("error", "invalid send"))
+			return
+		}
+		err = s.buses[client.busName].Send(frame)
+		if err != nil {
+			log.Error("socketcand server", "send on %s: %v", client.busName, err)
+			client.send(SocketcandElement("error", "send failed"))
+		}
+	case "echo":
+		client.send(SocketcandElement("echo"))
+	default:
+		client.send(SocketcandElement("error", "unsupported command"))
+	}
+}
+
+func (s *SocketcandServer) clientWriter(client *socketcandClient) {
+	defer s.wg.Done()
+
+	for element := range client.tx {
+		_, err := client.conn.Write([]byte(element))
+		if err != nil {
+			_ = log.Fine("socketcand server", "write %s: %v", client.conn.RemoteAddr(), err)
+			_ = client.conn.Close()
+		}
+	}
+}
+
+// do not block the bus on slow clients
+func (c *socketcandClient) send(element string) {
+	select {
+	case c.tx <- element:
+	default:
+		log.Warn("socketcand server", "client %s tx full", c.conn.RemoteAddr())
+	}
+}
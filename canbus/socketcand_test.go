@@ -0,0 +1,152 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+type memoryBus struct {
+	rx   chan *can.Frame
+	sent chan *can.Frame
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{
+		rx:   make(chan *can.Frame, 16),
+		sent: make(chan *can.Frame, 16),
+	}
+}
+
+func (b *memoryBus) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
+	out := make(chan *Frame, 16)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+		for f := range b.rx {
+			out <- NewFrame(f)
+		}
+	}()
+	return out, nil
+}
+
+func (b *memoryBus) Disconnect() error {
+	close(b.rx)
+	return nil
+}
+
+func (b *memoryBus) Send(message *can.Frame) error {
+	b.sent <- message
+	return nil
+}
+
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestSocketcandLoopback(t *testing.T) {
+	var wg sync.WaitGroup
+
+	bus := newMemoryBus()
+	port := freePort(t)
+	server := NewSocketcandServer("127.0.0.1", port, map[string]CanBus{"vcan0": bus})
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer server.Stop()
+
+	client := NewSocketcand("127.0.0.1", port, "vcan0")
+	var rx <-chan *Frame
+	var err error
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		rx, err = client.Connect(&wg)
+		if err == nil {
+			break
+		}
+		wg.Done()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+
+	// give the server time to switch the client to raw mode
+	time.Sleep(50 * time.Millisecond)
+
+	bus.rx <- &can.Frame{ArbitrationID: 0x108, DLC: 3, Data: [8]byte{0x13, 0x0c, 0xf3}}
+	select {
+	case frame := <-rx:
+		if frame.ArbitrationID != 0x108 || frame.DLC != 3 || frame.Data[2] != 0xf3 {
+			t.Errorf("received %+v", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+	}
+
+	err = client.Send(&can.Frame{ArbitrationID: 0x12345 | CanEffFlag, DLC: 2, Data: [8]byte{0xde, 0xad}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case frame := <-bus.sent:
+		if frame.ArbitrationID != 0x12345|CanEffFlag || frame.DLC != 2 || frame.Data[1] != 0xad {
+			t.Errorf("sent %+v", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no frame sent")
+	}
+}
+
+func TestParseSocketcandFrame(t *testing.T) {
+	_, args, err := ParseSocketcandElement([]byte(" < frame 1F334455 1342517189.122 1122 "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, timestamp, err := ParseSocketcandFrame(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.ArbitrationID != 0x1F334455|CanEffFlag || frame.DLC != 2 || frame.Data[1] != 0x22 {
+		t.Errorf("frame %+v", frame)
+	}
+	if timestamp.Unix() != 1342517189 {
+		t.Errorf("timestamp %v", timestamp)
+	}
+}
@@ -26,8 +26,6 @@
 package canbus
 
 import (
-	"bufio"
-	"bytes"
 	"net"
 	"strconv"
 	"sync"
@@ -52,6 +50,8 @@ type TcpClient struct {
 	tcp             net.Conn
 	useCustomParser bool
 	customParser    CanFrameParser
+	frames          *FrameBuffer
+	filter          softwareFilter
 	bus             can.Bus
 }
 
@@ -73,10 +73,11 @@ func NewTcpClientCustomParser(address string, port uint16,
 		port:            port,
 		useCustomParser: true,
 		customParser:    parser,
+		frames:          NewFrameBuffer(FramerFor(parser)),
 	}
 }
 
-func (c *TcpClient) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
+func (c *TcpClient) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
 
 	var err error
 
@@ -89,7 +90,7 @@ func (c *TcpClient) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 		return nil, err
 	}
 
-	rxCh := make(chan *can.Frame, CanbusBufferSize)
+	rxCh := make(chan *Frame, CanbusBufferSize)
 
 	go func() {
 		defer wg.Done()
@@ -101,14 +102,17 @@ func (c *TcpClient) Connect(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
 				log.Error("tcp can", "read can tcp: %v", err)
 				return
 			}
-			rxCh <- canFrame
+			if !c.filter.match(canFrame.ArbitrationID) {
+				continue
+			}
+			rxCh <- NewFrame(canFrame)
 		}
 	}()
 
 	return rxCh, err
 }
 
-func (c *TcpClient) connectTcpNative(wg *sync.WaitGroup) (<-chan *can.Frame, error) {
+func (c *TcpClient) connectTcpNative(wg *sync.WaitGroup) (<-chan *Frame, error) {
 	var err error
 
 	c.tcp, err = net.Dial(TcpCanNetworkType, c.address+":"+strconv.Itoa(int(c.port)))
@@ -116,41 +120,36 @@ func (c *TcpClient) connectTcpNative(wg *sync.WaitGroup) (<-chan *can.Frame, err
 		return nil, err
 	}
 
-	rxCh := make(chan *can.Frame, CanbusBufferSize)
+	// bytes of the last connection would be stitched to the first frame
+	c.frames.Reset()
+	rxCh := make(chan *Frame, CanbusBufferSize)
 
 	go func() {
 		defer wg.Done()
 		defer close(rxCh)
 
-		buffer := make([]byte, CanbusBufferSize)
-
-		packages := 0
-		for {
-			b, err := c.tcp.Read(buffer)
-			if err != nil {
-				log.Error("tcp can", "read tcp driveMode: %v", err)
-			} else if b > 0 {
-				// line for line
-				scanner := bufio.NewScanner(bytes.NewBuffer(buffer[:b-1]))
-				for scanner.Scan() {
-					packages++
-					canFrame := c.customParser.Unmarshal(scanner.Bytes())
-					if canFrame != nil {
-						select {
-						// do not block, if the rx channel is full
-						case rxCh <- canFrame:
-						default:
-							log.Warn("tcp can", "full rx channel")
-						}
-					}
-				}
-			}
+		err := readFrames("tcp can", c.tcp, c.frames, c.customParser, &c.filter, rxCh)
+		if err != nil {
+			log.Error("tcp can", "read tcp: %v", err)
 		}
 	}()
 
 	return rxCh, err
 }
 
+// filters are applied in software
+func (c *TcpClient) SetFilters(filters CanFilters) error {
+	return c.filter.SetFilters(filters)
+}
+
+// statistics of the stream framing. only available with a custom parser
+func (c *TcpClient) FramingStats() FramingStats {
+	if c.frames == nil {
+		return FramingStats{}
+	}
+	return c.frames.Stats()
+}
+
 func (c *TcpClient) Disconnect() error {
 
 	if c.useCustomParser {
@@ -0,0 +1,400 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+const (
+	// replay speed factor to not wait between frames
+	ReplayAsFastAsPossible = 0
+	// replay speed factor for the original timing
+	ReplayRealtime = 1
+)
+
+var ErrReadOnly = errors.New("bus is read only")
+
+// a frame in a trace file
+type TraceRecord struct {
+	Timestamp           time.Time
+	Interface           string // interface or channel name
+	ArbitrationID       uint32 // with socketcan flags (CanEffFlag, CanRtrFlag, CanErrFlag)
+	DLC                 uint8  // requested length of remote frames, else len(Data)
+	Data                []byte // up to 64 bytes for can fd
+	FD                  bool
+	BitRateSwitch       bool
+	ErrorStateIndicator bool
+	Tx                  bool
+}
+
+type TraceReader interface {
+	// Next returns io.EOF at the end of the trace
+	Next() (*TraceRecord, error)
+	Close() error
+}
+
+type TraceWriter interface {
+	Write(record *TraceRecord) error
+	Close() error
+}
+
+func NewTraceRecord(iface string, frame *Frame) *TraceRecord {
+	id := frame.ArbitrationID
+	if IsExtendedID(id) {
+		id |= CanEffFlag
+	}
+	record := &TraceRecord{
+		Timestamp:     frame.Timestamp,
+		Interface:     iface,
+		ArbitrationID: id,
+		DLC:           frame.DLC,
+	}
+	if id&CanRtrFlag == 0 {
+		record.Data = append([]byte{}, frame.GetData()...)
+	}
+	return record
+}
+
+// trace formats with channel numbers (vector, peak) count from 1.
+// channel 1 is named can0, channel 2 can1, ...
+func ChannelInterface(channel int) string {
+	return fmt.Sprintf("can%d", channel-1)
+}
+
+// the channel number of an interface name. names, which do not follow
+// the can<N> pattern get the next free number from channels
+func InterfaceChannel(iface string, channels map[string]int) int {
+	if channel, ok := channels[iface]; ok {
+		return channel
+	}
+	channel := 0
+	if n, err := strconv.Atoi(strings.TrimPrefix(iface, "can")); err == nil && n >= 0 &&
+		strings.HasPrefix(iface, "can") {
+		channel = n + 1
+	} else {
+		for _, c := range channels {
+			if c > channel {
+				channel = c
+			}
+		}
+		channel++
+	}
+	channels[iface] = channel
+	return channel
+}
+
+var canFdLengths = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+func CanFdDlcToLen(dlc uint8) int {
+	if int(dlc) >= len(canFdLengths) {
+		return 64
+	}
+	return canFdLengths[dlc]
+}
+
+// the smallest dlc, which fits length bytes
+func CanFdLenToDlc(length int) uint8 {
+	for dlc, l := range canFdLengths {
+		if l >= length {
+			return uint8(dlc)
+		}
+	}
+	return 15
+}
+
+func (r *TraceRecord) IsExtended() bool {
+	return IsExtendedID(r.ArbitrationID)
+}
+
+func (r *TraceRecord) IsRemote() bool {
+	return r.ArbitrationID&CanRtrFlag != 0
+}
+
+func (r *TraceRecord) IsError() bool {
+	return r.ArbitrationID&CanErrFlag != 0
+}
+
+// the id without flags
+func (r *TraceRecord) ID() uint32 {
+	if r.IsExtended() {
+		return r.ArbitrationID & CanEffMask
+	}
+	return r.ArbitrationID & CanSffMask
+}
+
+// the record as received frame. can fd frames with more than 8 bytes do not fit
+func (r *TraceRecord) Frame() (*Frame, error) {
+	if len(r.Data) > 8 {
+		return nil, fmt.Errorf("can fd frame 0x%x with %d bytes does not fit into a can frame",
+			r.ID(), len(r.Data))
+	}
+	frame := &Frame{
+		Frame: can.Frame{
+			ArbitrationID: r.ArbitrationID,
+			DLC:           uint8(len(r.Data)),
+		},
+		Timestamp: r.Timestamp,
+	}
+	if r.IsRemote() {
+		frame.DLC = r.DLC
+	}
+	copy(frame.Data[:], r.Data)
+	return frame, nil
+}
+
+// replays a trace as CanBus. frames carry their recorded timestamp
+type Replay struct {
+	open   func() (TraceReader, error)
+	iface  string
+	speed  float64
+	filter softwareFilter
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// open is called on every Connect. only records of iface are replayed,
+// an empty iface replays all. speed is a factor of the original timing,
+// ReplayAsFastAsPossible does not wait between frames
+func NewReplay(open func() (TraceReader, error), iface string, speed float64) *Replay {
+	return &Replay{
+		open:  open,
+		iface: iface,
+		speed: speed,
+	}
+}
+
+// opens a trace file by its extension: .asc, .blf, .trc, .csv (gvret), anything else is a candump log
+func OpenTrace(path string) (TraceReader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".asc":
+		return OpenAsc(path)
+	case ".blf":
+		return OpenBlf(path)
+	case ".trc":
+		return OpenTrc(path)
+	case ".csv":
+		return OpenGvret(path)
+	default:
+		return OpenCandump(path)
+	}
+}
+
+// creates a trace file by its extension: .asc, .blf, .trc, .csv (gvret), anything else is a candump log
+func CreateTrace(path string) (TraceWriter, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".asc":
+		return CreateAsc(path)
+	case ".blf":
+		return CreateBlf(path)
+	case ".trc":
+		return CreateTrc(path)
+	case ".csv":
+		return CreateGvret(path)
+	default:
+		return CreateCandump(path)
+	}
+}
+
+// replays a trace file of any supported format
+func NewTraceReplay(path string, iface string, speed float64) *Replay {
+	return NewReplay(func() (TraceReader, error) {
+		return OpenTrace(path)
+	}, iface, speed)
+}
+
+func (r *Replay) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
+	reader, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	r.stop = make(chan struct{})
+	r.once = sync.Once{}
+	rxCh := make(chan *Frame, CanbusBufferSize)
+
+	go func() {
+		defer wg.Done()
+		defer close(rxCh)
+		defer reader.Close()
+
+		var (
+			first   time.Time
+			started time.Time
+		)
+
+		for {
+			record, err := reader.Next()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					log.Error("replay", "read trace: %v", err)
+				}
+				return
+			}
+			// records of single bus traces have no interface
+			if r.iface != "" && record.Interface != "" && record.Interface != r.iface {
+				continue
+			}
+			frame, err := record.Frame()
+			if err != nil {
+				log.Warn("replay", "skip: %v", err)
+				continue
+			}
+			if !r.filter.match(frame.ArbitrationID) {
+				continue
+			}
+
+			if r.speed > 0 {
+				if first.IsZero() {
+					first = record.Timestamp
+					started = time.Now()
+				}
+				due := started.Add(time.Duration(float64(record.Timestamp.Sub(first)) / r.speed))
+				if wait := time.Until(due); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-r.stop:
+						return
+					}
+				}
+			}
+
+			// a replay is not real time, block instead of dropping frames
+			select {
+			case rxCh <- frame:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+
+	return rxCh, nil
+}
+
+func (r *Replay) Disconnect() error {
+	if r.stop != nil {
+		r.once.Do(func() { close(r.stop) })
+	}
+	return nil
+}
+
+func (r *Replay) Send(message *can.Frame) error {
+	return ErrReadOnly
+}
+
+// filters are applied in software
+func (r *Replay) SetFilters(filters CanFilters) error {
+	return r.filter.SetFilters(filters)
+}
+
+// records all frames received from a bus
+type Recorder struct {
+	bus    CanBus
+	writer TraceWriter
+	iface  string
+	errors uint64
+	mutex  sync.Mutex
+}
+
+// iface is the interface name in the trace
+func NewRecorder(bus CanBus, writer TraceWriter, iface string) *Recorder {
+	return &Recorder{
+		bus:    bus,
+		writer: writer,
+		iface:  iface,
+	}
+}
+
+func (r *Recorder) Connect(wg *sync.WaitGroup) (<-chan *Frame, error) {
+	rx, err := r.bus.Connect(wg)
+	if err != nil {
+		return nil, err
+	}
+
+	rxCh := make(chan *Frame, CanbusBufferSize)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(rxCh)
+		defer func() {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			if err := r.writer.Close(); err != nil {
+				log.Error("recorder", "close trace: %v", err)
+			}
+		}()
+
+		for frame := range rx {
+			r.mutex.Lock()
+			err := r.writer.Write(NewTraceRecord(r.iface, frame))
+			if err != nil {
+				r.errors++
+				log.Error("recorder", "write trace: %v", err)
+			}
+			r.mutex.Unlock()
+
+			rxCh <- frame
+		}
+	}()
+
+	return rxCh, nil
+}
+
+// the trace writer is closed as soon as the bus stopped delivering frames
+func (r *Recorder) Disconnect() error {
+	return r.bus.Disconnect()
+}
+
+func (r *Recorder) Send(message *can.Frame) error {
+	return r.bus.Send(message)
+}
+
+func (r *Recorder) SetFilters(filters CanFilters) error {
+	if filterable, ok := r.bus.(FilterableBus); ok {
+		return filterable.SetFilters(filters)
+	}
+	return errors.New("recorded bus does not support filters")
+}
+
+// write errors since connect
+func (r *Recorder) Errors() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.errors
+}
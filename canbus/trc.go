@@ -0,0 +1,490 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// peak pcan-view trace (.trc). version 1.0/1.1 (single bus) and 2.x
+
+type TrcVersion string
+
+const (
+	TrcVersion11 TrcVersion = "1.1"
+	TrcVersion21 TrcVersion = "2.1"
+)
+
+// columns of version 2.0 files, 2.1 files declare them with $COLUMNS
+var trcDefaultColumns = []string{"N", "O", "T", "I", "d", "l", "D"}
+
+// $STARTTIME counts days since this date (ole automation date)
+var trcEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local)
+
+type TrcReader struct {
+	scanner *bufio.Scanner
+	closer  io.Closer
+	line    int
+	version TrcVersion
+	start   time.Time
+	columns []string
+}
+
+func NewTrcReader(r io.Reader) *TrcReader {
+	reader := &TrcReader{
+		scanner: bufio.NewScanner(r),
+		version: "1.0",
+		start:   time.Unix(0, 0),
+		columns: trcDefaultColumns,
+	}
+	if closer, ok := r.(io.Closer); ok {
+		reader.closer = closer
+	}
+	return reader
+}
+
+func OpenTrc(path string) (*TrcReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewTrcReader(file), nil
+}
+
+// replays a trc trace. only frames of iface (can<bus-1>) are replayed, an empty iface replays all.
+// version 1.x traces have no bus and are always replayed
+func NewTrcReplay(path string, iface string, speed float64) *Replay {
+	return NewReplay(func() (TraceReader, error) {
+		return OpenTrc(path)
+	}, iface, speed)
+}
+
+func (r *TrcReader) Next() (*TraceRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			err := r.parseHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("trc line %d: %v", r.line, err)
+			}
+			continue
+		}
+
+		var (
+			record *TraceRecord
+			err    error
+		)
+		if strings.HasPrefix(string(r.version), "1.") {
+			record, err = r.parseV1(strings.Fields(line))
+		} else {
+			record, err = r.parseV2(strings.Fields(line))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("trc line %d: %v", r.line, err)
+		}
+		if record == nil {
+			// status, events, ...
+			continue
+		}
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *TrcReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// ;$FILEVERSION=2.1, ;$STARTTIME=45352.6041666667, ;$COLUMNS=N,O,T,B,I,d,R,L,D
+func (r *TrcReader) parseHeader(line string) error {
+	key, value, found := strings.Cut(strings.TrimPrefix(line, ";$"), "=")
+	if !found || !strings.HasPrefix(line, ";$") {
+		// comment
+		return nil
+	}
+
+	switch key {
+	case "FILEVERSION":
+		r.version = TrcVersion(value)
+		switch r.version {
+		case "1.0", "1.1", "2.0", "2.1":
+		default:
+			return fmt.Errorf("trc version %s is not supported", value)
+		}
+	case "STARTTIME":
+		days, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("start time %q: %v", value, err)
+		}
+		r.start = trcTime(days)
+	case "COLUMNS":
+		r.columns = strings.Split(value, ",")
+		if r.columns[len(r.columns)-1] != "D" {
+			return errors.New("data must be the last column")
+		}
+	}
+	return nil
+}
+
+// N) O [T] I l D
+func (r *TrcReader) parseV1(fields []string) (*TraceRecord, error) {
+	if len(fields) < 4 || !strings.HasSuffix(fields[0], ")") {
+		return nil, errors.New("expected message number")
+	}
+	record := &TraceRecord{}
+	if err := r.parseOffset(record, fields[1]); err != nil {
+		return nil, err
+	}
+
+	fields = fields[2:]
+	switch fields[0] {
+	case "Rx", "Tx":
+		record.Tx = fields[0] == "Tx"
+		fields = fields[1:]
+	case "Error":
+		record.ArbitrationID = CanErrFlag
+		fields = fields[1:]
+	case "Warng":
+		return nil, nil
+	}
+	if len(fields) < 2 {
+		return nil, errors.New("missing id or dlc")
+	}
+
+	if !record.IsError() {
+		id, err := trcID(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		record.ArbitrationID = id
+	}
+	dlc, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil || dlc > 8 {
+		return nil, fmt.Errorf("dlc %q", fields[1])
+	}
+	record.DLC = uint8(dlc)
+
+	data := fields[2:]
+	if len(data) > 0 && data[0] == "RTR" {
+		record.ArbitrationID |= CanRtrFlag
+		return record, nil
+	}
+	record.Data, err = trcData(data, int(dlc))
+	return record, err
+}
+
+// columns as declared in the header
+func (r *TrcReader) parseV2(fields []string) (*TraceRecord, error) {
+	values := make(map[string]string, len(r.columns))
+	var data []string
+	for i, column := range r.columns {
+		if column == "D" {
+			if i < len(fields) {
+				data = fields[i:]
+			}
+			break
+		}
+		if i >= len(fields) {
+			return nil, fmt.Errorf("missing column %s", column)
+		}
+		values[column] = fields[i]
+	}
+
+	record := &TraceRecord{}
+	switch values["T"] {
+	case "DT":
+	case "FD":
+		record.FD = true
+	case "FB":
+		record.FD, record.BitRateSwitch = true, true
+	case "FE":
+		record.FD, record.ErrorStateIndicator = true, true
+	case "BI":
+		record.FD, record.BitRateSwitch, record.ErrorStateIndicator = true, true, true
+	case "RR":
+		record.ArbitrationID = CanRtrFlag
+	case "ER":
+		record.ArbitrationID = CanErrFlag
+	default:
+		// status, error counter, events
+		return nil, nil
+	}
+
+	if err := r.parseOffset(record, values["O"]); err != nil {
+		return nil, err
+	}
+	if bus, ok := values["B"]; ok {
+		channel, err := strconv.Atoi(bus)
+		if err != nil {
+			return nil, fmt.Errorf("bus %q", bus)
+		}
+		record.Interface = ChannelInterface(channel)
+	}
+	record.Tx = values["d"] == "Tx"
+
+	if !record.IsError() {
+		id, err := trcID(values["I"])
+		if err != nil {
+			return nil, err
+		}
+		record.ArbitrationID |= id
+	}
+
+	// L is the data length, l the dlc
+	length := 0
+	if l, ok := values["L"]; ok {
+		n, err := strconv.ParseUint(l, 10, 8)
+		if err != nil || n > 64 {
+			return nil, fmt.Errorf("data length %q", l)
+		}
+		length = int(n)
+	} else {
+		dlc, err := strconv.ParseUint(values["l"], 16, 8)
+		if err != nil || dlc > 15 {
+			return nil, fmt.Errorf("dlc %q", values["l"])
+		}
+		length = int(dlc)
+		if record.FD {
+			length = CanFdDlcToLen(uint8(dlc))
+		}
+	}
+
+	if record.IsRemote() {
+		record.DLC = uint8(length)
+		return record, nil
+	}
+	var err error
+	record.Data, err = trcData(data, length)
+	record.DLC = uint8(len(record.Data))
+	return record, err
+}
+
+// milliseconds since start
+func (r *TrcReader) parseOffset(record *TraceRecord, offset string) error {
+	ms, err := strconv.ParseFloat(offset, 64)
+	if err != nil {
+		return fmt.Errorf("time offset %q: %v", offset, err)
+	}
+	record.Timestamp = r.start.Add(time.Duration(math.Round(ms*1e3)) * time.Microsecond)
+	return nil
+}
+
+// 4 digits are standard, 8 digits extended ids
+func trcID(id string) (uint32, error) {
+	raw, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("arbitration id %q: %v", id, err)
+	}
+	if len(id) > 4 || raw > CanSffMask {
+		return uint32(raw)&CanEffMask | CanEffFlag, nil
+	}
+	return uint32(raw), nil
+}
+
+func trcData(fields []string, length int) ([]byte, error) {
+	if len(fields) < length {
+		return nil, fmt.Errorf("expected %d data bytes", length)
+	}
+	data, err := hex.DecodeString(strings.Join(fields[:length], ""))
+	if err != nil {
+		return nil, fmt.Errorf("data: %v", err)
+	}
+	return data, nil
+}
+
+// the start time has millisecond resolution in pcan-view
+func trcTime(days float64) time.Time {
+	whole := math.Floor(days)
+	fraction := time.Duration((days - whole) * float64(24*time.Hour))
+	return trcEpoch.AddDate(0, 0, int(whole)).Add(fraction).Round(time.Millisecond)
+}
+
+func trcDays(t time.Time) float64 {
+	t = t.In(time.Local)
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	// the epoch may have an odd local offset, count whole days
+	days := math.Round(midnight.Sub(trcEpoch).Hours() / 24)
+	return days + float64(t.Sub(midnight))/float64(24*time.Hour)
+}
+
+type TrcWriter struct {
+	writer   *bufio.Writer
+	closer   io.Closer
+	version  TrcVersion
+	start    time.Time
+	started  bool
+	number   int
+	channels map[string]int
+}
+
+// version 1.1 has no bus and can fd, use TrcVersion21 for these
+func NewTrcWriter(w io.Writer, version TrcVersion) *TrcWriter {
+	writer := &TrcWriter{
+		writer:   bufio.NewWriter(w),
+		version:  version,
+		channels: make(map[string]int),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	return writer
+}
+
+// creates a version 2.1 trace
+func CreateTrc(path string) (*TrcWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewTrcWriter(file, TrcVersion21), nil
+}
+
+// the header is written with the first record, which defines the measurement start
+func (w *TrcWriter) writeHeader(start time.Time) error {
+	w.start = start.Truncate(time.Millisecond)
+	w.started = true
+
+	header := fmt.Sprintf(";$FILEVERSION=%s\n;$STARTTIME=%.10f\n", w.version, trcDays(w.start))
+	if w.version == TrcVersion21 {
+		header += ";$COLUMNS=N,O,T,B,I,d,R,L,D\n"
+	}
+	header += ";\n" +
+		";   Start time: " + w.start.In(time.Local).Format("02.01.2006 15:04:05.000") + ".0\n" +
+		";   Generated by go-can-coder\n" +
+		";-------------------------------------------------------------------------------\n"
+	if w.version == TrcVersion21 {
+		header += ";   Message   Time    Type    ID     Rx/Tx\n" +
+			";   Number    Offset  |  Bus  [hex]  |  Reserved\n" +
+			";   |         [ms]    |  |    |      |  |  Data Length\n" +
+			";   |         |       |  |    |      |  |  |    Data [hex] ...\n" +
+			";   |         |       |  |    |      |  |  |    |\n" +
+			";---+-- ------+------ +- +- --+----- +- +- +--- +- -- -- -- -- -- -- --\n"
+	} else {
+		header += ";   Message Number\n" +
+			";   |         Time Offset (ms)\n" +
+			";   |         |        Type\n" +
+			";   |         |        |        ID (hex)\n" +
+			";   |         |        |        |     Data Length Code\n" +
+			";   |         |        |        |     |   Data Bytes (hex) ...\n" +
+			";   |         |        |        |     |   |\n" +
+			";---+--   ----+----  --+--  ----+---  +  -+ -- -- -- -- -- -- --\n"
+	}
+	_, err := w.writer.WriteString(header)
+	return err
+}
+
+func (w *TrcWriter) Write(record *TraceRecord) error {
+	if w.version != TrcVersion21 && record.FD {
+		return errors.New("trc 1.1 does not support can fd")
+	}
+	if !w.started {
+		if err := w.writeHeader(record.Timestamp); err != nil {
+			return err
+		}
+	}
+	w.number++
+
+	offset := float64(record.Timestamp.Sub(w.start)) / float64(time.Millisecond)
+	direction := "Rx"
+	if record.Tx {
+		direction = "Tx"
+	}
+	id := fmt.Sprintf("%04X", record.ID())
+	if record.IsExtended() {
+		id = fmt.Sprintf("%08X", record.ID())
+	}
+
+	var err error
+	if w.version != TrcVersion21 {
+		kind, dlc, data := direction, len(record.Data), ascData(record.Data)
+		switch {
+		case record.IsError():
+			kind, id = "Error", "-"
+		case record.IsRemote():
+			dlc, data = int(record.DLC), "RTR"
+		}
+		line := fmt.Sprintf("%6d)%12.1f  %-7s%8s  %d  %s", w.number, offset, kind, id, dlc, data)
+		_, err = w.writer.WriteString(strings.TrimRight(line, " ") + "\n")
+		return err
+	}
+
+	kind, length := "DT", len(record.Data)
+	switch {
+	case record.IsError():
+		kind, id = "ER", "-"
+	case record.IsRemote():
+		kind, length = "RR", int(record.DLC)
+	case record.FD && record.BitRateSwitch && record.ErrorStateIndicator:
+		kind = "BI"
+	case record.FD && record.BitRateSwitch:
+		kind = "FB"
+	case record.FD && record.ErrorStateIndicator:
+		kind = "FE"
+	case record.FD:
+		kind = "FD"
+	}
+	line := fmt.Sprintf("%7d %13.3f %s %-2d %8s %s - %-4d %s",
+		w.number, offset, kind, InterfaceChannel(record.Interface, w.channels), id, direction,
+		length, ascData(record.Data))
+	_, err = w.writer.WriteString(strings.TrimRight(line, " ") + "\n")
+	return err
+}
+
+func (w *TrcWriter) Close() error {
+	var err error
+	if !w.started {
+		err = w.writeHeader(time.Now())
+	}
+	if fErr := w.writer.Flush(); fErr != nil && err == nil {
+		err = fErr
+	}
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
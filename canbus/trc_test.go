@@ -0,0 +1,146 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readRecords(t *testing.T, reader TraceReader) []*TraceRecord {
+	records := []*TraceRecord{}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	_ = reader.Close()
+	return records
+}
+
+// writes the records, reads them back and compares them with the original ones.
+// returns the written trace
+func roundTrip(t *testing.T, records []*TraceRecord, create func(io.Writer) TraceWriter,
+	open func(io.Reader) TraceReader) string {
+
+	var out bytes.Buffer
+	writer := create(&out)
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := out.String()
+	written := readRecords(t, open(&out))
+	if len(written) != len(records) {
+		t.Fatalf("expected %d records, got %d:\n%s", len(records), len(written), trace)
+	}
+	for i := range records {
+		if !reflect.DeepEqual(records[i], written[i]) {
+			t.Errorf("record %d: expected %+v, got %+v", i, records[i], written[i])
+		}
+	}
+	return trace
+}
+
+func openTrc(r io.Reader) TraceReader {
+	return NewTrcReader(r)
+}
+
+func TestTrcV1(t *testing.T) {
+	reader, err := OpenTrc("testdata/pcan_v1_1.trc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readRecords(t, reader)
+	if len(records) != 5 {
+		t.Fatalf("expected 5 records, got %d", len(records))
+	}
+
+	start := time.Date(2024, 3, 1, 14, 30, 0, 120000000, time.Local)
+	if !records[0].Timestamp.Equal(start) || records[0].ID() != 0x108 || len(records[0].Data) != 8 {
+		t.Errorf("first record %+v", records[0])
+	}
+	if !records[1].IsExtended() || records[1].ID() != 0x18daf110 ||
+		!records[1].Timestamp.Equal(start.Add(10400*time.Microsecond)) {
+		t.Errorf("extended record %+v", records[1])
+	}
+	if !records[2].IsRemote() || records[2].DLC != 8 || !records[2].Tx {
+		t.Errorf("remote record %+v", records[2])
+	}
+	if !records[3].IsError() || len(records[3].Data) != 5 {
+		t.Errorf("error record %+v", records[3])
+	}
+
+	roundTrip(t, records, func(w io.Writer) TraceWriter {
+		return NewTrcWriter(w, TrcVersion11)
+	}, openTrc)
+}
+
+func TestTrcV2(t *testing.T) {
+	reader, err := OpenTrc("testdata/pcan_v2_1.trc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readRecords(t, reader)
+	if len(records) != 6 {
+		t.Fatalf("expected 6 records, got %d", len(records))
+	}
+
+	if records[0].Interface != "can0" || records[1].Interface != "can1" || !records[1].Tx {
+		t.Errorf("bus and direction: %+v %+v", records[0], records[1])
+	}
+	if !records[2].IsRemote() || records[2].DLC != 8 {
+		t.Errorf("remote record %+v", records[2])
+	}
+	if !records[3].FD || !records[3].BitRateSwitch || len(records[3].Data) != 12 {
+		t.Errorf("fd record %+v", records[3])
+	}
+	if !records[4].IsError() {
+		t.Errorf("error record %+v", records[4])
+	}
+
+	roundTrip(t, records, func(w io.Writer) TraceWriter {
+		return NewTrcWriter(w, TrcVersion21)
+	}, openTrc)
+
+	// fd frames do not fit into version 1.1
+	if err = NewTrcWriter(io.Discard, TrcVersion11).Write(records[3]); err == nil {
+		t.Error("expected an error for can fd in trc 1.1")
+	}
+}
@@ -0,0 +1,156 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package canbus
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func vectorRecords() []*TraceRecord {
+	start := time.Date(2024, 3, 1, 14, 30, 0, 123456000, time.Local)
+	return []*TraceRecord{
+		{Timestamp: start, Interface: "can0", ArbitrationID: 0x108, DLC: 3, Data: []byte{0x13, 0x0c, 0xf3}},
+		{Timestamp: start.Add(1500 * time.Microsecond), Interface: "can1", ArbitrationID: 0x18daf110 | CanEffFlag,
+			DLC: 2, Data: []byte{0x01, 0x02}, Tx: true},
+		{Timestamp: start.Add(2 * time.Millisecond), Interface: "can0", ArbitrationID: 0x500 | CanRtrFlag, DLC: 8},
+		{Timestamp: start.Add(3 * time.Millisecond), Interface: "can1", ArbitrationID: 0x123, DLC: 12,
+			Data: bytes.Repeat([]byte{0xde, 0xad, 0xbe}, 4), FD: true, BitRateSwitch: true},
+		{Timestamp: start.Add(4 * time.Millisecond), Interface: "can0", ArbitrationID: CanErrFlag},
+	}
+}
+
+func compareRecords(t *testing.T, reader TraceReader) {
+	expected := vectorRecords()
+	for i, exp := range expected {
+		record, err := reader.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if record.Interface != exp.Interface || record.ArbitrationID != exp.ArbitrationID ||
+			record.FD != exp.FD || record.BitRateSwitch != exp.BitRateSwitch || record.Tx != exp.Tx ||
+			!bytes.Equal(record.Data, exp.Data) {
+			t.Errorf("record %d: expected %+v, got %+v", i, exp, record)
+		}
+		if exp.IsRemote() && record.DLC != exp.DLC {
+			t.Errorf("record %d: remote dlc %d", i, record.DLC)
+		}
+		if !record.Timestamp.Equal(exp.Timestamp) {
+			t.Errorf("record %d: timestamp %v, expected %v", i, record.Timestamp, exp.Timestamp)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestAscRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	writer := NewAscWriter(&out)
+	for _, record := range vectorRecords() {
+		if err := writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	compareRecords(t, NewAscReader(&out))
+}
+
+func TestAscReadsVectorLines(t *testing.T) {
+	asc := `date Fri Mar 1 02:30:00.000 pm 2024
+base hex  timestamps absolute
+Begin Triggerblock Fri Mar 1 02:30:00.000 pm 2024
+   0.000000 Start of measurement
+   0.010000 1  108             Rx   d 2 AB CD  Length = 0 BitCount = 0 ID = 264
+   0.020000 2  18DAF110x       Tx   d 1 01
+   0.030000 CANFD   1 Rx        123  EngineData                       1 0 9 12 01 02 03 04 05 06 07 08 09 0A 0B 0C        0    0     3000        0        0        0        0        0
+   0.040000 1  Statistic: D 0 R 0 XD 0 XR 0 E 0 O 0 B 0.00%
+End TriggerBlock
+`
+	reader := NewAscReader(bytes.NewBufferString(asc))
+	ids := []uint32{0x108, 0x18daf110 | CanEffFlag, 0x123}
+	for _, id := range ids {
+		record, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.ArbitrationID != id {
+			t.Errorf("expected id %x, got %x", id, record.ArbitrationID)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestAscUppercasePm(t *testing.T) {
+	asc := `date Fri Mar 1 02:30:00.000 PM 2024
+base hex  timestamps absolute
+   0.010000 1  108             Rx   d 2 AB CD
+`
+	record, err := NewAscReader(bytes.NewBufferString(asc)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2024, 3, 1, 14, 30, 0, int(10*time.Millisecond), time.Local)
+	if !record.Timestamp.Equal(expected) {
+		t.Errorf("timestamp %v, expected %v", record.Timestamp, expected)
+	}
+
+	_, err = NewAscReader(bytes.NewBufferString("date 2024-03-01 14:30:00\n")).Next()
+	if err == nil {
+		t.Error("expected an error for an unknown date")
+	}
+}
+
+func TestBlfRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drive.blf")
+	writer, err := CreateBlf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range vectorRecords() {
+		if err = writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenBlf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	compareRecords(t, reader)
+}
@@ -33,6 +33,8 @@ var CancoderDefs []CancoderDef = []CancoderDef{
 type CancoderDef struct {
 	Name      string
 	Cancoders Cancoders
+	// named values of the signals, e.g. ENGINE_OFF
+	Constants map[string]float64
 }
 
 var OpelAstraHOpc2006 CancoderDef = CancoderDef{
@@ -51,4 +53,5 @@ var OpelAstraHOpc2006 CancoderDef = CancoderDef{
 		// Device: "can2",
 		// },
 	},
+	Constants: OpelAstraHOpc2006Constants,
 }
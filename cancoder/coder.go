@@ -26,15 +26,13 @@
 package cancoder
 
 import (
-	"encoding/hex"
 	"errors"
-	"fmt"
 	"go/token"
 	"go/types"
 	"strconv"
 	"strings"
-
-	log "github.com/ChrIgiSta/go-utils/logger"
+	"sync"
+	"time"
 
 	"github.com/ChrIgiSta/go-can-coder/utils"
 
@@ -44,29 +42,43 @@ import (
 
 const EventChannelBufferSize = 100
 
+// safe for concurrent use
 type Decoder struct {
+	mutex sync.Mutex
+
 	frameBuffer []can.Frame
 	valueMaps   []CanValueMap
+	timings     []signalTiming
+	virtuals    []*virtual
+	errorStats  []ErrorStat
 
-	eventChannels []chan<- CanValueMap
+	// time of the last frame and when it was decoded
+	clock     time.Time
+	clockWall time.Time
+
+	subscribers   []*subscriber
+	blocked       []blockedEvent
+	stateChannels []chan<- StateEvent
 }
 
 func NewCanCoder(valueMaps []CanValueMap) *Decoder {
-	return &Decoder{
+	d := &Decoder{
 		frameBuffer: []can.Frame{},
 
-		valueMaps: valueMaps,
+		// decoding writes the values, decoders of the same map must not share them
+		valueMaps:  append([]CanValueMap{}, valueMaps...),
+		timings:    make([]signalTiming, len(valueMaps)),
+		errorStats: make([]ErrorStat, len(valueMaps)),
 	}
+	d.parseVirtuals()
+	return d
 }
 
-func (d *Decoder) GetEventChannel() <-chan CanValueMap {
-	event := make(chan CanValueMap, EventChannelBufferSize)
-	d.eventChannels = append(d.eventChannels, event)
-
-	return event
-}
-
+// a copy of the last value of name
 func (d *Decoder) GetValue(name CanVars) *CanValueMap {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	for _, val := range d.valueMaps {
 		if val.CanValueDef.Name == name {
 			return &val
@@ -75,44 +87,77 @@ func (d *Decoder) GetValue(name CanVars) *CanValueMap {
 	return nil
 }
 
+// decodes a frame received now
 func (d *Decoder) Decoder(frame *can.Frame) (values []*CanValueMap, err error) {
+	return d.DecodeAt(frame, time.Now())
+}
+
+// decodes a frame received at timestamp into copies of the values. values of
+// other frames are checked for staleness at timestamp. failing definitions are
+// returned as DecodeErrors, the others decode the frame anyway
+func (d *Decoder) DecodeAt(frame *can.Frame, timestamp time.Time) (values []*CanValueMap, err error) {
+	defer d.deliverBlocked()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if timestamp.After(d.clock) {
+		d.clock, d.clockWall = timestamp, time.Now()
+	}
+	defer d.checkAt(timestamp)
 
+	var errs DecodeErrors
+	buffered := false
 	for i, mapping := range d.valueMaps {
 		if mapping.ArbitrationID == frame.ArbitrationID {
-			val, err := d.processFrame(&d.valueMaps[i], frame)
+			if !buffered {
+				d.bufferFrame(frame)
+				buffered = true
+			}
+			val, err := d.processFrame(i, frame, timestamp)
 			if err != nil {
-				return values, err
+				d.failed(i, err, timestamp)
+				errs = append(errs, err)
 			} else if val != nil {
-				values = append(values, val)
-				continue
+				value := *val
+				values = append(values, &value)
 			}
 		}
 	}
 
+	if len(d.virtuals) > 0 {
+		virtuals, virtualErrs := d.computeVirtuals(values, timestamp)
+		values = append(values, virtuals...)
+		errs = append(errs, virtualErrs...)
+	}
+
+	if len(errs) > 0 {
+		return values, errs
+	}
 	return values, nil
 }
 
-func (c *Decoder) Encode(value *CanValueMap) (frame *can.Frame, err error) {
-
-	frame = &can.Frame{
-		ArbitrationID: value.ArbitrationID,
+// encodes the value of a definition into the last frame seen for its id, so
+// other signals of the frame keep their values. raw commands (calculation of
+// ; separated hex bytes) are sent as they are
+func (d *Decoder) Encode(value *CanValueMap) (frame *can.Frame, err error) {
+	if value == nil {
+		return nil, errors.New("value <nil>")
+	}
+	if rawBytes.MatchString(value.CanValueDef.Calculation) {
+		return encodeRaw(value)
 	}
 
-	split := strings.Split(value.CanValueDef.Calculation, ";")
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-	for i, hVal := range split {
-		b, err := hex.DecodeString(hVal)
-		if err != nil {
-			return nil, err
-		}
-		if len(b) != 1 {
-			return nil, fmt.Errorf("unexpected len in calc to encode: %v", b)
-		}
-		frame.Data[i] = b[0]
-		frame.DLC = uint8(i + 1)
+	frame = &can.Frame{ArbitrationID: value.ArbitrationID}
+	if last := d.findFrameByArbitrationId(value.ArbitrationID); last != nil {
+		*frame = *last
 	}
-
-	return
+	if err = EncodeInto(frame, value); err != nil {
+		return nil, err
+	}
+	return frame, nil
 }
 
 func (d *Decoder) PushFrame(frame *can.Frame) error {
@@ -120,6 +165,12 @@ func (d *Decoder) PushFrame(frame *can.Frame) error {
 		return errors.New("frame <nil>")
 	}
 
+	_, err := d.Decoder(frame)
+	return err
+}
+
+// keeps the last frame of each id for encoding
+func (d *Decoder) bufferFrame(frame *can.Frame) {
 	found := d.findFrameByArbitrationId(frame.ArbitrationID)
 	if found != nil {
 		found.ArbitrationID = frame.ArbitrationID
@@ -128,9 +179,6 @@ func (d *Decoder) PushFrame(frame *can.Frame) error {
 	} else {
 		d.frameBuffer = append(d.frameBuffer, *frame)
 	}
-
-	_, err := d.Decoder(frame)
-	return err
 }
 
 func (d *Decoder) findFrameByArbitrationId(arbitrationID uint32) *can.Frame {
@@ -142,83 +190,79 @@ func (d *Decoder) findFrameByArbitrationId(arbitrationID uint32) *can.Frame {
 	return nil
 }
 
-func (d *Decoder) processFrame(mapping *CanValueMap, frame *can.Frame) (*CanValueMap, error) {
+func (d *Decoder) processFrame(i int, frame *can.Frame, timestamp time.Time) (*CanValueMap, *DecodeError) {
+	mapping := &d.valueMaps[i]
+	fail := func(expression string, err error) *DecodeError {
+		return &DecodeError{
+			ArbitrationID: mapping.ArbitrationID,
+			Name:          mapping.CanValueDef.Name,
+			Data:          append([]byte{}, frame.Data[0:frame.DLC]...),
+			Expression:    expression,
+			Err:           err,
+		}
+	}
+
 	condition, err := d.substituteVars(mapping.CanValueDef.Condition, frame)
 	if err != nil {
-		return nil, err
+		return nil, fail(mapping.CanValueDef.Condition, err)
 	}
 
 	fileSet := token.NewFileSet()
 	tav, err := types.Eval(fileSet, nil, token.NoPos, condition)
 	if err != nil {
-		return nil, err
+		return nil, fail(condition, err)
+	}
+	if tav.Value == nil {
+		return nil, fail(condition, errors.New("condition is not constant"))
+	}
+	if tav.Value.String() != "true" {
+		return nil, nil
 	}
-	if tav.Value.String() == "true" {
-		equation, err := d.substituteVars(mapping.CanValueDef.Calculation, frame)
-		if err != nil {
-			return nil, err
-		}
 
-		mapping.OriginalData = frame.Data[0:frame.DLC]
+	equation, err := d.substituteVars(mapping.CanValueDef.Calculation, frame)
+	if err != nil {
+		return nil, fail(mapping.CanValueDef.Calculation, err)
+	}
 
-		formatedString := false
-		splittedEquation := strings.Split(equation, ";")
-		if len(splittedEquation) != 1 {
-			formatedString = true
+	var value interface{}
+	splittedEquation := strings.Split(equation, ";")
+	if len(splittedEquation) == 1 {
+		expression, err := govaluate.NewEvaluableExpression(equation)
+		if err != nil {
+			return nil, fail(equation, err)
 		}
-		if !formatedString {
-			expression, err := govaluate.NewEvaluableExpression(equation)
+		value, err = expression.Evaluate(nil)
+		if err != nil {
+			return nil, fail(equation, err)
+		}
+	} else {
+		output := ""
+		for sIndx, split := range splittedEquation {
+			expression, err := govaluate.NewEvaluableExpression(split)
 			if err != nil {
-				return nil, err
+				return nil, fail(split, err)
 			}
 			result, err := expression.Evaluate(nil)
 			if err != nil {
-				return nil, err
-			}
-			mapping.CanValueDef.Value = result
-			if mapping.TriggerEvent {
-				d.processEvent(mapping)
+				return nil, fail(split, err)
 			}
-			return mapping, nil
-		} else {
-			output := ""
-			for sIndx, split := range splittedEquation {
-				expression, err := govaluate.NewEvaluableExpression(split)
-				if err != nil {
-					return nil, err
-				}
-				result, err := expression.Evaluate(nil)
-				if err != nil {
-					return nil, err
-				}
-				output += utils.InterfaceToString(result)
-				if len(mapping.CanValueDef.FormatSeperators) > sIndx {
-					output += mapping.CanValueDef.FormatSeperators[sIndx]
-				}
+			output += utils.InterfaceToString(result)
+			if len(mapping.CanValueDef.FormatSeperators) > sIndx {
+				output += mapping.CanValueDef.FormatSeperators[sIndx]
 			}
-			mapping.CanValueDef.Value = output
-			if mapping.TriggerEvent {
-				d.processEvent(mapping)
-			}
-			return mapping, nil
 		}
+		value = output
 	}
 
-	return nil, nil
-}
-
-func (d *Decoder) processEvent(canVal *CanValueMap) {
-	if canVal != nil {
-		for _, evtCh := range d.eventChannels {
-			select {
-			case evtCh <- *canVal:
-			default:
-				log.Warn("decoder", "event channel full. you need to process faster ;)")
-			}
-		}
-	} else {
-		log.Error("decoder", "event: value <nil>")
+	// replaced, never changed. copies of the value share it
+	mapping.OriginalData = append([]byte{}, frame.Data[0:frame.DLC]...)
+	mapping.Timestamp = timestamp
+	mapping.CanValueDef.Value = value
+	d.updated(i, timestamp)
+	if mapping.TriggerEvent {
+		d.processEvent(i)
 	}
+	return mapping, nil
 }
 
 func (d *Decoder) substituteVars(query string, frame *can.Frame) (string, error) {
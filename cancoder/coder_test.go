@@ -28,7 +28,11 @@ package cancoder
 import (
 	"github.com/ChrIgiSta/go-can-coder/utils"
 
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
@@ -135,6 +139,587 @@ func TestMidspeedDecoder(t *testing.T) {
 	// acData := []byte{0x23, 0xe0, 0x50, 0x00, 0x37, 0x20, 0x26, 0x02}
 }
 
+func TestDecodeAtTimestamp(t *testing.T) {
+	gmLan := NewCanCoder(OpelAstraHOpc2006GMLan)
+
+	received := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	values, err := gmLan.DecodeAt(&can.Frame{
+		ArbitrationID: uint32(GMLanBatteryVoltage),
+		DLC:           2,
+		Data:          [8]byte{0x00, 0x70},
+	}, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || !values[0].Timestamp.Equal(received) {
+		t.Errorf("value not stamped with frame time: %v", values)
+	}
+	if voltage := gmLan.GetValue(BatteryVoltage); !voltage.Timestamp.Equal(received) {
+		t.Errorf("stored value not stamped: %v", voltage.Timestamp)
+	}
+}
+
 func printCanValueInfos(t *testing.T, canValue *CanValueMap) {
 	t.Logf("%s is %v%s", canValue.CanValueDef.Name, canValue.CanValueDef.Value, canValue.CanValueDef.Unit)
 }
+
+func TestLinearCalculation(t *testing.T) {
+	linear := map[string][3]float64{ // bytes, factor, offset
+		"(${1}*256 + ${2})/4":                {2, 0.25, 0},
+		"${1}/2+10":                          {1, 0.5, 10},
+		"(${2}*65536 + ${3}*256 +${4}) / 64": {3, 1.0 / 64, 0},
+		"${3} - 40":                          {1, 1, -40},
+	}
+	for calculation, expected := range linear {
+		l, ok := CanValueDef{Calculation: calculation}.Linear()
+		if !ok {
+			t.Errorf("%s is linear", calculation)
+			continue
+		}
+		if len(l.Bytes) != int(expected[0]) || l.Factor != expected[1] || l.Offset != expected[2] {
+			t.Errorf("%s: %+v", calculation, l)
+		}
+	}
+
+	for _, calculation := range []string{"1", "${1} * ${2}", "${2}/25;${3}/25", "${1} * 256 + ${3} * 2"} {
+		if _, ok := (CanValueDef{Calculation: calculation}).Linear(); ok {
+			t.Errorf("%s is not linear", calculation)
+		}
+	}
+
+	l, _ := CanValueDef{Calculation: "(${1}*256 + ${2})/4"}.Linear()
+	raw, _ := l.Raw([]byte{0x13, 0x0c, 0xf3})
+	if raw != 0x0cf3 || l.Value(raw) != 828.75 {
+		t.Errorf("raw %x value %f", raw, l.Value(raw))
+	}
+}
+
+// decode(encode(v)) = v within the resolution for every invertible
+// definition of the opel maps
+func TestEncodeRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, coder := range OpelAstraHOpc2006.Cancoders {
+		for _, mapping := range coder.Map {
+			if mapping.CanValueDef.Name == "" {
+				continue
+			}
+			if err := mapping.Invertible(); err != nil {
+				if !errors.Is(err, ErrNotInvertible) {
+					t.Errorf("unexpected error %v", err)
+				}
+				value := mapping
+				value.CanValueDef.Value = 1.0
+				if _, err := NewCanCoder(coder.Map).Encode(&value); !errors.Is(err, ErrNotInvertible) {
+					t.Errorf("%s: expected not invertible, got %v", mapping.CanValueDef.Name, err)
+				}
+				continue
+			}
+
+			values := []float64{}
+			resolution := 1e-9
+			if linear, ok := mapping.CanValueDef.Linear(); ok {
+				low, high := linear.Limits()
+				values = append(values, low, high)
+				for i := 0; i < 50; i++ {
+					values = append(values, low+random.Float64()*(high-low))
+				}
+				resolution += math.Abs(linear.Factor) / 2
+			} else {
+				constant, _ := evaluate(mapping.CanValueDef.Calculation, [8]byte{})
+				values = append(values, constant)
+			}
+
+			for _, v := range values {
+				decoder := NewCanCoder(coder.Map)
+				value := mapping
+				value.CanValueDef.Value = v
+				frame, err := decoder.Encode(&value)
+				if err != nil {
+					t.Errorf("%s %v: %v", mapping.CanValueDef.Name, v, err)
+					continue
+				}
+				decoded, err := decoder.DecodeAt(frame, time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := false
+				for _, d := range decoded {
+					if d.CanValueDef.Name == mapping.CanValueDef.Name && d.CanValueDef.Calculation == mapping.CanValueDef.Calculation {
+						found = true
+						if got, _ := toFloat(d.CanValueDef.Value); math.Abs(got-v) > resolution {
+							t.Errorf("%s: encoded %v, decoded %v", mapping.CanValueDef.Name, v, got)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("%s %v: not decoded from % x", mapping.CanValueDef.Name, v, frame.Data)
+				}
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	gmLan := NewCanCoder(OpelAstraHOpc2006GMLan)
+	_, err := gmLan.DecodeAt(&can.Frame{ArbitrationID: uint32(GMLanEngineSpeedRPM), DLC: 8,
+		Data: [8]uint8{0x13, 0x0c, 0xf3, 0x00, 0x04, 0xe5, 0x00, 0x00}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the other signals of the last frame are kept
+	speed := *gmLan.GetValue(VehicleSpeed)
+	speed.CanValueDef.Value = 100
+	frame, err := gmLan.Encode(&speed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.DLC != 8 || frame.Data != [8]uint8{0x13, 0x0c, 0xf3, 0x00, 0x32, 0x00, 0x00, 0x00} {
+		t.Errorf("unexpected frame % x", frame.Data)
+	}
+
+	speed.CanValueDef.Value = 1000
+	if _, err = gmLan.Encode(&speed); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected out of range, got %v", err)
+	}
+
+	// raw commands
+	frame, err = gmLan.Encode(&CanValueMap{ArbitrationID: uint32(GMLanRemoteKey), CanValueDef: CanValueDef{Calculation: "02;80;70;d6"}})
+	if err != nil || frame.DLC != 4 || frame.Data[1] != DOOR_LOCK_LOCK {
+		t.Errorf("unexpected raw frame %v %v", frame, err)
+	}
+	raw := &CanValueMap{ArbitrationID: uint32(GMLanRemoteKey), CanValueDef: CanValueDef{Calculation: "01;02;03;04;05;06;07;08;09"}}
+	if _, err = gmLan.Encode(raw); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected out of range for 9 raw bytes, got %v", err)
+	}
+
+	if len(gmLan.NonInvertible()) == 0 {
+		t.Error("expected the tpms to be not invertible")
+	}
+}
+
+func TestStaleness(t *testing.T) {
+	const cycle = 100 * time.Millisecond
+
+	maps := []CanValueMap{
+		{
+			ArbitrationID: 0x100,
+			CycleTime:     cycle,
+			CanValueDef:   CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: "fixed"},
+		},
+		{
+			ArbitrationID: 0x100,
+			CanValueDef:   CanValueDef{Calculation: "${1}", Condition: "1 == 1", Name: "learned"},
+		},
+		{
+			ArbitrationID: 0x100,
+			CycleTime:     OnChange,
+			CanValueDef:   CanValueDef{Calculation: "${2}", Condition: "1 == 1", Name: "key"},
+		},
+	}
+	decoder := NewCanCoder(maps)
+	states := decoder.GetStateChannel()
+
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	frame := can.Frame{ArbitrationID: 0x100, DLC: 3}
+	for i := 0; i <= LearnIntervals; i++ {
+		if _, err := decoder.DecodeAt(&frame, start.Add(time.Duration(i)*cycle)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := start.Add(LearnIntervals * cycle)
+
+	kinds := func(events []StateEvent) (names []string) {
+		for _, event := range events {
+			names = append(names, fmt.Sprintf("%s %s", event.Kind, event.Value.CanValueDef.Name))
+		}
+		return names
+	}
+
+	if events := decoder.CheckAt(last.Add(2 * cycle)); len(events) != 0 {
+		t.Errorf("events within %d cycles: %v", StaleCycles, kinds(events))
+	}
+	events := decoder.CheckAt(last.Add(4 * cycle))
+	if fmt.Sprint(kinds(events)) != "[stale fixed stale learned]" {
+		t.Errorf("stale events %v", kinds(events))
+	}
+	if decoder.GetValue("fixed").State != StateStale || decoder.GetValue("key").State != StateValid {
+		t.Errorf("states %v %v", decoder.GetValue("fixed").State, decoder.GetValue("key").State)
+	}
+	events = decoder.CheckAt(last.Add(11 * cycle))
+	if fmt.Sprint(kinds(events)) != "[timeout fixed timeout learned]" {
+		t.Errorf("timeout events %v", kinds(events))
+	}
+	if events = decoder.CheckAt(last.Add(time.Hour)); len(events) != 0 {
+		t.Errorf("repeated events %v", kinds(events))
+	}
+	if decoder.GetValue("learned").State != StateTimeout {
+		t.Errorf("learned %v", decoder.GetValue("learned").State)
+	}
+
+	// the gap is not learned
+	if _, err := decoder.DecodeAt(&frame, last.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if decoder.GetValue("learned").State != StateValid {
+		t.Errorf("not recovered: %v", decoder.GetValue("learned").State)
+	}
+	if cycle := decoder.cycleTime(1); cycle != 100*time.Millisecond {
+		t.Errorf("learned cycle %v", cycle)
+	}
+
+	received := []StateEvent{}
+	for len(states) > 0 {
+		received = append(received, <-states)
+	}
+	if fmt.Sprint(kinds(received)) != "[stale fixed stale learned timeout fixed timeout learned recovered fixed recovered learned]" {
+		t.Errorf("state channel %v", kinds(received))
+	}
+	if !received[0].LastSeen.Equal(last) || received[0].CycleTime != cycle {
+		t.Errorf("last seen %v, cycle %v", received[0].LastSeen, received[0].CycleTime)
+	}
+}
+
+func TestEventPolicy(t *testing.T) {
+	maps := []CanValueMap{
+		{
+			ArbitrationID: 0x100,
+			CanValueDef: CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: "deadband",
+				Events: EventPolicy{Deadband: 2, Heartbeat: time.Second}},
+			TriggerEvent: true,
+		},
+		{
+			ArbitrationID: 0x100,
+			CanValueDef: CanValueDef{Calculation: "${1}", Condition: "1 == 1", Name: "limited",
+				Events: EventPolicy{OnChange: true, MaxRate: 2}},
+			TriggerEvent: true,
+		},
+		{
+			ArbitrationID: 0x100,
+			CanValueDef: CanValueDef{Calculation: "${2}", Condition: "1 == 1", Name: "percent",
+				Events: EventPolicy{DeadbandPercent: 10}},
+			TriggerEvent: true,
+		},
+	}
+	decoder := NewCanCoder(maps)
+	events := decoder.GetEventChannel()
+	every := decoder.GetEventChannelWithPolicy(EventPolicy{})
+
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	frames := [][3]byte{
+		{10, 1, 100},
+		{11, 1, 105}, // within the deadbands, unchanged
+		{13, 2, 111}, // limited is held back
+		{13, 3, 111}, // the held value is replaced
+		{13, 3, 111},
+		{13, 3, 99}, // beyond 10% of 111
+	}
+	for i, data := range frames {
+		frame := can.Frame{ArbitrationID: 0x100, DLC: 3, Data: [8]byte{data[0], data[1], data[2]}}
+		if _, err := decoder.DecodeAt(&frame, start.Add(time.Duration(i)*200*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the heartbeat of the unchanged deadband value
+	frame := can.Frame{ArbitrationID: 0x100, DLC: 3, Data: [8]byte{13, 3, 100}}
+	if _, err := decoder.DecodeAt(&frame, start.Add(1400*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	received := func(events <-chan CanValueMap) (values []string) {
+		for len(events) > 0 {
+			event := <-events
+			values = append(values, fmt.Sprintf("%s=%v@%d", event.CanValueDef.Name, event.CanValueDef.Value,
+				event.Timestamp.Sub(start).Milliseconds()))
+		}
+		return values
+	}
+	expected := "[deadband=10@0 limited=1@0 percent=100@0 deadband=13@400 percent=111@400 " +
+		"limited=3@600 percent=99@1000 deadband=13@1400]"
+	if values := received(events); fmt.Sprint(values) != expected {
+		t.Errorf("events %v\nexpected %s", values, expected)
+	}
+	if values := received(every); len(values) != 3*len(frames)+3 {
+		t.Errorf("%d events without policy: %v", len(values), values)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	maps := []CanValueMap{}
+	for i, name := range []CanVars{"Speed", "Display Row 1", "Display Row 2", "Milage"} {
+		maps = append(maps, CanValueMap{
+			ArbitrationID: uint32(0x100 + i/2),
+			CanValueDef:   CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: name},
+			TriggerEvent:  true,
+		})
+	}
+	decoder := NewCanCoder(maps)
+
+	if _, _, err := decoder.Subscribe(Subscription{Patterns: []string{"Display["}}); err == nil {
+		t.Error("bad pattern accepted")
+	}
+	filtered, unsubscribe, err := decoder.Subscribe(Subscription{
+		Names:    []CanVars{"Speed"},
+		Patterns: []string{"Display Row *"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID, _, _ := decoder.Subscribe(Subscription{IDs: []uint32{0x101}, BufferSize: 2, Overflow: DropOldest})
+	blocking, _, _ := decoder.Subscribe(Subscription{BufferSize: 1, Overflow: Block, BlockTimeout: time.Millisecond})
+
+	decode := func(id uint32, value byte) {
+		frame := can.Frame{ArbitrationID: id, DLC: 1, Data: [8]byte{value}}
+		if _, err := decoder.DecodeAt(&frame, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decode(0x100, 1)
+	decode(0x101, 2)
+	decode(0x101, 3)
+
+	received := func(events <-chan CanValueMap) (values []string) {
+		for len(events) > 0 {
+			event := <-events
+			values = append(values, fmt.Sprintf("%s=%v", event.CanValueDef.Name, event.CanValueDef.Value))
+		}
+		return values
+	}
+	if values := fmt.Sprint(received(filtered)); values != "[Speed=1 Display Row 1=1 Display Row 2=2 Display Row 2=3]" {
+		t.Errorf("filtered %s", values)
+	}
+	if values := fmt.Sprint(received(byID)); values != "[Display Row 2=3 Milage=3]" {
+		t.Errorf("drop oldest %s", values)
+	}
+	if values := fmt.Sprint(received(blocking)); values != "[Speed=1]" {
+		t.Errorf("block %s", values)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	decode(0x100, 4)
+	if _, ok := <-filtered; ok {
+		t.Error("event after unsubscribe")
+	}
+	if len(decoder.subscribers) != 2 {
+		t.Errorf("%d subscribers", len(decoder.subscribers))
+	}
+
+	// a blocked subscriber does not lock the decoder
+	slow, _, _ := decoder.Subscribe(Subscription{Names: []CanVars{"Milage"}, BufferSize: 1, Overflow: Block, BlockTimeout: time.Second})
+	decode(0x101, 5)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		frame := can.Frame{ArbitrationID: 0x101, DLC: 1, Data: [8]byte{6}}
+		_, _ = decoder.DecodeAt(&frame, time.Now())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	locked := time.Now()
+	decoder.GetValue("Milage")
+	if waited := time.Since(locked); waited > 100*time.Millisecond {
+		t.Errorf("the decoder was locked for %v", waited)
+	}
+	if values := fmt.Sprint((<-slow).CanValueDef.Value, (<-slow).CanValueDef.Value); values != "5 6" {
+		t.Errorf("block %s", values)
+	}
+	<-done
+}
+
+// run with -race
+func TestConcurrentDecoder(t *testing.T) {
+	const frameCount = 500
+
+	decoder := NewCanCoder(OpelAstraHOpc2006GMLan)
+	start := time.Now()
+	frames := []can.Frame{
+		{ArbitrationID: uint32(GMLanEngineSpeedRPM), DLC: 8, Data: [8]byte{0x13, 0x0c, 0xf3, 0x00, 0x04, 0xe5}},
+		{ArbitrationID: uint32(GMLanMilage), DLC: 7, Data: [8]byte{0x00, 0x00, 0x98, 0x92, 0xc0, 0x00, 0x21}},
+		{ArbitrationID: uint32(GMLanDoorState), DLC: 4, Data: [8]byte{0x00, 0x40, 0x00, 0x00}},
+	}
+
+	var (
+		producers sync.WaitGroup
+		readers   sync.WaitGroup
+		stop      = make(chan struct{})
+	)
+	for p := 0; p < 4; p++ {
+		producers.Add(1)
+		go func(p int) {
+			defer producers.Done()
+			for i := 0; i < frameCount; i++ {
+				frame := frames[(p+i)%len(frames)]
+				frame.Data[2] = byte(i)
+				if _, err := decoder.DecodeAt(&frame, start.Add(time.Duration(i)*time.Millisecond)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	reader := func(read func()) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					read()
+				}
+			}
+		}()
+	}
+	reader(func() {
+		if value := decoder.GetValue(EngineSpeedRPM); value != nil {
+			value.CanValueDef.Value = -1.0
+			value.OriginalData = nil
+		}
+	})
+	reader(func() { decoder.Check() })
+	reader(func() {
+		if value := decoder.GetValue(EngineSpeedRPM); value != nil && value.CanValueDef.Value != nil {
+			value.CanValueDef.Value = 800.0
+			if _, err := decoder.Encode(value); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	reader(func() {
+		events, unsubscribe, err := decoder.Subscribe(Subscription{Names: []CanVars{EngineSpeedRPM}, Overflow: DropOldest})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for i := 0; i < 10 && len(events) > 0; i++ {
+			<-events
+		}
+		unsubscribe()
+	})
+
+	producers.Wait()
+	close(stop)
+	readers.Wait()
+
+	value := decoder.GetValue(EngineSpeedRPM)
+	if value == nil || value.CanValueDef.Value == -1.0 || len(value.OriginalData) != 8 {
+		t.Errorf("snapshot changed the decoder: %+v", value)
+	}
+	if global := OpelAstraHOpc2006GMLan[3]; global.CanValueDef.Value != nil || global.State != StateUnknown {
+		t.Errorf("decoding changed the definitions: %+v", global)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	maps := []CanValueMap{
+		{ArbitrationID: 0x100, CanValueDef: CanValueDef{Calculation: "${0} +", Condition: "1 == 1", Name: "calculation"}},
+		{ArbitrationID: 0x100, CanValueDef: CanValueDef{Calculation: "${0}", Condition: "${1} ==", Name: "condition"}},
+		{ArbitrationID: 0x100, CanValueDef: CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: "good"}},
+	}
+	decoder := NewCanCoder(maps)
+
+	frame := can.Frame{ArbitrationID: 0x100, DLC: 2, Data: [8]byte{0x12, 0x34}}
+	for i := 0; i < 2; i++ {
+		values, err := decoder.Decoder(&frame)
+		if len(values) != 1 || values[0].CanValueDef.Value != 18.0 {
+			t.Errorf("values %v", values)
+		}
+		var errs DecodeErrors
+		if !errors.As(err, &errs) || len(errs) != 2 {
+			t.Fatalf("errors %v", err)
+		}
+		if errs[0].Name != "calculation" || errs[0].Expression != "18 +" || errs[0].ArbitrationID != 0x100 ||
+			fmt.Sprintf("% x", errs[0].Data) != "12 34" || errs[0].Err == nil {
+			t.Errorf("calculation error %+v", errs[0])
+		}
+		if errs[1].Name != "condition" || errs[1].Expression != "52 ==" {
+			t.Errorf("condition error %+v", errs[1])
+		}
+	}
+
+	stats := decoder.ErrorStats()
+	if len(stats) != 2 || stats[0].Count != 2 || stats[1].Name != "condition" || stats[1].Last == nil {
+		t.Errorf("stats %+v", stats)
+	}
+
+	errorLog := NewErrorLog("test", time.Hour)
+	_, err := decoder.Decoder(&frame)
+	errorLog.Log(err)
+	errorLog.Log(err)
+	if logged := errorLog.logged[errorKey{id: 0x100, name: "calculation"}]; logged == nil || logged.suppressed != 1 {
+		t.Errorf("logged %+v", logged)
+	}
+}
+
+func TestVirtual(t *testing.T) {
+	virtual := func(name CanVars, calculation string, condition string) CanValueMap {
+		return CanValueMap{
+			ArbitrationID: VirtualID,
+			CanValueDef:   CanValueDef{Calculation: calculation, Condition: condition, Name: name},
+			TriggerEvent:  true,
+		}
+	}
+	maps := []CanValueMap{
+		{ArbitrationID: 0x100, CanValueDef: CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: "Counter"}},
+		{ArbitrationID: 0x101, CanValueDef: CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: "Speed"}},
+		virtual("Sum", "[Counter] + [Speed]", ""),
+		virtual("Rate", "derivative([Counter], 0, 256)", ""),
+		virtual("Window Rate", "derivative([Counter], 2, 256)", ""),
+		virtual("Integral", "integral([Speed])", ""),
+		virtual("Average", "average([Speed], 2)", ""),
+		virtual("Moving", "[Sum] * 2", "[Speed] > 0x10"),
+		virtual("Broken", "[Unknown] * 2", ""),
+	}
+	decoder := NewCanCoder(maps)
+	events, _, err := decoder.Subscribe(Subscription{Names: []CanVars{"Moving"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	decode := func(second float64, id uint32, value byte) (values map[CanVars]interface{}) {
+		frame := can.Frame{ArbitrationID: id, DLC: 1, Data: [8]byte{value}}
+		decoded, err := decoder.DecodeAt(&frame, start.Add(time.Duration(second*float64(time.Second))))
+		var errs DecodeErrors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Name != "Broken" {
+			t.Errorf("errors %v", err)
+		}
+		values = make(map[CanVars]interface{})
+		for _, value := range decoded {
+			values[value.CanValueDef.Name] = value.CanValueDef.Value
+		}
+		return values
+	}
+
+	// the counter wraps from 250 to 4
+	if values := decode(0, 0x100, 250); len(values) != 1 {
+		t.Errorf("without speed %v", values)
+	}
+	if values := decode(0, 0x101, 10); values["Sum"] != 260.0 || values["Integral"] != 0.0 || values["Moving"] != nil {
+		t.Errorf("first speed %v", values)
+	}
+	if values := decode(1, 0x100, 254); values["Rate"] != 4.0 || values["Sum"] != 264.0 {
+		t.Errorf("counter %v", values)
+	}
+	if values := decode(2, 0x100, 4); values["Rate"] != 6.0 || values["Window Rate"] != 5.0 {
+		t.Errorf("wrapped counter %v", values)
+	}
+	if values := decode(2, 0x101, 30); values["Integral"] != 40.0 || values["Average"] != 20.0 || values["Moving"] != 68.0 {
+		t.Errorf("speed %v", values)
+	}
+	if values := decode(5, 0x101, 30); values["Average"] != 30.0 {
+		t.Errorf("average window %v", values)
+	}
+
+	if event := <-events; event.CanValueDef.Value != 68.0 || !event.IsVirtual() {
+		t.Errorf("event %+v", event)
+	}
+	if value := decoder.GetValue("Sum"); value == nil || value.CanValueDef.Value != 34.0 {
+		t.Errorf("sum %+v", value)
+	}
+	if stats := decoder.ErrorStats(); len(stats) != 1 || stats[0].Count != 6 {
+		t.Errorf("error stats %+v", stats)
+	}
+}
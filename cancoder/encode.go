@@ -0,0 +1,243 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/angelodlfrtr/go-can"
+)
+
+var (
+	ErrNotInvertible = errors.New("not invertible")
+	ErrOutOfRange    = errors.New("out of range")
+)
+
+var (
+	conditionByte     = regexp.MustCompile(`^\$\{([0-7])\}\s*==\s*(\S+)$`)
+	conditionConstant = regexp.MustCompile(`^(\S+)\s*==\s*(\S+)$`)
+	rawBytes          = regexp.MustCompile(`^[0-9a-fA-F]{2}(;[0-9a-fA-F]{2})*$`)
+)
+
+// a value, which cannot be encoded
+type EncodeError struct {
+	ArbitrationID uint32
+	Name          CanVars
+	Err           error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("encode 0x%03x %s: %v", e.ArbitrationID, e.Name, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// the bytes required by a condition of the form "${0} == 0x46 && ${1} == 0".
+// other conditions are not invertible
+func (def CanValueDef) ConditionBytes() (map[int]byte, error) {
+	bytes := map[int]byte{}
+	for _, part := range strings.Split(def.Condition, "&&") {
+		part = strings.TrimSpace(part)
+		if match := conditionByte.FindStringSubmatch(part); match != nil {
+			i, _ := strconv.Atoi(match[1])
+			value, err := strconv.ParseUint(match[2], 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%w: condition %q: %v", ErrNotInvertible, def.Condition, err)
+			}
+			bytes[i] = byte(value)
+			continue
+		}
+		// always true, e.g. "1 == 1"
+		if match := conditionConstant.FindStringSubmatch(part); match != nil && match[1] == match[2] &&
+			!byteVariable.MatchString(part) {
+			continue
+		}
+		return nil, fmt.Errorf("%w: condition %q is no conjunction of byte values", ErrNotInvertible, def.Condition)
+	}
+	return bytes, nil
+}
+
+// nil, if values of the definition can be encoded: the calculation is linear
+// or constant and the condition requires fixed bytes, which the value does
+// not use
+func (m CanValueMap) Invertible() error {
+	_, _, err := m.inverse()
+	if err != nil {
+		return &EncodeError{ArbitrationID: m.ArbitrationID, Name: m.CanValueDef.Name, Err: err}
+	}
+	return nil
+}
+
+// the linear calculation (nil for constant ones) and the condition bytes
+func (m CanValueMap) inverse() (*LinearCalculation, map[int]byte, error) {
+	if m.IsVirtual() {
+		return nil, nil, fmt.Errorf("%w: virtual signal", ErrNotInvertible)
+	}
+	def := m.CanValueDef
+	conditions, err := def.ConditionBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !byteVariable.MatchString(def.Calculation) {
+		if _, err := evaluate(def.Calculation, [8]byte{}); err != nil {
+			return nil, nil, fmt.Errorf("%w: calculation %q is no number", ErrNotInvertible, def.Calculation)
+		}
+		return nil, conditions, nil
+	}
+	linear, ok := def.Linear()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: calculation %q is not linear", ErrNotInvertible, def.Calculation)
+	}
+	for _, i := range linear.Bytes {
+		if _, ok := conditions[i]; ok {
+			return nil, nil, fmt.Errorf("%w: byte %d is used by the calculation and the condition", ErrNotInvertible, i)
+		}
+	}
+	return linear, conditions, nil
+}
+
+// the definitions, which cannot be encoded
+func (d *Decoder) NonInvertible() []error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	errs := []error{}
+	for _, mapping := range d.valueMaps {
+		if err := mapping.Invertible(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// the range of values the raw integer can hold
+func (l *LinearCalculation) Limits() (float64, float64) {
+	a, b := l.Value(0), l.Value(uint64(math.Pow(2, float64(l.BitCount()))-1))
+	return math.Min(a, b), math.Max(a, b)
+}
+
+// writes the value of the definition and the bytes required by its
+// condition into frame. other bytes are kept
+func EncodeInto(frame *can.Frame, value *CanValueMap) error {
+	fail := func(err error) error {
+		return &EncodeError{ArbitrationID: value.ArbitrationID, Name: value.CanValueDef.Name, Err: err}
+	}
+	linear, conditions, err := value.inverse()
+	if err != nil {
+		return fail(err)
+	}
+	number, ok := toFloat(value.CanValueDef.Value)
+	if !ok {
+		return fail(fmt.Errorf("value %v is no number", value.CanValueDef.Value))
+	}
+
+	length := int(frame.DLC)
+	set := func(i int, b byte) {
+		frame.Data[i] = b
+		if i+1 > length {
+			length = i + 1
+		}
+	}
+	if linear == nil {
+		constant, _ := evaluate(value.CanValueDef.Calculation, [8]byte{})
+		if !approximately(number, constant) {
+			return fail(fmt.Errorf("%w: the value is always %v", ErrOutOfRange, constant))
+		}
+	} else {
+		raw := math.Round((number - linear.Offset) / linear.Factor)
+		if raw < 0 || raw > math.Pow(2, float64(linear.BitCount()))-1 {
+			low, high := linear.Limits()
+			return fail(fmt.Errorf("%w: %v not in %v..%v", ErrOutOfRange, number, low, high))
+		}
+		u := uint64(raw)
+		for n := len(linear.Bytes) - 1; n >= 0; n-- {
+			set(linear.Bytes[n], byte(u))
+			u >>= 8
+		}
+	}
+	for i, b := range conditions {
+		set(i, b)
+	}
+	frame.ArbitrationID = value.ArbitrationID
+	frame.DLC = uint8(length)
+	return nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// raw commands: calculations of ; separated hex bytes, e.g. "02;80;70;d6"
+func encodeRaw(value *CanValueMap) (*can.Frame, error) {
+	frame := &can.Frame{ArbitrationID: value.ArbitrationID}
+	raw := strings.Split(value.CanValueDef.Calculation, ";")
+	if len(raw) > len(frame.Data) {
+		return nil, &EncodeError{ArbitrationID: value.ArbitrationID, Name: value.CanValueDef.Name,
+			Err: fmt.Errorf("%w: %d bytes, a frame has %d", ErrOutOfRange, len(raw), len(frame.Data))}
+	}
+	for i, hVal := range raw {
+		b, err := hex.DecodeString(hVal)
+		if err != nil {
+			return nil, err
+		}
+		frame.Data[i] = b[0]
+		frame.DLC = uint8(i + 1)
+	}
+	return frame, nil
+}
@@ -0,0 +1,172 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// default interval of an ErrorLog
+const ErrorLogInterval = 10 * time.Second
+
+// a definition, which failed to decode a frame
+type DecodeError struct {
+	ArbitrationID uint32
+	Name          CanVars
+	Data          []byte
+	Expression    string // condition or calculation with the bytes of the frame
+	Err           error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode 0x%03x %s [% x] %q: %v", e.ArbitrationID, e.Name, e.Data, e.Expression, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// the definitions, which failed on a frame. the others decoded it
+type DecodeErrors []*DecodeError
+
+func (e DecodeErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	if len(e) == 1 {
+		return messages[0]
+	}
+	return fmt.Sprintf("%d definitions failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+func (e DecodeErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// the failures of a definition
+type ErrorStat struct {
+	ArbitrationID uint32
+	Name          CanVars
+	Count         uint64
+	Last          *DecodeError
+	LastTime      time.Time // of the frame
+}
+
+// definitions with failures, in the order of the map
+func (d *Decoder) ErrorStats() []ErrorStat {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats := []ErrorStat{}
+	for _, stat := range d.errorStats {
+		if stat.Count > 0 {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+func (d *Decoder) failed(i int, err *DecodeError, timestamp time.Time) {
+	stat := &d.errorStats[i]
+	stat.ArbitrationID, stat.Name = err.ArbitrationID, err.Name
+	stat.Count++
+	stat.Last, stat.LastTime = err, timestamp
+}
+
+// logs decode errors at most once per interval and definition, with the
+// number of the suppressed ones. safe for concurrent use
+type ErrorLog struct {
+	module   string
+	interval time.Duration
+	logged   map[errorKey]*loggedError
+	mutex    sync.Mutex
+}
+
+type errorKey struct {
+	id   uint32
+	name CanVars
+}
+
+type loggedError struct {
+	at         time.Time
+	suppressed uint64
+}
+
+// interval 0 is ErrorLogInterval
+func NewErrorLog(module string, interval time.Duration) *ErrorLog {
+	if interval <= 0 {
+		interval = ErrorLogInterval
+	}
+	return &ErrorLog{
+		module:   module,
+		interval: interval,
+		logged:   make(map[errorKey]*loggedError),
+	}
+}
+
+// logs the DecodeErrors in err separately, other errors as they are
+func (l *ErrorLog) Log(err error) {
+	var decodeErrors DecodeErrors
+	if !errors.As(err, &decodeErrors) {
+		if err != nil {
+			log.Warn(l.module, "%v", err)
+		}
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	for _, err := range decodeErrors {
+		key := errorKey{id: err.ArbitrationID, name: err.Name}
+		logged, ok := l.logged[key]
+		if !ok {
+			logged = &loggedError{}
+			l.logged[key] = logged
+		} else if now.Sub(logged.at) < l.interval {
+			logged.suppressed++
+			continue
+		}
+		if logged.suppressed > 0 {
+			log.Warn(l.module, "%v (%d more since %s)", err, logged.suppressed, logged.at.Format("15:04:05"))
+		} else {
+			log.Warn(l.module, "%v", err)
+		}
+		logged.at, logged.suppressed = now, 0
+	}
+}
@@ -0,0 +1,162 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/angelodlfrtr/go-can"
+)
+
+// a calculation of the form Factor * raw + Offset, where raw is the unsigned
+// big endian integer of the frame bytes Bytes (most significant first)
+type LinearCalculation struct {
+	Bytes  []int
+	Factor float64
+	Offset float64
+}
+
+var byteVariable = regexp.MustCompile(`\$\{([0-7])\}`)
+
+// data used to prove, that a calculation is linear
+var linearProbes = [][8]byte{
+	{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	{0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55},
+	{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa},
+	{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0},
+	{0x80, 0x01, 0x7f, 0xfe, 0x40, 0x02, 0xc0, 0x03},
+}
+
+// Linear analyses the calculation. formatted (;) and constant calculations are not linear
+func (def CanValueDef) Linear() (*LinearCalculation, bool) {
+	if strings.Contains(def.Calculation, ";") {
+		return nil, false
+	}
+
+	used := map[int]bool{}
+	for _, match := range byteVariable.FindAllStringSubmatch(def.Calculation, -1) {
+		i, _ := strconv.Atoi(match[1])
+		used[i] = true
+	}
+	if len(used) == 0 {
+		return nil, false
+	}
+
+	offset, err := evaluate(def.Calculation, [8]byte{})
+	if err != nil {
+		return nil, false
+	}
+
+	coefficients := map[int]float64{}
+	linear := &LinearCalculation{Offset: offset}
+	for i := range used {
+		data := [8]byte{}
+		data[i] = 1
+		value, err := evaluate(def.Calculation, data)
+		if err != nil || value == offset {
+			return nil, false
+		}
+		coefficients[i] = value - offset
+		linear.Bytes = append(linear.Bytes, i)
+	}
+
+	// the bytes must build an integer: coefficients are factor * 256^n
+	sort.Slice(linear.Bytes, func(a, b int) bool {
+		return math.Abs(coefficients[linear.Bytes[a]]) > math.Abs(coefficients[linear.Bytes[b]])
+	})
+	linear.Factor = coefficients[linear.Bytes[len(linear.Bytes)-1]]
+	for n, i := range linear.Bytes {
+		weight := math.Pow(256, float64(len(linear.Bytes)-1-n))
+		if !approximately(coefficients[i], linear.Factor*weight) {
+			return nil, false
+		}
+	}
+
+	for _, probe := range linearProbes {
+		value, err := evaluate(def.Calculation, probe)
+		if err != nil {
+			return nil, false
+		}
+		raw, _ := linear.Raw(probe[:])
+		if !approximately(value, linear.Value(raw)) {
+			return nil, false
+		}
+	}
+
+	return linear, true
+}
+
+// the raw integer of the frame data. false, if data is too short
+func (l *LinearCalculation) Raw(data []byte) (uint64, bool) {
+	raw := uint64(0)
+	for _, i := range l.Bytes {
+		if i >= len(data) {
+			return 0, false
+		}
+		raw = raw<<8 | uint64(data[i])
+	}
+	return raw, true
+}
+
+func (l *LinearCalculation) Value(raw uint64) float64 {
+	return l.Factor*float64(raw) + l.Offset
+}
+
+// the number of bits of the raw integer
+func (l *LinearCalculation) BitCount() int {
+	return 8 * len(l.Bytes)
+}
+
+func evaluate(calculation string, data [8]byte) (float64, error) {
+	var d Decoder
+	equation, err := d.substituteVars(calculation, &can.Frame{Data: data})
+	if err != nil {
+		return 0, err
+	}
+	expression, err := govaluate.NewEvaluableExpression(equation)
+	if err != nil {
+		return 0, err
+	}
+	result, err := expression.Evaluate(nil)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := result.(float64)
+	if !ok {
+		return 0, errors.New("not a number")
+	}
+	return value, nil
+}
+
+func approximately(a float64, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
@@ -25,6 +25,8 @@
 
 package cancoder
 
+import "time"
+
 // CAN
 //   female plug (car)
 //  __________________________________________  Astra H:
@@ -95,6 +97,55 @@ const (
 	DOOR_LOCK_WINDOWS_UP   = 0xC0
 )
 
+// the named values of the signals, e.g. for alert rules
+var OpelAstraHOpc2006Constants = map[string]float64{
+	"BREAK_PRESSED":                BREAK_PRESSED,
+	"BREAK_OPEN":                   BREAK_OPEN,
+	"WEEL_KEY_SEEK_UP":             WEEL_KEY_SEEK_UP,
+	"WEEL_KEY_SEEK_DOWN":           WEEL_KEY_SEEK_DOWN,
+	"WEEL_KEY_SEEK_PRESSED":        WEEL_KEY_SEEK_PRESSED,
+	"WEEL_KEY_MUTE_PRESSED":        WEEL_KEY_MUTE_PRESSED,
+	"WEEL_KEY_MODE_PRESSED":        WEEL_KEY_MODE_PRESSED,
+	"WEEL_KEY_UP_PRESSED":          WEEL_KEY_UP_PRESSED,
+	"WEEL_KEY_DOWN_PRESSED":        WEEL_KEY_DOWN_PRESSED,
+	"WEEL_KEY_VOLUME_UP":           WEEL_KEY_VOLUME_UP,
+	"WEEL_KEY_VOLUME_DOWN":         WEEL_KEY_VOLUME_DOWN,
+	"DRIVING_LIGHT_OFF":            DRIVING_LIGHT_OFF,
+	"DRIVING_LIGHT_PARKING":        DRIVING_LIGHT_PARKING,
+	"DRIVING_LIGHT_LOW_BEAM":       DRIVING_LIGHT_LOW_BEAM,
+	"DRIVING_LIGHT_REVERSE":        DRIVING_LIGHT_REVERSE,
+	"LIGHT_LEVELER_HIGH_BEAM_BIT":  LIGHT_LEVELER_HIGH_BEAM_BIT,
+	"LIGHT_LEVELER_FOG_FRONT_BIT":  LIGHT_LEVELER_FOG_FRONT_BIT,
+	"LIGHT_BACK_FOG":               LIGHT_BACK_FOG,
+	"LIGHT_BACK_HANDBRAKE":         LIGHT_BACK_HANDBRAKE,
+	"LIGHT_BACK_WISHWATER":         LIGHT_BACK_WISHWATER,
+	"DOOR_STATE_FRONT_LEFT_OPEN":   DOOR_STATE_FRONT_LEFT_OPEN,
+	"DOOR_STATE_FRONT_RIGHT_OPPEN": DOOR_STATE_FRONT_RIGHT_OPPEN,
+	"DOOR_STATE_TRUNK_OPEN":        DOOR_STATE_TRUNK_OPEN,
+	"DOOR_STATE_BACK_RIGHT_OPEN":   DOOR_STATE_BACK_RIGHT_OPEN,
+	"DOOR_STATE_BACK_LEFT_OPEN":    DOOR_STATE_BACK_LEFT_OPEN,
+	"ENGINE_OFF":                   ENGINE_OFF,
+	"ENGINE_IGNITION_ON":           ENGINE_IGNITION_ON,
+	"ENGINE_STARTER_RUNNING":       ENGINE_STARTER_RUNNING,
+	"ENGINE_RUNNING":               ENGINE_RUNNING,
+	"ENGINE_RUNNING_DRIVING":       ENGINE_RUNNING_DRIVING,
+	"CRUSE_CONTROLL_ON":            CRUSE_CONTROLL_ON,
+	"RANGE_WARNING_OFF":            RANGE_WARNING_OFF,
+	"RANGE_WARNING_ON":             RANGE_WARNING_ON,
+	"AC_MODE_AUTO":                 AC_MODE_AUTO,
+	"AC_MODE_HEAD":                 AC_MODE_HEAD,
+	"AC_MODE_BODY":                 AC_MODE_BODY,
+	"AC_MODE_FOOD":                 AC_MODE_FOOD,
+	"AC_MODE_HEAD_BODY":            AC_MODE_HEAD_BODY,
+	"AC_MODE_HEAD_FOOD":            AC_MODE_HEAD_FOOD,
+	"AC_MODE_BODY_FOOD":            AC_MODE_BODY_FOOD,
+	"AC_MODE_HEAD_BODY_FOOD":       AC_MODE_HEAD_BODY_FOOD,
+	"DOOR_LOCK_UNLOCK":             DOOR_LOCK_UNLOCK,
+	"DOOR_LOCK_LOCK":               DOOR_LOCK_LOCK,
+	"DOOR_LOCK_WINDOWS_DOWN":       DOOR_LOCK_WINDOWS_DOWN,
+	"DOOR_LOCK_WINDOWS_UP":         DOOR_LOCK_WINDOWS_UP,
+}
+
 // mid speed
 const (
 	SOME_MID_SPEED = 0x00
@@ -190,10 +241,17 @@ const (
 	HSCANErrorCodes2   = 0xa9
 )
 
+// the engine frames come every 100ms, smaller changes only load the subscribers
+var (
+	opelRPMEvents   = EventPolicy{Deadband: 25, MaxRate: 5, Heartbeat: time.Second}
+	opelSpeedEvents = EventPolicy{Deadband: 0.5, MaxRate: 5, Heartbeat: time.Second}
+)
+
 // Opel Astra H OPC 2006
 var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 	{
 		ArbitrationID: uint32(GMLanWeelRemoteControll),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "Key Action",
 			Calculation: "${5}",
@@ -204,6 +262,7 @@ var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(GMLanWeelRemoteControll),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "Turn Lights",
 			Calculation: "${4}",
@@ -214,6 +273,7 @@ var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(GMLanBusWakeup),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "Bus Wakeup",
 			Calculation: "1",
@@ -229,6 +289,7 @@ var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 			Calculation: "(${1}*256 + ${2})/4",
 			Condition:   "1 == 1", // engine is running -> ${0} == 0x13
 			Name:        EngineSpeedRPM,
+			Events:      opelRPMEvents,
 		},
 		TriggerEvent: true,
 	},
@@ -239,6 +300,7 @@ var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 			Calculation: "(${4}*256 + ${5}) / 128",
 			Condition:   "1 == 1", // engine is running -> ${0} == 0x13
 			Name:        VehicleSpeed,
+			Events:      opelSpeedEvents,
 		},
 		TriggerEvent: true,
 	},
@@ -414,6 +476,7 @@ var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(GMLanRemoteKey),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "",
 			Calculation: "${1}",
@@ -421,6 +484,29 @@ var OpelAstraHOpc2006GMLan []CanValueMap = []CanValueMap{
 			Name:        DoorLook,
 		},
 	},
+	// virtual
+	{
+		ArbitrationID: VirtualID,
+		CanValueDef: CanValueDef{
+			Unit: "l/100km",
+			// injection counter steps of 0.03054 ml per s -> l/h (* 3.6) -> per 100 km
+			Calculation: "derivative([Full Injection], 2, 65536) * 0.03054 * 360 / [Speed]",
+			Condition:   "[Speed] > 5",
+			Name:        FuelConsumption,
+			Events:      EventPolicy{MaxRate: 2},
+		},
+		TriggerEvent: true,
+	},
+	{
+		ArbitrationID: VirtualID,
+		CanValueDef: CanValueDef{
+			Unit:        "km/h",
+			Calculation: "derivative([Traveled Distance], 60, 1032.060928) * 3.6", // wraps at 65536 * 0.015748 m
+			Name:        AverageSpeed,
+			Events:      EventPolicy{MaxRate: 2},
+		},
+		TriggerEvent: true,
+	},
 }
 
 var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
@@ -457,6 +543,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANAirConditioner), // works
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "°C",
 			Calculation: "(((${3} & 0x03) * 10) + (${5} & 0x3f))-48", // oberstes bit (0x80) -> low or high
@@ -467,6 +554,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANAirConditioner), // works
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "°C",
 			Calculation: "100", // Hi
@@ -477,6 +565,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANAirConditioner), // works
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "°C",
 			Calculation: "-100", // Low
@@ -487,6 +576,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANAirConditioner), // works
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "",
 			Calculation: "${3} & 0x0f",
@@ -507,6 +597,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	// },
 	{
 		ArbitrationID: uint32(EntertainmentCANAirConditioner), // works
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:        "",
 			Calculation: "${2}",
@@ -551,6 +642,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 			Calculation: "(${2} * 256 + ${3}) / 4",
 			Condition:   "${0} == 0x46",
 			Name:        EngineSpeedRPM,
+			Events:      opelRPMEvents,
 		},
 		TriggerEvent: true,
 	},
@@ -561,6 +653,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 			Calculation: "${4} * 2",
 			Condition:   "${0} == 0x46",
 			Name:        VehicleSpeedMid, // VehicleSpeed,
+			Events:      opelSpeedEvents,
 		},
 		TriggerEvent: true,
 	},
@@ -606,6 +699,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANDisplayData),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:             "",
 			Calculation:      "${2};${4};${6}",
@@ -617,6 +711,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANDisplayData),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:             "",
 			Calculation:      "${1};${3};${5};${7}",
@@ -628,6 +723,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANDisplayData),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:             "",
 			Calculation:      "${2};${4};${6}",
@@ -639,6 +735,7 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 	},
 	{
 		ArbitrationID: uint32(EntertainmentCANDisplayData),
+		CycleTime:     OnChange,
 		CanValueDef: CanValueDef{
 			Unit:             "",
 			Calculation:      "${1};${3};${5};${7}",
@@ -648,6 +745,18 @@ var OpelAstraHOpc2006EntertainmentCAN []CanValueMap = []CanValueMap{
 		},
 		TriggerEvent: true,
 	},
+	// virtual
+	{
+		ArbitrationID: VirtualID,
+		CanValueDef: CanValueDef{
+			Unit: "l/100km",
+			// the consumption the range is based on, to cross check it with the measured one
+			Calculation: "[Full Level Mid] * 100 / [Range]",
+			Condition:   "[Range] > 0",
+			Name:        RangeConsumption,
+		},
+		TriggerEvent: true,
+	},
 }
 
 var OpelAstraHOpc2006HighSpeedCAN []CanValueMap = []CanValueMap{
@@ -0,0 +1,134 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"math"
+	"time"
+)
+
+// when a triggered value is sent to a subscriber. the zero policy sends the
+// value of every frame. deadbands apply to numeric values and imply OnChange
+type EventPolicy struct {
+	OnChange        bool          // only values different from the last sent one
+	Deadband        float64       // changes up to this are no changes
+	DeadbandPercent float64       // changes up to this percentage of the last sent value are no changes
+	MaxRate         float64       // events per second at most, the latest held value is sent when due. 0 unlimited
+	Heartbeat       time.Duration // the value is sent again after this time without event, even if unchanged
+}
+
+// whether value is a change from last
+func (p *EventPolicy) changed(last interface{}, value interface{}) bool {
+	if !p.OnChange && p.Deadband <= 0 && p.DeadbandPercent <= 0 {
+		return true
+	}
+	a, aNumeric := last.(float64)
+	b, bNumeric := value.(float64)
+	if !aNumeric || !bNumeric {
+		return !equal(last, value)
+	}
+	diff := math.Abs(b - a)
+	if diff == 0 {
+		return false
+	}
+	if p.Deadband > 0 && diff <= p.Deadband {
+		return false
+	}
+	if p.DeadbandPercent > 0 && diff <= math.Abs(a)*p.DeadbandPercent/100 {
+		return false
+	}
+	return true
+}
+
+// shortest time between two events
+func (p *EventPolicy) interval() time.Duration {
+	if p.MaxRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / p.MaxRate)
+}
+
+// decoded values are numbers, strings or bools
+func equal(a interface{}, b interface{}) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// the last event of a value sent to a subscriber
+type sentValue struct {
+	value   interface{}
+	at      time.Time
+	sent    bool
+	pending *CanValueMap // held back by the rate limit
+}
+
+func (d *Decoder) policy(s *subscriber, i int) *EventPolicy {
+	if s.policy != nil {
+		return s.policy
+	}
+	return &d.valueMaps[i].CanValueDef.Events
+}
+
+// sends the decoded value of mapping i to the subscribers, whose policies let it
+func (d *Decoder) processEvent(i int) {
+	value := &d.valueMaps[i]
+	for _, s := range d.subscribers {
+		if !s.matches[i] {
+			continue
+		}
+		policy := d.policy(s, i)
+		last := &s.sent[i]
+		if last.sent {
+			heartbeat := policy.Heartbeat > 0 && value.Timestamp.Sub(last.at) >= policy.Heartbeat
+			if !heartbeat && !policy.changed(last.value, value.CanValueDef.Value) {
+				last.pending = nil
+				continue
+			}
+			if value.Timestamp.Sub(last.at) < policy.interval() {
+				held := *value
+				last.pending = &held
+				continue
+			}
+		}
+		d.send(s, i, value)
+	}
+}
+
+// sends the values held back by rate limits, which are due at now
+func (d *Decoder) flushEvents(now time.Time) {
+	for _, s := range d.subscribers {
+		for i := range s.sent {
+			last := &s.sent[i]
+			if last.pending != nil && now.Sub(last.at) >= d.policy(s, i).interval() {
+				d.send(s, i, last.pending)
+			}
+		}
+	}
+}
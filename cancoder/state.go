@@ -0,0 +1,214 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const (
+	// a value is stale after this many cycles without update, its last value is kept
+	StaleCycles = 3
+	// and invalid after this many
+	TimeoutCycles = 10
+	// intervals to see before a learned cycle time is used
+	LearnIntervals = 4
+	// how often Check should be called by the user of a decoder
+	CheckInterval = 200 * time.Millisecond
+)
+
+// cycle time of values sent on changes, e.g. keys. they never get stale
+const OnChange time.Duration = -1
+
+// validity of a decoded value
+type SignalState int
+
+const (
+	StateUnknown SignalState = iota // not received yet
+	StateValid
+	StateStale
+	StateTimeout
+)
+
+func (s SignalState) String() string {
+	switch s {
+	case StateValid:
+		return "valid"
+	case StateStale:
+		return "stale"
+	case StateTimeout:
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
+
+func (s SignalState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type StateEventKind string
+
+const (
+	EventStale     StateEventKind = "stale"
+	EventTimeout   StateEventKind = "timeout"
+	EventRecovered StateEventKind = "recovered"
+)
+
+// a value changed its state
+type StateEvent struct {
+	Kind      StateEventKind
+	Value     CanValueMap // with its last value
+	LastSeen  time.Time
+	CycleTime time.Duration // expected or learned
+	Timestamp time.Time     // detection time, in the time of the frames
+}
+
+// update times of a value
+type signalTiming struct {
+	last      time.Time
+	cycle     time.Duration // learned
+	intervals int
+}
+
+func (d *Decoder) GetStateChannel() <-chan StateEvent {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	event := make(chan StateEvent, EventChannelBufferSize)
+	d.stateChannels = append(d.stateChannels, event)
+
+	return event
+}
+
+// the expected cycle time of a mapping, 0 if not known (yet)
+func (d *Decoder) cycleTime(i int) time.Duration {
+	mapping := &d.valueMaps[i]
+	if mapping.CycleTime != 0 {
+		if mapping.CycleTime < 0 {
+			return 0
+		}
+		return mapping.CycleTime
+	}
+	if d.timings[i].intervals < LearnIntervals {
+		return 0
+	}
+	return d.timings[i].cycle
+}
+
+// a value of mapping i was decoded at timestamp
+func (d *Decoder) updated(i int, timestamp time.Time) {
+	mapping := &d.valueMaps[i]
+	timing := &d.timings[i]
+
+	interval := timestamp.Sub(timing.last)
+	// gaps of stale values are no cycles
+	if !timing.last.IsZero() && interval > 0 && mapping.State == StateValid {
+		if timing.intervals == 0 {
+			timing.cycle = interval
+		} else {
+			timing.cycle += (interval - timing.cycle) / 8
+		}
+		timing.intervals++
+	}
+	lastSeen := timing.last
+	timing.last = timestamp
+
+	recovered := mapping.State == StateStale || mapping.State == StateTimeout
+	mapping.State = StateValid
+	if recovered {
+		d.processState(EventRecovered, i, lastSeen, timestamp)
+	}
+}
+
+// checks the ages of the values at now in the time of the frames, which
+// is the time of the last frame plus the time passed since it was decoded.
+// should be called every CheckInterval, a silent bus decodes nothing
+func (d *Decoder) Check() []StateEvent {
+	defer d.deliverBlocked()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	if d.clock.IsZero() {
+		return nil
+	}
+	return d.checkAt(d.clock.Add(now.Sub(d.clockWall)))
+}
+
+// marks values without update since StaleCycles as stale and since
+// TimeoutCycles as timed out. the events are sent on the state channels too.
+// values held back by the rate limits of event policies are sent, when due
+func (d *Decoder) CheckAt(now time.Time) []StateEvent {
+	defer d.deliverBlocked()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.checkAt(now)
+}
+
+func (d *Decoder) checkAt(now time.Time) (events []StateEvent) {
+	d.flushEvents(now)
+
+	for i := range d.valueMaps {
+		mapping := &d.valueMaps[i]
+		cycle := d.cycleTime(i)
+		if cycle <= 0 || mapping.State == StateUnknown || mapping.State == StateTimeout {
+			continue
+		}
+		age := now.Sub(d.timings[i].last)
+		kind := StateEventKind("")
+		if age > TimeoutCycles*cycle {
+			mapping.State, kind = StateTimeout, EventTimeout
+		} else if age > StaleCycles*cycle && mapping.State == StateValid {
+			mapping.State, kind = StateStale, EventStale
+		} else {
+			continue
+		}
+		events = append(events, d.processState(kind, i, d.timings[i].last, now))
+	}
+	return events
+}
+
+func (d *Decoder) processState(kind StateEventKind, i int, lastSeen time.Time, now time.Time) StateEvent {
+	event := StateEvent{
+		Kind:      kind,
+		Value:     d.valueMaps[i],
+		LastSeen:  lastSeen,
+		CycleTime: d.cycleTime(i),
+		Timestamp: now,
+	}
+	for _, stateCh := range d.stateChannels {
+		select {
+		case stateCh <- event:
+		default:
+			log.Warn("decoder", "state channel full. you need to process faster ;)")
+		}
+	}
+	return event
+}
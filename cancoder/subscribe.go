@@ -0,0 +1,239 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// waiting time of Block subscriptions without timeout
+const DefaultBlockTimeout = 100 * time.Millisecond
+
+// what happens with an event, if the channel of a subscription is full
+type Overflow int
+
+const (
+	DropNewest Overflow = iota // the event is dropped
+	DropOldest                 // the oldest event in the channel is dropped
+	// the decoding goroutine waits up to the timeout, then the event is dropped.
+	// it waits after the decoder is unlocked, other users of the decoder are
+	// not blocked. the events stay in order, as long as one goroutine decodes
+	Block
+)
+
+// the values to receive and how. without names, patterns and ids all
+// triggered values are received, else the ones matching any of them
+type Subscription struct {
+	Names        []CanVars
+	Patterns     []string // shell patterns of names, e.g. "Display Row *"
+	IDs          []uint32 // arbitration ids
+	BufferSize   int      // 0 is EventChannelBufferSize
+	Overflow     Overflow
+	BlockTimeout time.Duration // of Block, 0 is DefaultBlockTimeout
+	Policy       *EventPolicy  // replaces the policies of the definitions, if set
+}
+
+func (s *Subscription) match(mapping *CanValueMap) bool {
+	if len(s.Names) == 0 && len(s.Patterns) == 0 && len(s.IDs) == 0 {
+		return true
+	}
+	for _, name := range s.Names {
+		if name == mapping.CanValueDef.Name {
+			return true
+		}
+	}
+	for _, pattern := range s.Patterns {
+		if ok, _ := path.Match(pattern, string(mapping.CanValueDef.Name)); ok {
+			return true
+		}
+	}
+	for _, id := range s.IDs {
+		if id == mapping.ArbitrationID {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriber struct {
+	events   chan CanValueMap
+	policy   *EventPolicy
+	matches  []bool      // per value map
+	sent     []sentValue // per value map
+	overflow Overflow
+	timeout  time.Duration
+	once     sync.Once
+	queued   int // events of Block waiting for delivery
+
+	// held while blocked on the channel, closing waits for it
+	mutex  sync.Mutex
+	closed bool
+}
+
+// an event of a Block subscription, which did not fit in the channel
+type blockedEvent struct {
+	subscriber *subscriber
+	value      CanValueMap
+}
+
+// events of the triggered values by the policies of their definitions
+func (d *Decoder) GetEventChannel() <-chan CanValueMap {
+	events, _, _ := d.Subscribe(Subscription{})
+	return events
+}
+
+// events of the triggered values by policy instead of the ones of the definitions
+func (d *Decoder) GetEventChannelWithPolicy(policy EventPolicy) <-chan CanValueMap {
+	events, _, _ := d.Subscribe(Subscription{Policy: &policy})
+	return events
+}
+
+// events of the triggered values of the subscription. unsubscribe closes
+// the channel, it may be called more than once
+func (d *Decoder) Subscribe(subscription Subscription) (events <-chan CanValueMap, unsubscribe func(), err error) {
+	for _, pattern := range subscription.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	size := subscription.BufferSize
+	if size <= 0 {
+		size = EventChannelBufferSize
+	}
+	timeout := subscription.BlockTimeout
+	if timeout <= 0 {
+		timeout = DefaultBlockTimeout
+	}
+	s := &subscriber{
+		events:   make(chan CanValueMap, size),
+		policy:   subscription.Policy,
+		matches:  make([]bool, len(d.valueMaps)),
+		sent:     make([]sentValue, len(d.valueMaps)),
+		overflow: subscription.Overflow,
+		timeout:  timeout,
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for i := range d.valueMaps {
+		s.matches[i] = subscription.match(&d.valueMaps[i])
+	}
+	d.subscribers = append(d.subscribers, s)
+
+	return s.events, func() { d.unsubscribe(s) }, nil
+}
+
+func (d *Decoder) unsubscribe(s *subscriber) {
+	s.once.Do(func() {
+		d.mutex.Lock()
+		for i, subscribed := range d.subscribers {
+			if subscribed == s {
+				d.subscribers = append(d.subscribers[:i:i], d.subscribers[i+1:]...)
+				break
+			}
+		}
+		d.mutex.Unlock()
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.closed = true
+		close(s.events)
+	})
+}
+
+func (d *Decoder) send(s *subscriber, i int, value *CanValueMap) {
+	s.sent[i] = sentValue{value: value.CanValueDef.Value, at: value.Timestamp, sent: true}
+	// behind the events waiting for delivery
+	if s.overflow == Block && s.queued > 0 {
+		s.queued++
+		d.blocked = append(d.blocked, blockedEvent{subscriber: s, value: *value})
+		return
+	}
+	select {
+	case s.events <- *value:
+		return
+	default:
+	}
+
+	switch s.overflow {
+	case DropOldest:
+		// the receiver may have made space meanwhile
+		select {
+		case <-s.events:
+		default:
+		}
+		select {
+		case s.events <- *value:
+			return
+		default:
+		}
+	case Block:
+		// delivered by deliverBlocked, when the decoder is unlocked
+		s.queued++
+		d.blocked = append(d.blocked, blockedEvent{subscriber: s, value: *value})
+		return
+	}
+	log.Warn("decoder", "event channel full. you need to process faster ;)")
+}
+
+// sends the events of Block subscriptions, which did not fit in their
+// channels. must be called without holding the decoder's lock
+func (d *Decoder) deliverBlocked() {
+	d.mutex.Lock()
+	blocked := d.blocked
+	d.blocked = nil
+	d.mutex.Unlock()
+
+	for _, event := range blocked {
+		event.subscriber.block(event.value)
+
+		d.mutex.Lock()
+		event.subscriber.queued--
+		d.mutex.Unlock()
+	}
+}
+
+func (s *subscriber) block(value CanValueMap) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case s.events <- value:
+	case <-timer.C:
+		log.Warn("decoder", "event channel full. you need to process faster ;)")
+	}
+}
@@ -25,6 +25,8 @@
 
 package cancoder
 
+import "time"
+
 type CanVars string
 
 const (
@@ -67,6 +69,11 @@ const (
 	TraveledDistance   CanVars = "Traveled Distance"          // tested
 	Distance           CanVars = "Distance"
 	DoorLook           CanVars = "Door Lock"
+
+	// virtual
+	FuelConsumption  CanVars = "Fuel Consumption"
+	AverageSpeed     CanVars = "Average Speed"
+	RangeConsumption CanVars = "Range Consumption"
 )
 
 type CanValueDef struct {
@@ -76,6 +83,7 @@ type CanValueDef struct {
 	Unit             string      `json:"unit"`
 	Name             CanVars     `json:"name"`
 	Value            interface{} `json:"value"`
+	Events           EventPolicy `json:"-"` // of TriggerEvent values
 }
 
 type CanValueMap struct {
@@ -83,6 +91,11 @@ type CanValueMap struct {
 	ArbitrationID uint32
 	TriggerEvent  bool
 	OriginalData  []byte
+	Timestamp     time.Time // receive time of the frame, which produced the value
+	// expected time between updates. 0 learns it from the traffic, OnChange
+	// for values sent on changes only
+	CycleTime time.Duration
+	State     SignalState // set by the decoder
 }
 
 type Cancoder struct {
@@ -91,3 +104,17 @@ type Cancoder struct {
 }
 
 type Cancoders []Cancoder
+
+// distinct arbitration ids used by the map, e.g. to set up acceptance filters.
+// without VirtualID
+func (c Cancoder) ArbitrationIDs() []uint32 {
+	ids := []uint32{}
+	seen := make(map[uint32]bool)
+	for _, mapping := range c.Map {
+		if !seen[mapping.ArbitrationID] && !mapping.IsVirtual() {
+			seen[mapping.ArbitrationID] = true
+			ids = append(ids, mapping.ArbitrationID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,349 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cancoder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/utils"
+
+	"github.com/Knetic/govaluate"
+)
+
+// arbitration id of virtual signals, no frame has it. their calculation and
+// condition reference other signals of the map as [name] and may use
+//
+//	derivative([name], window, modulus) change per second over the window in s,
+//	                                    0 or without between the last two values.
+//	                                    counters wrapping at modulus are unwrapped
+//	integral([name])                    sum of value times s since the first value
+//	average([name], window)             mean of the values within the window in s
+//
+// they are computed, whenever an input is decoded
+const VirtualID uint32 = math.MaxUint32
+
+// window of average without one
+const DefaultAverageWindow = 60 * time.Second
+
+var (
+	signalReference = regexp.MustCompile(`\[([^\]]+)\]`)
+	timeFunction    = regexp.MustCompile(`(derivative|integral|average)\(\s*\[([^\]]+)\]((?:\s*,\s*[0-9.]+)*)\s*\)`)
+)
+
+func (m *CanValueMap) IsVirtual() bool {
+	return m.ArbitrationID == VirtualID
+}
+
+func (c Cancoder) HasVirtual() bool {
+	for i := range c.Map {
+		if c.Map[i].IsVirtual() {
+			return true
+		}
+	}
+	return false
+}
+
+type sample struct {
+	at    time.Time
+	value float64 // unwrapped
+}
+
+// a time function in the expressions of a virtual signal
+type function struct {
+	kind    string
+	input   CanVars
+	window  time.Duration
+	modulus float64
+
+	samples  []sample
+	last     float64 // raw last value
+	integral float64
+}
+
+// adds the value of the input at at
+func (f *function) add(raw float64, at time.Time) {
+	value := raw
+	if len(f.samples) > 0 {
+		last := f.samples[len(f.samples)-1]
+		if !at.After(last.at) {
+			return
+		}
+		diff := raw - f.last
+		if f.modulus > 0 {
+			diff = math.Mod(diff, f.modulus)
+			if diff < 0 {
+				diff += f.modulus
+			}
+		}
+		f.integral += (raw + f.last) / 2 * at.Sub(last.at).Seconds()
+		value = last.value + diff
+	}
+	f.last = raw
+	f.samples = append(f.samples, sample{at: at, value: value})
+
+	start := at.Add(-f.window)
+	switch f.kind {
+	case "derivative":
+		// the last sample before the window spans it
+		for len(f.samples) > 2 && !f.samples[1].at.After(start) {
+			f.samples = f.samples[1:]
+		}
+	case "average":
+		for len(f.samples) > 1 && f.samples[0].at.Before(start) {
+			f.samples = f.samples[1:]
+		}
+	default:
+		f.samples = f.samples[len(f.samples)-1:]
+	}
+}
+
+func (f *function) value() (float64, bool) {
+	switch f.kind {
+	case "derivative":
+		if len(f.samples) < 2 {
+			return 0, false
+		}
+		first, last := f.samples[0], f.samples[len(f.samples)-1]
+		return (last.value - first.value) / last.at.Sub(first.at).Seconds(), true
+	case "average":
+		if len(f.samples) == 0 {
+			return 0, false
+		}
+		sum := 0.0
+		for _, s := range f.samples {
+			sum += s.value
+		}
+		return sum / float64(len(f.samples)), true
+	default:
+		return f.integral, len(f.samples) > 0
+	}
+}
+
+// a parsed virtual signal
+type virtual struct {
+	index       int // of the value map
+	condition   *govaluate.EvaluableExpression
+	calculation *govaluate.EvaluableExpression
+	inputs      []CanVars
+	functions   []*function
+	err         error // of parsing, reported on each computation
+}
+
+// parses the virtual definitions of the decoder's map
+func (d *Decoder) parseVirtuals() {
+	names := make(map[CanVars]bool)
+	for _, mapping := range d.valueMaps {
+		names[mapping.CanValueDef.Name] = true
+	}
+	for i := range d.valueMaps {
+		if !d.valueMaps[i].IsVirtual() {
+			continue
+		}
+		v := &virtual{index: i}
+		def := d.valueMaps[i].CanValueDef
+		v.calculation, v.err = v.parse(def.Calculation, names)
+		if v.err == nil && strings.TrimSpace(def.Condition) != "" {
+			v.condition, v.err = v.parse(def.Condition, names)
+		}
+		d.virtuals = append(d.virtuals, v)
+	}
+}
+
+// the expression with the time functions replaced by parameters
+func (v *virtual) parse(expression string, names map[CanVars]bool) (*govaluate.EvaluableExpression, error) {
+	var err error
+	expression = timeFunction.ReplaceAllStringFunc(expression, func(call string) string {
+		match := timeFunction.FindStringSubmatch(call)
+		f := &function{kind: match[1], input: CanVars(match[2])}
+		if f.kind == "average" {
+			f.window = DefaultAverageWindow
+		}
+		args := strings.Split(match[3], ",")[1:]
+		if len(args) > 2 || (f.kind != "derivative" && len(args) > 1) || (f.kind == "integral" && len(args) > 0) {
+			err = fmt.Errorf("%s: too many arguments", call)
+		}
+		for j, arg := range args {
+			number, pErr := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if pErr != nil {
+				err = fmt.Errorf("%s: %w", call, pErr)
+			} else if j == 0 {
+				f.window = time.Duration(number * float64(time.Second))
+			} else {
+				f.modulus = number
+			}
+		}
+		v.functions = append(v.functions, f)
+		return fmt.Sprintf("[#%d]", len(v.functions)-1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range v.functions {
+		if !names[f.input] {
+			return nil, fmt.Errorf("unknown signal %q", f.input)
+		}
+	}
+	for _, match := range signalReference.FindAllStringSubmatch(expression, -1) {
+		name := CanVars(match[1])
+		if strings.HasPrefix(match[1], "#") {
+			continue
+		}
+		if !names[name] {
+			return nil, fmt.Errorf("unknown signal %q", name)
+		}
+		v.inputs = append(v.inputs, name)
+	}
+	return govaluate.NewEvaluableExpression(utils.ReplaceHexWithDecimal(expression))
+}
+
+func (v *virtual) uses(updated map[CanVars]bool) bool {
+	// reported on every decoded frame
+	if v.err != nil {
+		return len(updated) > 0
+	}
+	for _, name := range v.inputs {
+		if updated[name] {
+			return true
+		}
+	}
+	for _, f := range v.functions {
+		if updated[f.input] {
+			return true
+		}
+	}
+	return false
+}
+
+// the last decoded value of name, nil if none
+func (d *Decoder) lastValue(name CanVars) interface{} {
+	var last *CanValueMap
+	for i := range d.valueMaps {
+		mapping := &d.valueMaps[i]
+		if mapping.CanValueDef.Name == name && mapping.CanValueDef.Value != nil &&
+			(last == nil || mapping.Timestamp.After(last.Timestamp)) {
+			last = mapping
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return last.CanValueDef.Value
+}
+
+// computes the virtual signals using the values decoded at timestamp
+func (d *Decoder) computeVirtuals(decoded []*CanValueMap, timestamp time.Time) (values []*CanValueMap, errs DecodeErrors) {
+	updated := make(map[CanVars]bool)
+	for _, value := range decoded {
+		updated[value.CanValueDef.Name] = true
+	}
+
+	for _, v := range d.virtuals {
+		if !v.uses(updated) {
+			continue
+		}
+		value, err := d.computeVirtual(v, updated, timestamp)
+		if err != nil {
+			mapping := &d.valueMaps[v.index]
+			decodeErr := &DecodeError{
+				ArbitrationID: mapping.ArbitrationID,
+				Name:          mapping.CanValueDef.Name,
+				Expression:    mapping.CanValueDef.Calculation,
+				Err:           err,
+			}
+			d.failed(v.index, decodeErr, timestamp)
+			errs = append(errs, decodeErr)
+		} else if value != nil {
+			updated[value.CanValueDef.Name] = true
+			values = append(values, value)
+		}
+	}
+	return values, errs
+}
+
+// a copy of the new value, nil if inputs are missing or the condition is false
+func (d *Decoder) computeVirtual(v *virtual, updated map[CanVars]bool, timestamp time.Time) (*CanValueMap, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	parameters := make(map[string]interface{})
+	complete := true
+	for j, f := range v.functions {
+		input := d.lastValue(f.input)
+		if updated[f.input] && input != nil {
+			number, ok := input.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s of %s: %v is no number", f.kind, f.input, input)
+			}
+			f.add(number, timestamp)
+		}
+		value, ok := f.value()
+		complete = complete && ok
+		parameters[fmt.Sprintf("#%d", j)] = value
+	}
+	for _, name := range v.inputs {
+		input := d.lastValue(name)
+		complete = complete && input != nil
+		parameters[string(name)] = input
+	}
+	if !complete {
+		return nil, nil
+	}
+
+	if v.condition != nil {
+		result, err := v.condition.Evaluate(parameters)
+		if err != nil {
+			return nil, err
+		}
+		if ok, isBool := result.(bool); !isBool {
+			return nil, errors.New("condition is no boolean")
+		} else if !ok {
+			return nil, nil
+		}
+	}
+	result, err := v.calculation.Evaluate(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := &d.valueMaps[v.index]
+	mapping.OriginalData = nil
+	mapping.Timestamp = timestamp
+	mapping.CanValueDef.Value = result
+	d.updated(v.index, timestamp)
+	if mapping.TriggerEvent {
+		d.processEvent(v.index)
+	}
+	value := *mapping
+	return &value, nil
+}
@@ -26,19 +26,33 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"math/big"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ChrIgiSta/go-can-coder/alert"
 	"github.com/ChrIgiSta/go-can-coder/canbus"
 	"github.com/ChrIgiSta/go-can-coder/cancoder"
 	"github.com/ChrIgiSta/go-can-coder/server"
+	"github.com/ChrIgiSta/go-can-coder/trip"
 	ccrypt "github.com/ChrIgiSta/go-utils/crypto"
 	log "github.com/ChrIgiSta/go-utils/logger"
+	"github.com/angelodlfrtr/go-can"
 )
 
+// the trip in progress is sent this often
+const tripInterval = 10 * time.Second
+
 // can -> websocket
 // websocket -> can
 func main() {
+	alertWebhook := flag.String("webhook", "",
+		"alerts are posted to this url too, e.g. of a local home automation")
+	flag.Parse()
+
 	// make a CLI
 	cert, key, err := ccrypt.CreateSelfsignedX509Certificate(big.NewInt(202405060001),
 		365, ccrypt.KeyLength2048Bit,
@@ -54,67 +68,139 @@ func main() {
 		log.Error("main", "cannot create selfsigned cert: %v", err)
 	}
 
-	can2Websocket(cancoder.OpelAstraHOpc2006, "myToken", cert, key, 19001)
+	can2Websocket(cancoder.OpelAstraHOpc2006, "myToken", cert, key, 19001, "trips.jsonl", *alertWebhook)
 
 	log.Info("main", "exited")
 }
 
-func can2Websocket(cancoderDef cancoder.CancoderDef, token string, cert []byte, privKey []byte, wsPort uint16) {
+func can2Websocket(cancoderDef cancoder.CancoderDef, token string, cert []byte, privKey []byte, wsPort uint16,
+	tripStore string, webhook string) {
 
 	var (
 		err    error
 		wg     sync.WaitGroup = sync.WaitGroup{}
-		failed bool           = false
-		// canIfs []*canbus.NetworkIf
-		// canDecoders []*cancoder.Decoder
+		failed atomic.Bool
+		// closed on the first failure, stops the goroutines waiting
+		done = make(chan struct{})
 		// canRxChs    []<-chan *can.Frame
 		canDecEvnts []<-chan cancoder.CanValueMap
+		canStates   []<-chan cancoder.StateEvent
+	)
+	var (
+		canIfs      = map[string]*canbus.NetworkIf{}
+		canDecoders = map[string]*cancoder.Decoder{}
+		// trips of the values of all buses
+		trips     = trip.NewComputer()
+		tripsDone = make(chan trip.Trip, 8)
+		store     = trip.NewStore(tripStore)
 	)
 
+	fail := func() {
+		if failed.CompareAndSwap(false, true) {
+			close(done)
+		}
+	}
+
 	defer wg.Wait()
 
+	alerts, err := alert.NewEngine(&cancoderDef, alert.OpelAstraHOpc2006Rules)
+	if err != nil {
+		log.Error("can2ws", "alert rules: %v", err)
+		return
+	}
+	// the events returned by Add and Check are the ones of this channel, which
+	// the notifiers get
+	alertEvents := alerts.GetEventChannel()
+
 	for _, def := range cancoderDef.Cancoders {
 		canDev := canbus.NewIface(def.Device)
-		// canIfs = append(canIfs, canDev)
+		// only frames, the decoder knows
+		err = canDev.SetFilters(canbus.FilterIDs(def.ArbitrationIDs()...))
+		if err != nil {
+			log.Error("can2ws", "set filters on %s: %v", def.Device, err)
+			return
+		}
 		canDec := cancoder.NewCanCoder(def.Map)
-		// canDecoders = append(canDecoders, canDec)
+		// bad definitions are reported, the others keep being forwarded
+		canErrs := cancoder.NewErrorLog("can2ws "+def.Device, 0)
+		canIfs[def.Device] = canDev
+		canDecoders[def.Device] = canDec
+		for _, err := range canDec.NonInvertible() {
+			log.Debug("can2ws", "%s: %v", def.Device, err)
+		}
 		wg.Add(1)
 		canRx, err := canDev.Connect(&wg)
 		if err != nil {
 			log.Error("can2ws", "connect to %s %s can: %v", cancoderDef.Name, def.Device, err)
 			return
 		}
-		// canRxChs = append(canRxChs, canRx)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for !failed {
-				_, err := canDec.Decoder(<-canRx)
+			for {
+				var frame *canbus.Frame
+				select {
+				case f, ok := <-canRx:
+					if !ok {
+						log.Error("can2ws", "can rx closed")
+						fail()
+						return
+					}
+					frame = f
+				case <-done:
+					return
+				}
+				values, err := canDec.DecodeAt(&frame.Frame, frame.Timestamp)
 				if err != nil {
-					log.Error("can2ws", "decode frame: %v", err)
-					failed = true
+					canErrs.Log(err)
+				}
+				for _, value := range values {
+					alerts.Add(value)
+					if completed := trips.Add(value); completed != nil {
+						select {
+						case tripsDone <- *completed:
+						case <-done:
+							return
+						}
+					}
 				}
 			}
 		}()
 		canDecEvnts = append(canDecEvnts, canDec.GetEventChannel())
+		canStates = append(canStates, canDec.GetStateChannel())
+
+		// a sleeping car sends nothing, its values get stale by the checks
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check := time.NewTicker(cancoder.CheckInterval)
+			defer check.Stop()
+			for {
+				select {
+				case <-check.C:
+					canDec.Check()
+				case <-done:
+					return
+				}
+			}
+		}()
 	}
 
-	wsDec := server.NewWsServer(
-		19001,
+	// trip requests are answered by the server
+	var wsDec *server.WsServer
+	wsDec = server.NewWsServer(
+		wsPort,
 		"decoded",
 		func(msg any) {
 			log.Debug("can2ws", "websocket rx: %v", msg)
 			switch m := msg.(type) {
 			case server.WsMsg:
-				// Need to know the can channel
-				for _, cancoder := range cancoderDef.Cancoders {
-					if cancoder.Device == m.Device {
-						// canDecoders[i].
-						// msg.Msg.Value
-						// err = canIfs[i].Send(&can.Frame{})
-						log.Warn("can2ws", "encoder not implemented: %s %v", cancoder.Device, msg)
-						break
-					}
+				if err := wsEncode(m, cancoderDef, canDecoders, canIfs); err != nil {
+					log.Warn("can2ws", "websocket rx: %v", err)
+				}
+			case server.WsTripsRequest:
+				if err := wsTrips(m, store, wsDec); err != nil {
+					log.Warn("can2ws", "websocket trips: %v", err)
 				}
 			}
 		},
@@ -127,32 +213,182 @@ func can2Websocket(cancoderDef cancoder.CancoderDef, token string, cert []byte,
 		defer wg.Done()
 		if err := wsDec.Serve(); err != nil {
 			log.Error("can2ws", "ws server exited with err %v", err)
-			failed = true
+			fail()
+		}
+	}()
+
+	// completed trips are stored and sent, the trip in progress is sent
+	// periodically
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		check := time.NewTicker(time.Second)
+		defer check.Stop()
+		update := time.NewTicker(tripInterval)
+		defer update.Stop()
+		for {
+			var completed *trip.Trip
+			select {
+			case <-done:
+				return
+			case t := <-tripsDone:
+				completed = &t
+			case now := <-check.C:
+				completed = trips.Check(now)
+			case <-update.C:
+				if current, ok := trips.Current(); ok {
+					if err := wsDec.Send(server.WsTrip{Trip: current, Running: true}); err != nil {
+						log.Warn("can2ws", "send trip: %v", err)
+					}
+				}
+			}
+			if completed == nil {
+				continue
+			}
+			log.Info("can2ws", "trip of %.1f km completed", completed.Distance)
+			if err := store.Save(*completed); err != nil {
+				log.Error("can2ws", "store trip: %v", err)
+			}
+			if err := wsDec.Send(server.WsTrip{Trip: *completed}); err != nil {
+				log.Warn("can2ws", "send trip: %v", err)
+			}
+		}
+	}()
+
+	// alerts go to the log, the websocket clients and the webhook
+	notifiers := []alert.Notifier{alert.NewLogNotifier("can2ws"), wsNotifier{wsDec}}
+	if webhook != "" {
+		notifiers = append(notifiers, alert.NewWebhookNotifier(webhook))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		alert.Notify(alertEvents, done, notifiers...)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		check := time.NewTicker(cancoder.CheckInterval)
+		defer check.Stop()
+		for {
+			select {
+			case now := <-check.C:
+				alerts.Check(now)
+			case <-done:
+				return
+			}
 		}
 	}()
 
 	log.Info("can2ws", "started. ws listen on port %d", wsPort)
 
-	for !failed {
+	for !failed.Load() {
 
 		for i, rxCh := range canDecEvnts {
 			select {
 			case rx := <-rxCh:
 				log.Debug("can2ws", "gmLan rx: %v", rx)
 				err = wsDec.Send(server.WsMsg{
-					Msg:    rx.CanValueDef,
-					Device: cancoderDef.Cancoders[i].Device,
+					Msg:       rx.CanValueDef,
+					Device:    cancoderDef.Cancoders[i].Device,
+					Timestamp: rx.Timestamp,
+				})
+				if err != nil {
+					log.Error("can2ws", "send on %s: %v", cancoderDef.Cancoders[i].Device, err)
+					fail()
+				}
+			default:
+			}
+		}
+		for i, stateCh := range canStates {
+			select {
+			case state := <-stateCh:
+				log.Info("can2ws", "%s %s: %s", cancoderDef.Cancoders[i].Device,
+					state.Value.CanValueDef.Name, state.Kind)
+				alerts.State(state)
+				err = wsDec.Send(server.WsMsg{
+					Msg:       state.Value.CanValueDef,
+					Device:    cancoderDef.Cancoders[i].Device,
+					Timestamp: state.Timestamp,
+					Event:     state.Kind,
 				})
 				if err != nil {
 					log.Error("can2ws", "send on %s: %v", cancoderDef.Cancoders[i].Device, err)
-					failed = true
+					fail()
 				}
 			default:
 			}
 		}
 
-		if failed {
+		if failed.Load() {
 			log.Error("can2ws", "something failed. exiting app")
 		}
 	}
 }
+
+// encodes a value received over the websocket into the last frame of its id
+// and sends it on the device's bus
+func wsEncode(m server.WsMsg, cancoderDef cancoder.CancoderDef, canDecoders map[string]*cancoder.Decoder,
+	canIfs map[string]*canbus.NetworkIf) error {
+
+	frame, err := wsFrame(m, cancoderDef, canDecoders)
+	if err != nil {
+		return err
+	}
+	log.Debug("can2ws", "send 0x%x % x on %s", frame.ArbitrationID, frame.Data[:frame.DLC], m.Device)
+	return canIfs[m.Device].Send(frame)
+}
+
+// the frame of a value received over the websocket
+func wsFrame(m server.WsMsg, cancoderDef cancoder.CancoderDef, canDecoders map[string]*cancoder.Decoder) (*can.Frame, error) {
+	canDec, ok := canDecoders[m.Device]
+	if !ok {
+		return nil, fmt.Errorf("unknown device %q", m.Device)
+	}
+	var (
+		value *cancoder.CanValueMap
+		err   error = fmt.Errorf("%s has no value %q", m.Device, m.Msg.Name)
+	)
+	for _, def := range cancoderDef.Cancoders {
+		if def.Device != m.Device {
+			continue
+		}
+		// the first definition of the name, which can be encoded
+		for _, mapping := range def.Map {
+			if mapping.CanValueDef.Name != m.Msg.Name {
+				continue
+			}
+			if err = mapping.Invertible(); err == nil {
+				value = &mapping
+				break
+			}
+		}
+	}
+	if value == nil {
+		return nil, err
+	}
+	value.CanValueDef.Value = m.Msg.Value
+
+	return canDec.Encode(value)
+}
+
+// answers a client with the last stored trips, all without a count
+func wsTrips(m server.WsTripsRequest, store *trip.Store, wsDec *server.WsServer) error {
+	trips, err := store.Trips()
+	if err != nil {
+		return err
+	}
+	if m.Trips > 0 && len(trips) > m.Trips {
+		trips = trips[len(trips)-m.Trips:]
+	}
+	return wsDec.SendTo(m.ClientId, server.WsTrips{Trips: trips})
+}
+
+// sends the alerts to the websocket clients
+type wsNotifier struct {
+	wsDec *server.WsServer
+}
+
+func (n wsNotifier) Notify(event alert.Event) error {
+	return n.wsDec.Send(server.WsAlert{Alert: event})
+}
@@ -0,0 +1,83 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/server"
+	"github.com/ChrIgiSta/go-easy-websockets/websocket"
+	"github.com/angelodlfrtr/go-can"
+)
+
+// a value received over the websocket is encoded into the frame of its id
+func TestWsReceiveEncode(t *testing.T) {
+	canDecoders := map[string]*cancoder.Decoder{}
+	for _, def := range cancoder.OpelAstraHOpc2006.Cancoders {
+		canDecoders[def.Device] = cancoder.NewCanCoder(def.Map)
+	}
+	var (
+		frame *can.Frame
+		err   error
+		other any
+	)
+	wsDec := server.NewWsServer(19001, "decoded", func(msg any) {
+		switch m := msg.(type) {
+		case server.WsMsg:
+			frame, err = wsFrame(m, cancoder.OpelAstraHOpc2006, canDecoders)
+		default:
+			other = m
+		}
+	}, "token", nil, nil)
+
+	wsDec.OnReceive(websocket.Message{Data: []byte(`{"device":"can1","message":{"name":"Speed","value":88.5}}`)})
+	if err != nil || frame == nil {
+		t.Fatalf("no frame: %v", err)
+	}
+	values, err := canDecoders["can1"].Decoder(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, value := range values {
+		if value.CanValueDef.Name == cancoder.VehicleSpeed {
+			found = value.CanValueDef.Value == 88.5
+		}
+	}
+	if !found {
+		t.Errorf("frame % x does not decode to the speed", frame.Data)
+	}
+
+	wsDec.OnReceive(websocket.Message{Data: []byte(`{"arbitrationID":264,"DLC":2,"data":"AQI="}`)})
+	if f, ok := other.(server.CanFrame); !ok || f.ArbitrationID != 264 {
+		t.Errorf("received %#v, expected a can frame", other)
+	}
+	wsDec.OnReceive(websocket.Message{Data: []byte(`{"trips":3}`), ClientId: 7})
+	if r, ok := other.(server.WsTripsRequest); !ok || r.Trips != 3 || r.ClientId != 7 {
+		t.Errorf("received %#v, expected a trips request", other)
+	}
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________________
+ *  / _____  _  ____________/  / __|_|   /_______________   _____/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |__
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const statsInterval = 10 * time.Second
+
+func main() {
+	var canInterface = flag.String("interface", "can0", "can interface to tunnel (lookup with ifconfig)")
+	var localPort = flag.Uint("port", canbus.CannelloniDefaultPort, "local udp port")
+	var remoteAddress = flag.String("remote", "", "address of the remote cannelloni peer")
+	var remotePort = flag.Uint("remote-port", canbus.CannelloniDefaultPort, "udp port of the remote cannelloni peer")
+	var batchTimeout = flag.Duration("batch", canbus.CannelloniDefaultBatchTimeout, "max time to collect frames into one packet")
+
+	flag.Parse()
+
+	if *remoteAddress == "" {
+		log.Error("cannelloni forwarder", "remote peer required")
+		return
+	}
+
+	tunnel := canbus.NewCannelloni(uint16(*localPort), *remoteAddress, uint16(*remotePort))
+	tunnel.SetBatchTimeout(*batchTimeout)
+
+	forwarder(*canInterface, tunnel)
+}
+
+func forwarder(canInterface string, tunnel *canbus.Cannelloni) {
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	canIf := canbus.NewIface(canInterface)
+	wg.Add(1)
+	canRx, err := canIf.Connect(&wg)
+	if err != nil {
+		log.Error("cannelloni forwarder", "can connect %v", err)
+		return
+	}
+	defer canIf.Disconnect()
+
+	wg.Add(1)
+	tunnelRx, err := tunnel.Connect(&wg)
+	if err != nil {
+		log.Error("cannelloni forwarder", "udp connect %v", err)
+		return
+	}
+	defer tunnel.Disconnect()
+
+	statsTicker := time.NewTicker(statsInterval)
+	defer statsTicker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-canRx:
+			if !ok {
+				log.Error("cannelloni forwarder", "error can rx")
+				return
+			}
+			err = tunnel.Send(&msg.Frame)
+			if err != nil {
+				log.Warn("cannelloni forwarder", "error send udp: %v", err)
+			}
+
+		case msg, ok := <-tunnelRx:
+			if !ok {
+				log.Error("cannelloni forwarder", "error udp rx")
+				return
+			}
+			err = canIf.Send(&msg.Frame)
+			if err != nil {
+				log.Error("cannelloni forwarder", "error send on can interface: %v", err)
+				return
+			}
+
+		case <-statsTicker.C:
+			stats := tunnel.Stats()
+			if stats.Lost > 0 || stats.OutOfOrder > 0 || stats.Malformed > 0 {
+				log.Warn("cannelloni forwarder", "tunnel stats: %+v", stats)
+			} else {
+				log.Info("cannelloni forwarder", "tunnel stats: %+v", stats)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________________
+ *  / _____  _  ____________/  / __|_|   /_______________   _____/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |__
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+func main() {
+	var canInterfaces = flag.String("interface", "can0", "comma separated can interfaces to expose (lookup with ifconfig)")
+	var listenerPort = flag.Uint("port", canbus.SocketcandDefaultPort, "port to bind the socketcand server")
+
+	flag.Parse()
+
+	buses := make(map[string]canbus.CanBus)
+	for _, iface := range strings.Split(*canInterfaces, ",") {
+		buses[iface] = canbus.NewIface(iface)
+	}
+
+	forwarder(buses, uint16(*listenerPort))
+}
+
+func forwarder(buses map[string]canbus.CanBus, port uint16) {
+	server := canbus.NewSocketcandServer("", port, buses)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		server.Stop()
+	}()
+
+	log.Info("socketcand forwarder", "listen on port %d", port)
+
+	err := server.ListenAndServe()
+	if err != nil {
+		log.Error("socketcand forwarder", "listen %v", err)
+	}
+}
@@ -63,6 +63,9 @@ func forwarder(canInterface string, tcpPort uint16, customParser canbus.CanFrame
 	}
 	defer tcpServer.Stop()
 
+	// a tcp message is not guaranteed to contain exactly one frame
+	clientFrames := make(map[int]*canbus.FrameBuffer)
+
 	canIf := canbus.NewIface(canInterface)
 	wg.Add(1)
 	canRx, err := canIf.Connect(&wg)
@@ -81,7 +84,7 @@ func forwarder(canInterface string, tcpPort uint16, customParser canbus.CanFrame
 				return
 			}
 
-			err = tcpServer.Broadcast(customParser.Marshal(msg))
+			err = tcpServer.Broadcast(customParser.Marshal(&msg.Frame))
 			if err != nil {
 				log.Error("tcp forwarder", "error send txp: %v", err)
 				return
@@ -93,12 +96,32 @@ func forwarder(canInterface string, tcpPort uint16, customParser canbus.CanFrame
 				return
 			}
 
-			cFrame := customParser.Unmarshal(msg.Content)
+			frames, ok := clientFrames[msg.Id]
+			if !ok {
+				frames = canbus.NewFrameBuffer(canbus.FramerFor(customParser))
+				clientFrames[msg.Id] = frames
+			}
+			_, _ = frames.Write(msg.Content)
+
+			for raw := frames.Next(); raw != nil; raw = frames.Next() {
+				cFrame := customParser.Unmarshal(raw)
+				if cFrame == nil {
+					frames.CountParseError()
+					log.Warn("tcp forwarder", "client %d: unparsable frame, %+v",
+						msg.Id, frames.Stats())
+					continue
+				}
+
+				err = canIf.Send(cFrame)
+				if err != nil {
+					log.Error("tcp forwarder", "error send on can interface: %v", err)
+					return
+				}
+			}
 
-			err = canIf.Send(cFrame)
-			if err != nil {
-				log.Error("tcp forwarder", "error send on can interface: %v", err)
-				return
+		case evnt := <-tcpEvnt:
+			if evnt.EventType == connection.DISCONNECTED {
+				delete(clientFrames, evnt.Id)
 			}
 
 		default:
@@ -0,0 +1,204 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/analyzer"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/table"
+)
+
+// correlate subcommand: ranks the bit fields of a trace by their correlation
+// with a reference, a signal decoded from the same trace or a csv column
+func correlateCli(args []string) int {
+	flags := flag.NewFlagSet("correlate", flag.ExitOnError)
+	enDecoder := flags.String("parser",
+		"Opel_Astra_H_OPC_2006", "en- decoder for parsing the -signal reference")
+	signal := flags.String("signal", "", "reference signal (name or device.name) decoded from the trace")
+	reference := flags.String("reference", "", "reference csv file, e.g. obd readings or a decode table")
+	column := flags.String("column", "", "value column of the -reference csv")
+	timeColumn := flags.String("time", "", "time column of the -reference csv (RFC 3339 or unix seconds), default the first")
+	offset := flags.Duration("offset", 0, "shift the reference in time, e.g. to match the clock of an external logger")
+	lengths := flags.String("lengths", "", "comma separated field lengths in bits (default 4,8,10,12,16,24,32)")
+	maxGap := flags.Duration("max-gap", analyzer.DefaultMaxGap, "do not interpolate reference samples further apart")
+	top := flags.Int("top", 20, "number of ranked fields, 0 for all")
+	device := flags.String("device", "",
+		"device of frames without interface (single bus traces). default the parser's first device")
+	mapping := flags.String("map", "",
+		"map trace interfaces to devices, e.g. vcan0=can1,vcan1=can0")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: can-coder correlate [options] (-signal <name> | -reference <csv> -column <name>) <trace>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || (*signal == "") == (*reference == "") || (*reference != "" && *column == "") {
+		flags.Usage()
+		return 2
+	}
+	input := flags.Arg(0)
+
+	options := analyzer.CorrelateOptions{MaxGap: *maxGap}
+	if *lengths != "" {
+		for _, field := range strings.Split(*lengths, ",") {
+			length, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || length < 1 || length > 32 {
+				fmt.Fprintf(os.Stderr, "invalid length %q, expected 1..32 bits\n", field)
+				return 2
+			}
+			options.Lengths = append(options.Lengths, length)
+		}
+	}
+
+	var (
+		series *analyzer.Series
+		err    error
+	)
+	if *signal != "" {
+		endecoder := findParser(*enDecoder)
+		if endecoder == nil {
+			fmt.Fprintf(os.Stderr, "unknown parser %q\n", *enDecoder)
+			return 1
+		}
+		decode := decodeOptions{input: input, signals: []string{*signal}, device: *device}
+		decode.devices, err = parseDeviceMap(*mapping)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		series, err = decodeSeries(endecoder, decode)
+	} else {
+		series, err = readSeries(*reference, *timeColumn, *column)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "correlate: reference: %v\n", err)
+		return 1
+	}
+	if series.Len() < 2 {
+		fmt.Fprintln(os.Stderr, "correlate: reference has less than 2 samples")
+		return 1
+	}
+	series.Shift(*offset)
+
+	reader, err := openTrace(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "correlate: %v\n", err)
+		return 1
+	}
+	results, err := analyzer.Correlate(reader, series, options)
+	reader.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "correlate: %v\n", err)
+		return 1
+	}
+
+	if *top > 0 && len(results) > *top {
+		results = results[:*top]
+	}
+	writeCorrelations(os.Stdout, results)
+	fmt.Fprintf(os.Stderr, "%d reference samples\n", series.Len())
+	return 0
+}
+
+func readSeries(path string, timeColumn string, column string) (*analyzer.Series, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return analyzer.ReadCsvSeries(file, timeColumn, column)
+}
+
+// collects the rows of a single numeric column
+type seriesWriter struct {
+	series *analyzer.Series
+}
+
+func (w *seriesWriter) WriteRow(timestamp time.Time, cells []interface{}) error {
+	if value, ok := cells[0].(float64); ok {
+		w.series.Add(timestamp, value)
+	}
+	return nil
+}
+
+func (w *seriesWriter) Close() error {
+	return nil
+}
+
+// the values of a signal decoded from the trace
+func decodeSeries(endecoder *cancoder.CancoderDef, options decodeOptions) (*analyzer.Series, error) {
+	columns, err := table.Select(table.Columns(endecoder.Cancoders), options.signals)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 1 {
+		return nil, fmt.Errorf("signal %q is ambiguous, use device.name", options.signals[0])
+	}
+	if columns[0].Text {
+		return nil, fmt.Errorf("signal %q is not numeric", options.signals[0])
+	}
+	decoders := traceDecoders(endecoder, &options)
+
+	reader, err := openTrace(options.input)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	writer := &seriesWriter{series: &analyzer.Series{}}
+	aligner := table.NewAligner(writer, 1, 0, false)
+	if _, err = decodeRecords(reader, decoders, columns, aligner, options); err != nil {
+		return nil, err
+	}
+	return writer.series, aligner.Close()
+}
+
+func writeCorrelations(w io.Writer, results []analyzer.Correlation) {
+	for i, c := range results {
+		id := fmt.Sprintf("0x%03X", c.ID)
+		if c.Extended {
+			id = fmt.Sprintf("0x%08X", c.ID)
+		}
+		iface := c.Interface
+		if iface == "" {
+			iface = "-"
+		}
+		fmt.Fprintf(w, "%3d  %s %s  %-44s r %+.4f  x %.6g %+.6g  %d samples",
+			i+1, iface, id, c.Field, c.Coefficient, c.Factor, c.Offset, c.Samples)
+		if calculation := c.Calculation(); calculation != "" {
+			fmt.Fprintf(w, "  %s", calculation)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,286 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/mdf"
+	"github.com/ChrIgiSta/go-can-coder/table"
+)
+
+type decodeOptions struct {
+	input   string
+	output  string
+	format  table.Format
+	signals []string
+	period  time.Duration
+	fill    bool
+	device  string            // device of records without interface
+	devices map[string]string // trace interface to device
+}
+
+type decodeStats struct {
+	records uint64
+	decoded uint64
+	skipped uint64 // no decoder for the interface or can fd
+	errors  uint64
+}
+
+// decode subcommand: decodes a recorded trace into a table of signals.
+// the output goes to stdout without -o, messages to stderr
+func decodeCli(args []string) int {
+	flags := flag.NewFlagSet("decode", flag.ExitOnError)
+	enDecoder := flags.String("parser",
+		"Opel_Astra_H_OPC_2006", "en- decoder for parsing can frames")
+	output := flags.String("o", "", "write the table to this file instead of stdout")
+	format := flags.String("format", "",
+		"csv, jsonl or parquet. default by -o extension (.csv, .jsonl, .parquet), else csv")
+	signals := flags.String("signals", "",
+		"comma separated signals (name or device.name) to decode, all if empty")
+	rate := flags.Float64("rate", 0,
+		"resample to a fixed rate in Hz. 0 writes a row per decoded frame")
+	fill := flags.Bool("ffill", false, "forward-fill empty cells with the last known value")
+	device := flags.String("device", "",
+		"device of frames without interface (single bus traces). default the parser's first device")
+	mapping := flags.String("map", "",
+		"map trace interfaces to devices, e.g. vcan0=can1,vcan1=can0")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: can-coder decode [options] <trace (.asc, .blf, .trc, .csv, .mf4 or candump log)>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	endecoder := findParser(*enDecoder)
+	if endecoder == nil {
+		fmt.Fprintf(os.Stderr, "unknown parser %q\n", *enDecoder)
+		return 1
+	}
+
+	options := decodeOptions{
+		input:  flags.Arg(0),
+		output: *output,
+		format: table.Format(*format),
+		device: *device,
+		fill:   *fill,
+	}
+	var err error
+	options.devices, err = parseDeviceMap(*mapping)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if options.format == "" {
+		options.format = table.FormatOf(options.output)
+	}
+	if *rate > 0 {
+		options.period = time.Duration(float64(time.Second) / *rate)
+	}
+	if *signals != "" {
+		for _, signal := range strings.Split(*signals, ",") {
+			options.signals = append(options.signals, strings.TrimSpace(signal))
+		}
+	}
+
+	stats, err := decodeTrace(endecoder, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "decode: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d frames, %d decoded, %d skipped, %d with decoder errors\n",
+		stats.records, stats.decoded, stats.skipped, stats.errors)
+	return 0
+}
+
+func findParser(name string) *cancoder.CancoderDef {
+	for i, coder := range cancoder.CancoderDefs {
+		if coder.Name == name {
+			return &cancoder.CancoderDefs[i]
+		}
+	}
+	return nil
+}
+
+// trace interfaces to devices, e.g. vcan0=can1,vcan1=can0
+func parseDeviceMap(mapping string) (map[string]string, error) {
+	devices := make(map[string]string)
+	if mapping == "" {
+		return devices, nil
+	}
+	for _, pair := range strings.Split(mapping, ",") {
+		iface, dev, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping %q, expected interface=device", pair)
+		}
+		devices[strings.TrimSpace(iface)] = strings.TrimSpace(dev)
+	}
+	return devices, nil
+}
+
+func openTrace(path string) (canbus.TraceReader, error) {
+	if isMdf(path) {
+		return mdf.OpenBus(path)
+	}
+	return canbus.OpenTrace(path)
+}
+
+// stdout is not closed by the table writer
+type nopCloser struct {
+	io.Writer
+}
+
+func decodeTrace(endecoder *cancoder.CancoderDef, options decodeOptions) (*decodeStats, error) {
+	if len(endecoder.Cancoders) == 0 {
+		return nil, errors.New("parser without cancoders")
+	}
+
+	columns := table.Columns(endecoder.Cancoders)
+	if len(options.signals) > 0 {
+		var err error
+		columns, err = table.Select(columns, options.signals)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decoders := traceDecoders(endecoder, &options)
+
+	reader, err := openTrace(options.input)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var writer table.Writer
+	if options.output == "" {
+		writer, err = table.NewWriter(nopCloser{os.Stdout}, options.format, columns)
+	} else {
+		writer, err = table.Create(options.output, options.format, columns)
+	}
+	if err != nil {
+		return nil, err
+	}
+	aligner := table.NewAligner(writer, len(columns), options.period, options.fill)
+
+	stats, err := decodeRecords(reader, decoders, columns, aligner, options)
+	if cErr := aligner.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	for _, coder := range endecoder.Cancoders {
+		for _, stat := range decoders[coder.Device].ErrorStats() {
+			fmt.Fprintf(os.Stderr, "%s 0x%x %s: %d errors, last: %v\n",
+				coder.Device, stat.ArbitrationID, stat.Name, stat.Count, stat.Last)
+		}
+	}
+	return stats, err
+}
+
+// a decoder per device. records without interface belong to the first
+// device, if the options do not name one
+func traceDecoders(endecoder *cancoder.CancoderDef, options *decodeOptions) map[string]*cancoder.Decoder {
+	decoders := make(map[string]*cancoder.Decoder)
+	for _, coder := range endecoder.Cancoders {
+		decoders[coder.Device] = cancoder.NewCanCoder(coder.Map)
+	}
+	if options.device == "" {
+		options.device = endecoder.Cancoders[0].Device
+	}
+	return decoders
+}
+
+func decodeRecords(reader canbus.TraceReader, decoders map[string]*cancoder.Decoder,
+	columns []table.Column, aligner *table.Aligner, options decodeOptions) (*decodeStats, error) {
+
+	stats := &decodeStats{}
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+		stats.records++
+
+		device := record.Interface
+		if device == "" {
+			device = options.device
+		}
+		if mapped, ok := options.devices[device]; ok {
+			device = mapped
+		}
+		decoder := decoders[device]
+		if decoder == nil || record.IsError() {
+			stats.skipped++
+			continue
+		}
+		frame, err := record.Frame()
+		if err != nil {
+			stats.skipped++
+			continue
+		}
+
+		// failing definitions are reported per definition at the end
+		values, err := decoder.DecodeAt(&frame.Frame, record.Timestamp)
+		if err != nil {
+			stats.errors++
+		}
+		if len(values) == 0 {
+			continue
+		}
+		stats.decoded++
+
+		cells := make([]interface{}, len(columns))
+		updated := false
+		for _, value := range values {
+			i := table.Index(columns, device, value.CanValueDef.Name)
+			if i < 0 {
+				continue
+			}
+			if cell := columns[i].Cell(value.CanValueDef.Value); cell != nil {
+				cells[i] = cell
+				updated = true
+			}
+		}
+		if updated {
+			if err := aligner.Add(record.Timestamp, cells); err != nil {
+				return stats, err
+			}
+		}
+	}
+}
@@ -7,7 +7,9 @@ require (
 	github.com/ChrIgiSta/go-utils v0.0.4
 	github.com/Knetic/govaluate v3.0.0+incompatible
 	github.com/angelodlfrtr/go-can v0.0.4
+	github.com/mattn/go-tty v0.0.5
 	go.bug.st/serial v1.6.2
+	golang.org/x/sys v0.13.0
 )
 
 require (
@@ -16,7 +18,5 @@ require (
 	github.com/creack/goselect v0.1.2 // indirect
 	github.com/gorilla/websocket v1.5.1 // indirect
 	github.com/mattn/go-isatty v0.0.10 // indirect
-	github.com/mattn/go-tty v0.0.5 // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
 )
@@ -29,15 +29,20 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/angelodlfrtr/go-can"
-	"github.com/mattn/go-tty"
 
 	"github.com/ChrIgiSta/go-can-coder/canbus"
 	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/mdf"
+	"github.com/ChrIgiSta/go-can-coder/router"
+	"github.com/ChrIgiSta/go-can-coder/sniffer"
 	log "github.com/ChrIgiSta/go-utils/logger"
 )
 
@@ -47,12 +52,43 @@ const (
 	NetIf  CanType = 0
 	Serial CanType = 1
 	TCP    CanType = 2
+	Replay CanType = 3
 )
 
+type traceOptions struct {
+	record  string
+	replay  string
+	speed   float64
+	mdf     string
+	mdfRaw  bool
+	logFile string // log messages while the terminal ui runs
+}
+
+type sniffOptions struct {
+	enabled bool
+	ignore  []uint32
+}
+
 // CLI to read encoded data
 func main() {
 	t := NetIf
 
+	if len(os.Args) > 1 && os.Args[1] == "decode" {
+		os.Exit(decodeCli(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		os.Exit(analyzeCli(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "correlate" {
+		os.Exit(correlateCli(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		os.Exit(simulateCli(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "trips" {
+		os.Exit(tripsCli(os.Args[2:]))
+	}
+
 	log.Debug("main", "stared")
 
 	fmt.Println("available de-encoder:")
@@ -61,7 +97,10 @@ func main() {
 	}
 
 	canDev := flag.String("device", "can0",
-		"CAN Network Interface to connect")
+		"CAN Network Interface, tcp host or serial port to connect. on its own, only the parser's first device is decoded")
+	busSpec := flag.String("buses", "",
+		"comma separated devices of the parser to open as device[=interface, host or serial port], e.g. can1=vcan0,can0=vcan1. "+
+			"default all devices on network interfaces and replays")
 	enDecoder := flag.String("parser",
 		"Opel_Astra_H_OPC_2006", "en- decoder for parsing can frames")
 	port := flag.Int("port", -1,
@@ -71,112 +110,288 @@ func main() {
 	verbose := flag.Bool("verbose", false, "print also undecodable can frames")
 	raw := flag.Bool("raw", false, "if only the raw output should displayed")
 	utf8 := flag.Bool("utf8", false, "show utf8 encoded package")
+	record := flag.String("record", "",
+		"record received frames to this trace file (.asc, .blf, .trc, .csv, .mf4 or candump log)")
+	replay := flag.String("replay", "",
+		"replay this trace file (.asc, .blf, .trc, .csv, .mf4 or candump log) instead of connecting to a bus. frames of a device's interface, or all frames of single bus traces")
+	speed := flag.Float64("speed", canbus.ReplayRealtime,
+		"replay speed factor. 0 replays as fast as possible")
+
+	mdfLog := flag.String("mdf", "", "log the decoded signals to this mdf4 file (.mf4)")
+	mdfRaw := flag.Bool("mdf-raw", false, "log also the raw frames (CAN_DataFrame) to the -mdf file")
+	sniff := flag.Bool("sniff", false,
+		"sniffer to reverse engineer signals: bit changes per id, ctrl-k marks an action (all frames, implies -verbose)")
+	ignore := flag.String("ignore", "", "sniffer: comma separated ids to ignore, e.g. 0x100,3E9")
+	logFile := flag.String("log", "",
+		"write log messages to this new file while the terminal ui runs. without, they are suppressed")
 
 	flag.Parse()
 
-	if *port > 0 {
+	if *replay != "" {
+		t = Replay
+	} else if *port > 0 {
 		t = TCP
 	} else if *baudrate > 0 {
 		t = Serial
 	}
 
+	trace := traceOptions{
+		record:  *record,
+		replay:  *replay,
+		speed:   *speed,
+		mdf:     *mdfLog,
+		mdfRaw:  *mdfRaw,
+		logFile: *logFile,
+	}
+
+	sniffing := sniffOptions{enabled: *sniff}
+	if *ignore != "" {
+		ids, err := sniffer.ParseIDs(*ignore)
+		if err != nil {
+			log.Error("main", "-ignore: %v", err)
+			return
+		}
+		sniffing.ignore = ids
+	}
+
+	if *logFile != "" {
+		// the logger cannot write to existing files
+		if _, err := os.Stat(*logFile); err == nil {
+			log.Error("main", "log file %s exists", *logFile)
+			return
+		}
+	}
+
+	deviceSet := false
+	flag.Visit(func(f *flag.Flag) {
+		deviceSet = deviceSet || f.Name == "device"
+	})
+
 	for _, coder := range cancoder.CancoderDefs {
 		if coder.Name == *enDecoder {
-			canCli(*canDev, &coder, t, *port, *baudrate, *verbose, *raw, *utf8)
+			buses, err := router.Select(&coder, router.Options{
+				Spec:      *busSpec,
+				Device:    *canDev,
+				DeviceSet: deviceSet,
+				Shared:    t == TCP || t == Serial,
+			})
+			if err != nil {
+				log.Error("main", "%v", err)
+				break
+			}
+			canCli(buses, t, *port, *baudrate, *verbose || *sniff, *raw, *utf8, trace, sniffing)
 		}
 	}
 
 	log.Info("main", "exited")
 }
 
-func help() {
-	fmt.Println("StaufiTec- CAN Tool CLI")
-	fmt.Println("")
-	fmt.Println("send:")
-	fmt.Println("     - raw: <arbitration id as hex>:<8 byte data as hex>: e.g. 160:022070d600000000")
+// commands of the cmdInterpreter, for completion
+var cliCommands = []string{"help", "quit", "dooropen", "doorclose", "winopen", "winclose"}
+
+func help() []string {
+	return []string{
+		"StaufiTec- CAN Tool CLI",
+		"",
+		"send:",
+		"     - raw: <arbitration id as hex>:<8 byte data as hex>: e.g. 160:022070d600000000",
+		"     - on another bus than the first: <device> <command>: e.g. can0 160:022070d600000000",
+		"     - " + strings.Join(cliCommands[2:], ", "),
+		"",
+		"quit: quit or ctrl-c",
+	}
 }
 
-func canCli(device string, endecoder *cancoder.CancoderDef,
-	canType CanType, port int, baudrate int, verbose bool,
-	raw bool, utf8 bool) {
+// the connection of a bus, by its endpoint
+func openBus(b *router.Bus, canType CanType, port int, baudrate int, trace traceOptions) canbus.CanBus {
+	switch canType {
+	case TCP:
+		fmt.Println("connecting to", b.Coder.Device, "via tcp", b.Endpoint, port)
+		return canbus.NewTcpClient(b.Endpoint, uint16(port))
+	case Serial:
+		fmt.Println("connecting to", b.Coder.Device, "via serial", b.Endpoint, baudrate)
+		return canbus.NewSerial(b.Endpoint, baudrate)
+	case Replay:
+		fmt.Println("replaying", b.Coder.Device, "from", trace.replay, b.Endpoint)
+		return openReplay(trace.replay, b.Endpoint, trace.speed)
+	default:
+		fmt.Println("connecting to", b.Coder.Device, "via network interface", b.Endpoint)
+		return canbus.NewIface(b.Endpoint)
+	}
+}
+
+func canCli(buses []*router.Bus, canType CanType, port int, baudrate int, verbose bool,
+	raw bool, utf8 bool, trace traceOptions, sniffing sniffOptions) {
 
 	var (
 		wg        sync.WaitGroup
-		canBus    canbus.CanBus
-		codec     cancoder.Decoder
-		inputEvnt chan bool     = make(chan bool, 1)
-		prettyOut *PrettyOutput = NewPrettyOutput()
-		inReader  *InputScanner = NewInputScanner(inputEvnt)
+		connected []*router.Bus
+		channels  []<-chan *canbus.Frame
 	)
 
 	defer wg.Wait()
 
-	go inReader.Scan()
-
-	codec = *cancoder.NewCanCoder(endecoder.Cancoders[0].Map) // add all available decoders? or select over flag?
+	var recorder canbus.TraceWriter
+	if trace.record != "" {
+		var err error
+		recorder, err = createTrace(trace.record)
+		if err != nil {
+			log.Error("cli", "cannot create record file: %v", err)
+			return
+		}
+		fmt.Println("recording to ", trace.record)
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Error("cli", "close record file: %v", err)
+			}
+		}()
+	}
 
-	switch canType {
-	case TCP:
-		fmt.Println("connecting to can via tcp ", device, port)
-		canBus = canbus.NewTcpClient(device, uint16(port))
-	case NetIf:
-		fmt.Println("connecting to can via network interface ", device)
-		canBus = canbus.NewIface(device)
-	case Serial:
-		fmt.Println("connecting to can via serial ", device, baudrate)
-		canBus = canbus.NewSerial(device, baudrate)
+	var signalLog *mdf.Writer
+	if trace.mdf != "" {
+		coders := cancoder.Cancoders{}
+		for _, bus := range buses {
+			coders = append(coders, bus.Coder)
+		}
+		var err error
+		signalLog, err = mdf.Create(trace.mdf, coders, trace.mdfRaw)
+		if err != nil {
+			log.Error("cli", "cannot create mdf file: %v", err)
+			return
+		}
+		fmt.Println("logging signals to ", trace.mdf)
+		defer signalLog.Close()
 	}
 
-	wg.Add(1)
-	canFrameCh, err := canBus.Connect(&wg)
-	if err != nil {
-		log.Error("cli", "cannot open connection to can device: %v", err)
+	for _, bus := range buses {
+		bus.CanBus = openBus(bus, canType, port, baudrate, trace)
+
+		// undecodable frames are only shown in verbose mode
+		if filterable, ok := bus.CanBus.(canbus.FilterableBus); ok && !verbose {
+			err := filterable.SetFilters(canbus.FilterIDs(bus.Coder.ArbitrationIDs()...))
+			if err != nil {
+				log.Warn("cli", "cannot set filters on %s: %v", bus.Coder.Device, err)
+			}
+		}
+
+		wg.Add(1)
+		canFrameCh, err := bus.CanBus.Connect(&wg)
+		if err != nil {
+			wg.Done()
+			log.Error("cli", "cannot open connection to can device %s: %v", bus.Coder.Device, err)
+			continue
+		}
+		defer bus.CanBus.Disconnect()
+		connected = append(connected, bus)
+		channels = append(channels, canFrameCh)
+	}
+	if len(connected) == 0 {
 		return
 	}
-	defer canBus.Disconnect()
+	frames := router.Route(connected, channels)
+
+	var sniff *sniffer.Sniffer
+	if sniffing.enabled {
+		sniff = sniffer.New()
+		for _, id := range sniffing.ignore {
+			sniff.Ignore(id)
+		}
+	}
 
+	out := newCliOutput(connected, trace.logFile, verbose, raw, utf8, sniff)
+	defer out.Close()
 	go func() {
-		for range inputEvnt {
-			typed, complete := inReader.Typed()
-			prettyOut.Print(typed)
-			if complete {
-				cmd := inReader.ReadLine()
-				// to send on can
-				cmdInterpreter(cmd, canBus)
-			}
+		// quitting the ui disconnects the buses, which ends the frame loop
+		<-out.Done()
+		for _, bus := range connected {
+			bus.CanBus.Disconnect()
 		}
 	}()
 
-	for canFrame := range canFrameCh {
-		values, err := codec.Decoder(canFrame)
-		if err != nil {
-			log.Warn("cli", "decoder: %v", err)
-		} else if values != nil {
-			// fmt.Printf("rx[decoded]: [%s]:%v%s\r\n",
-			// 	val.CanValueDef.Name,
-			// 	val.CanValueDef.Value,
-			// 	val.CanValueDef.Unit)
-			for _, val := range values {
-				if !raw {
-					prettyOut.Add(val)
-				} else {
-					prettyOut.Add(rawOut(canFrame, utf8))
-				}
+	// a silent bus decodes nothing, its values get stale by the checks
+	check := time.NewTicker(cancoder.CheckInterval)
+	defer check.Stop()
+
+	for {
+		select {
+		case received, ok := <-frames:
+			if !ok {
+				out.Wait()
+				return
 			}
-		} else {
-			// fmt.Printf("rx[encoded]: %x:%X",
-			// 	canFrame.ArbitrationID,
-			// 	canFrame.Data) // only verbose
-			if verbose {
-				prettyOut.Add(rawOut(canFrame, utf8))
+			cliFrame(received, out, recorder, signalLog, trace.mdfRaw)
+		case <-check.C:
+			for _, bus := range connected {
+				bus.Decoder.Check()
 			}
 		}
-		userIn, _ := inReader.Typed()
-		prettyOut.Print(userIn)
+		for _, bus := range connected {
+			for len(bus.States) > 0 {
+				out.State(bus.Coder.Device, <-bus.States)
+			}
+		}
+	}
+}
+
+// records, decodes and shows a received frame
+func cliFrame(received router.Frame, out cliOutput, recorder canbus.TraceWriter, signalLog *mdf.Writer, mdfRaw bool) {
+	bus, canFrame := received.Bus, received.Frame
+	device := bus.Coder.Device
+
+	if recorder != nil {
+		if err := recorder.Write(canbus.NewTraceRecord(device, canFrame)); err != nil {
+			log.Error("cli", "write trace: %v", err)
+		}
+	}
+
+	values := bus.Decode(canFrame)
+	if signalLog != nil {
+		logSignals(signalLog, device, canFrame, values, mdfRaw)
+	}
+	out.Frame(device, canFrame, len(values) > 0)
+	for _, val := range values {
+		out.Signal(device, val)
+	}
+}
+
+// mdf files are handled by the mdf package, other formats by canbus
+func isMdf(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".mf4" || ext == ".mdf"
+}
+
+func openReplay(path string, device string, speed float64) canbus.CanBus {
+	if isMdf(path) {
+		return mdf.NewBusReplay(path, device, speed)
+	}
+	return canbus.NewTraceReplay(path, device, speed)
+}
+
+func createTrace(path string) (canbus.TraceWriter, error) {
+	if isMdf(path) {
+		return mdf.CreateBus(path)
+	}
+	return canbus.CreateTrace(path)
+}
+
+func logSignals(signalLog *mdf.Writer, device string, canFrame *canbus.Frame,
+	values []*cancoder.CanValueMap, raw bool) {
+
+	if raw {
+		err := signalLog.Write(canbus.NewTraceRecord(device, canFrame))
+		if err != nil {
+			log.Warn("cli", "mdf: %v", err)
+		}
+	}
+	if len(values) > 0 {
+		err := signalLog.WriteValues(device, values)
+		if err != nil {
+			log.Warn("cli", "mdf: %v", err)
+		}
 	}
 }
 
-func rawOut(canFrame *can.Frame, utf8 bool) *cancoder.CanValueMap {
+func rawOut(canFrame *canbus.Frame, utf8 bool) *cancoder.CanValueMap {
 	spaces := ""
 	for i := 0; i < 8-int(canFrame.DLC); i++ {
 		spaces += " "
@@ -185,6 +400,7 @@ func rawOut(canFrame *can.Frame, utf8 bool) *cancoder.CanValueMap {
 	raw := &cancoder.CanValueMap{
 		ArbitrationID: canFrame.ArbitrationID,
 		OriginalData:  canFrame.Data[:],
+		Timestamp:     canFrame.Timestamp,
 		CanValueDef: cancoder.CanValueDef{
 			Name:  cancoder.CanVars(fmt.Sprintf("0x%x", canFrame.ArbitrationID)),
 			Value: fmt.Sprintf("[%d] 0x%X%s", canFrame.DLC, canFrame.Data[:canFrame.DLC], spaces),
@@ -200,46 +416,45 @@ func rawOut(canFrame *can.Frame, utf8 bool) *cancoder.CanValueMap {
 	return raw
 }
 
-func cmdInterpreter(cmd string, can canbus.CanBus) {
+// runs a command on can, returns lines to show
+func cmdInterpreter(cmd string, can canbus.CanBus) ([]string, error) {
 	if cmd == "help" {
-		help()
-		return
+		return help(), nil
 	}
 
 	sp := strings.Split(cmd, ":")
 	if len(sp) == 2 {
 		arbId, err := strconv.ParseInt(sp[0], 16, 32)
 		if err != nil {
-			log.Error("cmd", "cannot get valid arbitration id: %v", err)
-			return
+			return nil, fmt.Errorf("cannot get valid arbitration id: %v", err)
 		}
 		data, err := hex.DecodeString(sp[1])
 		if err != nil {
-			log.Error("cmd", "cannot convert data: %v", err)
-			return
+			return nil, fmt.Errorf("cannot convert data: %v", err)
 		}
-		sendRaw(can, uint32(arbId), data)
+		return nil, sendRaw(can, uint32(arbId), data)
 	} else if len(sp) == 1 {
 		switch sp[0] {
 		case "dooropen":
-			sendRaw(can, 0x160, []byte{0x02, 0x20, 0x70, 0xD6})
+			return nil, sendRaw(can, 0x160, []byte{0x02, 0x20, 0x70, 0xD6})
 		case "doorclose":
-			sendRaw(can, 0x160, []byte{0x02, 0x80, 0x70, 0xD6})
+			return nil, sendRaw(can, 0x160, []byte{0x02, 0x80, 0x70, 0xD6})
 		case "winopen":
 			// for i := 0; i < 3; i++ {
-			sendRaw(can, 0x160, []byte{0x02, 0x30, 0x70, 0xD6})
+			return nil, sendRaw(can, 0x160, []byte{0x02, 0x30, 0x70, 0xD6})
 			// 	time.Sleep(1000 * time.Millisecond)
 			// }
 		case "winclose":
 			// for i := 0; i < 3; i++ {
-			sendRaw(can, 0x160, []byte{0x02, 0xC0, 0x70, 0xD6})
+			return nil, sendRaw(can, 0x160, []byte{0x02, 0xC0, 0x70, 0xD6})
 			// 	time.Sleep(1000 * time.Millisecond)
 			// }
 		}
 	}
+	return nil, fmt.Errorf("unknown command, see help")
 }
 
-func sendRaw(canbus canbus.CanBus, arbId uint32, data []byte) {
+func sendRaw(canbus canbus.CanBus, arbId uint32, data []byte) error {
 	var data8 [8]byte
 
 	for i, b := range data {
@@ -253,133 +468,10 @@ func sendRaw(canbus canbus.CanBus, arbId uint32, data []byte) {
 		DLC:           uint8(len(data)),
 		Data:          data8,
 	}
-	// fmt.Println(frame)
 
 	err := canbus.Send(&frame)
 	if err != nil {
-		log.Error("send raw", "couldn't send frame: %v", err)
+		return fmt.Errorf("couldn't send frame: %v", err)
 	}
-}
-
-type PrettyOutput struct {
-	values    []*cancoder.CanValueMap
-	lastLines int
-	mutex     sync.Mutex
-}
-
-func NewPrettyOutput() *PrettyOutput {
-	return &PrettyOutput{
-		values:    make([]*cancoder.CanValueMap, 0),
-		lastLines: 0,
-		mutex:     sync.Mutex{},
-	}
-}
-
-func (o *PrettyOutput) Add(value *cancoder.CanValueMap) {
-	o.mutex.Lock()
-	defer o.mutex.Unlock()
-
-	for i, v := range o.values {
-		if v.CanValueDef.Name == value.CanValueDef.Name {
-			o.values[i] = value
-			return
-		}
-	}
-	o.values = append(o.values, value)
-}
-
-func (o *PrettyOutput) Print(appendix string) {
-	o.mutex.Lock()
-	defer o.mutex.Unlock()
-
-	o.clearLines(o.lastLines)
-	o.lastLines = 0
-	for _, v := range o.values {
-		o.lastLines++
-		fmt.Printf("* %s:\t %v%s\r\n",
-			v.CanValueDef.Name, v.CanValueDef.Value, v.CanValueDef.Unit)
-	}
-	if appendix != "" {
-		o.lastLines++
-		fmt.Print("\033[2K\r") // rm line
-		fmt.Println("\r > ", appendix)
-	}
-}
-
-func (o *PrettyOutput) clearLines(num int) {
-	for i := 0; i < num; i++ {
-		fmt.Print("\033[2K\r") // rm line
-		fmt.Print("\033[A")    // curser up
-	}
-}
-
-type InputScanner struct {
-	buffer string
-	event  chan<- bool
-}
-
-func NewInputScanner(event chan<- bool) *InputScanner {
-	return &InputScanner{
-		buffer: "",
-		event:  event,
-	}
-}
-
-func (s *InputScanner) Scan() {
-	tty, err := tty.Open()
-
-	if err != nil {
-		log.Error("input scaner", "open: %v", err)
-		return
-	}
-	defer tty.Close()
-
-	for err == nil {
-		var in rune
-
-		in, err = tty.ReadRune()
-
-		if in == 13 {
-			in = '\n'
-		}
-
-		if in != 127 {
-			s.buffer += string(in)
-		} else {
-			if len(s.buffer) > 0 {
-				s.buffer = s.buffer[:len(s.buffer)-1]
-			}
-		}
-
-		if s.event != nil {
-			s.event <- true
-		}
-	}
-}
-
-func (s *InputScanner) Typed() (input string, complete bool) {
-	return s.get(false)
-}
-
-func (s *InputScanner) ReadLine() (input string) {
-	text, completed := s.get(true)
-	if completed {
-		return text
-	}
-	return ""
-}
-
-func (s *InputScanner) get(rmLine bool) (text string, complete bool) {
-	if strings.ContainsAny(s.buffer, "\n") {
-		complete = true
-		indexNewLine := strings.Index(s.buffer, "\n")
-		text = s.buffer[:indexNewLine]
-		if rmLine {
-			s.buffer = s.buffer[indexNewLine+1:]
-		}
-		return
-	}
-
-	text = s.buffer
-	return
+	return nil
 }
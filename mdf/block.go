@@ -0,0 +1,271 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package mdf reads and writes ASAM MDF 4.1 measurement files (.mf4).
+// Decoded signals are logged with one channel group per arbitration id and
+// raw frames in the ASAM bus logging format (CAN_DataFrame).
+package mdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	idBlockSize     = 64
+	blockHeaderSize = 24
+
+	mdfVersion = 410
+
+	// id_unfin_flags: cycle counters and the length of the last DT block are not written yet
+	unfinishedCycleCounters = 0x0001
+	unfinishedDataLength    = 0x0004
+)
+
+// channel types and data types
+const (
+	channelFixedLength    = 0
+	channelVariableLength = 1
+	channelMaster         = 2
+
+	syncNone = 0
+	syncTime = 1
+
+	dataUnsignedLE  = 0
+	dataUnsignedBE  = 1
+	dataSignedLE    = 2
+	dataSignedBE    = 3
+	dataFloatLE     = 4
+	dataFloatBE     = 5
+	dataStringLatin = 6
+	dataStringUTF8  = 7
+	dataByteArray   = 10
+
+	channelAllInvalid   = 0x0001
+	channelInvalidation = 0x0002
+
+	conversionIdentity = 0
+	conversionLinear   = 1
+	conversionRational = 2
+
+	groupVariableLength = 0x0001
+	groupBusEvent       = 0x0002
+	groupPlainBusEvent  = 0x0004
+
+	sourceBus = 2
+	busCan    = 2
+
+	timeFlagLocal   = 0x01
+	timeFlagOffsets = 0x02
+)
+
+// a block as written to the file: header, links and data
+type block struct {
+	id    string
+	links []uint64
+	data  []byte
+}
+
+func (b *block) size() uint64 {
+	return uint64(blockHeaderSize + 8*len(b.links) + len(b.data))
+}
+
+func (b *block) bytes() []byte {
+	buf := make([]byte, blockHeaderSize, b.size())
+	copy(buf, "##"+b.id)
+	binary.LittleEndian.PutUint64(buf[8:], b.size())
+	binary.LittleEndian.PutUint64(buf[16:], uint64(len(b.links)))
+	for _, link := range b.links {
+		buf = binary.LittleEndian.AppendUint64(buf, link)
+	}
+	return append(buf, b.data...)
+}
+
+// a zero terminated text, blocks are 8 byte aligned
+func textBlock(id string, text string) *block {
+	data := append([]byte(text), 0)
+	data = append(data, make([]byte, (8-len(data)%8)%8)...)
+	return &block{id: id, data: data}
+}
+
+// little endian encoding of block data
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) put(values ...interface{}) {
+	for _, v := range values {
+		_ = binary.Write(&e.Buffer, binary.LittleEndian, v)
+	}
+}
+
+// appends blocks to a file and patches them later on
+type blockWriter struct {
+	w      io.WriteSeeker
+	offset uint64
+}
+
+// writes b at the end of the file and returns its address
+func (bw *blockWriter) write(b *block) (uint64, error) {
+	address := bw.offset
+	if _, err := bw.w.Seek(int64(address), io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := bw.w.Write(b.bytes()); err != nil {
+		return 0, err
+	}
+	bw.offset += b.size()
+	return address, nil
+}
+
+// writes a text block, an empty text is no block
+func (bw *blockWriter) text(id string, text string) (uint64, error) {
+	if text == "" {
+		return 0, nil
+	}
+	return bw.write(textBlock(id, text))
+}
+
+func (bw *blockWriter) patch(address uint64, value interface{}) error {
+	if _, err := bw.w.Seek(int64(address), io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(bw.w, binary.LittleEndian, value)
+}
+
+func idBlock(finished bool) []byte {
+	id := make([]byte, idBlockSize)
+	copy(id, "MDF     ")
+	if !finished {
+		copy(id, "UnFinMF ")
+		binary.LittleEndian.PutUint16(id[60:], unfinishedCycleCounters|unfinishedDataLength)
+	}
+	copy(id[8:], "4.10    ")
+	copy(id[16:], "CanCoder")
+	binary.LittleEndian.PutUint16(id[28:], mdfVersion)
+	return id
+}
+
+// block header and links of a block read from a file
+type blockHeader struct {
+	id     string
+	length uint64
+	links  []uint64
+	data   []byte
+}
+
+// reads the block at address. large data blocks are read by dataStream instead
+func readBlock(r io.ReaderAt, address uint64, withData bool) (*blockHeader, error) {
+	header := make([]byte, blockHeaderSize)
+	if _, err := r.ReadAt(header, int64(address)); err != nil {
+		return nil, fmt.Errorf("block at 0x%x: %v", address, err)
+	}
+	if string(header[:2]) != "##" {
+		return nil, fmt.Errorf("no block at 0x%x", address)
+	}
+	b := &blockHeader{
+		id:     string(header[2:4]),
+		length: binary.LittleEndian.Uint64(header[8:]),
+	}
+	linkCount := binary.LittleEndian.Uint64(header[16:])
+	if b.length < blockHeaderSize+8*linkCount || linkCount > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid %s block at 0x%x", b.id, address)
+	}
+
+	size := 8 * linkCount
+	if withData {
+		size = b.length - blockHeaderSize
+	}
+	if size > 1<<30 {
+		return nil, fmt.Errorf("%s block at 0x%x too large", b.id, address)
+	}
+	raw := make([]byte, size)
+	if _, err := r.ReadAt(raw, int64(address)+blockHeaderSize); err != nil {
+		return nil, fmt.Errorf("%s block at 0x%x: %v", b.id, address, err)
+	}
+	for i := uint64(0); i < linkCount; i++ {
+		b.links = append(b.links, binary.LittleEndian.Uint64(raw[8*i:]))
+	}
+	b.data = raw[8*linkCount:]
+	return b, nil
+}
+
+func (b *blockHeader) link(i int) uint64 {
+	if i >= len(b.links) {
+		return 0
+	}
+	return b.links[i]
+}
+
+// the data of the block, zero filled if the block is shorter (older versions)
+func (b *blockHeader) field(offset int, size int) []byte {
+	if offset+size > len(b.data) {
+		field := make([]byte, size)
+		if offset < len(b.data) {
+			copy(field, b.data[offset:])
+		}
+		return field
+	}
+	return b.data[offset : offset+size]
+}
+
+func (b *blockHeader) uint8(offset int) uint8 {
+	return b.field(offset, 1)[0]
+}
+
+func (b *blockHeader) uint16(offset int) uint16 {
+	return binary.LittleEndian.Uint16(b.field(offset, 2))
+}
+
+func (b *blockHeader) uint32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(b.field(offset, 4))
+}
+
+func (b *blockHeader) uint64(offset int) uint64 {
+	return binary.LittleEndian.Uint64(b.field(offset, 8))
+}
+
+func (b *blockHeader) float64(offset int) float64 {
+	return math.Float64frombits(b.uint64(offset))
+}
+
+// reads the text of a TX or MD block. xml comments are returned as they are
+func readText(r io.ReaderAt, address uint64) (string, error) {
+	if address == 0 {
+		return "", nil
+	}
+	b, err := readBlock(r, address, true)
+	if err != nil {
+		return "", err
+	}
+	if b.id != "TX" && b.id != "MD" {
+		return "", errors.New("expected a text block")
+	}
+	return string(bytes.TrimRight(b.data, "\x00")), nil
+}
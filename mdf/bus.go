@@ -0,0 +1,242 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mdf
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+)
+
+// channels of a bus logging channel group
+type busGroup struct {
+	frameType  string
+	busChannel *Channel
+	id         *Channel
+	ide        *Channel
+	dlc        *Channel
+	dir        *Channel
+	edl        *Channel
+	brs        *Channel
+	esi        *Channel
+	dataLength *Channel
+	dataBytes  *Channel
+}
+
+// records of one data group, sorted by time within
+type busStream struct {
+	records *RecordReader
+	next    *canbus.TraceRecord
+	done    bool
+}
+
+// BusReader reads the raw frames of the bus logging groups (CAN_DataFrame,
+// CAN_RemoteFrame, CAN_ErrorFrame) of a mdf file in time order
+type BusReader struct {
+	file    *File
+	groups  map[*ChannelGroup]*busGroup
+	streams []*busStream
+}
+
+func NewBusReader(file *File) (*BusReader, error) {
+	reader := &BusReader{
+		file:   file,
+		groups: make(map[*ChannelGroup]*busGroup),
+	}
+	for _, dg := range file.dataGroups {
+		found := false
+		for _, group := range dg.groups {
+			if bus := newBusGroup(group); bus != nil {
+				reader.groups[group] = bus
+				found = true
+			}
+		}
+		if found {
+			reader.streams = append(reader.streams, &busStream{records: file.records(dg)})
+		}
+	}
+	if len(reader.streams) == 0 {
+		return nil, errors.New("mdf file without can bus logging")
+	}
+	return reader, nil
+}
+
+func OpenBus(path string) (*BusReader, error) {
+	file, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewBusReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// replays the frames of a bus logging file. only frames of iface (can<BusChannel-1>)
+// are replayed, an empty iface replays all
+func NewBusReplay(path string, iface string, speed float64) *canbus.Replay {
+	return canbus.NewReplay(func() (canbus.TraceReader, error) {
+		return OpenBus(path)
+	}, iface, speed)
+}
+
+func newBusGroup(group *ChannelGroup) *busGroup {
+	frameType := ""
+	for _, name := range busFrameTypes {
+		if group.Name == name || group.Channel(name) != nil {
+			frameType = name
+		}
+	}
+	if frameType == "" {
+		return nil
+	}
+
+	member := func(name string) *Channel {
+		return findChannel(group.Channels, func(c *Channel) bool {
+			return c.Name == frameType+"."+name || c.Name == name || strings.HasSuffix(c.Name, "."+name)
+		})
+	}
+	bus := &busGroup{
+		frameType:  frameType,
+		busChannel: member("BusChannel"),
+		id:         member("ID"),
+		ide:        member("IDE"),
+		dlc:        member("DLC"),
+		dir:        member("Dir"),
+		edl:        member("EDL"),
+		brs:        member("BRS"),
+		esi:        member("ESI"),
+		dataLength: member("DataLength"),
+		dataBytes:  member("DataBytes"),
+	}
+	if bus.id == nil && frameType != CanErrorFrame {
+		return nil
+	}
+	return bus
+}
+
+func (r *BusReader) Next() (*canbus.TraceRecord, error) {
+	var first *busStream
+	for _, stream := range r.streams {
+		if stream.next == nil && !stream.done {
+			record, err := r.read(stream)
+			if err != nil {
+				return nil, err
+			}
+			stream.next = record
+			stream.done = record == nil
+		}
+		if stream.next != nil && (first == nil || stream.next.Timestamp.Before(first.next.Timestamp)) {
+			first = stream
+		}
+	}
+	if first == nil {
+		return nil, io.EOF
+	}
+	record := first.next
+	first.next = nil
+	return record, nil
+}
+
+func (r *BusReader) Close() error {
+	return r.file.Close()
+}
+
+// the next frame of the stream, nil at the end
+func (r *BusReader) read(stream *busStream) (*canbus.TraceRecord, error) {
+	for {
+		record, err := stream.records.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		bus, ok := r.groups[record.Group]
+		if !ok {
+			continue
+		}
+		return bus.traceRecord(record, r.file), nil
+	}
+}
+
+func (b *busGroup) uint(record *Record, channel *Channel) uint64 {
+	if channel == nil {
+		return 0
+	}
+	return record.Uint(channel)
+}
+
+func (b *busGroup) traceRecord(record *Record, file *File) *canbus.TraceRecord {
+	trace := &canbus.TraceRecord{
+		Tx:                  b.uint(record, b.dir) == 1,
+		FD:                  b.uint(record, b.edl) == 1,
+		BitRateSwitch:       b.uint(record, b.brs) == 1,
+		ErrorStateIndicator: b.uint(record, b.esi) == 1,
+	}
+	trace.Timestamp, _ = record.Time(file.Start)
+	if b.busChannel != nil {
+		trace.Interface = canbus.ChannelInterface(int(record.Uint(b.busChannel)))
+	}
+
+	id := uint32(b.uint(record, b.id)) & canbus.CanEffMask
+	if b.uint(record, b.ide) == 1 || id > canbus.CanSffMask {
+		id |= canbus.CanEffFlag
+	}
+	trace.ArbitrationID = id
+
+	dlc := uint8(b.uint(record, b.dlc))
+	length := int(dlc)
+	if trace.FD {
+		length = canbus.CanFdDlcToLen(dlc)
+	}
+	if b.dataLength != nil {
+		length = int(record.Uint(b.dataLength))
+	}
+
+	switch b.frameType {
+	case CanRemoteFrame:
+		trace.ArbitrationID |= canbus.CanRtrFlag
+		trace.DLC = dlc
+		return trace
+	case CanErrorFrame:
+		trace.ArbitrationID = canbus.CanErrFlag | id&canbus.CanEffMask
+	}
+
+	if b.dataBytes != nil {
+		data := record.Bytes(b.dataBytes)
+		if length > len(data) {
+			length = len(data)
+		}
+		trace.Data = append([]byte{}, data[:length]...)
+	}
+	trace.DLC = uint8(len(trace.Data))
+	return trace
+}
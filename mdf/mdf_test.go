@@ -0,0 +1,229 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/angelodlfrtr/go-can"
+)
+
+func TestBusLoggingRoundTrip(t *testing.T) {
+	start := time.Date(2024, 3, 1, 14, 30, 0, 120000000, time.Local)
+	records := []*canbus.TraceRecord{
+		{Timestamp: start, Interface: "can0", ArbitrationID: 0x108, DLC: 3, Data: []byte{0x13, 0x0c, 0xf3}},
+		{Timestamp: start.Add(1500 * time.Microsecond), Interface: "can1",
+			ArbitrationID: 0x18daf110 | canbus.CanEffFlag, DLC: 2, Data: []byte{0x01, 0x02}, Tx: true},
+		{Timestamp: start.Add(2 * time.Millisecond), Interface: "can0",
+			ArbitrationID: 0x500 | canbus.CanRtrFlag, DLC: 8},
+		{Timestamp: start.Add(3 * time.Millisecond), Interface: "can1", ArbitrationID: 0x123, DLC: 12,
+			Data: bytes.Repeat([]byte{0xde, 0xad, 0xbe}, 4), FD: true, BitRateSwitch: true},
+		{Timestamp: start.Add(4 * time.Millisecond), Interface: "can0", ArbitrationID: canbus.CanErrFlag,
+			Data: []byte{0x04, 0x00}, DLC: 2},
+	}
+
+	path := filepath.Join(t.TempDir(), "drive.mf4")
+	writer, err := CreateBus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err = writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenBus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for i, expected := range records {
+		record, err := reader.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if !record.Timestamp.Equal(expected.Timestamp) {
+			t.Errorf("record %d: timestamp %v, expected %v", i, record.Timestamp, expected.Timestamp)
+		}
+		record.Timestamp = expected.Timestamp
+		if !reflect.DeepEqual(record, expected) {
+			t.Errorf("record %d: expected %+v, got %+v", i, expected, record)
+		}
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	if _, err = reader.file.Records(reader.file.Groups[0]).Next(); err != nil {
+		t.Error(err)
+	}
+	if reader.file.Groups[0].Cycles != 3 {
+		t.Errorf("cycle counter %d", reader.file.Groups[0].Cycles)
+	}
+}
+
+func TestSignalLogging(t *testing.T) {
+	gmLan := cancoder.Cancoder{Map: cancoder.OpelAstraHOpc2006GMLan, Device: "can1"}
+	decoder := cancoder.NewCanCoder(gmLan.Map)
+
+	path := filepath.Join(t.TempDir(), "signals.mf4")
+	writer, err := Create(path, cancoder.Cancoders{gmLan}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)
+	frames := []can.Frame{
+		{ArbitrationID: uint32(cancoder.GMLanEngineSpeedRPM), DLC: 8,
+			Data: [8]byte{0x13, 0x0c, 0xf3, 0x00, 0x04, 0xe5, 0x00, 0x00}},
+		{ArbitrationID: uint32(cancoder.GMLanTPMS), DLC: 6, Data: [8]byte{0, 0, 50, 51, 52, 53}},
+		{ArbitrationID: uint32(cancoder.GMLanEngineSpeedRPM), DLC: 8,
+			Data: [8]byte{0x13, 0x10, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00}},
+	}
+	for i, frame := range frames {
+		values, err := decoder.DecodeAt(&frame, start.Add(time.Duration(i)*100*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writer.WriteValues("can1", values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if !file.Start.Equal(start) {
+		t.Errorf("start %v", file.Start)
+	}
+	var engine, tpms *ChannelGroup
+	for _, group := range file.Groups {
+		switch group.Name {
+		case "0x108":
+			engine = group
+		case "0x530":
+			tpms = group
+		}
+		if group.Source != "can1" {
+			t.Errorf("source %q", group.Source)
+		}
+	}
+	if engine == nil || tpms == nil || engine.Cycles != 2 || tpms.Cycles != 1 {
+		t.Fatalf("channel groups %+v %+v", engine, tpms)
+	}
+
+	rpm := engine.Channel(string(cancoder.EngineSpeedRPM))
+	if rpm == nil || rpm.Unit != "RPM" || rpm.Conversion == nil {
+		t.Fatalf("rpm channel %+v", rpm)
+	}
+	records := file.Records(engine)
+	expected := []float64{828.75, 1024}
+	for i, value := range expected {
+		record, err := records.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !record.Valid(rpm) || record.Float(rpm) != value {
+			t.Errorf("rpm %f, expected %f", record.Float(rpm), value)
+		}
+		timestamp, _ := record.Time(file.Start)
+		if !timestamp.Equal(start.Add(time.Duration(2*i) * 100 * time.Millisecond)) {
+			t.Errorf("time %v", timestamp)
+		}
+	}
+
+	record, err := file.Records(tpms).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pressure := record.String(tpms.Channel(string(cancoder.TPMS))); pressure != "22.042.082.12" {
+		t.Errorf("tpms %q", pressure)
+	}
+}
+
+func TestDataStream(t *testing.T) {
+	original := []byte("0123456789abcdefghij")
+
+	// transposed with 4 columns
+	transposed := make([]byte, len(original))
+	rows := len(original) / 4
+	for row := 0; row < rows; row++ {
+		for column := 0; column < 4; column++ {
+			transposed[column*rows+row] = original[row*4+column]
+		}
+	}
+	var zipped bytes.Buffer
+	z := zlib.NewWriter(&zipped)
+	_, _ = z.Write(transposed)
+	_ = z.Close()
+
+	dz := encoder{}
+	dz.put([2]byte{'D', 'T'}, uint8(1), uint8(0), uint32(4), uint64(len(original)), uint64(zipped.Len()))
+	dz.Write(zipped.Bytes())
+	dzBlock := &block{id: "DZ", data: dz.Bytes()}
+	dtBlock := &block{id: "DT", data: []byte("klmnop")}
+
+	var file bytes.Buffer
+	file.Write(make([]byte, 8))
+	dzAddress := uint64(file.Len())
+	file.Write(dzBlock.bytes())
+	dtAddress := uint64(file.Len())
+	file.Write(dtBlock.bytes())
+	dl := encoder{}
+	dl.put(uint8(0), [3]byte{}, uint32(2), uint64(0), uint64(len(original)))
+	dlAddress := uint64(file.Len())
+	file.Write((&block{id: "DL", links: []uint64{0, dzAddress, dtAddress}, data: dl.Bytes()}).bytes())
+
+	data, err := io.ReadAll(newDataStream(bytes.NewReader(file.Bytes()), dlAddress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(original)+"klmnop" {
+		t.Errorf("data %q", data)
+	}
+
+	if (&Conversion{Type: conversionLinear, Values: []float64{-40, 0.5}}).Apply(100) != 10 {
+		t.Error("linear conversion")
+	}
+}
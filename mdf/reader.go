@@ -0,0 +1,718 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+type File struct {
+	Start  time.Time
+	Groups []*ChannelGroup
+
+	r          io.ReaderAt
+	closer     io.Closer
+	dataGroups []*dataGroup
+}
+
+type dataGroup struct {
+	recordIDSize int
+	data         uint64
+	groups       []*ChannelGroup
+}
+
+type ChannelGroup struct {
+	Name       string // acquisition name
+	Source     string // acquisition source, e.g. the bus
+	Flags      uint16
+	RecordID   uint64
+	Cycles     uint64
+	DataBytes  uint32
+	InvalBytes uint32
+	Channels   []*Channel
+
+	address   uint64
+	dataGroup *dataGroup
+}
+
+type Channel struct {
+	Name        string
+	Unit        string
+	Type        uint8
+	Sync        uint8
+	DataType    uint8
+	BitOffset   uint8
+	ByteOffset  uint32
+	BitCount    uint32
+	Flags       uint32
+	InvalBitPos uint32
+	Conversion  *Conversion
+	Members     []*Channel // members of a structure
+
+	data uint64 // signal data or vlsd channel group of variable length channels
+}
+
+type Conversion struct {
+	Type   uint8
+	Values []float64
+}
+
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewFile(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	f.closer = file
+	return f, nil
+}
+
+// reads the structure of the file. the data is read by Records
+func NewFile(r io.ReaderAt) (*File, error) {
+	id := make([]byte, idBlockSize)
+	if _, err := r.ReadAt(id, 0); err != nil {
+		return nil, fmt.Errorf("mdf id: %v", err)
+	}
+	if !bytes.Equal(id[:8], []byte("MDF     ")) && !bytes.Equal(id[:8], []byte("UnFinMF ")) {
+		return nil, errors.New("not a mdf file")
+	}
+	if version := binary.LittleEndian.Uint16(id[28:]); version < 400 {
+		return nil, fmt.Errorf("mdf version %d is not supported", version)
+	}
+
+	f := &File{r: r}
+	hd, err := readBlock(r, idBlockSize, true)
+	if err != nil {
+		return nil, err
+	}
+	if hd.id != "HD" {
+		return nil, errors.New("mdf header block not found")
+	}
+	f.Start = time.Unix(0, int64(hd.uint64(0)))
+	if hd.uint8(12)&timeFlagLocal != 0 {
+		// local time without zone
+		utc := f.Start.UTC()
+		f.Start = time.Date(utc.Year(), utc.Month(), utc.Day(), utc.Hour(), utc.Minute(), utc.Second(),
+			utc.Nanosecond(), time.Local)
+	}
+
+	for address := hd.link(0); address != 0; {
+		dg, err := readBlock(r, address, true)
+		if err != nil {
+			return nil, err
+		}
+		group := &dataGroup{
+			recordIDSize: int(dg.uint8(0)),
+			data:         dg.link(2),
+		}
+		if err = f.readChannelGroups(group, dg.link(1)); err != nil {
+			return nil, err
+		}
+		f.dataGroups = append(f.dataGroups, group)
+		address = dg.link(0)
+	}
+
+	return f, nil
+}
+
+func (f *File) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *File) readChannelGroups(dg *dataGroup, address uint64) error {
+	for address != 0 {
+		cg, err := readBlock(f.r, address, true)
+		if err != nil {
+			return err
+		}
+		group := &ChannelGroup{
+			RecordID:   cg.uint64(0),
+			Cycles:     cg.uint64(8),
+			Flags:      cg.uint16(16),
+			DataBytes:  cg.uint32(24),
+			InvalBytes: cg.uint32(28),
+			address:    address,
+			dataGroup:  dg,
+		}
+		if group.Name, err = readText(f.r, cg.link(2)); err != nil {
+			return err
+		}
+		if source := cg.link(3); source != 0 {
+			si, err := readBlock(f.r, source, false)
+			if err != nil {
+				return err
+			}
+			if group.Source, err = readText(f.r, si.link(0)); err != nil {
+				return err
+			}
+		}
+		if group.Channels, err = f.readChannels(cg.link(1)); err != nil {
+			return err
+		}
+
+		dg.groups = append(dg.groups, group)
+		f.Groups = append(f.Groups, group)
+		address = cg.link(0)
+	}
+	return nil
+}
+
+func (f *File) readChannels(address uint64) ([]*Channel, error) {
+	channels := []*Channel{}
+	for address != 0 {
+		cn, err := readBlock(f.r, address, true)
+		if err != nil {
+			return nil, err
+		}
+		if cn.id != "CN" {
+			// e.g. arrays
+			break
+		}
+		channel := &Channel{
+			Type:        cn.uint8(0),
+			Sync:        cn.uint8(1),
+			DataType:    cn.uint8(2),
+			BitOffset:   cn.uint8(3),
+			ByteOffset:  cn.uint32(4),
+			BitCount:    cn.uint32(8),
+			Flags:       cn.uint32(12),
+			InvalBitPos: cn.uint32(16),
+			data:        cn.link(5),
+		}
+		if channel.Name, err = readText(f.r, cn.link(2)); err != nil {
+			return nil, err
+		}
+		if channel.Unit, err = readText(f.r, cn.link(6)); err != nil {
+			return nil, err
+		}
+		if channel.Conversion, err = f.readConversion(cn.link(4)); err != nil {
+			return nil, err
+		}
+		if channel.Members, err = f.readChannels(cn.link(1)); err != nil {
+			return nil, err
+		}
+
+		channels = append(channels, channel)
+		address = cn.link(0)
+	}
+	return channels, nil
+}
+
+func (f *File) readConversion(address uint64) (*Conversion, error) {
+	if address == 0 {
+		return nil, nil
+	}
+	cc, err := readBlock(f.r, address, true)
+	if err != nil {
+		return nil, err
+	}
+	conversion := &Conversion{Type: cc.uint8(0)}
+	for i := 0; i < int(cc.uint16(6)); i++ {
+		conversion.Values = append(conversion.Values, cc.float64(24+8*i))
+	}
+	return conversion, nil
+}
+
+// the master (time) channel of the group
+func (g *ChannelGroup) Master() *Channel {
+	for _, channel := range g.Channels {
+		if channel.Type == channelMaster && channel.Sync == syncTime {
+			return channel
+		}
+	}
+	return nil
+}
+
+// finds a channel or structure member by name
+func (g *ChannelGroup) Channel(name string) *Channel {
+	return findChannel(g.Channels, func(c *Channel) bool { return c.Name == name })
+}
+
+func findChannel(channels []*Channel, match func(c *Channel) bool) *Channel {
+	for _, channel := range channels {
+		if match(channel) {
+			return channel
+		}
+		if member := findChannel(channel.Members, match); member != nil {
+			return member
+		}
+	}
+	return nil
+}
+
+// identity, linear and rational conversions. other conversions return the raw value
+func (c *Conversion) Apply(raw float64) float64 {
+	if c == nil {
+		return raw
+	}
+	v := c.Values
+	switch {
+	case c.Type == conversionLinear && len(v) >= 2:
+		return v[0] + v[1]*raw
+	case c.Type == conversionRational && len(v) >= 6:
+		return (v[0]*raw*raw + v[1]*raw + v[2]) / (v[3]*raw*raw + v[4]*raw + v[5])
+	}
+	return raw
+}
+
+type Record struct {
+	Group *ChannelGroup
+	Data  []byte // without record id, with invalidation bytes
+
+	vlsd map[*Channel][]byte
+}
+
+// the time of the record, if the group has a master channel
+func (r *Record) Time(start time.Time) (time.Time, bool) {
+	master := r.Group.Master()
+	if master == nil {
+		return time.Time{}, false
+	}
+	seconds := r.Float(master)
+	return start.Add(time.Duration(math.Round(seconds * float64(time.Second)))), true
+}
+
+// the raw bytes of the channel, e.g. byte arrays or strings
+func (r *Record) Bytes(c *Channel) []byte {
+	if c.Type == channelVariableLength {
+		return r.vlsd[c]
+	}
+	start := int(c.ByteOffset)
+	end := start + (int(c.BitOffset)+int(c.BitCount)+7)/8
+	if end > len(r.Data) {
+		return nil
+	}
+	return r.Data[start:end]
+}
+
+// the unsigned integer value of the channel
+func (r *Record) Uint(c *Channel) uint64 {
+	size := (int(c.BitOffset) + int(c.BitCount) + 7) / 8
+	start := int(c.ByteOffset)
+	if size > 8 || start+size > len(r.Data) {
+		return 0
+	}
+	raw := make([]byte, 8)
+	value := uint64(0)
+	if c.DataType == dataUnsignedBE || c.DataType == dataSignedBE {
+		copy(raw[8-size:], r.Data[start:start+size])
+		value = binary.BigEndian.Uint64(raw)
+	} else {
+		copy(raw, r.Data[start:start+size])
+		value = binary.LittleEndian.Uint64(raw)
+	}
+	value >>= c.BitOffset
+	if c.BitCount < 64 {
+		value &= 1<<c.BitCount - 1
+	}
+	return value
+}
+
+// the physical value of a numeric channel
+func (r *Record) Float(c *Channel) float64 {
+	raw := r.Uint(c)
+	var value float64
+	switch c.DataType {
+	case dataFloatLE, dataFloatBE:
+		if c.BitCount == 32 {
+			value = float64(math.Float32frombits(uint32(raw)))
+		} else {
+			value = math.Float64frombits(raw)
+		}
+	case dataSignedLE, dataSignedBE:
+		shift := 64 - c.BitCount
+		value = float64(int64(raw<<shift) >> shift)
+	default:
+		value = float64(raw)
+	}
+	return c.Conversion.Apply(value)
+}
+
+func (r *Record) String(c *Channel) string {
+	return string(bytes.TrimRight(r.Bytes(c), "\x00"))
+}
+
+func (r *Record) Valid(c *Channel) bool {
+	if c.Flags&channelAllInvalid != 0 {
+		return false
+	}
+	if c.Flags&channelInvalidation == 0 {
+		return true
+	}
+	i := int(r.Group.DataBytes) + int(c.InvalBitPos/8)
+	if i >= len(r.Data) {
+		return true
+	}
+	return r.Data[i]&(1<<(c.InvalBitPos%8)) == 0
+}
+
+type RecordReader struct {
+	file    *File
+	dg      *dataGroup
+	stream  *bufio.Reader
+	groups  map[uint64]*ChannelGroup
+	filter  *ChannelGroup
+	pending []*Record
+	vlsd    map[*ChannelGroup]*vlsdBuffer
+	signals map[*Channel]*signalData
+}
+
+// records of a variable length channel group, by offset
+type vlsdBuffer struct {
+	offset uint64
+	values map[uint64][]byte
+}
+
+// variable length values in a signal data block
+type signalData struct {
+	stream *bufio.Reader
+	offset uint64
+}
+
+// reads the records of group in file order. io.EOF at the end
+func (f *File) Records(group *ChannelGroup) *RecordReader {
+	reader := f.records(group.dataGroup)
+	reader.filter = group
+	return reader
+}
+
+// all records of a data group
+func (f *File) records(dg *dataGroup) *RecordReader {
+	reader := &RecordReader{
+		file:    f,
+		dg:      dg,
+		stream:  bufio.NewReader(newDataStream(f.r, dg.data)),
+		groups:  make(map[uint64]*ChannelGroup),
+		vlsd:    make(map[*ChannelGroup]*vlsdBuffer),
+		signals: make(map[*Channel]*signalData),
+	}
+	for _, group := range dg.groups {
+		reader.groups[group.RecordID] = group
+	}
+	return reader
+}
+
+func (rr *RecordReader) Next() (*Record, error) {
+	for {
+		var (
+			record *Record
+			err    error
+		)
+		if len(rr.pending) > 0 {
+			record, rr.pending = rr.pending[0], rr.pending[1:]
+		} else if record, err = rr.read(); err != nil {
+			return nil, err
+		}
+		if rr.filter != nil && record.Group != rr.filter {
+			continue
+		}
+		if err = rr.resolve(record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+}
+
+// reads the next fixed length record, variable length records are buffered
+func (rr *RecordReader) read() (*Record, error) {
+	for {
+		group, err := rr.readRecordID()
+		if err != nil {
+			return nil, err
+		}
+
+		if group.Flags&groupVariableLength != 0 {
+			length := make([]byte, 4)
+			if _, err = io.ReadFull(rr.stream, length); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			value := make([]byte, binary.LittleEndian.Uint32(length))
+			if _, err = io.ReadFull(rr.stream, value); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			buffer := rr.vlsdBuffer(group)
+			buffer.values[buffer.offset] = value
+			buffer.offset += uint64(4 + len(value))
+			continue
+		}
+
+		data := make([]byte, group.DataBytes+group.InvalBytes)
+		if _, err = io.ReadFull(rr.stream, data); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return &Record{Group: group, Data: data}, nil
+	}
+}
+
+func (rr *RecordReader) readRecordID() (*ChannelGroup, error) {
+	if rr.dg.recordIDSize == 0 {
+		if len(rr.dg.groups) == 0 {
+			return nil, io.EOF
+		}
+		if _, err := rr.stream.Peek(1); err != nil {
+			return nil, err
+		}
+		return rr.dg.groups[0], nil
+	}
+
+	raw := make([]byte, 8)
+	if _, err := io.ReadFull(rr.stream, raw[:rr.dg.recordIDSize]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	id := binary.LittleEndian.Uint64(raw)
+	group, ok := rr.groups[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown record id %d", id)
+	}
+	return group, nil
+}
+
+func (rr *RecordReader) vlsdBuffer(group *ChannelGroup) *vlsdBuffer {
+	buffer, ok := rr.vlsd[group]
+	if !ok {
+		buffer = &vlsdBuffer{values: make(map[uint64][]byte)}
+		rr.vlsd[group] = buffer
+	}
+	return buffer
+}
+
+// looks up the values of variable length channels
+func (rr *RecordReader) resolve(record *Record) error {
+	for _, channel := range allChannels(record.Group.Channels) {
+		if channel.Type != channelVariableLength || channel.data == 0 {
+			continue
+		}
+		if record.vlsd == nil {
+			record.vlsd = make(map[*Channel][]byte)
+		}
+		offset := record.Uint(channel)
+
+		if group := rr.vlsdGroup(channel.data); group != nil {
+			value, err := rr.vlsdValue(group, offset)
+			if err != nil {
+				return err
+			}
+			record.vlsd[channel] = value
+			continue
+		}
+
+		value, err := rr.signalValue(channel, offset)
+		if err != nil {
+			return err
+		}
+		record.vlsd[channel] = value
+	}
+	return nil
+}
+
+func (rr *RecordReader) vlsdGroup(address uint64) *ChannelGroup {
+	for _, group := range rr.dg.groups {
+		if group.address == address {
+			return group
+		}
+	}
+	return nil
+}
+
+// reads ahead until the value is found
+func (rr *RecordReader) vlsdValue(group *ChannelGroup, offset uint64) ([]byte, error) {
+	buffer := rr.vlsdBuffer(group)
+	for {
+		if value, ok := buffer.values[offset]; ok {
+			delete(buffer.values, offset)
+			return value, nil
+		}
+		record, err := rr.read()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rr.pending = append(rr.pending, record)
+	}
+}
+
+// signal data is read in order, a value before the current position restarts the stream
+func (rr *RecordReader) signalValue(channel *Channel, offset uint64) ([]byte, error) {
+	signal, ok := rr.signals[channel]
+	if !ok || offset < signal.offset {
+		signal = &signalData{stream: bufio.NewReader(newDataStream(rr.file.r, channel.data))}
+		rr.signals[channel] = signal
+	}
+	if _, err := signal.stream.Discard(int(offset - signal.offset)); err != nil {
+		return nil, fmt.Errorf("signal data of %s: %v", channel.Name, err)
+	}
+	signal.offset = offset
+
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(signal.stream, length); err != nil {
+		return nil, fmt.Errorf("signal data of %s: %v", channel.Name, err)
+	}
+	value := make([]byte, binary.LittleEndian.Uint32(length))
+	if _, err := io.ReadFull(signal.stream, value); err != nil {
+		return nil, fmt.Errorf("signal data of %s: %v", channel.Name, err)
+	}
+	signal.offset += uint64(4 + len(value))
+	return value, nil
+}
+
+func allChannels(channels []*Channel) []*Channel {
+	all := []*Channel{}
+	for _, channel := range channels {
+		all = append(all, channel)
+		all = append(all, allChannels(channel.Members)...)
+	}
+	return all
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// the data of a DT, SD, DZ block or lists of them (DL, HL) as one stream
+type dataStream struct {
+	r       io.ReaderAt
+	blocks  []uint64
+	current io.Reader
+}
+
+func newDataStream(r io.ReaderAt, address uint64) *dataStream {
+	return &dataStream{
+		r:      r,
+		blocks: []uint64{address},
+	}
+}
+
+func (s *dataStream) Read(p []byte) (int, error) {
+	for {
+		if s.current != nil {
+			n, err := s.current.Read(p)
+			if errors.Is(err, io.EOF) {
+				s.current = nil
+				if n > 0 {
+					return n, nil
+				}
+				continue
+			}
+			return n, err
+		}
+
+		if len(s.blocks) == 0 {
+			return 0, io.EOF
+		}
+		address := s.blocks[0]
+		s.blocks = s.blocks[1:]
+		if address == 0 {
+			continue
+		}
+
+		b, err := readBlock(s.r, address, false)
+		if err != nil {
+			return 0, err
+		}
+		dataStart := address + blockHeaderSize + 8*uint64(len(b.links))
+		switch b.id {
+		case "DT", "SD", "RD", "DV":
+			s.current = io.NewSectionReader(s.r, int64(dataStart), int64(b.length)-int64(dataStart-address))
+		case "DZ":
+			data, err := s.unzip(address)
+			if err != nil {
+				return 0, err
+			}
+			s.current = bytes.NewReader(data)
+		case "DL":
+			// data blocks of the list, then the next list
+			blocks := append([]uint64{}, b.links[1:]...)
+			blocks = append(blocks, b.link(0))
+			s.blocks = append(blocks, s.blocks...)
+		case "HL":
+			s.blocks = append([]uint64{b.link(0)}, s.blocks...)
+		default:
+			return 0, fmt.Errorf("unexpected %s block in data", b.id)
+		}
+	}
+}
+
+// zip type 0 is deflate, 1 transposed and deflated
+func (s *dataStream) unzip(address uint64) ([]byte, error) {
+	dz, err := readBlock(s.r, address, true)
+	if err != nil {
+		return nil, err
+	}
+	zipType := dz.uint8(2)
+	columns := int(dz.uint32(4))
+	length := dz.uint64(8)
+	size := dz.uint64(16)
+	if 24+size > uint64(len(dz.data)) || length > 1<<30 {
+		return nil, fmt.Errorf("invalid DZ block at 0x%x", address)
+	}
+
+	z, err := zlib.NewReader(bytes.NewReader(dz.data[24 : 24+size]))
+	if err != nil {
+		return nil, fmt.Errorf("DZ block at 0x%x: %v", address, err)
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(z, data); err != nil {
+		return nil, fmt.Errorf("DZ block at 0x%x: %v", address, err)
+	}
+
+	if zipType == 1 && columns > 0 {
+		rows := len(data) / columns
+		transposed := data[:rows*columns]
+		original := make([]byte, len(data))
+		for column := 0; column < columns; column++ {
+			for row := 0; row < rows; row++ {
+				original[row*columns+column] = transposed[column*rows+row]
+			}
+		}
+		copy(original[rows*columns:], data[rows*columns:])
+		data = original
+	}
+	return data, nil
+}
@@ -0,0 +1,709 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mdf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+const (
+	// formatted values are stored with this fixed length
+	textChannelSize = 32
+
+	busSourceName = "CAN"
+)
+
+var ErrNoBusLogging = errors.New("mdf writer without bus logging")
+
+// bus logging channel groups as in the asam mdf bus logging standard
+const (
+	CanDataFrame   = "CAN_DataFrame"
+	CanRemoteFrame = "CAN_RemoteFrame"
+	CanErrorFrame  = "CAN_ErrorFrame"
+)
+
+// a member of the bus logging structure. offsets are in the record
+type busMember struct {
+	name       string
+	byteOffset uint32
+	bitOffset  uint8
+	bitCount   uint32
+	dataType   uint8
+}
+
+// record layout: timestamp (float64), structure starting at byte 8
+var busMembers = map[string][]busMember{
+	CanDataFrame: {
+		{"BusChannel", 8, 0, 8, dataUnsignedLE},
+		{"ID", 9, 0, 29, dataUnsignedLE},
+		{"IDE", 12, 7, 1, dataUnsignedLE},
+		{"DLC", 13, 0, 4, dataUnsignedLE},
+		{"Dir", 13, 4, 1, dataUnsignedLE},
+		{"EDL", 13, 5, 1, dataUnsignedLE},
+		{"BRS", 13, 6, 1, dataUnsignedLE},
+		{"ESI", 13, 7, 1, dataUnsignedLE},
+		{"DataLength", 14, 0, 8, dataUnsignedLE},
+		{"DataBytes", 15, 0, 64 * 8, dataByteArray},
+	},
+	CanRemoteFrame: {
+		{"BusChannel", 8, 0, 8, dataUnsignedLE},
+		{"ID", 9, 0, 29, dataUnsignedLE},
+		{"IDE", 12, 7, 1, dataUnsignedLE},
+		{"DLC", 13, 0, 4, dataUnsignedLE},
+		{"Dir", 13, 4, 1, dataUnsignedLE},
+		{"DataLength", 14, 0, 8, dataUnsignedLE},
+	},
+	CanErrorFrame: {
+		{"BusChannel", 8, 0, 8, dataUnsignedLE},
+		{"ID", 9, 0, 29, dataUnsignedLE},
+		{"IDE", 12, 7, 1, dataUnsignedLE},
+		{"DLC", 13, 0, 4, dataUnsignedLE},
+		{"Dir", 13, 4, 1, dataUnsignedLE},
+		{"DataLength", 14, 0, 8, dataUnsignedLE},
+		{"DataBytes", 15, 0, 8 * 8, dataByteArray},
+	},
+}
+
+var busFrameTypes = []string{CanDataFrame, CanRemoteFrame, CanErrorFrame}
+
+// a channel group in the data block
+type groupWriter struct {
+	recordID   uint64
+	address    uint64
+	cycles     uint64
+	dataBytes  int
+	invalBytes int
+}
+
+type signalKind int
+
+const (
+	signalFloat signalKind = iota
+	signalLinear
+	signalText
+)
+
+type signalChannel struct {
+	def        cancoder.CanValueDef
+	kind       signalKind
+	linear     *cancoder.LinearCalculation
+	byteOffset int
+	size       int
+	invalBit   int
+}
+
+type signalGroup struct {
+	groupWriter
+	device   string
+	id       uint32
+	channels []*signalChannel
+}
+
+type Writer struct {
+	blocks       blockWriter
+	closer       io.Closer
+	records      *bufio.Writer
+	recordIDSize int
+	dgAddress    uint64
+	fhAddress    uint64
+	dtAddress    uint64
+	dataLength   uint64
+	start        time.Time
+	started      bool
+
+	signals  map[string]map[uint32]*signalGroup // by device and arbitration id
+	bus      map[string]*groupWriter
+	channels map[string]int // bus channel numbers by interface
+	groups   []*groupWriter
+
+	mutex sync.Mutex
+}
+
+// NewWriter logs the decoded signals of coders, one channel group per device and
+// arbitration id. with busLogging, frames passed to Write are logged as CAN_DataFrame.
+// the header is updated on Close, therefore w needs to seek
+func NewWriter(w io.WriteSeeker, coders cancoder.Cancoders, busLogging bool) (*Writer, error) {
+	writer := &Writer{
+		blocks:   blockWriter{w: w},
+		signals:  make(map[string]map[uint32]*signalGroup),
+		channels: make(map[string]int),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+
+	var signalGroups []*signalGroup
+	for _, coder := range coders {
+		writer.signals[coder.Device] = make(map[uint32]*signalGroup)
+		ids := coder.ArbitrationIDs()
+		if coder.HasVirtual() {
+			ids = append(ids, cancoder.VirtualID)
+		}
+		for _, id := range ids {
+			group := newSignalGroup(coder, id)
+			writer.signals[coder.Device][id] = group
+			signalGroups = append(signalGroups, group)
+			writer.groups = append(writer.groups, &group.groupWriter)
+		}
+	}
+	if busLogging {
+		writer.bus = make(map[string]*groupWriter)
+		for _, frameType := range busFrameTypes {
+			group := &groupWriter{}
+			for _, member := range busMembers[frameType] {
+				end := int(member.byteOffset) + (int(member.bitOffset)+int(member.bitCount)+7)/8
+				if end > group.dataBytes {
+					group.dataBytes = end
+				}
+			}
+			writer.bus[frameType] = group
+			writer.groups = append(writer.groups, group)
+		}
+	}
+	if len(writer.groups) == 0 {
+		return nil, errors.New("nothing to log")
+	}
+
+	writer.recordIDSize = 1
+	if len(writer.groups) > math.MaxUint8 {
+		writer.recordIDSize = 2
+	}
+	for i, group := range writer.groups {
+		group.recordID = uint64(i + 1)
+	}
+
+	err := writer.writeHeader(signalGroups)
+	if err != nil {
+		return nil, err
+	}
+	writer.records = bufio.NewWriter(w)
+	return writer, nil
+}
+
+func Create(path string, coders cancoder.Cancoders, busLogging bool) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewWriter(file, coders, busLogging)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// a raw frame logger, e.g. for canbus.NewRecorder
+func CreateBus(path string) (*Writer, error) {
+	return Create(path, nil, true)
+}
+
+func newSignalGroup(coder cancoder.Cancoder, id uint32) *signalGroup {
+	// time first
+	group := &signalGroup{
+		groupWriter: groupWriter{dataBytes: 8},
+		device:      coder.Device,
+		id:          id,
+	}
+	for _, mapping := range coder.Map {
+		if mapping.ArbitrationID != id {
+			continue
+		}
+		channel := &signalChannel{
+			def:        mapping.CanValueDef,
+			kind:       signalFloat,
+			byteOffset: group.dataBytes,
+			size:       8,
+			invalBit:   len(group.channels),
+		}
+		if linear, ok := mapping.CanValueDef.Linear(); ok {
+			channel.kind = signalLinear
+			channel.linear = linear
+			channel.size = len(linear.Bytes)
+		} else if strings.Contains(mapping.CanValueDef.Calculation, ";") {
+			channel.kind = signalText
+			channel.size = textChannelSize
+		}
+		group.dataBytes += channel.size
+		group.channels = append(group.channels, channel)
+	}
+	group.invalBytes = (len(group.channels) + 7) / 8
+	return group
+}
+
+// id block, header, file history, channel groups, data group and the start of the data block
+func (w *Writer) writeHeader(signalGroups []*signalGroup) error {
+	if _, err := w.blocks.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.blocks.w.Write(idBlock(false)); err != nil {
+		return err
+	}
+	w.blocks.offset = idBlockSize
+	// placeholder, rewritten on Close
+	if _, err := w.blocks.write(w.headerBlock()); err != nil {
+		return err
+	}
+
+	comment, err := w.blocks.write(textBlock("MD", "<FHcomment><TX>created by go-can-coder</TX>"+
+		"<tool_id>CanCoder</tool_id><tool_vendor>Staufi Tech</tool_vendor>"+
+		"<tool_version>1.0</tool_version></FHcomment>"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, offset := now.Zone()
+	fh := encoder{}
+	fh.put(uint64(now.UnixNano()), int16(offset/60), int16(0), uint8(timeFlagOffsets), [3]byte{})
+	w.fhAddress, err = w.blocks.write(&block{id: "FH", links: []uint64{0, comment}, data: fh.Bytes()})
+	if err != nil {
+		return err
+	}
+
+	// channel groups are chained, the last one is written first
+	next := uint64(0)
+	for i := len(busFrameTypes) - 1; i >= 0 && w.bus != nil; i-- {
+		frameType := busFrameTypes[i]
+		if next, err = w.writeBusGroup(frameType, w.bus[frameType], next); err != nil {
+			return err
+		}
+	}
+	for i := len(signalGroups) - 1; i >= 0; i-- {
+		if next, err = w.writeSignalGroup(signalGroups[i], next); err != nil {
+			return err
+		}
+	}
+
+	// the data block follows the data group
+	dg := encoder{}
+	dg.put(uint8(w.recordIDSize), [7]byte{})
+	dgBlock := &block{id: "DG", links: []uint64{0, next, 0, 0}, data: dg.Bytes()}
+	w.dtAddress = w.blocks.offset + dgBlock.size()
+	dgBlock.links[2] = w.dtAddress
+	if w.dgAddress, err = w.blocks.write(dgBlock); err != nil {
+		return err
+	}
+	_, err = w.blocks.write(&block{id: "DT"})
+	return err
+}
+
+func (w *Writer) headerBlock() *block {
+	start := uint64(0)
+	if w.started {
+		start = uint64(w.start.UnixNano())
+	}
+	_, offset := w.start.Zone()
+	hd := encoder{}
+	hd.put(start, int16(offset/60), int16(0), uint8(timeFlagOffsets), uint8(0), uint8(0), uint8(0),
+		float64(0), float64(0))
+	return &block{id: "HD", links: []uint64{w.dgAddress, w.fhAddress, 0, 0, 0, 0}, data: hd.Bytes()}
+}
+
+func (w *Writer) writeSource(name string) (uint64, error) {
+	nameAddress, err := w.blocks.text("TX", name)
+	if err != nil {
+		return 0, err
+	}
+	si := encoder{}
+	si.put(uint8(sourceBus), uint8(busCan), uint8(0), [5]byte{})
+	return w.blocks.write(&block{id: "SI", links: []uint64{nameAddress, 0, 0}, data: si.Bytes()})
+}
+
+type channelBlock struct {
+	name        string
+	unit        string
+	kind        uint8
+	sync        uint8
+	dataType    uint8
+	bitOffset   uint8
+	byteOffset  uint32
+	bitCount    uint32
+	flags       uint32
+	invalBitPos uint32
+	conversion  uint64
+	composition uint64
+}
+
+func (w *Writer) writeChannel(c channelBlock, next uint64) (uint64, error) {
+	name, err := w.blocks.text("TX", c.name)
+	if err != nil {
+		return 0, err
+	}
+	unit, err := w.blocks.text("TX", c.unit)
+	if err != nil {
+		return 0, err
+	}
+	cn := encoder{}
+	cn.put(c.kind, c.sync, c.dataType, c.bitOffset, c.byteOffset, c.bitCount, c.flags, c.invalBitPos,
+		uint8(0), uint8(0), uint16(0), [6]float64{})
+	return w.blocks.write(&block{
+		id:    "CN",
+		links: []uint64{next, c.composition, name, 0, c.conversion, 0, unit, 0},
+		data:  cn.Bytes(),
+	})
+}
+
+func (w *Writer) writeTimeChannel(next uint64) (uint64, error) {
+	return w.writeChannel(channelBlock{
+		name:     "Timestamp",
+		unit:     "s",
+		kind:     channelMaster,
+		sync:     syncTime,
+		dataType: dataFloatLE,
+		bitCount: 64,
+	}, next)
+}
+
+func (w *Writer) writeGroup(group *groupWriter, name string, source uint64, flags uint16,
+	firstChannel uint64, next uint64) (uint64, error) {
+
+	acqName, err := w.blocks.text("TX", name)
+	if err != nil {
+		return 0, err
+	}
+	separator := uint16(0)
+	if flags&groupBusEvent != 0 {
+		separator = '.'
+	}
+	cg := encoder{}
+	cg.put(group.recordID, uint64(0), flags, separator, [4]byte{}, uint32(group.dataBytes),
+		uint32(group.invalBytes))
+	group.address, err = w.blocks.write(&block{
+		id:    "CG",
+		links: []uint64{next, firstChannel, acqName, source, 0, 0},
+		data:  cg.Bytes(),
+	})
+	return group.address, err
+}
+
+func (w *Writer) writeSignalGroup(group *signalGroup, next uint64) (uint64, error) {
+	channel := uint64(0)
+	var err error
+	for i := len(group.channels) - 1; i >= 0; i-- {
+		signal := group.channels[i]
+		c := channelBlock{
+			name:        string(signal.def.Name),
+			unit:        signal.def.Unit,
+			dataType:    dataFloatLE,
+			byteOffset:  uint32(signal.byteOffset),
+			bitCount:    uint32(8 * signal.size),
+			flags:       channelInvalidation,
+			invalBitPos: uint32(signal.invalBit),
+		}
+		switch signal.kind {
+		case signalText:
+			c.dataType = dataStringUTF8
+		case signalLinear:
+			c.dataType = dataUnsignedLE
+			if signal.linear.Factor != 1 || signal.linear.Offset != 0 {
+				cc := encoder{}
+				cc.put(uint8(conversionLinear), uint8(0), uint16(0), uint16(0), uint16(2),
+					float64(0), float64(0), signal.linear.Offset, signal.linear.Factor)
+				c.conversion, err = w.blocks.write(&block{id: "CC", links: []uint64{0, 0, 0, 0}, data: cc.Bytes()})
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+		if channel, err = w.writeChannel(c, channel); err != nil {
+			return 0, err
+		}
+	}
+	if channel, err = w.writeTimeChannel(channel); err != nil {
+		return 0, err
+	}
+
+	source, err := w.writeSource(group.device)
+	if err != nil {
+		return 0, err
+	}
+	name := fmt.Sprintf("0x%X", group.id)
+	if group.id == cancoder.VirtualID {
+		name = "virtual"
+	}
+	return w.writeGroup(&group.groupWriter, name, source, 0, channel, next)
+}
+
+func (w *Writer) writeBusGroup(frameType string, group *groupWriter, next uint64) (uint64, error) {
+	members := busMembers[frameType]
+	member := uint64(0)
+	var err error
+	for i := len(members) - 1; i >= 0; i-- {
+		m := members[i]
+		member, err = w.writeChannel(channelBlock{
+			name:       frameType + "." + m.name,
+			dataType:   m.dataType,
+			bitOffset:  m.bitOffset,
+			byteOffset: m.byteOffset,
+			bitCount:   m.bitCount,
+		}, member)
+		if err != nil {
+			return 0, err
+		}
+	}
+	structure, err := w.writeChannel(channelBlock{
+		name:        frameType,
+		dataType:    dataByteArray,
+		byteOffset:  8,
+		bitCount:    uint32(8 * (group.dataBytes - 8)),
+		composition: member,
+	}, 0)
+	if err != nil {
+		return 0, err
+	}
+	channel, err := w.writeTimeChannel(structure)
+	if err != nil {
+		return 0, err
+	}
+
+	source, err := w.writeSource(busSourceName)
+	if err != nil {
+		return 0, err
+	}
+	return w.writeGroup(group, frameType, source, groupBusEvent|groupPlainBusEvent, channel, next)
+}
+
+// seconds since the first record
+func (w *Writer) offset(timestamp time.Time) float64 {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	if !w.started {
+		w.start = timestamp
+		w.started = true
+	}
+	return timestamp.Sub(w.start).Seconds()
+}
+
+func (w *Writer) writeRecord(group *groupWriter, record []byte) error {
+	id := make([]byte, 8)
+	binary.LittleEndian.PutUint64(id, group.recordID)
+	if _, err := w.records.Write(id[:w.recordIDSize]); err != nil {
+		return err
+	}
+	if _, err := w.records.Write(record); err != nil {
+		return err
+	}
+	group.cycles++
+	w.dataLength += uint64(w.recordIDSize + len(record))
+	return nil
+}
+
+// WriteValues logs values decoded from the frames of device. values of
+// the same arbitration id (e.g. of one frame) share a record
+func (w *Writer) WriteValues(device string, values []*cancoder.CanValueMap) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	groups, ok := w.signals[device]
+	if !ok {
+		return fmt.Errorf("no signals of device %s", device)
+	}
+
+	for len(values) > 0 {
+		id := values[0].ArbitrationID
+		group, ok := groups[id]
+		if !ok {
+			return fmt.Errorf("no signals of arbitration id 0x%x", id)
+		}
+
+		record := make([]byte, group.dataBytes+group.invalBytes)
+		binary.LittleEndian.PutUint64(record, math.Float64bits(w.offset(values[0].Timestamp)))
+		// all invalid, unless there is a value
+		for i := group.dataBytes; i < len(record); i++ {
+			record[i] = 0xff
+		}
+
+		rest := []*cancoder.CanValueMap{}
+		for _, value := range values {
+			if value.ArbitrationID != id {
+				rest = append(rest, value)
+				continue
+			}
+			for _, channel := range group.channels {
+				if channel.def.Name == value.CanValueDef.Name && channel.put(record, value) {
+					record[group.dataBytes+channel.invalBit/8] &^= 1 << (channel.invalBit % 8)
+					break
+				}
+			}
+		}
+		values = rest
+
+		if err := w.writeRecord(&group.groupWriter, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes the value into the record, false if the value does not fit
+func (c *signalChannel) put(record []byte, value *cancoder.CanValueMap) bool {
+	field := record[c.byteOffset : c.byteOffset+c.size]
+	switch c.kind {
+	case signalLinear:
+		raw, ok := c.linear.Raw(value.OriginalData)
+		if !ok {
+			return false
+		}
+		for i := range field {
+			field[i] = uint8(raw >> (8 * i))
+		}
+	case signalText:
+		copy(field, fmt.Sprint(value.CanValueDef.Value))
+	default:
+		var number float64
+		switch v := value.CanValueDef.Value.(type) {
+		case float64:
+			number = v
+		case bool:
+			if v {
+				number = 1
+			}
+		default:
+			parsed, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+			if err != nil {
+				return false
+			}
+			number = parsed
+		}
+		binary.LittleEndian.PutUint64(field, math.Float64bits(number))
+	}
+	return true
+}
+
+// Write logs a raw frame (bus logging)
+func (w *Writer) Write(record *canbus.TraceRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.bus == nil {
+		return ErrNoBusLogging
+	}
+
+	frameType := CanDataFrame
+	switch {
+	case record.IsError():
+		frameType = CanErrorFrame
+	case record.IsRemote():
+		frameType = CanRemoteFrame
+	}
+	group := w.bus[frameType]
+
+	data := make([]byte, group.dataBytes)
+	binary.LittleEndian.PutUint64(data, math.Float64bits(w.offset(record.Timestamp)))
+	data[8] = uint8(canbus.InterfaceChannel(record.Interface, w.channels))
+	id := record.ID()
+	if record.IsError() {
+		id = record.ArbitrationID & canbus.CanEffMask
+	}
+	if record.IsExtended() {
+		id |= 1 << 31
+	}
+	binary.LittleEndian.PutUint32(data[9:], id)
+
+	length := len(record.Data)
+	dlc := uint8(length)
+	if record.IsRemote() {
+		dlc, length = record.DLC, 0
+	}
+	if record.FD {
+		dlc = canbus.CanFdLenToDlc(length)
+	}
+	flags := dlc & 0x0f
+	if record.Tx {
+		flags |= 1 << 4
+	}
+	if record.FD {
+		flags |= 1 << 5
+	}
+	if record.BitRateSwitch {
+		flags |= 1 << 6
+	}
+	if record.ErrorStateIndicator {
+		flags |= 1 << 7
+	}
+	data[13] = flags
+	length = copy(data[15:], record.Data)
+	if !record.IsRemote() {
+		data[14] = uint8(length)
+	}
+
+	return w.writeRecord(group, data)
+}
+
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.finish()
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// data block length, cycle counters, start time and the finished id
+func (w *Writer) finish() error {
+	if err := w.records.Flush(); err != nil {
+		return err
+	}
+	if err := w.blocks.patch(w.dtAddress+8, uint64(blockHeaderSize)+w.dataLength); err != nil {
+		return err
+	}
+	for _, group := range w.groups {
+		// cg_cycle_count after header, links and record id
+		if err := w.blocks.patch(group.address+blockHeaderSize+6*8+8, group.cycles); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.blocks.w.Seek(idBlockSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.blocks.w.Write(w.headerBlock().bytes()); err != nil {
+		return err
+	}
+	if _, err := w.blocks.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.blocks.w.Write(idBlock(true))
+	return err
+}
@@ -0,0 +1,225 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/router"
+	"github.com/ChrIgiSta/go-can-coder/sniffer"
+	"github.com/ChrIgiSta/go-can-coder/tui"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// the live view of the cli
+type cliOutput interface {
+	// a received frame, decoded if values were decoded from it
+	Frame(device string, frame *canbus.Frame, decoded bool)
+	Signal(device string, value *cancoder.CanValueMap)
+	// a decoded value got stale, timed out or recovered
+	State(device string, event cancoder.StateEvent)
+	// all buses closed, waits for the user to quit
+	Wait()
+	// closed, when the user quits
+	Done() <-chan struct{}
+	Close() error
+}
+
+// the terminal ui, or lines on stdout without a terminal. sniff replaces
+// signals and frames by the sniffer
+func newCliOutput(buses []*router.Bus, logFile string, verbose bool, raw bool, utf8 bool,
+	sniff *sniffer.Sniffer) cliOutput {
+
+	screen, err := tui.OpenScreen()
+	if err != nil {
+		log.Info("cli", "no terminal ui: %v", err)
+		return &lineOutput{verbose: verbose, raw: raw, utf8: utf8, sniffer: sniff,
+			done: make(chan struct{})}
+	}
+
+	// log messages would break the screen
+	if logFile != "" {
+		if err := log.ToFile(logFile); err != nil {
+			log.SetLogLevel("none")
+		}
+	} else {
+		log.SetLogLevel("none")
+	}
+
+	words := append([]string{}, cliCommands...)
+	for _, bus := range buses {
+		words = append(words, bus.Coder.Device)
+	}
+	execute := func(line string) ([]string, error) {
+		// on the first bus if not prefixed with a device
+		bus := buses[0]
+		if device, rest, ok := strings.Cut(line, " "); ok {
+			for _, b := range buses {
+				if b.Coder.Device == device {
+					bus, line = b, strings.TrimSpace(rest)
+				}
+			}
+		}
+		return cmdInterpreter(line, bus.CanBus)
+	}
+
+	title := "can-coder"
+	for _, bus := range buses {
+		title += "  " + bus.Coder.Device + ":" + bus.Endpoint
+	}
+
+	out := &tuiOutput{
+		screen: screen,
+		app:    tui.NewApp(screen, title, execute, func() []string { return words }),
+		raw:    raw,
+	}
+	if raw {
+		out.app.HideSignals()
+	}
+	if sniff != nil {
+		out.app.EnableSniffer(sniff)
+	}
+	out.running.Add(1)
+	go func() {
+		defer out.running.Done()
+		if err := out.app.Run(); err != nil {
+			log.Error("cli", "terminal ui: %v", err)
+		}
+	}()
+	return out
+}
+
+type tuiOutput struct {
+	screen  *tui.Screen
+	app     *tui.App
+	raw     bool
+	running sync.WaitGroup
+}
+
+func (o *tuiOutput) Frame(device string, frame *canbus.Frame, decoded bool) {
+	o.app.Frame(device, frame)
+}
+
+func (o *tuiOutput) Signal(device string, value *cancoder.CanValueMap) {
+	if !o.raw {
+		o.app.Signal(device, value)
+	}
+}
+
+func (o *tuiOutput) State(device string, event cancoder.StateEvent) {
+	if !o.raw {
+		o.app.State(device, event)
+	}
+}
+
+func (o *tuiOutput) Wait() {
+	o.app.Message("all buses closed. quit with ctrl-c")
+	<-o.app.Done()
+}
+
+func (o *tuiOutput) Done() <-chan struct{} {
+	return o.app.Done()
+}
+
+func (o *tuiOutput) Close() error {
+	o.app.Quit()
+	o.running.Wait()
+	err := o.screen.Close()
+	log.SetLogLevel(os.Getenv("LOG_LEVEL"))
+	return err
+}
+
+// a line per decoded value. the sniffer reports the changed bits at the end
+type lineOutput struct {
+	verbose bool
+	raw     bool
+	utf8    bool
+	sniffer *sniffer.Sniffer
+	done    chan struct{}
+}
+
+func (o *lineOutput) print(device string, value *cancoder.CanValueMap) {
+	fmt.Printf("%s %s\t%s:\t %v%s\n", value.Timestamp.Format("15:04:05.000"),
+		device, value.CanValueDef.Name, value.CanValueDef.Value, value.CanValueDef.Unit)
+}
+
+func (o *lineOutput) Frame(device string, frame *canbus.Frame, decoded bool) {
+	if o.sniffer != nil {
+		o.sniffer.Add(device, frame, frame.Timestamp)
+		return
+	}
+	if o.raw || (o.verbose && !decoded) {
+		o.print(device, rawOut(frame, o.utf8))
+	}
+}
+
+func (o *lineOutput) Signal(device string, value *cancoder.CanValueMap) {
+	if !o.raw && o.sniffer == nil {
+		o.print(device, value)
+	}
+}
+
+func (o *lineOutput) State(device string, event cancoder.StateEvent) {
+	if o.raw || o.sniffer != nil {
+		return
+	}
+	fmt.Printf("%s %s\t%s:\t %s, last update %s ago\n", event.Timestamp.Format("15:04:05.000"),
+		device, event.Value.CanValueDef.Name, event.Kind,
+		event.Timestamp.Sub(event.LastSeen).Round(time.Millisecond))
+}
+
+func (o *lineOutput) Wait() {
+	if o.sniffer == nil {
+		return
+	}
+	fmt.Println("changes per bit (byte.bit:changes):")
+	for i := 0; i < o.sniffer.Len(); i++ {
+		entry := o.sniffer.Get(i)
+		changed := []string{}
+		for bit, state := range entry.Bits {
+			if state.Changes > 0 {
+				changed = append(changed, fmt.Sprintf("%d.%d:%d", bit/8, bit%8, state.Changes))
+			}
+		}
+		fmt.Printf("%s\t0x%X\t%d frames\t%s\n", entry.Device, entry.ID, entry.Count,
+			strings.Join(changed, " "))
+	}
+}
+
+// never closed, there is nothing to quit
+func (o *lineOutput) Done() <-chan struct{} {
+	return o.done
+}
+
+func (o *lineOutput) Close() error {
+	return nil
+}
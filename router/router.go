@@ -0,0 +1,148 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package router
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+// a device of a parser with its own decoder
+type Bus struct {
+	Coder    cancoder.Cancoder
+	Endpoint string // network interface, host, serial port or interface in the trace
+	Decoder  *cancoder.Decoder
+	States   <-chan cancoder.StateEvent
+	Errors   *cancoder.ErrorLog
+	CanBus   canbus.CanBus // the connection, once opened
+}
+
+// a frame received on a bus
+type Frame struct {
+	Bus   *Bus
+	Frame *canbus.Frame
+}
+
+type Options struct {
+	// comma separated list of device[=endpoint]
+	Spec string
+	// the -device flag, endpoint of a single bus
+	Device string
+	// the device was given, only the first device is opened on it
+	DeviceSet bool
+	// tcp and serial: all devices without endpoint are opened on Device,
+	// else on an interface named as the device
+	Shared bool
+}
+
+// the parser's buses to open. without spec all devices are opened, with
+// Shared or DeviceSet only the first device on Device
+func Select(def *cancoder.CancoderDef, options Options) ([]*Bus, error) {
+	if len(def.Cancoders) == 0 {
+		return nil, fmt.Errorf("parser %s without cancoders", def.Name)
+	}
+
+	endpoint := func(coder cancoder.Cancoder) string {
+		if options.Shared {
+			return options.Device
+		}
+		return coder.Device
+	}
+
+	buses := []*Bus{}
+	if options.Spec != "" {
+		selected := map[string]bool{}
+		for _, entry := range strings.Split(options.Spec, ",") {
+			name, address, hasAddress := strings.Cut(strings.TrimSpace(entry), "=")
+			if selected[name] {
+				return nil, fmt.Errorf("device %q selected twice", name)
+			}
+			selected[name] = true
+			found := false
+			for _, coder := range def.Cancoders {
+				if coder.Device == name {
+					bus := &Bus{Coder: coder, Endpoint: address}
+					if !hasAddress {
+						bus.Endpoint = endpoint(coder)
+					}
+					buses = append(buses, bus)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("parser %s has no device %q", def.Name, name)
+			}
+		}
+	} else if options.DeviceSet || options.Shared {
+		buses = append(buses, &Bus{Coder: def.Cancoders[0], Endpoint: options.Device})
+	} else {
+		for _, coder := range def.Cancoders {
+			buses = append(buses, &Bus{Coder: coder, Endpoint: endpoint(coder)})
+		}
+	}
+
+	for _, bus := range buses {
+		bus.Decoder = cancoder.NewCanCoder(bus.Coder.Map)
+		bus.States = bus.Decoder.GetStateChannel()
+		bus.Errors = cancoder.NewErrorLog("cli "+bus.Coder.Device, 0)
+	}
+	return buses, nil
+}
+
+// decodes a frame of the bus at its receive time, errors are logged
+func (b *Bus) Decode(frame *canbus.Frame) []*cancoder.CanValueMap {
+	values, err := b.Decoder.DecodeAt(&frame.Frame, frame.Timestamp)
+	if err != nil {
+		b.Errors.Log(err)
+	}
+	return values
+}
+
+// the frames of the buses' receive channels in one channel, closed when all
+// of them are
+func Route(buses []*Bus, channels []<-chan *canbus.Frame) <-chan Frame {
+	var wg sync.WaitGroup
+
+	frames := make(chan Frame, canbus.CanbusBufferSize)
+	for i, bus := range buses {
+		wg.Add(1)
+		go func(bus *Bus, rx <-chan *canbus.Frame) {
+			defer wg.Done()
+			for frame := range rx {
+				frames <- Frame{Bus: bus, Frame: frame}
+			}
+		}(bus, channels[i])
+	}
+	go func() {
+		wg.Wait()
+		close(frames)
+	}()
+	return frames
+}
@@ -0,0 +1,133 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/angelodlfrtr/go-can"
+)
+
+var testDef = cancoder.CancoderDef{
+	Name: "test",
+	Cancoders: cancoder.Cancoders{
+		{Device: "can1", Map: []cancoder.CanValueMap{{ArbitrationID: 0x100,
+			CanValueDef: cancoder.CanValueDef{Calculation: "${0}", Condition: "1 == 1", Name: "speed"}}}},
+		{Device: "can0", Map: []cancoder.CanValueMap{{ArbitrationID: 0x100,
+			CanValueDef: cancoder.CanValueDef{Calculation: "${0} * 2", Condition: "1 == 1", Name: "volume"}}}},
+	},
+}
+
+func TestSelect(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		options Options
+		buses   []string // device=endpoint
+		err     bool
+	}{
+		{"all on interfaces", Options{Device: "can0"}, []string{"can1=can1", "can0=can0"}, false},
+		{"first on the device", Options{Device: "vcan0", DeviceSet: true}, []string{"can1=vcan0"}, false},
+		{"spec", Options{Spec: "can0=vcan1, can1", Device: "can0"}, []string{"can0=vcan1", "can1=can1"}, false},
+		{"spec over the device", Options{Spec: "can0", Device: "vcan0", DeviceSet: true}, []string{"can0=can0"}, false},
+		{"spec on serial", Options{Spec: "can0,can1=/dev/ttyUSB1", Device: "/dev/ttyUSB0", Shared: true},
+			[]string{"can0=/dev/ttyUSB0", "can1=/dev/ttyUSB1"}, false},
+		{"first on tcp or serial", Options{Device: "/dev/ttyUSB0", Shared: true}, []string{"can1=/dev/ttyUSB0"}, false},
+		{"unknown device", Options{Spec: "can1,can5"}, nil, true},
+		{"empty device", Options{Spec: "can1,"}, nil, true},
+		{"duplicate", Options{Spec: "can1=vcan0,can1=vcan1"}, nil, true},
+	} {
+		buses, err := Select(&testDef, test.options)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		selected := []string{}
+		for _, bus := range buses {
+			selected = append(selected, bus.Coder.Device+"="+bus.Endpoint)
+			if bus.Decoder == nil || bus.States == nil || bus.Errors == nil {
+				t.Errorf("%s: %s without decoder", test.name, bus.Coder.Device)
+			}
+		}
+		if len(selected) != len(test.buses) {
+			t.Errorf("%s: buses %v, expected %v", test.name, selected, test.buses)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != test.buses[i] {
+				t.Errorf("%s: buses %v, expected %v", test.name, selected, test.buses)
+				break
+			}
+		}
+	}
+
+	if _, err := Select(&cancoder.CancoderDef{Name: "empty"}, Options{}); err == nil {
+		t.Error("expected an error for a parser without cancoders")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	buses, err := Select(&testDef, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx := []chan *canbus.Frame{make(chan *canbus.Frame, 1), make(chan *canbus.Frame, 1)}
+	frames := Route(buses, []<-chan *canbus.Frame{rx[0], rx[1]})
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// the same id on both buses, decoded by the definition of its bus
+	expected := map[cancoder.CanVars]float64{"speed": 21, "volume": 42}
+	for i, ch := range rx {
+		ch <- &canbus.Frame{Frame: can.Frame{ArbitrationID: 0x100, DLC: 1, Data: [8]byte{21}},
+			Timestamp: start.Add(time.Duration(i) * time.Second)}
+		close(ch)
+	}
+	received := 0
+	for frame := range frames {
+		values := frame.Bus.Decode(frame.Frame)
+		if len(values) != 1 {
+			t.Fatalf("%s: values %v", frame.Bus.Coder.Device, values)
+		}
+		value := values[0]
+		if value.CanValueDef.Value != expected[value.CanValueDef.Name] || !value.Timestamp.Equal(frame.Frame.Timestamp) {
+			t.Errorf("%s: %s %v at %v", frame.Bus.Coder.Device, value.CanValueDef.Name,
+				value.CanValueDef.Value, value.Timestamp)
+		}
+		delete(expected, value.CanValueDef.Name)
+		received++
+	}
+	if received != 2 || len(expected) != 0 {
+		t.Errorf("received %d frames, not decoded %v", received, expected)
+	}
+}
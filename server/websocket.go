@@ -30,15 +30,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/ChrIgiSta/go-can-coder/alert"
 	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/trip"
 	"github.com/ChrIgiSta/go-easy-websockets/websocket"
 	log "github.com/ChrIgiSta/go-utils/logger"
 )
 
 type WsMsg struct {
-	Device string               `json:"device"`
-	Msg    cancoder.CanValueDef `json:"message"`
+	Device    string               `json:"device"`
+	Msg       cancoder.CanValueDef `json:"message"`
+	Timestamp time.Time            `json:"timestamp"`
+	// stale, timeout or recovered of the value in Msg. empty for decoded values
+	Event cancoder.StateEventKind `json:"event,omitempty"`
+}
+
+// an alert triggered or cleared
+type WsAlert struct {
+	Alert alert.Event `json:"alert"`
+}
+
+// a completed trip or, running, the trip in progress
+type WsTrip struct {
+	Trip    trip.Trip `json:"trip"`
+	Running bool      `json:"running,omitempty"`
+}
+
+// a client asks for the last stored trips, e.g. {"trips": 10}.
+// it is answered with WsTrips to this client
+type WsTripsRequest struct {
+	Trips    int `json:"trips"`
+	ClientId int `json:"-"`
+}
+
+type WsTrips struct {
+	Trips []trip.Trip `json:"trips"`
 }
 
 type CanFrame struct {
@@ -72,9 +100,10 @@ func NewWsServer(port uint16, path string, receiveCallback ReceiveCallback, apiK
 		rxClbk: receiveCallback,
 	}
 
-	portS := fmt.Sprintf(":%d/%s", port, path)
+	// all interfaces, the scheme is not used by the server
+	url := fmt.Sprintf("wss://:%d/%s", port, path)
 
-	ws.server = websocket.NewServer(":"+portS, &ws)
+	ws.server = websocket.NewServer(url, &ws)
 	ws.server.SetupTls(certificate, privateKey)
 	ws.server.SetAuthHeader(websocket.NewAuthHeader("X-Api-Key", apiKey, websocket.HashAlgoSHA256))
 
@@ -108,18 +137,43 @@ func (s *WsServer) Send(msg any) error {
 	return nil
 }
 
+// sends to a single client
+func (s *WsServer) SendTo(clientId int, msg any) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.server.Send(clientId, &websocket.Message{
+		MessageType: 1,
+		Data:        payload,
+	})
+}
+
 func (t *WsServer) OnReceive(msg websocket.Message) {
 	_ = log.Fine("Websocket", "onReceive: %v", msg)
 
-	var wsMsg any
-
-	if strings.ContainsAny(string(msg.Data), "message") {
-		wsMsg = WsMsg{}
-	} else if strings.ContainsAny(string(msg.Data), "arbitrationID") {
-		wsMsg = CanFrame{}
+	var (
+		wsMsg any
+		err   error
+	)
+	data := string(msg.Data)
+	switch {
+	case strings.Contains(data, `"trips"`):
+		request := WsTripsRequest{ClientId: msg.ClientId}
+		err = json.Unmarshal(msg.Data, &request)
+		wsMsg = request
+	case strings.Contains(data, `"message"`):
+		value := WsMsg{}
+		err = json.Unmarshal(msg.Data, &value)
+		wsMsg = value
+	case strings.Contains(data, `"arbitrationID"`):
+		frame := CanFrame{}
+		err = json.Unmarshal(msg.Data, &frame)
+		wsMsg = frame
+	default:
+		err = fmt.Errorf("unknown message %q", data)
 	}
 
-	err := json.Unmarshal(msg.Data, &wsMsg)
 	if err != nil {
 		log.Warn("websocket", "rx msg error: %v", err)
 	} else if t.rxClbk != nil {
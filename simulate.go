@@ -0,0 +1,195 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/simulator"
+)
+
+// simulate subcommand: sends the traffic of a simulated car on network
+// interfaces (e.g. vcan) in real time, or writes a trace as fast as possible
+func simulateCli(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	enDecoder := flags.String("parser",
+		"Opel_Astra_H_OPC_2006", "en- decoder of the simulated car")
+	scriptFile := flags.String("script", "", "script driving the vehicle model, default a drive in a loop")
+	busSpec := flags.String("buses", "",
+		"devices and their network interfaces, e.g. can1=vcan0,can0=vcan1. default all devices on their own name")
+	output := flags.String("o", "", "write a trace file instead of sending (format by extension)")
+	duration := flags.Duration("duration", 5*time.Minute, "simulated time of the -o trace")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: can-coder simulate [options]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	endecoder := findParser(*enDecoder)
+	if endecoder == nil {
+		fmt.Fprintf(os.Stderr, "unknown parser %q\n", *enDecoder)
+		return 1
+	}
+
+	var (
+		script *simulator.Script
+		err    error
+	)
+	if *scriptFile == "" {
+		script, err = simulator.ParseScript(strings.NewReader(simulator.DefaultScript))
+	} else {
+		var file *os.File
+		file, err = os.Open(*scriptFile)
+		if err == nil {
+			script, err = simulator.ParseScript(file)
+			file.Close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: script: %v\n", err)
+		return 1
+	}
+
+	sim := simulator.New(*endecoder, simulator.NewVehicle(), script, nil)
+	for _, problem := range sim.Problems() {
+		fmt.Fprintf(os.Stderr, "not simulated: %s\n", problem)
+	}
+
+	if *output != "" {
+		err = simulateTrace(sim, *output, *duration)
+	} else {
+		err = simulateBuses(sim, endecoder.Cancoders, *busSpec)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func simulateTrace(sim *simulator.Simulator, path string, duration time.Duration) error {
+	writer, err := createTrace(path)
+	if err != nil {
+		return err
+	}
+	frames := 0
+	start := time.Now()
+	for elapsed := time.Duration(0); elapsed <= duration; elapsed += simulator.Tick {
+		outputs, running := sim.Step(start.Add(elapsed))
+		for _, output := range outputs {
+			if err = writer.Write(canbus.NewTraceRecord(output.Device, output.Frame)); err != nil {
+				writer.Close()
+				return err
+			}
+			frames++
+		}
+		if !running {
+			break
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d frames written\n", frames)
+	return writer.Close()
+}
+
+func simulateBuses(sim *simulator.Simulator, coders cancoder.Cancoders, spec string) error {
+	interfaces := map[string]string{}
+	for _, coder := range coders {
+		interfaces[coder.Device] = coder.Device
+	}
+	if spec != "" {
+		interfaces = map[string]string{}
+		for _, entry := range strings.Split(spec, ",") {
+			device, iface, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				iface = device
+			}
+			interfaces[device] = iface
+		}
+	}
+
+	var wg sync.WaitGroup
+	buses := map[string]canbus.CanBus{}
+	defer func() {
+		for _, bus := range buses {
+			bus.Disconnect()
+		}
+		wg.Wait()
+	}()
+	for device, iface := range interfaces {
+		bus := canbus.NewIface(iface)
+		wg.Add(1)
+		rx, err := bus.Connect(&wg)
+		if err != nil {
+			wg.Done()
+			return fmt.Errorf("connect %s on %s: %w", device, iface, err)
+		}
+		buses[device] = bus
+		// the own frames and the ones of other nodes are not needed
+		go func() {
+			for range rx {
+			}
+		}()
+		fmt.Fprintf(os.Stderr, "simulating %s on %s\n", device, iface)
+	}
+
+	done := make(chan struct{})
+	var simulation sync.WaitGroup
+	simulation.Add(1)
+	sim.Start(&simulation, func(output simulator.Output) error {
+		bus, ok := buses[output.Device]
+		if !ok {
+			return nil
+		}
+		return bus.Send(&output.Frame.Frame)
+	})
+	go func() {
+		simulation.Wait()
+		close(done)
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-interrupt:
+		sim.Stop()
+		<-done
+	case <-done:
+	}
+	return nil
+}
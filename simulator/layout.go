@@ -0,0 +1,215 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// a signal of a layout. signals without linear calculation are constant,
+// e.g. the bus wakeup, and mark the frame as present
+type field struct {
+	mapping cancoder.CanValueMap
+	linear  *cancoder.LinearCalculation
+}
+
+// a frame of an id: the bytes required by the conditions of its
+// definitions and the signals encoded into it. multiplexed ids have a
+// layout per condition
+type layout struct {
+	device     string
+	id         uint32
+	period     time.Duration // 0 sends on changes
+	conditions map[int]byte
+	fields     []field
+
+	next     time.Time
+	observed map[cancoder.CanVars]float64 // of event layouts
+}
+
+func conditionKey(conditions map[int]byte) string {
+	keys := []string{}
+	for i, value := range conditions {
+		keys = append(keys, fmt.Sprintf("%d=%02x", i, value))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// the layouts of the definitions of a device. definitions, which cannot be
+// encoded, are reported as problems
+func layouts(coder cancoder.Cancoder, periods map[uint32]time.Duration) ([]*layout, []string) {
+	var (
+		result   []*layout
+		problems []string
+		byKey    = map[string]*layout{}
+		free     = map[uint32][]field{} // without conditions
+	)
+	period := func(id uint32) time.Duration {
+		if p, ok := periods[id]; ok {
+			return p
+		}
+		return DefaultPeriod
+	}
+
+	for _, mapping := range coder.Map {
+		def := mapping.CanValueDef
+		// virtual signals follow from the others
+		if def.Name == "" || mapping.IsVirtual() {
+			continue
+		}
+		if err := mapping.Invertible(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", coder.Device, err))
+			continue
+		}
+		f := field{mapping: mapping}
+		if linear, ok := def.Linear(); ok {
+			f.linear = linear
+		}
+		conditions, _ := def.ConditionBytes()
+		if len(conditions) == 0 {
+			free[mapping.ArbitrationID] = append(free[mapping.ArbitrationID], f)
+			continue
+		}
+		key := fmt.Sprintf("%x:%s", mapping.ArbitrationID, conditionKey(conditions))
+		l := byKey[key]
+		if l == nil {
+			l = &layout{device: coder.Device, id: mapping.ArbitrationID, period: period(mapping.ArbitrationID),
+				conditions: conditions}
+			byKey[key] = l
+			result = append(result, l)
+		}
+		l.fields = append(l.fields, f)
+	}
+
+	// signals without conditions fit into every layout of the id, unless
+	// they overlap its condition bytes. the others get a layout of their own
+	ids := []uint32{}
+	for id := range free {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		var own *layout
+		for _, f := range free[id] {
+			placed := false
+			for _, l := range result {
+				if l.id == id && len(l.conditions) > 0 && !f.overlaps(l.conditions) {
+					l.fields = append(l.fields, f)
+					placed = true
+				}
+			}
+			if !placed {
+				if own == nil {
+					own = &layout{device: coder.Device, id: id, period: period(id), conditions: map[int]byte{}}
+					result = append(result, own)
+				}
+				own.fields = append(own.fields, f)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, problems
+}
+
+func (f field) overlaps(conditions map[int]byte) bool {
+	if f.linear == nil {
+		return false
+	}
+	for _, i := range f.linear.Bytes {
+		if _, ok := conditions[i]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// the frame with the signals. false, if none of its signals has a value.
+// values are limited to the range of their bytes
+func (l *layout) encode(signals map[cancoder.CanVars]float64, timestamp time.Time) (*canbus.Frame, bool) {
+	frame := &canbus.Frame{Timestamp: timestamp}
+	frame.ArbitrationID = l.id
+	for i, value := range l.conditions {
+		frame.Data[i] = value
+		if i+1 > int(frame.DLC) {
+			frame.DLC = uint8(i + 1)
+		}
+	}
+	present := false
+	for _, f := range l.fields {
+		value, ok := signals[f.mapping.CanValueDef.Name]
+		if !ok {
+			continue
+		}
+		present = true
+		if f.linear == nil {
+			continue
+		}
+		low, high := f.linear.Limits()
+		mapping := f.mapping
+		mapping.CanValueDef.Value = math.Max(low, math.Min(high, value))
+		if err := cancoder.EncodeInto(&frame.Frame, &mapping); err != nil {
+			log.Warn("simulator", "%v", err)
+		}
+	}
+	return frame, present
+}
+
+// event layouts are sent, when one of their signals changes
+func (l *layout) changed(signals map[cancoder.CanVars]float64) bool {
+	changed := false
+	for _, f := range l.fields {
+		value, ok := signals[f.mapping.CanValueDef.Name]
+		last, seen := l.observed[f.mapping.CanValueDef.Name]
+		if ok != seen || (ok && value != last) {
+			changed = true
+		}
+		if ok {
+			l.observed[f.mapping.CanValueDef.Name] = value
+		} else {
+			delete(l.observed, f.mapping.CanValueDef.Name)
+		}
+	}
+	return changed && l.present(signals)
+}
+
+func (l *layout) present(signals map[cancoder.CanVars]float64) bool {
+	for _, f := range l.fields {
+		if _, ok := signals[f.mapping.CanValueDef.Name]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package simulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+// the drive of the simulate subcommand without a script
+const DefaultScript = `# park, start and drive through town and on the highway
+door front-left open
+wait 2s
+door front-left close
+ignition on
+wait 2s
+start
+wait 5s
+lights low
+drive 50 8s
+wait 30s
+drive 30
+wait 10s
+drive 120 20s
+wait 60s
+drive 0 15s
+wait 20s
+stop
+lights off
+ignition off
+wait 15s
+loop
+`
+
+var doors = map[string]byte{
+	"front-left":  cancoder.DOOR_STATE_FRONT_LEFT_OPEN,
+	"front-right": cancoder.DOOR_STATE_FRONT_RIGHT_OPPEN,
+	"back-left":   cancoder.DOOR_STATE_BACK_LEFT_OPEN,
+	"back-right":  cancoder.DOOR_STATE_BACK_RIGHT_OPEN,
+	"trunk":       cancoder.DOOR_STATE_TRUNK_OPEN,
+}
+
+var lights = map[string]byte{
+	"off":     cancoder.DRIVING_LIGHT_OFF,
+	"parking": cancoder.DRIVING_LIGHT_PARKING,
+	"low":     cancoder.DRIVING_LIGHT_LOW_BEAM,
+}
+
+type command struct {
+	line int
+	run  func(v *Vehicle)
+	wait time.Duration
+}
+
+// a sequence of commands, one per line. # starts a comment
+//
+//	ignition on|off       start, stop (engine)
+//	drive <km/h> [<dur>]  accelerate or brake to the speed within the duration
+//	door <front-left|front-right|back-left|back-right|trunk> open|close
+//	lights off|parking|low
+//	outdoor <°C>          fuel <l>
+//	set <signal> = <value>, unset <signal>  override a signal, e.g. a key press
+//	wait <dur>            loop (start over)
+type Script struct {
+	commands []command
+	loop     bool
+
+	next    int
+	waiting time.Time
+}
+
+func ParseScript(r io.Reader) (*Script, error) {
+	script := &Script{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if script.loop {
+			return nil, fmt.Errorf("line %d: commands after loop", line)
+		}
+		cmd, err := parseCommand(fields, text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if cmd == nil {
+			script.loop = true
+			continue
+		}
+		cmd.line = line
+		script.commands = append(script.commands, *cmd)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if script.loop {
+		waits := false
+		for _, cmd := range script.commands {
+			waits = waits || cmd.wait > 0
+		}
+		if !waits {
+			return nil, fmt.Errorf("loop without wait")
+		}
+	}
+	return script, nil
+}
+
+// nil for loop
+func parseCommand(fields []string, text string) (*command, error) {
+	args := fields[1:]
+	expect := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s: expected %d arguments", fields[0], n)
+		}
+		return nil
+	}
+
+	switch fields[0] {
+	case "loop":
+		return nil, expect(0)
+	case "wait":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return &command{wait: d}, nil
+	case "ignition":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		if args[0] != "on" && args[0] != "off" {
+			return nil, fmt.Errorf("ignition: expected on or off")
+		}
+		on := args[0] == "on"
+		return &command{run: func(v *Vehicle) { v.SetIgnition(on) }}, nil
+	case "start":
+		return &command{run: func(v *Vehicle) { v.Start() }}, expect(0)
+	case "stop":
+		return &command{run: func(v *Vehicle) { v.Stop() }}, expect(0)
+	case "drive":
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("drive: expected speed and optional duration")
+		}
+		speed, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		duration := time.Duration(0)
+		if len(args) == 2 {
+			if duration, err = time.ParseDuration(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		return &command{run: func(v *Vehicle) { v.Drive(speed, duration) }}, nil
+	case "door":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+		door, ok := doors[args[0]]
+		if !ok || (args[1] != "open" && args[1] != "close") {
+			return nil, fmt.Errorf("door: unknown door %q or state %q", args[0], args[1])
+		}
+		open := args[1] == "open"
+		return &command{run: func(v *Vehicle) { v.SetDoor(door, open) }}, nil
+	case "lights":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		light, ok := lights[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("lights: unknown state %q", args[0])
+		}
+		return &command{run: func(v *Vehicle) { v.Lights = light }}, nil
+	case "outdoor", "fuel":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		if fields[0] == "fuel" {
+			return &command{run: func(v *Vehicle) { v.Fuel = value }}, nil
+		}
+		return &command{run: func(v *Vehicle) { v.Outdoor = value }}, nil
+	case "set":
+		name, value, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "set")), "=")
+		if !ok {
+			return nil, fmt.Errorf("set: expected <signal> = <value>")
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			// hex like in the definitions, e.g. 0x80
+			u, hexErr := strconv.ParseUint(strings.TrimSpace(value), 0, 64)
+			if hexErr != nil {
+				return nil, err
+			}
+			number = float64(u)
+		}
+		signal := cancoder.CanVars(strings.TrimSpace(name))
+		return &command{run: func(v *Vehicle) { v.Set(signal, number) }}, nil
+	case "unset":
+		signal := cancoder.CanVars(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "unset")))
+		if signal == "" {
+			return nil, fmt.Errorf("unset: expected a signal")
+		}
+		return &command{run: func(v *Vehicle) { v.Unset(signal) }}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", fields[0])
+}
+
+// runs the commands due at now. false at the end of a script without loop
+func (s *Script) Advance(v *Vehicle, now time.Time) bool {
+	for now.After(s.waiting) || now.Equal(s.waiting) {
+		if s.next >= len(s.commands) {
+			if !s.loop || len(s.commands) == 0 {
+				return false
+			}
+			s.next = 0
+		}
+		cmd := s.commands[s.next]
+		s.next++
+		if cmd.run != nil {
+			cmd.run(v)
+		}
+		if cmd.wait > 0 {
+			s.waiting = now.Add(cmd.wait)
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package simulator generates the periodic traffic of a car for a cancoder
+// definition, driven by a scriptable vehicle model. values are encoded
+// inversely through the definitions
+package simulator
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const (
+	// of ids without known period
+	DefaultPeriod = 500 * time.Millisecond
+	// resolution of the model and the schedule
+	Tick = 10 * time.Millisecond
+)
+
+// cycle times per parser and id. 0 sends the id on changes, e.g. keys
+var Periods = map[string]map[uint32]time.Duration{
+	cancoder.OpelAstraHOpc2006.Name: OpelAstraHOpc2006Periods,
+}
+
+// approximate cycle times, keys, buttons and display texts are sent on changes
+var OpelAstraHOpc2006Periods = map[uint32]time.Duration{
+	uint32(cancoder.GMLanBusWakeup):          0,
+	uint32(cancoder.GMLanEngineSpeedRPM):     100 * time.Millisecond,
+	uint32(cancoder.GMLanTraveledDistance):   100 * time.Millisecond,
+	uint32(cancoder.GMLanFullInjection):      500 * time.Millisecond,
+	uint32(cancoder.GMLanCoolant):            1 * time.Second,
+	uint32(cancoder.GMLanRemoteKey):          0,
+	uint32(cancoder.GMLanWeelRemoteControll): 0,
+	uint32(cancoder.GMLanMilage):             1 * time.Second,
+	uint32(cancoder.GMLanDoorState):          500 * time.Millisecond,
+	uint32(cancoder.GMLanLedBrightness):      1 * time.Second,
+	uint32(cancoder.GMLanLightSwitch):        500 * time.Millisecond,
+	uint32(cancoder.GMLanLightLevler):        1 * time.Second,
+	uint32(cancoder.GMLanClutchBreak):        100 * time.Millisecond,
+	uint32(cancoder.GMLanLightBack):          500 * time.Millisecond,
+	uint32(cancoder.GMLanFullLevel):          1 * time.Second,
+	uint32(cancoder.GMLanSysTime):            1 * time.Second,
+	uint32(cancoder.GMLanOutputTemperature):  1 * time.Second,
+	uint32(cancoder.GMLanBatteryVoltage):     1 * time.Second,
+	uint32(cancoder.GMLanTPMS):               5 * time.Second,
+
+	uint32(cancoder.EntertainmentCANDate):                 1 * time.Second,
+	uint32(cancoder.EntertainmentCANDistance):             500 * time.Millisecond,
+	uint32(cancoder.EntertainmentCANRadioButtons):         0,
+	uint32(cancoder.EntertainmentCANSteeringWheelButtons): 0,
+	uint32(cancoder.EntertainmentCANACKnobs):              0,
+	uint32(cancoder.EntertainmentCANEngineMotion):         100 * time.Millisecond,
+	uint32(cancoder.EntertainmentCANEngineTemperature):    1 * time.Second,
+	uint32(cancoder.EntertainmentCANFullInjection):        500 * time.Millisecond,
+	uint32(cancoder.EntertainmentCANRange):                1 * time.Second,
+	uint32(cancoder.EntertainmentCANDisplayTemperature):   1 * time.Second,
+	uint32(cancoder.EntertainmentCANSensorTemperature):    1 * time.Second,
+	uint32(cancoder.EntertainmentCANTPMSPressure):         5 * time.Second,
+	uint32(cancoder.EntertainmentCANTPMSBattery):          5 * time.Second,
+	uint32(cancoder.EntertainmentCANFullLevel):            1 * time.Second,
+	uint32(cancoder.EntertainmentCANDisplayData):          0,
+	uint32(cancoder.EntertainmentCANAirConditioner):       0,
+}
+
+// a frame to send on the bus of the device
+type Output struct {
+	Device string
+	Frame  *canbus.Frame
+}
+
+// not safe for concurrent use, except Start and Stop
+type Simulator struct {
+	vehicle  *Vehicle
+	script   *Script
+	layouts  []*layout
+	problems []string
+	last     time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// periods nil takes the ones of the parser, if known
+func New(def cancoder.CancoderDef, vehicle *Vehicle, script *Script, periods map[uint32]time.Duration) *Simulator {
+	if periods == nil {
+		periods = Periods[def.Name]
+	}
+	s := &Simulator{vehicle: vehicle, script: script}
+	for _, coder := range def.Cancoders {
+		layouts, problems := layouts(coder, periods)
+		s.layouts = append(s.layouts, layouts...)
+		s.problems = append(s.problems, problems...)
+	}
+	return s
+}
+
+// definitions, which are not simulated
+func (s *Simulator) Problems() []string {
+	return s.problems
+}
+
+func (s *Simulator) Vehicle() *Vehicle {
+	return s.vehicle
+}
+
+// advances the script and the model to now and returns the frames due.
+// false, when the script ended
+func (s *Simulator) Step(now time.Time) ([]Output, bool) {
+	running := true
+	if s.script != nil {
+		running = s.script.Advance(s.vehicle, now)
+	}
+	if s.last.IsZero() {
+		// spread the first frames over their period, as the ecus do
+		for _, l := range s.layouts {
+			if l.period > 0 {
+				l.next = now.Add(time.Duration(l.id*7919) % l.period)
+			}
+			l.observed = map[cancoder.CanVars]float64{}
+		}
+	} else {
+		s.vehicle.Step(now.Sub(s.last))
+	}
+	s.last = now
+
+	signals := s.vehicle.Signals()
+	awake := s.vehicle.Awake()
+	outputs := []Output{}
+	for _, l := range s.layouts {
+		if l.period == 0 {
+			if !l.changed(signals) {
+				continue
+			}
+		} else {
+			if now.Before(l.next) {
+				continue
+			}
+			for !now.Before(l.next) {
+				l.next = l.next.Add(l.period)
+			}
+			if !awake {
+				continue
+			}
+		}
+		if frame, ok := l.encode(signals, now); ok {
+			outputs = append(outputs, Output{Device: l.device, Frame: frame})
+		}
+	}
+	sort.SliceStable(outputs, func(i, j int) bool { return outputs[i].Frame.ArbitrationID < outputs[j].Frame.ArbitrationID })
+	return outputs, running
+}
+
+// runs the simulation in real time until Stop or the end of the script and
+// passes the frames to send
+func (s *Simulator) Start(wg *sync.WaitGroup, send func(output Output) error) {
+	s.stop = make(chan struct{})
+	s.once = sync.Once{}
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(Tick)
+		defer ticker.Stop()
+
+		for {
+			outputs, running := s.Step(time.Now())
+			for _, output := range outputs {
+				if err := send(output); err != nil {
+					log.Warn("simulator", "send 0x%x on %s: %v", output.Frame.ArbitrationID, output.Device, err)
+				}
+			}
+			if !running {
+				log.Info("simulator", "script ended")
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Simulator) Stop() {
+	if s.stop != nil {
+		s.once.Do(func() { close(s.stop) })
+	}
+}
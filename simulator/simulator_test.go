@@ -0,0 +1,124 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package simulator
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestScript(t *testing.T) {
+	for _, script := range []string{"drive fast", "door hood open", "loop\nstart", "start\nloop", "set Speed 10"} {
+		if _, err := ParseScript(strings.NewReader(script)); err == nil {
+			t.Errorf("expected an error for %q", script)
+		}
+	}
+	if _, err := ParseScript(strings.NewReader(DefaultScript)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the frames of the simulator decode to the values of the model
+func TestRoundTrip(t *testing.T) {
+	script, err := ParseScript(strings.NewReader(`start
+wait 3s
+door trunk open
+set Weel Remote Key = 0x10
+drive 100 10s
+wait 30s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := New(cancoder.OpelAstraHOpc2006, NewVehicle(), script, nil)
+
+	decoders := map[string]*cancoder.Decoder{}
+	for _, coder := range cancoder.OpelAstraHOpc2006.Cancoders {
+		decoders[coder.Device] = cancoder.NewCanCoder(coder.Map)
+	}
+	counts := map[uint32]int{}
+	for elapsed := time.Duration(0); elapsed < 30*time.Second; elapsed += Tick {
+		outputs, running := sim.Step(start.Add(elapsed))
+		if !running {
+			t.Fatalf("script ended at %v", elapsed)
+		}
+		for _, output := range outputs {
+			counts[output.Frame.ArbitrationID]++
+			if _, err := decoders[output.Device].DecodeAt(&output.Frame.Frame, output.Frame.Timestamp); err != nil {
+				t.Fatalf("decode 0x%x: %v", output.Frame.ArbitrationID, err)
+			}
+		}
+	}
+
+	// periodic ids at their period, events once
+	if n := counts[uint32(cancoder.GMLanEngineSpeedRPM)]; n < 295 || n > 301 {
+		t.Errorf("expected 300 rpm frames, got %d", n)
+	}
+	if n := counts[uint32(cancoder.GMLanWeelRemoteControll)]; n != 1 {
+		t.Errorf("expected 1 key frame, got %d", n)
+	}
+	if n := counts[uint32(cancoder.GMLanBusWakeup)]; n != 1 {
+		t.Errorf("expected 1 wakeup frame, got %d", n)
+	}
+
+	v := sim.Vehicle()
+	expected := map[cancoder.CanVars]float64{
+		cancoder.VehicleSpeed:       v.Speed,
+		cancoder.EngineSpeedRPM:     v.RPM,
+		cancoder.EngineRunningState: cancoder.ENGINE_RUNNING_DRIVING,
+		cancoder.DoorState:          cancoder.DOOR_STATE_TRUNK_OPEN,
+		cancoder.WeelKey:            0x10,
+		cancoder.BatteryVoltage:     v.Battery,
+		cancoder.Milage:             v.Milage,
+	}
+	for name, value := range expected {
+		decoded := decoders["can1"].GetValue(name)
+		if decoded == nil {
+			t.Errorf("%s not decoded", name)
+			continue
+		}
+		if got, _ := decoded.CanValueDef.Value.(float64); math.Abs(got-value) > 0.2 {
+			t.Errorf("%s: expected %v, got %v", name, value, decoded.CanValueDef.Value)
+		}
+	}
+}
+
+func TestProblems(t *testing.T) {
+	sim := New(cancoder.OpelAstraHOpc2006, NewVehicle(), nil, nil)
+	found := false
+	for _, problem := range sim.Problems() {
+		found = found || strings.Contains(problem, "Date")
+	}
+	if !found {
+		t.Errorf("expected the formatted date to be reported, got %v", sim.Problems())
+	}
+}
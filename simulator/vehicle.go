@@ -0,0 +1,302 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package simulator
+
+import (
+	"math"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+const (
+	IdleRPM         = 800
+	ShiftRPM        = 2800
+	StarterDuration = 1200 * time.Millisecond
+	// the bus stays awake after the ignition is switched off
+	AwakeAfterIgnition = 10 * time.Second
+	// km/h per s
+	DefaultAcceleration = 8.0
+	// ml of an injection counter step, 0x130
+	InjectionStep = 0.03054
+	// l/100 km for the range
+	AverageConsumption = 8.5
+)
+
+// km/h at 1000 rpm per gear
+var gearRatios = []float64{7.5, 13, 19, 25.5, 32, 38}
+
+type EngineState int
+
+const (
+	EngineOff EngineState = iota
+	EngineStarting
+	EngineRunning
+)
+
+// a simple model of the car. the script changes it, Step advances it in time
+type Vehicle struct {
+	Ignition bool
+	Engine   EngineState
+	Speed    float64 // km/h
+	RPM      float64
+	Gear     int  // 1.., 0 standing
+	Doors    byte // DOOR_STATE_* bits
+	Lights   byte // DRIVING_LIGHT_*
+	Braking  bool
+	Fuel     float64 // l
+	Injected float64 // ml since the start of the simulation
+	Milage   float64 // km
+	Trip     float64 // km since the ignition was switched on
+	Coolant  float64 // °C
+	Outdoor  float64 // °C
+	Battery  float64 // V
+
+	target       float64 // km/h
+	acceleration float64 // km/h per s
+	starter      time.Duration
+	awake        time.Duration // left after the ignition is off
+	wakeup       bool          // the bus woke up in the last step
+
+	overrides map[cancoder.CanVars]float64
+}
+
+func NewVehicle() *Vehicle {
+	return &Vehicle{
+		Fuel:         cancoder.FULL_CAPACITY_L * 0.6,
+		Milage:       84250,
+		Coolant:      15,
+		Outdoor:      15,
+		Battery:      12.5,
+		acceleration: DefaultAcceleration,
+		overrides:    make(map[cancoder.CanVars]float64),
+	}
+}
+
+func (v *Vehicle) SetIgnition(on bool) {
+	if on && !v.Ignition {
+		v.Trip = 0
+		v.wakeUp()
+	}
+	if !on {
+		v.Engine = EngineOff
+		v.awake = AwakeAfterIgnition
+	}
+	v.Ignition = on
+}
+
+func (v *Vehicle) Start() {
+	v.SetIgnition(true)
+	if v.Engine == EngineOff {
+		v.Engine = EngineStarting
+		v.starter = 0
+	}
+}
+
+func (v *Vehicle) Stop() {
+	v.Engine = EngineOff
+	v.target = 0
+}
+
+// accelerates or brakes to speed within duration, 0 uses the default
+// acceleration
+func (v *Vehicle) Drive(speed float64, duration time.Duration) {
+	v.target = math.Max(0, speed)
+	v.acceleration = DefaultAcceleration
+	if duration > 0 {
+		v.acceleration = math.Abs(v.target-v.Speed) / duration.Seconds()
+	}
+}
+
+func (v *Vehicle) SetDoor(door byte, open bool) {
+	if open {
+		v.Doors |= door
+		// opening a door wakes up the bus
+		if !v.Ignition && v.awake <= 0 {
+			v.wakeUp()
+		}
+		v.awake = AwakeAfterIgnition
+	} else {
+		v.Doors &^= door
+	}
+}
+
+// a value overriding the model, e.g. a key press
+func (v *Vehicle) Set(name cancoder.CanVars, value float64) {
+	v.overrides[name] = value
+}
+
+func (v *Vehicle) Unset(name cancoder.CanVars) {
+	delete(v.overrides, name)
+}
+
+func (v *Vehicle) wakeUp() {
+	v.wakeup = true
+	v.awake = AwakeAfterIgnition
+}
+
+// the bus is awake while the ignition is on and a while after
+func (v *Vehicle) Awake() bool {
+	return v.Ignition || v.awake > 0
+}
+
+func (v *Vehicle) Step(dt time.Duration) {
+	s := dt.Seconds()
+	if !v.Ignition && v.awake > 0 {
+		v.awake -= dt
+	}
+
+	if v.Engine == EngineStarting {
+		v.starter += dt
+		if v.starter >= StarterDuration {
+			v.Engine = EngineRunning
+		}
+	}
+	target := v.target
+	if v.Engine != EngineRunning {
+		target = 0
+	}
+
+	// speed
+	previous := v.Speed
+	if v.Speed < target {
+		v.Speed = math.Min(target, v.Speed+v.acceleration*s)
+	} else if v.Speed > target {
+		// rolling out without engine
+		rate := v.acceleration
+		if v.Engine != EngineRunning {
+			rate = DefaultAcceleration
+		}
+		v.Speed = math.Max(target, v.Speed-rate*s)
+	}
+	v.Braking = v.Speed < previous-0.5*DefaultAcceleration*s
+	v.Milage += v.Speed * s / 3600
+	v.Trip += v.Speed * s / 3600
+
+	// gear and rpm
+	switch v.Engine {
+	case EngineOff:
+		v.RPM, v.Gear = 0, 0
+	case EngineStarting:
+		v.RPM, v.Gear = 250, 0
+	default:
+		v.Gear = 0
+		v.RPM = IdleRPM
+		if v.Speed > 0.5 {
+			v.Gear = len(gearRatios)
+			for g, ratio := range gearRatios {
+				if v.Speed/ratio*1000 <= ShiftRPM {
+					v.Gear = g + 1
+					break
+				}
+			}
+			v.RPM = math.Max(IdleRPM, v.Speed/gearRatios[v.Gear-1]*1000)
+		}
+	}
+
+	// fuel: idle consumption rises with the rpm, acceleration costs extra
+	if v.Engine == EngineRunning {
+		ml := 0.22 * v.RPM / IdleRPM * s
+		if v.Speed > previous {
+			ml += 1.5 * s
+		}
+		v.Injected += ml
+		v.Fuel = math.Max(0, v.Fuel-ml/1000)
+	}
+
+	// temperatures and voltage
+	coolant, constant := v.Outdoor, 1800.0
+	if v.Engine == EngineRunning {
+		coolant, constant = 90, 300
+	}
+	v.Coolant += (coolant - v.Coolant) * math.Min(1, s/constant)
+	switch {
+	case v.Engine == EngineRunning:
+		v.Battery = 14.2
+	case v.Engine == EngineStarting:
+		v.Battery = 10.5
+	case v.Ignition:
+		v.Battery = 12.2
+	default:
+		v.Battery = 12.5
+	}
+}
+
+// the decoded values of the model by the names of the opel definitions.
+// signals of a sleeping bus are missing
+func (v *Vehicle) Signals() map[cancoder.CanVars]float64 {
+	signals := map[cancoder.CanVars]float64{}
+	if v.wakeup {
+		signals[cancoder.BusWakeup] = 1
+		v.wakeup = false
+	}
+	if v.Awake() {
+		state := float64(cancoder.ENGINE_OFF)
+		switch {
+		case v.Engine == EngineStarting:
+			state = cancoder.ENGINE_STARTER_RUNNING
+		case v.Engine == EngineRunning && v.Speed > 0:
+			state = cancoder.ENGINE_RUNNING_DRIVING
+		case v.Engine == EngineRunning:
+			state = cancoder.ENGINE_RUNNING
+		case v.Ignition:
+			state = cancoder.ENGINE_IGNITION_ON
+		}
+		brake := float64(cancoder.BREAK_OPEN)
+		if v.Braking {
+			brake = cancoder.BREAK_PRESSED
+		}
+		rangeWarning := float64(cancoder.RANGE_WARNING_OFF)
+		distance := v.Fuel / AverageConsumption * 100
+		if distance < 50 {
+			rangeWarning = cancoder.RANGE_WARNING_ON
+		}
+
+		signals[cancoder.EngineRunningState] = state
+		signals[cancoder.EngineSpeedRPM] = v.RPM
+		signals[cancoder.VehicleSpeed] = v.Speed
+		signals[cancoder.VehicleSpeedMid] = v.Speed
+		signals[cancoder.Milage] = v.Milage
+		signals[cancoder.TraveledDistance] = math.Mod(v.Trip*1000, 65536*0.015748) // m, wrapping
+		signals[cancoder.CoolantTemperature] = v.Coolant
+		signals[cancoder.BatteryVoltage] = v.Battery
+		signals[cancoder.FullLevel] = v.Fuel
+		signals[cancoder.FullLevelMid] = v.Fuel
+		signals[cancoder.FullInjection] = math.Mod(math.Floor(v.Injected/InjectionStep), 65536)
+		signals[cancoder.OutdoorTemperature] = v.Outdoor
+		signals[cancoder.SensorTemperature] = v.Outdoor
+		signals[cancoder.DisplayTemperature] = v.Outdoor
+		signals[cancoder.DoorState] = float64(v.Doors)
+		signals[cancoder.LightSwitch] = float64(v.Lights)
+		signals[cancoder.BreakState] = brake
+		signals[cancoder.LeftTravelRange] = distance
+		signals[cancoder.RangeWarning] = rangeWarning
+	}
+	for name, value := range v.overrides {
+		signals[name] = value
+	}
+	return signals
+}
@@ -0,0 +1,287 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package sniffer tracks bit changes of can frames to reverse engineer
+// signals: mark the moments of an action (e.g. a button pressed) and the
+// bits, which changed only around the marks, are the candidates.
+package sniffer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+)
+
+const (
+	// changes within the window before or after a mark are around the mark
+	DefaultWindow = time.Second
+	// change times kept per bit to compare them with the marks
+	ChangeHistory = 128
+)
+
+type BitState int
+
+const (
+	Unchanged BitState = iota
+	Changed
+	Marked // changed only around marks
+)
+
+// changes of a bit
+type Bit struct {
+	Changes uint64
+	Changed time.Time // last change
+	times   []time.Time
+}
+
+// the frames of an arbitration id. bit i is bit i%8 (0 = lsb) of byte i/8
+type ID struct {
+	Device string
+	ID     uint32
+	DLC    uint8
+	Data   [8]byte
+	Count  uint64
+	First  time.Time
+	Last   time.Time
+	Bits   [64]Bit
+}
+
+// the ids with marked bits
+type Candidate struct {
+	*ID
+	Bits []int
+}
+
+// tracks bit changes per id. not safe for concurrent use
+type Sniffer struct {
+	ids     []*ID
+	ignored map[uint32]bool
+	marks   []time.Time
+	window  time.Duration
+}
+
+func New() *Sniffer {
+	return &Sniffer{
+		ignored: make(map[uint32]bool),
+		window:  DefaultWindow,
+	}
+}
+
+func (s *Sniffer) search(device string, id uint32) int {
+	return sort.Search(len(s.ids), func(i int) bool {
+		entry := s.ids[i]
+		return entry.Device > device || (entry.Device == device && entry.ID >= id)
+	})
+}
+
+// counts the changed bits of the frame, received at now
+func (s *Sniffer) Add(device string, frame *canbus.Frame, now time.Time) {
+	if s.ignored[frame.ArbitrationID] {
+		return
+	}
+	var data [8]byte
+	copy(data[:], frame.Data[:frame.DLC])
+
+	i := s.search(device, frame.ArbitrationID)
+	if i == len(s.ids) || s.ids[i].Device != device || s.ids[i].ID != frame.ArbitrationID {
+		s.ids = append(s.ids, nil)
+		copy(s.ids[i+1:], s.ids[i:])
+		s.ids[i] = &ID{Device: device, ID: frame.ArbitrationID, DLC: frame.DLC, Data: data, First: now}
+	} else {
+		entry := s.ids[i]
+		for b := range data {
+			changed := data[b] ^ entry.Data[b]
+			for bit := 0; changed != 0 && bit < 8; bit++ {
+				if changed&(1<<bit) == 0 {
+					continue
+				}
+				state := &entry.Bits[b*8+bit]
+				state.Changes++
+				state.Changed = now
+				state.times = append(state.times, now)
+				if len(state.times) > ChangeHistory {
+					state.times = state.times[1:]
+				}
+			}
+		}
+		entry.DLC = frame.DLC
+		entry.Data = data
+	}
+	s.ids[i].Count++
+	s.ids[i].Last = now
+}
+
+func (s *Sniffer) Len() int {
+	return len(s.ids)
+}
+
+// ids sorted by device and arbitration id
+func (s *Sniffer) Get(i int) *ID {
+	if i < 0 || i >= len(s.ids) {
+		return nil
+	}
+	return s.ids[i]
+}
+
+// marks now, returns the number of marks
+func (s *Sniffer) Mark(now time.Time) int {
+	s.marks = append(s.marks, now)
+	return len(s.marks)
+}
+
+func (s *Sniffer) Marks() []time.Time {
+	return s.marks
+}
+
+func (s *Sniffer) Window() time.Duration {
+	return s.window
+}
+
+func (s *Sniffer) SetWindow(window time.Duration) {
+	s.window = window
+}
+
+// frames of the id are dropped. the id's statistics are removed
+func (s *Sniffer) Ignore(id uint32) {
+	s.ignored[id] = true
+	ids := s.ids[:0]
+	for _, entry := range s.ids {
+		if entry.ID != id {
+			ids = append(ids, entry)
+		}
+	}
+	s.ids = ids
+}
+
+func (s *Sniffer) Unignore(id uint32) {
+	delete(s.ignored, id)
+}
+
+func (s *Sniffer) Ignored() []uint32 {
+	ids := []uint32{}
+	for id := range s.ignored {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ignores all ids, which changed so far. e.g. to drop the noise of a bus
+// before the action. returns the number of ignored ids
+func (s *Sniffer) IgnoreChanging() int {
+	changing := []uint32{}
+	for _, entry := range s.ids {
+		for _, bit := range entry.Bits {
+			if bit.Changes > 0 {
+				changing = append(changing, entry.ID)
+				break
+			}
+		}
+	}
+	for _, id := range changing {
+		s.Ignore(id)
+	}
+	return len(changing)
+}
+
+// forgets ids and marks, ignored ids stay ignored
+func (s *Sniffer) Reset() {
+	s.ids = nil
+	s.marks = nil
+}
+
+func (s *Sniffer) aroundMark(t time.Time) bool {
+	for _, mark := range s.marks {
+		if d := t.Sub(mark); d >= -s.window && d <= s.window {
+			return true
+		}
+	}
+	return false
+}
+
+// Marked if all changes of the bit happened around marks
+func (s *Sniffer) State(entry *ID, bit int) BitState {
+	state := &entry.Bits[bit]
+	if state.Changes == 0 {
+		return Unchanged
+	}
+	// older changes are not known anymore
+	if len(s.marks) == 0 || state.Changes > uint64(len(state.times)) {
+		return Changed
+	}
+	for _, t := range state.times {
+		if !s.aroundMark(t) {
+			return Changed
+		}
+	}
+	return Marked
+}
+
+// the ids with bits, which changed only around marks
+func (s *Sniffer) Candidates() []Candidate {
+	candidates := []Candidate{}
+	for _, entry := range s.ids {
+		candidate := Candidate{ID: entry}
+		for bit := range entry.Bits {
+			if s.State(entry, bit) == Marked {
+				candidate.Bits = append(candidate.Bits, bit)
+			}
+		}
+		if len(candidate.Bits) > 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// bits as byte.bit, e.g. 2.7 for the msb of byte 2
+func FormatBits(bits []int) string {
+	names := []string{}
+	for _, bit := range bits {
+		names = append(names, fmt.Sprintf("%d.%d", bit/8, bit%8))
+	}
+	return strings.Join(names, " ")
+}
+
+// a comma separated list of hex ids, e.g. 0x100,3E9
+func ParseIDs(list string) ([]uint32, error) {
+	ids := []uint32{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(field), "0x"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", field)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
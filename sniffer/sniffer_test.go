@@ -0,0 +1,109 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+)
+
+func frame(id uint32, data ...byte) *canbus.Frame {
+	f := &canbus.Frame{}
+	f.ArbitrationID = id
+	f.DLC = uint8(len(data))
+	copy(f.Data[:], data)
+	return f
+}
+
+func TestMarkedBits(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	s := New()
+	// a counter and a door lock, which changes once at 5s
+	for i := 0; i < 100; i++ {
+		s.Add("can1", frame(0x100, byte(i)), at(i*100))
+		lock := byte(0x20)
+		if i >= 50 {
+			lock = 0x30
+		}
+		s.Add("can1", frame(0x160, 0x02, lock, 0x70, 0xd6), at(i*100+10))
+	}
+	s.Mark(at(5300))
+
+	if s.Len() != 2 || s.Get(0).ID != 0x100 || s.Get(1).Count != 100 {
+		t.Fatal("ids")
+	}
+	counter := s.Get(0)
+	if counter.Bits[0].Changes != 99 || counter.Bits[1].Changes != 49 {
+		t.Errorf("counter changes: %d %d", counter.Bits[0].Changes, counter.Bits[1].Changes)
+	}
+	if s.State(counter, 0) != Changed || s.State(counter, 15) != Unchanged {
+		t.Error("counter states")
+	}
+
+	candidates := s.Candidates()
+	if len(candidates) != 1 || candidates[0].ID.ID != 0x160 || FormatBits(candidates[0].Bits) != "1.4" {
+		t.Errorf("candidates: %+v", candidates)
+	}
+
+	s.SetWindow(100 * time.Millisecond)
+	if len(s.Candidates()) != 0 {
+		t.Error("change outside of the window")
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	now := time.Now()
+	s := New()
+	s.Add("can1", frame(0x100, 1), now)
+	s.Add("can1", frame(0x100, 2), now)
+	s.Add("can1", frame(0x160, 1), now)
+	s.Add("can1", frame(0x160, 1), now)
+
+	if n := s.IgnoreChanging(); n != 1 || s.Len() != 1 || s.Get(0).ID != 0x160 {
+		t.Errorf("ignore changing: %d", n)
+	}
+	s.Add("can1", frame(0x100, 3), now)
+	if s.Len() != 1 {
+		t.Error("ignored id added")
+	}
+	s.Unignore(0x100)
+	s.Add("can1", frame(0x100, 3), now)
+	if s.Len() != 2 {
+		t.Error("unignored id not added")
+	}
+
+	ids, err := ParseIDs("0x100, 3E9,")
+	if err != nil || len(ids) != 2 || ids[1] != 0x3e9 {
+		t.Errorf("parse: %v %v", ids, err)
+	}
+	if _, err := ParseIDs("xyz"); err == nil {
+		t.Error("invalid id parsed")
+	}
+}
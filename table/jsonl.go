@@ -0,0 +1,90 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package table
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+)
+
+// one json object per row, cells without value are left out
+type JsonLinesWriter struct {
+	writer  *bufio.Writer
+	closer  io.Closer
+	columns []Column
+	keys    [][]byte
+}
+
+func NewJsonLinesWriter(w io.Writer, columns []Column) *JsonLinesWriter {
+	writer := &JsonLinesWriter{
+		writer:  bufio.NewWriter(w),
+		columns: columns,
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	for _, column := range columns {
+		key, _ := json.Marshal(column.Name)
+		writer.keys = append(writer.keys, key)
+	}
+	return writer
+}
+
+func (w *JsonLinesWriter) WriteRow(timestamp time.Time, cells []interface{}) error {
+	line := []byte(`{"time":"` + timestamp.UTC().Format(TimeLayout) + `"`)
+	for i, cell := range cells {
+		if cell == nil {
+			continue
+		}
+		if f, ok := cell.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			continue
+		}
+		value, err := json.Marshal(cell)
+		if err != nil {
+			return err
+		}
+		line = append(line, ',')
+		line = append(line, w.keys[i]...)
+		line = append(line, ':')
+		line = append(line, value...)
+	}
+	line = append(line, '}', '\n')
+	_, err := w.writer.Write(line)
+	return err
+}
+
+func (w *JsonLinesWriter) Close() error {
+	err := w.writer.Flush()
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,377 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package table
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// rows per row group, a row group is buffered in memory
+const ParquetRowGroupSize = 65536
+
+// parquet physical types, repetitions, converted types and encodings
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUtf8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRle   = 3
+
+	parquetDataPage = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+type parquetChunk struct {
+	kind   int32
+	path   string
+	offset int64
+	size   int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+}
+
+// writes an uncompressed parquet file with plain encoded pages. the time is
+// a required timestamp (µs, utc), signals are optional double or utf8 columns
+type ParquetWriter struct {
+	writer  *bufio.Writer
+	closer  io.Closer
+	columns []Column
+	offset  int64
+	times   []int64
+	cells   [][]interface{}
+	groups  []parquetRowGroup
+	rows    int64
+	err     error
+}
+
+func NewParquetWriter(w io.Writer, columns []Column) *ParquetWriter {
+	writer := &ParquetWriter{
+		writer:  bufio.NewWriter(w),
+		columns: columns,
+		cells:   make([][]interface{}, len(columns)),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	writer.write(parquetMagic)
+	return writer
+}
+
+func (w *ParquetWriter) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.writer.Write(data)
+	w.offset += int64(len(data))
+}
+
+func (w *ParquetWriter) WriteRow(timestamp time.Time, cells []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.times = append(w.times, timestamp.UnixMicro())
+	for i := range w.columns {
+		var cell interface{}
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		w.cells[i] = append(w.cells[i], cell)
+	}
+	if len(w.times) >= ParquetRowGroupSize {
+		w.flushRowGroup()
+	}
+	return w.err
+}
+
+func (w *ParquetWriter) flushRowGroup() {
+	if len(w.times) == 0 {
+		return
+	}
+	group := parquetRowGroup{rows: int64(len(w.times))}
+
+	data := make([]byte, 0, 8*len(w.times))
+	for _, t := range w.times {
+		data = binary.LittleEndian.AppendUint64(data, uint64(t))
+	}
+	group.chunks = append(group.chunks, w.writePage(parquetInt64, "time", len(w.times), data))
+
+	for i, column := range w.columns {
+		kind := int32(parquetDouble)
+		if column.Text {
+			kind = parquetByteArray
+		}
+		present := make([]bool, len(w.cells[i]))
+		values := []byte{}
+		for row, cell := range w.cells[i] {
+			switch v := cell.(type) {
+			case float64:
+				if !column.Text {
+					present[row] = true
+					values = binary.LittleEndian.AppendUint64(values, math.Float64bits(v))
+				}
+			case string:
+				if column.Text {
+					present[row] = true
+					values = binary.LittleEndian.AppendUint32(values, uint32(len(v)))
+					values = append(values, v...)
+				}
+			}
+		}
+		levels := definitionLevels(present)
+		data := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+		data = append(data, levels...)
+		data = append(data, values...)
+		group.chunks = append(group.chunks, w.writePage(kind, column.Name, len(present), data))
+		w.cells[i] = w.cells[i][:0]
+	}
+
+	w.groups = append(w.groups, group)
+	w.rows += group.rows
+	w.times = w.times[:0]
+}
+
+// a column chunk with a single data page
+func (w *ParquetWriter) writePage(kind int32, path string, count int, data []byte) parquetChunk {
+	header := newCompactWriter()
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(len(data)))
+	header.i32(3, int32(len(data)))
+	header.begin(5)
+	header.i32(1, int32(count))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRle)
+	header.i32(4, parquetRle)
+	header.end()
+	header.end()
+
+	chunk := parquetChunk{
+		kind:   kind,
+		path:   path,
+		offset: w.offset,
+		size:   int64(len(header.buf) + len(data)),
+	}
+	w.write(header.buf)
+	w.write(data)
+	return chunk
+}
+
+// rle/bit-packed hybrid encoding of bit width 1 as bit-packed run
+func definitionLevels(present []bool) []byte {
+	groups := (len(present) + 7) / 8
+	levels := binary.AppendUvarint(nil, uint64(groups<<1|1))
+	packed := make([]byte, groups)
+	for i, p := range present {
+		if p {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(levels, packed...)
+}
+
+func (w *ParquetWriter) footer() []byte {
+	meta := newCompactWriter()
+	meta.i32(1, 1)
+
+	meta.list(2, compactStruct, len(w.columns)+2)
+	meta.element()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(w.columns)+1))
+	meta.end()
+	meta.element()
+	meta.i32(1, parquetInt64)
+	meta.i32(3, parquetRequired)
+	meta.string(4, "time")
+	meta.i32(6, parquetTimestampMicros)
+	meta.end()
+	for _, column := range w.columns {
+		meta.element()
+		if column.Text {
+			meta.i32(1, parquetByteArray)
+		} else {
+			meta.i32(1, parquetDouble)
+		}
+		meta.i32(3, parquetOptional)
+		meta.string(4, column.Name)
+		if column.Text {
+			meta.i32(6, parquetUtf8)
+		}
+		meta.end()
+	}
+
+	meta.i64(3, w.rows)
+
+	meta.list(4, compactStruct, len(w.groups))
+	for _, group := range w.groups {
+		size := int64(0)
+		meta.element()
+		meta.list(1, compactStruct, len(group.chunks))
+		for _, chunk := range group.chunks {
+			size += chunk.size
+			meta.element()
+			meta.i64(2, chunk.offset)
+			meta.begin(3)
+			meta.i32(1, chunk.kind)
+			meta.list(2, compactI32, 2)
+			meta.zigzag(parquetPlain)
+			meta.zigzag(parquetRle)
+			meta.list(3, compactBinary, 1)
+			meta.bytes(chunk.path)
+			meta.i32(4, 0) // uncompressed
+			meta.i64(5, group.rows)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, size)
+		meta.i64(3, group.rows)
+		meta.end()
+	}
+
+	meta.string(6, "go-can-coder")
+	meta.end()
+	return meta.buf
+}
+
+func (w *ParquetWriter) Close() error {
+	w.flushRowGroup()
+	footer := w.footer()
+	w.write(footer)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.write(parquetMagic)
+
+	err := w.err
+	if fErr := w.writer.Flush(); fErr != nil && err == nil {
+		err = fErr
+	}
+	if w.closer != nil {
+		if cErr := w.closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// thrift compact protocol types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// encodes thrift structs in the compact protocol, as used by parquet metadata
+type compactWriter struct {
+	buf    []byte
+	fields []int16 // last field id of the open structs
+}
+
+func newCompactWriter() *compactWriter {
+	return &compactWriter{fields: []int16{0}}
+}
+
+func (c *compactWriter) varint(v uint64) {
+	c.buf = binary.AppendUvarint(c.buf, v)
+}
+
+func (c *compactWriter) zigzag(v int64) {
+	c.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (c *compactWriter) bytes(v string) {
+	c.varint(uint64(len(v)))
+	c.buf = append(c.buf, v...)
+}
+
+func (c *compactWriter) field(id int16, kind byte) {
+	last := &c.fields[len(c.fields)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.buf = append(c.buf, byte(delta)<<4|kind)
+	} else {
+		c.buf = append(c.buf, kind)
+		c.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.field(id, compactI32)
+	c.zigzag(int64(v))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.field(id, compactI64)
+	c.zigzag(v)
+}
+
+func (c *compactWriter) string(id int16, v string) {
+	c.field(id, compactBinary)
+	c.bytes(v)
+}
+
+// a list field, followed by size elements
+func (c *compactWriter) list(id int16, kind byte, size int) {
+	c.field(id, compactList)
+	if size < 15 {
+		c.buf = append(c.buf, byte(size)<<4|kind)
+	} else {
+		c.buf = append(c.buf, 0xf0|kind)
+		c.varint(uint64(size))
+	}
+}
+
+// a struct field, closed by end
+func (c *compactWriter) begin(id int16) {
+	c.field(id, compactStruct)
+	c.fields = append(c.fields, 0)
+}
+
+// a struct in a list, closed by end
+func (c *compactWriter) element() {
+	c.fields = append(c.fields, 0)
+}
+
+func (c *compactWriter) end() {
+	c.buf = append(c.buf, 0)
+	c.fields = c.fields[:len(c.fields)-1]
+}
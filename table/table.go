@@ -0,0 +1,274 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package table writes decoded signals as time aligned table with one
+// column per signal, as csv, json lines or parquet.
+package table
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/utils"
+)
+
+// layout of the time column in csv and json lines
+const TimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+type Format string
+
+const (
+	Csv       Format = "csv"
+	JsonLines Format = "jsonl"
+	Parquet   Format = "parquet"
+)
+
+// a decoded signal of a device
+type Column struct {
+	Name   string // column header, the signal name or device.signal if ambiguous
+	Device string
+	Signal cancoder.CanVars
+	Text   bool // formatted values (; in the calculation), else numbers
+}
+
+// a row of a table. cells are nil, float64 or string
+type Writer interface {
+	WriteRow(timestamp time.Time, cells []interface{}) error
+	Close() error
+}
+
+// one column per distinct signal of the coders. signals with the same name
+// on several devices are prefixed with the device
+func Columns(coders cancoder.Cancoders) []Column {
+	columns := []Column{}
+	devices := make(map[cancoder.CanVars]map[string]bool)
+
+	for _, coder := range coders {
+		for _, mapping := range coder.Map {
+			name := mapping.CanValueDef.Name
+			if devices[name] == nil {
+				devices[name] = make(map[string]bool)
+			}
+			if devices[name][coder.Device] {
+				continue
+			}
+			devices[name][coder.Device] = true
+			columns = append(columns, Column{
+				Name:   string(name),
+				Device: coder.Device,
+				Signal: name,
+				Text:   strings.Contains(mapping.CanValueDef.Calculation, ";"),
+			})
+		}
+	}
+
+	for i, column := range columns {
+		if len(devices[column.Signal]) > 1 {
+			columns[i].Name = column.Device + "." + string(column.Signal)
+		}
+	}
+	return columns
+}
+
+// the columns with the given names (signal or device.signal) in the given order
+func Select(columns []Column, names []string) ([]Column, error) {
+	selected := []Column{}
+	for _, name := range names {
+		found := false
+		for _, column := range columns {
+			if name == column.Name || name == string(column.Signal) ||
+				name == column.Device+"."+string(column.Signal) {
+				selected = append(selected, column)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown signal %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// the index of the column of a device's signal, -1 if not in the table
+func Index(columns []Column, device string, signal cancoder.CanVars) int {
+	for i, column := range columns {
+		if column.Device == device && column.Signal == signal {
+			return i
+		}
+	}
+	return -1
+}
+
+// the cell of a decoded value, nil if it does not fit the column
+func (c Column) Cell(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if c.Text {
+		return utils.InterfaceToString(value)
+	}
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case bool:
+		if v {
+			return 1.0
+		}
+		return 0.0
+	}
+	return nil
+}
+
+func NewWriter(w io.Writer, format Format, columns []Column) (Writer, error) {
+	switch format {
+	case Csv:
+		return NewCsvWriter(w, columns), nil
+	case JsonLines:
+		return NewJsonLinesWriter(w, columns), nil
+	case Parquet:
+		return NewParquetWriter(w, columns), nil
+	}
+	return nil, fmt.Errorf("unknown table format %q", format)
+}
+
+// the format by file extension: .parquet, .jsonl (.json), anything else is csv
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".parquet":
+		return Parquet
+	case ".jsonl", ".json", ".ndjson":
+		return JsonLines
+	}
+	return Csv
+}
+
+// creates a table file. the writer closes the file
+func Create(path string, format Format, columns []Column) (Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewWriter(file, format, columns)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// aligns decoded values in time. without period every Add is a row, else
+// rows are resampled at multiples of period with the last value of the
+// interval before. fill repeats the last known value instead of empty cells
+type Aligner struct {
+	writer  Writer
+	period  time.Duration
+	fill    bool
+	last    []interface{}
+	pending []interface{}
+	next    time.Time
+	rows    uint64
+}
+
+func NewAligner(writer Writer, width int, period time.Duration, fill bool) *Aligner {
+	return &Aligner{
+		writer:  writer,
+		period:  period,
+		fill:    fill,
+		last:    make([]interface{}, width),
+		pending: make([]interface{}, width),
+	}
+}
+
+// values at timestamp. nil cells did not change. values must be added in time order
+func (a *Aligner) Add(timestamp time.Time, cells []interface{}) error {
+	if a.period <= 0 {
+		copy(a.pending, cells)
+		return a.flush(timestamp)
+	}
+
+	if a.next.IsZero() {
+		a.next = timestamp.Truncate(a.period)
+		if a.next.Before(timestamp) {
+			a.next = a.next.Add(a.period)
+		}
+	}
+	for timestamp.After(a.next) {
+		if err := a.flush(a.next); err != nil {
+			return err
+		}
+		a.next = a.next.Add(a.period)
+	}
+	for i, cell := range cells {
+		if cell != nil {
+			a.pending[i] = cell
+		}
+	}
+	return nil
+}
+
+func (a *Aligner) flush(timestamp time.Time) error {
+	row := make([]interface{}, len(a.pending))
+	for i, cell := range a.pending {
+		if cell != nil {
+			row[i] = cell
+			a.last[i] = cell
+		} else if a.fill {
+			row[i] = a.last[i]
+		}
+		a.pending[i] = nil
+	}
+	a.rows++
+	return a.writer.WriteRow(timestamp, row)
+}
+
+// written rows
+func (a *Aligner) Rows() uint64 {
+	return a.rows
+}
+
+// writes the last resampled row and closes the writer
+func (a *Aligner) Close() error {
+	var err error
+	if a.period > 0 && !a.next.IsZero() {
+		err = a.flush(a.next)
+	}
+	if cErr := a.writer.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
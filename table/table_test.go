@@ -0,0 +1,354 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testColumns() []Column {
+	return []Column{
+		{Name: "Engine RPM", Device: "can1", Signal: cancoder.EngineSpeedRPM},
+		{Name: "Date", Device: "can1", Signal: cancoder.DateTime, Text: true},
+	}
+}
+
+func alignedCsv(t *testing.T, period time.Duration, fill bool) string {
+	var out bytes.Buffer
+
+	aligner := NewAligner(NewCsvWriter(&out, testColumns()), 2, period, fill)
+	samples := []struct {
+		offset time.Duration
+		cells  []interface{}
+	}{
+		{10 * time.Millisecond, []interface{}{800.0, nil}},
+		{50 * time.Millisecond, []interface{}{nil, "01.03.24"}},
+		{120 * time.Millisecond, []interface{}{850.5, nil}},
+		{340 * time.Millisecond, []interface{}{900.0, nil}},
+	}
+	for _, sample := range samples {
+		if err := aligner.Add(start.Add(sample.offset), sample.cells); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aligner.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestAligner(t *testing.T) {
+	expected := "time,Engine RPM,Date\n" +
+		"2024-03-01T12:00:00.010000Z,800,\n" +
+		"2024-03-01T12:00:00.050000Z,,01.03.24\n" +
+		"2024-03-01T12:00:00.120000Z,850.5,\n" +
+		"2024-03-01T12:00:00.340000Z,900,\n"
+	if out := alignedCsv(t, 0, false); out != expected {
+		t.Errorf("unaligned:\n%s", out)
+	}
+
+	expected = "time,Engine RPM,Date\n" +
+		"2024-03-01T12:00:00.100000Z,800,01.03.24\n" +
+		"2024-03-01T12:00:00.200000Z,850.5,\n" +
+		"2024-03-01T12:00:00.300000Z,,\n" +
+		"2024-03-01T12:00:00.400000Z,900,\n"
+	if out := alignedCsv(t, 100*time.Millisecond, false); out != expected {
+		t.Errorf("resampled:\n%s", out)
+	}
+
+	expected = "time,Engine RPM,Date\n" +
+		"2024-03-01T12:00:00.100000Z,800,01.03.24\n" +
+		"2024-03-01T12:00:00.200000Z,850.5,01.03.24\n" +
+		"2024-03-01T12:00:00.300000Z,850.5,01.03.24\n" +
+		"2024-03-01T12:00:00.400000Z,900,01.03.24\n"
+	if out := alignedCsv(t, 100*time.Millisecond, true); out != expected {
+		t.Errorf("forward filled:\n%s", out)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	coders := cancoder.Cancoders{
+		{Device: "can1", Map: []cancoder.CanValueMap{
+			{CanValueDef: cancoder.CanValueDef{Name: cancoder.EngineSpeedRPM}},
+			{CanValueDef: cancoder.CanValueDef{Name: cancoder.ACTemperature}},
+			{CanValueDef: cancoder.CanValueDef{Name: cancoder.ACTemperature}},
+		}},
+		{Device: "can0", Map: []cancoder.CanValueMap{
+			{CanValueDef: cancoder.CanValueDef{Name: cancoder.ACTemperature}},
+			{CanValueDef: cancoder.CanValueDef{Name: cancoder.DateTime, Calculation: "${0};${1}"}},
+		}},
+	}
+	columns := Columns(coders)
+	names := []string{}
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	if strings.Join(names, "|") != "Engine RPM|can1.AC Temperature|can0.AC Temperature|Date" {
+		t.Errorf("columns: %v", names)
+	}
+	if !columns[3].Text || columns[0].Text {
+		t.Error("text columns")
+	}
+
+	selected, err := Select(columns, []string{"Date", "AC Temperature"})
+	if err != nil || len(selected) != 3 || selected[0].Signal != cancoder.DateTime {
+		t.Errorf("select: %v %v", selected, err)
+	}
+	if _, err := Select(columns, []string{"Unknown"}); err == nil {
+		t.Error("unknown signal selected")
+	}
+}
+
+func TestJsonLines(t *testing.T) {
+	var out bytes.Buffer
+
+	writer := NewJsonLinesWriter(&out, testColumns())
+	if err := writer.WriteRow(start, []interface{}{828.75, "01.03.24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteRow(start.Add(time.Second), []interface{}{nil, "02.03.24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"time":"2024-03-01T12:00:00.000000Z","Engine RPM":828.75,"Date":"01.03.24"}` + "\n" +
+		`{"time":"2024-03-01T12:00:01.000000Z","Date":"02.03.24"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("json lines:\n%s", out.String())
+	}
+}
+
+func TestParquetLayout(t *testing.T) {
+	var out bytes.Buffer
+
+	writer := NewParquetWriter(&out, testColumns())
+	if err := writer.WriteRow(start, []interface{}{828.75, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteRow(start.Add(time.Second), []interface{}{nil, "01.03.24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := out.Bytes()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatal("magic")
+	}
+	footer := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if footer <= 0 || footer > len(file)-12 {
+		t.Fatalf("footer length %d", footer)
+	}
+	footerOffset := int64(len(file) - 8 - footer)
+	reader := &compactReader{buf: file[footerOffset : len(file)-8]}
+	meta := reader.readStruct()
+	if reader.err != nil || reader.pos != footer {
+		t.Fatalf("footer: read %d of %d bytes: %v", reader.pos, footer, reader.err)
+	}
+
+	// FileMetaData: version, schema, num_rows, row_groups, created_by
+	if meta[1] != int64(1) || meta[3] != int64(2) || meta[6] != "go-can-coder" {
+		t.Errorf("file metadata: %v", meta)
+	}
+	// SchemaElement: type, repetition_type, name, num_children, converted_type
+	schema := []interface{}{
+		map[int16]interface{}{4: "schema", 5: int64(3)},
+		map[int16]interface{}{1: int64(2), 3: int64(0), 4: "time", 6: int64(10)},
+		map[int16]interface{}{1: int64(5), 3: int64(1), 4: "Engine RPM"},
+		map[int16]interface{}{1: int64(6), 3: int64(1), 4: "Date", 6: int64(0)},
+	}
+	if !reflect.DeepEqual(meta[2], schema) {
+		t.Errorf("schema: %v", meta[2])
+	}
+
+	groups, _ := meta[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("row groups: %v", meta[4])
+	}
+	group, _ := groups[0].(map[int16]interface{})
+	if group[3] != int64(2) {
+		t.Errorf("row group rows: %v", group[3])
+	}
+	chunks, _ := group[1].([]interface{})
+	if len(chunks) != 3 {
+		t.Fatalf("column chunks: %v", group[1])
+	}
+
+	micros := func(t time.Time) []byte {
+		return binary.LittleEndian.AppendUint64(nil, uint64(t.UnixMicro()))
+	}
+	expected := []struct {
+		kind int64
+		path string
+		page []byte
+	}{
+		{2, "time", append(micros(start), micros(start.Add(time.Second))...)},
+		// levels: 4 byte length, bit-packed run of one group, rows 0b01
+		{5, "Engine RPM", append([]byte{2, 0, 0, 0, 0x03, 0x01},
+			binary.LittleEndian.AppendUint64(nil, math.Float64bits(828.75))...)},
+		{6, "Date", append([]byte{2, 0, 0, 0, 0x03, 0x02, 8, 0, 0, 0}, "01.03.24"...)},
+	}
+	offset, total := int64(len("PAR1")), int64(0)
+	for i, want := range expected {
+		chunk, _ := chunks[i].(map[int16]interface{})
+		column, _ := chunk[3].(map[int16]interface{})
+		// ColumnChunk file_offset, ColumnMetaData data_page_offset
+		if chunk[2] != offset || column[9] != offset {
+			t.Fatalf("%s: offsets %v, %v, expected %d", want.path, chunk[2], column[9], offset)
+		}
+		// ColumnMetaData: type, encodings, path_in_schema, codec, num_values
+		if column[1] != want.kind || column[4] != int64(0) || column[5] != int64(2) ||
+			!reflect.DeepEqual(column[2], []interface{}{int64(0), int64(3)}) ||
+			!reflect.DeepEqual(column[3], []interface{}{want.path}) {
+			t.Errorf("%s: column metadata %v", want.path, column)
+		}
+		size, _ := column[7].(int64)
+		if column[6] != size {
+			t.Errorf("%s: sizes %v, %v", want.path, column[6], column[7])
+		}
+
+		// PageHeader: type, uncompressed_page_size, compressed_page_size,
+		// data_page_header with num_values and the encodings
+		pageReader := &compactReader{buf: file[offset : offset+size]}
+		header := pageReader.readStruct()
+		if pageReader.err != nil {
+			t.Fatalf("%s: page header: %v", want.path, pageReader.err)
+		}
+		dataPage := map[int16]interface{}{1: int64(2), 2: int64(0), 3: int64(3), 4: int64(3)}
+		if header[1] != int64(0) || header[2] != header[3] || !reflect.DeepEqual(header[5], dataPage) {
+			t.Errorf("%s: page header %v", want.path, header)
+		}
+		page := file[offset+int64(pageReader.pos) : offset+size]
+		if header[2] != int64(len(page)) || !bytes.Equal(page, want.page) {
+			t.Errorf("%s: page %x, expected %x", want.path, page, want.page)
+		}
+		offset += size
+		total += size
+	}
+	if offset != footerOffset || group[2] != total {
+		t.Errorf("chunks end at %d, footer at %d, row group size %v", offset, footerOffset, group[2])
+	}
+}
+
+// decodes thrift compact structs into field id maps, independent of the writer
+type compactReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *compactReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.pos++
+	return r.buf[r.pos-1]
+}
+
+func (r *compactReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.err = io.ErrUnexpectedEOF
+		r.pos = len(r.buf)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *compactReader) readStruct() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	id := int16(0)
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+	return fields
+}
+
+func (r *compactReader) value(kind byte) interface{} {
+	switch kind {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 8:
+		size := int(r.varint())
+		if size > len(r.buf)-r.pos {
+			r.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		r.pos += size
+		return string(r.buf[r.pos-size : r.pos])
+	case 9:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := []interface{}{}
+		for i := 0; i < size && r.err == nil; i++ {
+			list = append(list, r.value(header&0x0f))
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	}
+	r.err = fmt.Errorf("unsupported compact type %d", kind)
+	return nil
+}
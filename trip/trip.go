@@ -0,0 +1,285 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package trip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+const (
+	// a trip ends, when the engine state was not received for this long.
+	// the bus may fall asleep before the ignition off is decoded
+	EndTimeout = 30 * time.Second
+	// km/h, a running engine below it idles
+	IdleSpeed = 1.0
+	// °C of the coolant, an engine started below it is a cold start
+	ColdStartTemperature = 40.0
+	// ml per step of the injection counter, it wraps at 16 bit
+	InjectionStep  = 0.03054
+	InjectionSteps = 65536
+	// m, the traveled distance counter wraps at 16 bit of 0.015748 m
+	TraveledWrap = 65536 * 0.015748
+)
+
+// bits of the engine state, e.g. ENGINE_RUNNING_DRIVING 0x23
+const (
+	ignitionBits = 0x03
+	runningBits  = 0x30
+)
+
+// statistics of a trip from ignition on to off
+type Trip struct {
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	StartMilage  float64       `json:"startMilage,omitempty"` // km, odometer
+	EndMilage    float64       `json:"endMilage,omitempty"`
+	Distance     float64       `json:"distance"`     // km
+	FuelUsed     float64       `json:"fuelUsed"`     // l
+	AverageSpeed float64       `json:"averageSpeed"` // km/h over the whole trip
+	MaxSpeed     float64       `json:"maxSpeed"`     // km/h
+	EngineTime   time.Duration `json:"engineTime"`
+	IdleTime     time.Duration `json:"idleTime"`
+	Starts       int           `json:"starts"` // engine starts
+	ColdStarts   int           `json:"coldStarts"`
+}
+
+func (t Trip) Duration() time.Duration {
+	return t.End.Sub(t.Start)
+}
+
+// l/100 km, 0 without distance
+func (t Trip) Consumption() float64 {
+	if t.Distance <= 0 {
+		return 0
+	}
+	return t.FuelUsed / t.Distance * 100
+}
+
+// sums up the increments of a wrapping counter
+type counter struct {
+	last float64
+	seen bool
+	sum  float64
+}
+
+func (c *counter) add(value float64, wrap float64) {
+	if c.seen {
+		delta := value - c.last
+		if delta < 0 {
+			delta += wrap
+		}
+		c.sum += delta
+	}
+	c.last = value
+	c.seen = true
+}
+
+// the trip in progress
+type tracker struct {
+	trip       Trip
+	engineSeen time.Time // last engine state
+	last       time.Time // last value
+	running    bool
+	speed      float64
+	driven     float64 // km, integrated speed
+	milage     bool
+	traveled   counter
+	injection  counter
+	startLevel float64
+	endLevel   float64
+	level      bool
+}
+
+// time between the last and this value
+func (t *tracker) advance(timestamp time.Time) {
+	elapsed := timestamp.Sub(t.last)
+	if elapsed <= 0 {
+		return
+	}
+	// gaps of a sleeping bus are not driven
+	if elapsed > EndTimeout {
+		elapsed = EndTimeout
+	}
+	t.last = timestamp
+	if t.running {
+		t.trip.EngineTime += elapsed
+		if t.speed < IdleSpeed {
+			t.trip.IdleTime += elapsed
+		}
+	}
+	t.driven += t.speed * elapsed.Hours()
+}
+
+// the trip up to its last value. distance and fuel come from the most
+// precise source received: odometer, distance counter or the speed and
+// injection counter or tank level
+func (t *tracker) summary() Trip {
+	trip := t.trip
+	trip.End = t.last
+	switch {
+	case t.milage:
+		trip.Distance = trip.EndMilage - trip.StartMilage
+	case t.traveled.seen:
+		trip.Distance = t.traveled.sum / 1000
+	default:
+		trip.Distance = t.driven
+	}
+	if t.injection.seen {
+		trip.FuelUsed = t.injection.sum * InjectionStep / 1000
+	} else if t.level && t.startLevel > t.endLevel {
+		trip.FuelUsed = t.startLevel - t.endLevel
+	}
+	if hours := trip.Duration().Hours(); hours > 0 {
+		trip.AverageSpeed = trip.Distance / hours
+	}
+	return trip
+}
+
+// detects trips in the decoded values of a car. safe for concurrent use,
+// the values of all buses can be added
+type Computer struct {
+	mutex   sync.Mutex
+	current *tracker
+	coolant float64
+	cold    bool // coolant received
+}
+
+func NewComputer() *Computer {
+	return &Computer{}
+}
+
+// adds a decoded value, returns the trip it completed
+func (c *Computer) Add(value *cancoder.CanValueMap) *Trip {
+	number, ok := value.CanValueDef.Value.(float64)
+	if !ok {
+		return nil
+	}
+	timestamp := value.Timestamp
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if value.CanValueDef.Name == cancoder.CoolantTemperature {
+		c.coolant = number
+		c.cold = true
+	}
+	if value.CanValueDef.Name == cancoder.EngineRunningState && c.current == nil {
+		if int(number)&ignitionBits == 0 {
+			return nil
+		}
+		c.current = &tracker{
+			trip:       Trip{Start: timestamp},
+			last:       timestamp,
+			engineSeen: timestamp,
+		}
+	}
+	t := c.current
+	if t == nil {
+		return nil
+	}
+	t.advance(timestamp)
+
+	switch value.CanValueDef.Name {
+	case cancoder.EngineRunningState:
+		t.engineSeen = timestamp
+		running := int(number)&runningBits != 0
+		if running && !t.running {
+			t.trip.Starts++
+			if c.cold && c.coolant < ColdStartTemperature {
+				t.trip.ColdStarts++
+			}
+		}
+		t.running = running
+		if int(number)&ignitionBits == 0 {
+			return c.finish()
+		}
+	case cancoder.VehicleSpeed:
+		t.speed = number
+		if number > t.trip.MaxSpeed {
+			t.trip.MaxSpeed = number
+		}
+	case cancoder.Milage:
+		if !t.milage {
+			t.trip.StartMilage = number
+			t.milage = true
+		}
+		t.trip.EndMilage = number
+	case cancoder.TraveledDistance:
+		t.traveled.add(number, TraveledWrap)
+	case cancoder.FullInjection:
+		t.injection.add(number, InjectionSteps)
+	case cancoder.FullLevel:
+		if !t.level {
+			t.startLevel = number
+			t.level = true
+		}
+		t.endLevel = number
+	}
+	return nil
+}
+
+// ends a trip without engine state since EndTimeout, returns it.
+// now is in the time of the values
+func (c *Computer) Check(now time.Time) *Trip {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current == nil || now.Sub(c.current.engineSeen) <= EndTimeout {
+		return nil
+	}
+	return c.finish()
+}
+
+// ends the trip in progress at its last value, e.g. at the end of a trace
+func (c *Computer) Finish() *Trip {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current == nil {
+		return nil
+	}
+	return c.finish()
+}
+
+// the trip in progress up to now, false without
+func (c *Computer) Current() (Trip, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current == nil {
+		return Trip{}, false
+	}
+	return c.current.summary(), true
+}
+
+func (c *Computer) finish() *Trip {
+	trip := c.current.summary()
+	c.current = nil
+	return &trip
+}
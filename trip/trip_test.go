@@ -0,0 +1,137 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package trip
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/simulator"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// a simulated drive gives one trip with the numbers of the model
+func TestComputer(t *testing.T) {
+	script, err := simulator.ParseScript(strings.NewReader(`ignition on
+wait 2s
+start
+wait 10s
+drive 100 10s
+wait 60s
+drive 0 10s
+wait 20s
+stop
+ignition off
+wait 5s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vehicle := simulator.NewVehicle()
+	milage, fuel := vehicle.Milage, vehicle.Injected
+	sim := simulator.New(cancoder.OpelAstraHOpc2006, vehicle, script, nil)
+
+	decoders := map[string]*cancoder.Decoder{}
+	for _, coder := range cancoder.OpelAstraHOpc2006.Cancoders {
+		decoders[coder.Device] = cancoder.NewCanCoder(coder.Map)
+	}
+	computer := NewComputer()
+	var trips []Trip
+	for elapsed := time.Duration(0); ; elapsed += simulator.Tick {
+		outputs, running := sim.Step(start.Add(elapsed))
+		if !running {
+			break
+		}
+		for _, output := range outputs {
+			values, _ := decoders[output.Device].DecodeAt(&output.Frame.Frame, output.Frame.Timestamp)
+			for _, value := range values {
+				if trip := computer.Add(value); trip != nil {
+					trips = append(trips, *trip)
+				}
+			}
+		}
+	}
+	if len(trips) != 1 {
+		t.Fatalf("%d trips, expected 1", len(trips))
+	}
+	trip := trips[0]
+	if trip.Duration() < 92*time.Second || trip.Duration() > 93*time.Second {
+		t.Errorf("duration %v", trip.Duration())
+	}
+	if distance := vehicle.Milage - milage; math.Abs(trip.Distance-distance) > 0.05 {
+		t.Errorf("distance %.3f km, driven %.3f km", trip.Distance, distance)
+	}
+	if used := (vehicle.Injected - fuel) / 1000; math.Abs(trip.FuelUsed-used) > 0.01 {
+		t.Errorf("fuel used %.3f l, injected %.3f l", trip.FuelUsed, used)
+	}
+	if trip.MaxSpeed < 99 || trip.MaxSpeed > 101 {
+		t.Errorf("max speed %.1f", trip.MaxSpeed)
+	}
+	if trip.Starts != 1 || trip.ColdStarts != 1 {
+		t.Errorf("%d starts, %d cold", trip.Starts, trip.ColdStarts)
+	}
+	if trip.EngineTime < 85*time.Second || trip.IdleTime < 10*time.Second || trip.IdleTime > 20*time.Second {
+		t.Errorf("engine %v, idle %v", trip.EngineTime, trip.IdleTime)
+	}
+	if _, ok := computer.Current(); ok {
+		t.Error("trip in progress after ignition off")
+	}
+
+	// a silent bus ends the trip
+	state := &cancoder.CanValueMap{
+		CanValueDef: cancoder.CanValueDef{Name: cancoder.EngineRunningState, Value: float64(cancoder.ENGINE_RUNNING)},
+		Timestamp:   start,
+	}
+	computer.Add(state)
+	if computer.Check(start.Add(EndTimeout)) != nil {
+		t.Error("trip ended before the timeout")
+	}
+	if computer.Check(start.Add(EndTimeout+time.Second)) == nil {
+		t.Error("trip not ended after the timeout")
+	}
+
+	store := NewStore(filepath.Join(t.TempDir(), "trips.jsonl"))
+	if stored, err := store.Trips(); err != nil || len(stored) != 0 {
+		t.Fatalf("empty store: %v %v", stored, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Save(trip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, err := store.Trips()
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("stored %v %v", stored, err)
+	}
+	if !stored[1].Start.Equal(trip.Start) || stored[1].Distance != trip.Distance || stored[1].IdleTime != trip.IdleTime {
+		t.Errorf("stored %+v, expected %+v", stored[1], trip)
+	}
+}
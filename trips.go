@@ -0,0 +1,182 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/trip"
+)
+
+// trips subcommand: lists the trips of the store, or computes the trips of
+// recorded traces and optionally adds them to the store
+func tripsCli(args []string) int {
+	flags := flag.NewFlagSet("trips", flag.ExitOnError)
+	store := flags.String("store", "trips.jsonl", "file of the completed trips")
+	save := flags.Bool("save", false, "add the trips computed from the traces to the store")
+	last := flags.Int("last", 0, "list only the last n trips")
+	enDecoder := flags.String("parser",
+		"Opel_Astra_H_OPC_2006", "en- decoder for parsing the traces")
+	device := flags.String("device", "",
+		"device of frames without interface (single bus traces). default the parser's first device")
+	mapping := flags.String("map", "",
+		"map trace interfaces to devices, e.g. vcan0=can1,vcan1=can0")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: can-coder trips [options] [trace ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var (
+		trips []trip.Trip
+		err   error
+	)
+	if flags.NArg() == 0 {
+		trips, err = trip.NewStore(*store).Trips()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "trips: %v\n", err)
+			return 1
+		}
+	} else {
+		endecoder := findParser(*enDecoder)
+		if endecoder == nil {
+			fmt.Fprintf(os.Stderr, "unknown parser %q\n", *enDecoder)
+			return 1
+		}
+		devices, err := parseDeviceMap(*mapping)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, input := range flags.Args() {
+			found, err := traceTrips(endecoder, decodeOptions{input: input, device: *device, devices: devices})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "trips: %s: %v\n", input, err)
+				return 1
+			}
+			trips = append(trips, found...)
+		}
+		if *save {
+			for _, t := range trips {
+				if err := trip.NewStore(*store).Save(t); err != nil {
+					fmt.Fprintf(os.Stderr, "trips: %v\n", err)
+					return 1
+				}
+			}
+		}
+	}
+
+	if *last > 0 && len(trips) > *last {
+		trips = trips[len(trips)-*last:]
+	}
+	writeTrips(os.Stdout, trips)
+	return 0
+}
+
+// the trips of a trace. a trip still running at its end ends with it
+func traceTrips(endecoder *cancoder.CancoderDef, options decodeOptions) ([]trip.Trip, error) {
+	if len(endecoder.Cancoders) == 0 {
+		return nil, errors.New("parser without cancoders")
+	}
+	decoders := traceDecoders(endecoder, &options)
+	reader, err := openTrace(options.input)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var (
+		trips    []trip.Trip
+		computer = trip.NewComputer()
+	)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return trips, err
+		}
+		if ended := computer.Check(record.Timestamp); ended != nil {
+			trips = append(trips, *ended)
+		}
+
+		device := record.Interface
+		if device == "" {
+			device = options.device
+		}
+		if mapped, ok := options.devices[device]; ok {
+			device = mapped
+		}
+		decoder := decoders[device]
+		if decoder == nil || record.IsError() {
+			continue
+		}
+		frame, err := record.Frame()
+		if err != nil {
+			continue
+		}
+		// failing definitions do not end a trip
+		values, _ := decoder.DecodeAt(&frame.Frame, record.Timestamp)
+		for _, value := range values {
+			if ended := computer.Add(value); ended != nil {
+				trips = append(trips, *ended)
+			}
+		}
+	}
+	if ended := computer.Finish(); ended != nil {
+		trips = append(trips, *ended)
+	}
+	return trips, nil
+}
+
+func writeTrips(w io.Writer, trips []trip.Trip) {
+	if len(trips) == 0 {
+		fmt.Fprintln(w, "no trips")
+		return
+	}
+	fmt.Fprintf(w, "%-19s  %9s  %9s  %7s  %10s  %9s  %9s  %9s  %9s  %s\n", "start", "duration", "distance",
+		"fuel", "l/100 km", "average", "max", "engine", "idle", "starts (cold)")
+	var (
+		distance, fuel float64
+		duration       time.Duration
+	)
+	for _, t := range trips {
+		fmt.Fprintf(w, "%-19s  %9s  %6.1f km  %5.2f l  %10.1f  %4.0f km/h  %4.0f km/h  %9s  %9s  %d (%d)\n",
+			t.Start.Local().Format("2006-01-02 15:04:05"), t.Duration().Round(time.Second), t.Distance,
+			t.FuelUsed, t.Consumption(), t.AverageSpeed, t.MaxSpeed, t.EngineTime.Round(time.Second),
+			t.IdleTime.Round(time.Second), t.Starts, t.ColdStarts)
+		distance += t.Distance
+		fuel += t.FuelUsed
+		duration += t.Duration()
+	}
+	fmt.Fprintf(w, "%d trips, %s, %.1f km, %.2f l\n", len(trips), duration.Round(time.Second), distance, fuel)
+}
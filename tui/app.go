@@ -0,0 +1,436 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/sniffer"
+)
+
+// redraw interval for ages and rates
+const RefreshInterval = 200 * time.Millisecond
+
+// executes an entered command line, output lines are shown in the output view
+type CommandFunc func(line string) (output []string, err error)
+
+type view int
+
+const (
+	viewTables view = iota
+	viewDetail
+	viewOutput
+)
+
+const (
+	keyHelp     = "↑↓ PgUp/PgDn select  enter details  tab complete  ^P/^N history  ^U/^D frames  esc back  ^C quit"
+	snifferHelp = "^K mark  ignore <ids>|changing  unignore <ids>|all  window <duration>  candidates  reset  enter bits  ^C quit"
+)
+
+// the live signal table, raw frames and the command line
+type App struct {
+	screen      *Screen
+	title       string
+	signals     *SignalTable
+	frames      *FrameTable
+	editor      *LineEditor
+	execute     CommandFunc
+	view        view
+	selected    int
+	offset      int
+	frameOffset int
+	output      []string
+	message     string
+	hideSignals bool
+	sniffer     *sniffer.Sniffer
+	quit        chan struct{}
+	once        sync.Once
+	mutex       sync.Mutex
+}
+
+// words are the completions of the command line
+func NewApp(screen *Screen, title string, execute CommandFunc, words func() []string) *App {
+	a := &App{
+		screen:  screen,
+		title:   title,
+		signals: NewSignalTable(),
+		frames:  NewFrameTable(),
+		execute: execute,
+		quit:    make(chan struct{}),
+	}
+	a.editor = NewLineEditor(func() []string {
+		completions := []string{}
+		if words != nil {
+			completions = append(completions, words()...)
+		}
+		if a.sniffer != nil {
+			completions = append(completions, snifferCommands...)
+		}
+		return completions
+	})
+	return a
+}
+
+// a decoded value of a device
+func (a *App) Signal(device string, value *cancoder.CanValueMap) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.signals.Update(device, value, time.Now())
+}
+
+// a decoded value got stale, timed out or recovered
+func (a *App) State(device string, event cancoder.StateEvent) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if signal := a.signals.Find(device, event.Value.CanValueDef.Name); signal != nil {
+		signal.Value.State = event.Value.State
+	}
+}
+
+// a received frame of a device
+func (a *App) Frame(device string, frame *canbus.Frame) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	a.frames.Update(device, frame, now)
+	if a.sniffer != nil {
+		a.sniffer.Add(device, frame, now)
+	}
+}
+
+// only raw frames, e.g. while reverse engineering
+func (a *App) HideSignals() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.hideSignals = true
+}
+
+// shows a message in the status line
+func (a *App) Message(format string, args ...interface{}) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.message = fmt.Sprintf(format, args...)
+}
+
+func (a *App) Quit() {
+	a.once.Do(func() { close(a.quit) })
+}
+
+// closed on quit
+func (a *App) Done() <-chan struct{} {
+	return a.quit
+}
+
+// handles keys and redraws until quit or the terminal closed
+func (a *App) Run() error {
+	ticker := time.NewTicker(RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.draw(); err != nil {
+			a.Quit()
+			return err
+		}
+		select {
+		case key, ok := <-a.screen.Keys():
+			if !ok {
+				a.Quit()
+				return nil
+			}
+			a.handle(key)
+		case <-a.screen.Resized():
+		case <-ticker.C:
+		case <-a.quit:
+			return nil
+		}
+	}
+}
+
+func (a *App) handle(key Key) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, height := a.screen.Size()
+	page := height / 2
+
+	switch key.Code {
+	case KeyRune:
+		a.editor.Insert(key.Rune)
+	case KeyEnter:
+		a.enter()
+	case KeyTab:
+		if matches := a.editor.Complete(); len(matches) > 1 {
+			a.message = strings.Join(matches, "  ")
+		}
+	case KeyBackspace:
+		a.editor.Backspace()
+	case KeyDelete:
+		a.editor.Delete()
+	case KeyLeft:
+		a.editor.Left()
+	case KeyRight:
+		a.editor.Right()
+	case KeyHome:
+		a.editor.Home()
+	case KeyEnd:
+		a.editor.End()
+	case KeyUp:
+		a.selected--
+	case KeyDown:
+		a.selected++
+	case KeyPageUp:
+		a.selected -= page
+	case KeyPageDown:
+		a.selected += page
+	case KeyEscape:
+		if a.view != viewTables {
+			a.view = viewTables
+		} else {
+			a.editor.Clear()
+			a.message = ""
+		}
+	case KeyCtrl:
+		switch key.Rune {
+		case 'c':
+			a.once.Do(func() { close(a.quit) })
+		case 'a':
+			a.editor.Home()
+		case 'e':
+			a.editor.End()
+		case 'p':
+			a.editor.Previous()
+		case 'n':
+			a.editor.Next()
+		case 'u':
+			a.frameOffset -= page / 2
+		case 'd':
+			a.frameOffset += page / 2
+		case 'l':
+			a.screen.Invalidate()
+		case 'k':
+			if a.sniffer != nil {
+				a.mark()
+			}
+		}
+	}
+
+	if rows := a.rows(); a.selected >= rows {
+		a.selected = rows - 1
+	}
+	if a.selected < 0 {
+		a.selected = 0
+	}
+}
+
+// rows of the selectable list, signals or sniffed ids
+func (a *App) rows() int {
+	if a.sniffer != nil {
+		return a.sniffer.Len()
+	}
+	return a.signals.Len()
+}
+
+// runs the command line, an empty line toggles the detail view
+func (a *App) enter() {
+	if a.editor.Empty() {
+		if a.view == viewTables {
+			a.view = viewDetail
+		} else {
+			a.view = viewTables
+		}
+		return
+	}
+
+	line := a.editor.Submit()
+	if line == "quit" || line == "exit" {
+		a.once.Do(func() { close(a.quit) })
+		return
+	}
+	handled, output, err := a.snifferCommand(line)
+	if !handled {
+		if a.execute == nil {
+			return
+		}
+		output, err = a.execute(line)
+	}
+	if err != nil {
+		a.message = fmt.Sprintf("%s: %v", line, err)
+	} else if len(output) > 0 {
+		a.output = output
+		a.view = viewOutput
+		a.message = line
+	} else {
+		a.message = line + ": ok"
+	}
+}
+
+func (a *App) draw() error {
+	a.mutex.Lock()
+	width, height := a.screen.Size()
+	lines := a.render(width, height, time.Now())
+	a.mutex.Unlock()
+
+	return a.screen.Draw(lines)
+}
+
+func (a *App) render(width int, height int, now time.Time) []string {
+	title := fmt.Sprintf(" %s   signals %d   frames %d", a.title, a.signals.Len(), a.frames.Len())
+	if a.sniffer != nil {
+		title = fmt.Sprintf(" %s   ids %d   marks %d   window %v   ignored %d", a.title,
+			a.sniffer.Len(), len(a.sniffer.Marks()), a.sniffer.Window(), len(a.sniffer.Ignored()))
+	}
+	lines := []string{style(sgrReverse, fit(title, width))}
+
+	body := height - 3
+	switch a.view {
+	case viewDetail:
+		if a.sniffer != nil {
+			lines = append(lines, pad(a.renderSnifferDetail(width, body, now), body)...)
+		} else {
+			lines = append(lines, pad(a.renderDetail(width, body, now), body)...)
+		}
+	case viewOutput:
+		output := a.output
+		if len(output) > body {
+			output = output[:body]
+		}
+		lines = append(lines, pad(output, body)...)
+	default:
+		if a.sniffer != nil {
+			lines = append(lines, pad(a.renderSniffer(width, body, now), body)...)
+			break
+		}
+		signalHeight := body * 3 / 5
+		if a.hideSignals {
+			signalHeight = 0
+		}
+		frameHeight := body - signalHeight
+
+		// keep the selection visible
+		if a.selected < a.offset {
+			a.offset = a.selected
+		}
+		if rows := signalHeight - 1; rows > 0 && a.selected >= a.offset+rows {
+			a.offset = a.selected - rows + 1
+		}
+		if last := a.frames.Len() - (frameHeight - 1); a.frameOffset > last {
+			a.frameOffset = last
+		}
+		if a.frameOffset < 0 {
+			a.frameOffset = 0
+		}
+		if signalHeight > 0 {
+			lines = append(lines, pad(a.signals.Render(width, signalHeight, a.offset, a.selected, now), signalHeight)...)
+		}
+		lines = append(lines, pad(a.frames.Render(width, frameHeight, a.frameOffset, now), frameHeight)...)
+	}
+
+	status := a.message
+	if status == "" {
+		status = keyHelp
+		if a.sniffer != nil {
+			status = snifferHelp
+		}
+	}
+	lines = append(lines, style(sgrDim, fit(status, width)), "> "+a.editor.Render(width-2))
+
+	for i, line := range lines {
+		lines[i] = clip(line, width)
+	}
+	return lines
+}
+
+// lines filled up to height
+func pad(lines []string, height int) []string {
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func (a *App) renderDetail(width int, height int, now time.Time) []string {
+	signal := a.signals.Get(a.selected)
+	if signal == nil {
+		return []string{"no signal selected"}
+	}
+	def := signal.Value.CanValueDef
+
+	lines := []string{}
+	field := func(name string, value string) {
+		lines = append(lines, style(sgrBold, fit(name, 16))+value)
+	}
+	field("device", signal.Device)
+	field("signal", signal.Name())
+	field("value", signal.FormatValue()+" "+def.Unit)
+	field("state", signal.Value.State.String())
+	if signal.Value.IsVirtual() {
+		field("arbitration id", "virtual")
+	} else {
+		field("arbitration id", "0x"+formatID(signal.Value.ArbitrationID))
+	}
+	field("data", strings.ToUpper(fmt.Sprintf("% x", signal.Value.OriginalData)))
+	field("calculation", def.Calculation)
+	if len(def.FormatSeperators) > 0 {
+		field("separators", fmt.Sprintf("%q", def.FormatSeperators))
+	}
+	field("condition", def.Condition)
+	field("updates", fmt.Sprintf("%d, %s", signal.Count(), formatRate(signal.Rate(now))))
+	field("last update", fmt.Sprintf("%s (%s ago)",
+		signal.Updated.Format("15:04:05.000"), formatAge(now.Sub(signal.Updated))))
+	if !signal.Value.Timestamp.IsZero() {
+		field("frame time", signal.Value.Timestamp.Format("2006-01-02 15:04:05.000000"))
+	}
+	if entry := a.frames.Find(signal.Device, signal.Value.ArbitrationID); entry != nil {
+		field("frame", formatData(entry, now)+"  "+formatAscii(entry))
+	}
+	if len(signal.History) > 0 {
+		low, high := signal.History[0], signal.History[0]
+		for _, v := range signal.History {
+			if v < low {
+				low = v
+			}
+			if v > high {
+				high = v
+			}
+		}
+		field("history", sparkline(signal.History, width-16))
+		field("", fmt.Sprintf("min %g  max %g  last %d values", low, high, len(signal.History)))
+	}
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return lines
+}
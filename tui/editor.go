@@ -0,0 +1,200 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"sort"
+	"strings"
+)
+
+const HistorySize = 100
+
+// the command line with history and completion of the last word
+type LineEditor struct {
+	line    []rune
+	cursor  int
+	history []string
+	browse  int    // history index while browsing, len(history) otherwise
+	draft   string // the line before browsing
+	words   func() []string
+}
+
+// words lists the completions
+func NewLineEditor(words func() []string) *LineEditor {
+	return &LineEditor{words: words}
+}
+
+func (e *LineEditor) String() string {
+	return string(e.line)
+}
+
+func (e *LineEditor) Empty() bool {
+	return len(e.line) == 0
+}
+
+func (e *LineEditor) set(line string) {
+	e.line = []rune(line)
+	e.cursor = len(e.line)
+}
+
+func (e *LineEditor) Insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.cursor+1:], e.line[e.cursor:])
+	e.line[e.cursor] = r
+	e.cursor++
+}
+
+func (e *LineEditor) Backspace() {
+	if e.cursor > 0 {
+		e.line = append(e.line[:e.cursor-1], e.line[e.cursor:]...)
+		e.cursor--
+	}
+}
+
+func (e *LineEditor) Delete() {
+	if e.cursor < len(e.line) {
+		e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+	}
+}
+
+func (e *LineEditor) Left() {
+	if e.cursor > 0 {
+		e.cursor--
+	}
+}
+
+func (e *LineEditor) Right() {
+	if e.cursor < len(e.line) {
+		e.cursor++
+	}
+}
+
+func (e *LineEditor) Home() {
+	e.cursor = 0
+}
+
+func (e *LineEditor) End() {
+	e.cursor = len(e.line)
+}
+
+func (e *LineEditor) Clear() {
+	e.set("")
+	e.browse = len(e.history)
+}
+
+// the previous line of the history
+func (e *LineEditor) Previous() {
+	if e.browse == len(e.history) {
+		e.draft = e.String()
+	}
+	if e.browse > 0 {
+		e.browse--
+		e.set(e.history[e.browse])
+	}
+}
+
+// the next line of the history, the edited line after the last
+func (e *LineEditor) Next() {
+	if e.browse < len(e.history) {
+		e.browse++
+		if e.browse == len(e.history) {
+			e.set(e.draft)
+		} else {
+			e.set(e.history[e.browse])
+		}
+	}
+}
+
+// the entered line, added to the history
+func (e *LineEditor) Submit() string {
+	line := strings.TrimSpace(e.String())
+	if line != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+		e.history = append(e.history, line)
+		if len(e.history) > HistorySize {
+			e.history = e.history[1:]
+		}
+	}
+	e.Clear()
+	return line
+}
+
+// completes the word before the cursor to the longest common prefix of the
+// matching words. returns the matches
+func (e *LineEditor) Complete() []string {
+	if e.words == nil {
+		return nil
+	}
+	before := string(e.line[:e.cursor])
+	start := strings.LastIndex(before, " ") + 1
+	prefix := before[start:]
+
+	matches := []string{}
+	for _, word := range e.words() {
+		if strings.HasPrefix(word, prefix) {
+			matches = append(matches, word)
+		}
+	}
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return matches
+	}
+
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	completed := before[:start] + common
+	after := string(e.line[e.cursor:])
+	e.line = []rune(completed + after)
+	e.cursor = len([]rune(completed))
+	return matches
+}
+
+// the line with a block cursor, scrolled to keep the cursor visible
+func (e *LineEditor) Render(width int) string {
+	if width <= 1 {
+		return ""
+	}
+	start := 0
+	if e.cursor >= width {
+		start = e.cursor - width + 1
+	}
+	line := append([]rune{}, e.line...)
+	line = append(line, ' ')
+	visible := line[start:]
+	if len(visible) > width {
+		visible = visible[:width]
+	}
+	at := e.cursor - start
+	return fit(string(visible[:at]), at) +
+		style(sgrReverse, string(visible[at])) +
+		string(visible[at+1:])
+}
@@ -0,0 +1,172 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+)
+
+// bytes changed within this time are highlighted
+const ChangeHighlight = time.Second
+
+// the last frame of an arbitration id
+type FrameEntry struct {
+	Device  string
+	ID      uint32
+	DLC     uint8
+	Data    [8]byte
+	Changed [8]time.Time // last change of each byte
+	Updated time.Time
+	meter   rateMeter
+}
+
+func (f *FrameEntry) Count() uint64 {
+	return f.meter.count
+}
+
+func (f *FrameEntry) Rate(now time.Time) float64 {
+	return f.meter.rate(now)
+}
+
+// the frames sorted by device and id
+type FrameTable struct {
+	frames []*FrameEntry
+}
+
+func NewFrameTable() *FrameTable {
+	return &FrameTable{}
+}
+
+func (t *FrameTable) Len() int {
+	return len(t.frames)
+}
+
+func (t *FrameTable) Get(i int) *FrameEntry {
+	if i < 0 || i >= len(t.frames) {
+		return nil
+	}
+	return t.frames[i]
+}
+
+// the frame entry of an id, nil if not received yet
+func (t *FrameTable) Find(device string, id uint32) *FrameEntry {
+	i := t.search(device, id)
+	if i < len(t.frames) && t.frames[i].Device == device && t.frames[i].ID == id {
+		return t.frames[i]
+	}
+	return nil
+}
+
+func (t *FrameTable) search(device string, id uint32) int {
+	return sort.Search(len(t.frames), func(i int) bool {
+		f := t.frames[i]
+		return f.Device > device || (f.Device == device && f.ID >= id)
+	})
+}
+
+func (t *FrameTable) Update(device string, frame *canbus.Frame, now time.Time) *FrameEntry {
+	i := t.search(device, frame.ArbitrationID)
+	entry := t.Get(i)
+	if entry == nil || entry.Device != device || entry.ID != frame.ArbitrationID {
+		entry = &FrameEntry{Device: device, ID: frame.ArbitrationID, DLC: frame.DLC, Data: frame.Data}
+		t.frames = append(t.frames, nil)
+		copy(t.frames[i+1:], t.frames[i:])
+		t.frames[i] = entry
+	} else {
+		for b := range entry.Data {
+			if entry.Data[b] != frame.Data[b] || (b >= int(entry.DLC)) != (b >= int(frame.DLC)) {
+				entry.Changed[b] = now
+			}
+		}
+		entry.DLC = frame.DLC
+		entry.Data = frame.Data
+	}
+	entry.Updated = now
+	entry.meter.add(now)
+	return entry
+}
+
+// the id as candump does: 3 hex digits for standard, 8 for extended ids
+func formatID(id uint32) string {
+	if canbus.IsExtendedID(id) {
+		return fmt.Sprintf("%08X", id&canbus.CanEffMask)
+	}
+	return fmt.Sprintf("%03X", id&canbus.CanSffMask)
+}
+
+// the data bytes, changed ones highlighted
+func formatData(entry *FrameEntry, now time.Time) string {
+	var data strings.Builder
+	for b := 0; b < 8; b++ {
+		if b > 0 {
+			data.WriteByte(' ')
+		}
+		if b >= int(entry.DLC) {
+			data.WriteString("  ")
+			continue
+		}
+		text := fmt.Sprintf("%02X", entry.Data[b])
+		if !entry.Changed[b].IsZero() && now.Sub(entry.Changed[b]) < ChangeHighlight {
+			text = style(sgrChanged, text)
+		}
+		data.WriteString(text)
+	}
+	return data.String()
+}
+
+// printable data bytes
+func formatAscii(entry *FrameEntry) string {
+	text := []byte{}
+	for _, b := range entry.Data[:entry.DLC] {
+		if b < 32 || b > 126 {
+			b = '.'
+		}
+		text = append(text, b)
+	}
+	return fit(string(text), 8)
+}
+
+// header and the rows from offset
+func (t *FrameTable) Render(width int, height int, offset int, now time.Time) []string {
+	header := style(sgrBold, fit(fmt.Sprintf("%-8s %-8s %3s %-23s %-8s %8s %8s %7s",
+		"device", "id", "dlc", "data", "ascii", "count", "rate", "age"), width))
+	lines := []string{header}
+	for i := offset; i < len(t.frames) && len(lines) < height; i++ {
+		entry := t.frames[i]
+		line := fit(entry.Device, 8) + " " + fit(formatID(entry.ID), 8) + " " +
+			fitRight(fmt.Sprint(entry.DLC), 3) + " " + formatData(entry, now) + " " +
+			formatAscii(entry) + " " + fitRight(fmt.Sprint(entry.Count()), 8) + " " +
+			fitRight(formatRate(entry.Rate(now)), 8) + " " +
+			fitRight(formatAge(now.Sub(entry.Updated)), 7)
+		lines = append(lines, line)
+	}
+	return lines
+}
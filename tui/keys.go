@@ -0,0 +1,153 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package tui is a full screen terminal ui for the cli: a live signal table,
+// raw frames with change highlighting, a command line and a detail view.
+package tui
+
+import (
+	"strings"
+)
+
+type KeyCode int
+
+const (
+	KeyRune KeyCode = iota
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyDelete
+	KeyEscape
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyCtrl // Rune is the letter, e.g. 'c' for ctrl-c
+	KeyUnknown
+)
+
+type Key struct {
+	Code KeyCode
+	Rune rune
+}
+
+// a terminal input, tty.TTY in raw mode
+type terminalInput struct {
+	read     func() (rune, error)
+	buffered func() bool
+}
+
+// reads keys until the input fails. escape sequences have to arrive at
+// once, a lone escape is the escape key
+func readKeys(in terminalInput, keys chan<- Key) {
+	defer close(keys)
+
+	for {
+		r, err := in.read()
+		if err != nil {
+			return
+		}
+		key := Key{Code: KeyRune, Rune: r}
+		switch {
+		case r == 27:
+			key = readEscape(in)
+		case r == '\r' || r == '\n':
+			key.Code = KeyEnter
+		case r == '\t':
+			key.Code = KeyTab
+		case r == 127 || r == 8:
+			key.Code = KeyBackspace
+		case r < 32:
+			key = Key{Code: KeyCtrl, Rune: r + 'a' - 1}
+		}
+		keys <- key
+	}
+}
+
+func readEscape(in terminalInput) Key {
+	if !in.buffered() {
+		return Key{Code: KeyEscape}
+	}
+	r, err := in.read()
+	if err != nil || (r != '[' && r != 'O') {
+		return Key{Code: KeyEscape}
+	}
+
+	// csi/ss3: parameters up to a final byte
+	var sequence strings.Builder
+	for in.buffered() {
+		r, err = in.read()
+		if err != nil {
+			break
+		}
+		sequence.WriteRune(r)
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+	}
+	return escapeKey(sequence.String())
+}
+
+func escapeKey(sequence string) Key {
+	if sequence == "" {
+		return Key{Code: KeyUnknown}
+	}
+	final := sequence[len(sequence)-1]
+	// modifiers, e.g. 1;5A for ctrl-up, are ignored
+	params := strings.Split(sequence[:len(sequence)-1], ";")[0]
+
+	switch final {
+	case 'A':
+		return Key{Code: KeyUp}
+	case 'B':
+		return Key{Code: KeyDown}
+	case 'C':
+		return Key{Code: KeyRight}
+	case 'D':
+		return Key{Code: KeyLeft}
+	case 'H':
+		return Key{Code: KeyHome}
+	case 'F':
+		return Key{Code: KeyEnd}
+	case '~':
+		switch params {
+		case "1", "7":
+			return Key{Code: KeyHome}
+		case "3":
+			return Key{Code: KeyDelete}
+		case "4", "8":
+			return Key{Code: KeyEnd}
+		case "5":
+			return Key{Code: KeyPageUp}
+		case "6":
+			return Key{Code: KeyPageDown}
+		}
+	}
+	return Key{Code: KeyUnknown}
+}
@@ -0,0 +1,71 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import "time"
+
+const (
+	rateSamples = 32
+	rateWindow  = 10 * time.Second
+)
+
+// updates per second over the last updates within the rate window
+type rateMeter struct {
+	times [rateSamples]time.Time
+	next  int
+	count uint64
+}
+
+func (m *rateMeter) add(now time.Time) {
+	m.times[m.next] = now
+	m.next = (m.next + 1) % rateSamples
+	m.count++
+}
+
+func (m *rateMeter) last() time.Time {
+	return m.times[(m.next+rateSamples-1)%rateSamples]
+}
+
+func (m *rateMeter) rate(now time.Time) float64 {
+	var (
+		first time.Time
+		n     int
+	)
+	for _, t := range m.times {
+		if t.IsZero() || now.Sub(t) > rateWindow {
+			continue
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		n++
+	}
+	if n < 2 {
+		return 0
+	}
+	// from the first update in the window until now, a silent signal decays
+	return float64(n-1) / now.Sub(first).Seconds()
+}
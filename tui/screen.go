@@ -0,0 +1,157 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+
+	"github.com/mattn/go-tty"
+)
+
+// the terminal in raw mode on the alternate screen. only changed lines are
+// redrawn, so updates do not flicker
+type Screen struct {
+	tty     *tty.TTY
+	out     *bufio.Writer
+	restore func() error
+	width   int
+	height  int
+	drawn   []string
+	keys    chan Key
+	resize  chan struct{}
+	mutex   sync.Mutex
+}
+
+func OpenScreen() (*Screen, error) {
+	t, err := tty.Open()
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := t.Size()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	restore, err := t.Raw()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	s := &Screen{
+		tty:     t,
+		out:     bufio.NewWriterSize(t.Output(), 64*1024),
+		restore: restore,
+		width:   width,
+		height:  height,
+		keys:    make(chan Key, 16),
+		resize:  make(chan struct{}, 1),
+	}
+	// alternate screen, hidden cursor
+	s.out.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+	if err := s.out.Flush(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	go readKeys(terminalInput{read: t.ReadRune, buffered: t.Buffered}, s.keys)
+	go func() {
+		for size := range t.SIGWINCH() {
+			s.mutex.Lock()
+			s.width, s.height = size.W, size.H
+			s.drawn = nil
+			s.mutex.Unlock()
+			select {
+			case s.resize <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return s, nil
+}
+
+// closed when the terminal input fails
+func (s *Screen) Keys() <-chan Key {
+	return s.keys
+}
+
+func (s *Screen) Resized() <-chan struct{} {
+	return s.resize
+}
+
+func (s *Screen) Size() (width int, height int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.width, s.height
+}
+
+// draws lines from the top. lines have to fit the width, missing lines are cleared
+func (s *Screen) Draw(lines []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.drawn == nil {
+		s.out.WriteString("\x1b[2J")
+		s.drawn = make([]string, s.height)
+	}
+	for row := 0; row < s.height; row++ {
+		line := ""
+		if row < len(lines) {
+			line = lines[row]
+		}
+		if s.drawn[row] == line {
+			continue
+		}
+		s.drawn[row] = line
+		fmt.Fprintf(s.out, "\x1b[%d;1H%s%s\x1b[K", row+1, line, sgrReset)
+	}
+	return s.out.Flush()
+}
+
+// redraws everything on the next Draw
+func (s *Screen) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.drawn = nil
+}
+
+// restores the terminal
+func (s *Screen) Close() error {
+	s.mutex.Lock()
+	s.out.WriteString(sgrReset + "\x1b[?25h\x1b[?1049l")
+	s.out.Flush()
+	s.mutex.Unlock()
+
+	err := s.restore()
+	if cErr := s.tty.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
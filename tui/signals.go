@@ -0,0 +1,169 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+	"github.com/ChrIgiSta/go-can-coder/utils"
+)
+
+const historySize = 120
+
+// the last value of a decoded signal
+type Signal struct {
+	Device  string
+	Value   cancoder.CanValueMap
+	Updated time.Time // receive time, frames of replays carry the recorded time
+	History []float64 // the last numeric values
+	meter   rateMeter
+}
+
+func (s *Signal) Count() uint64 {
+	return s.meter.count
+}
+
+func (s *Signal) Rate(now time.Time) float64 {
+	return s.meter.rate(now)
+}
+
+func (s *Signal) Name() string {
+	return string(s.Value.CanValueDef.Name)
+}
+
+func (s *Signal) FormatValue() string {
+	switch v := s.Value.CanValueDef.Value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return utils.InterfaceToString(v)
+	}
+}
+
+// the signals sorted by device and name
+type SignalTable struct {
+	signals []*Signal
+}
+
+func NewSignalTable() *SignalTable {
+	return &SignalTable{}
+}
+
+func (t *SignalTable) Len() int {
+	return len(t.signals)
+}
+
+func (t *SignalTable) Get(i int) *Signal {
+	if i < 0 || i >= len(t.signals) {
+		return nil
+	}
+	return t.signals[i]
+}
+
+func (t *SignalTable) Find(device string, name cancoder.CanVars) *Signal {
+	i := t.search(device, name)
+	if i < len(t.signals) && t.signals[i].Device == device && t.signals[i].Value.CanValueDef.Name == name {
+		return t.signals[i]
+	}
+	return nil
+}
+
+func (t *SignalTable) search(device string, name cancoder.CanVars) int {
+	return sort.Search(len(t.signals), func(i int) bool {
+		s := t.signals[i]
+		return s.Device > device || (s.Device == device && s.Value.CanValueDef.Name >= name)
+	})
+}
+
+func (t *SignalTable) Update(device string, value *cancoder.CanValueMap, now time.Time) {
+	name := value.CanValueDef.Name
+	i := t.search(device, name)
+	if i == len(t.signals) || t.signals[i].Device != device || t.signals[i].Value.CanValueDef.Name != name {
+		t.signals = append(t.signals, nil)
+		copy(t.signals[i+1:], t.signals[i:])
+		t.signals[i] = &Signal{Device: device}
+	}
+
+	signal := t.signals[i]
+	signal.Value = *value
+	signal.Value.OriginalData = append([]byte{}, value.OriginalData...)
+	signal.Updated = now
+	signal.meter.add(now)
+	if v, ok := value.CanValueDef.Value.(float64); ok {
+		signal.History = append(signal.History, v)
+		if len(signal.History) > historySize {
+			signal.History = signal.History[1:]
+		}
+	}
+}
+
+// header and the rows from offset, the selected one highlighted
+func (t *SignalTable) Render(width int, height int, offset int, selected int, now time.Time) []string {
+	const (
+		deviceWidth = 8
+		unitWidth   = 8
+		ageWidth    = 7
+		rateWidth   = 8
+	)
+	rest := width - deviceWidth - unitWidth - ageWidth - rateWidth - 5
+	nameWidth := rest * 3 / 5
+	valueWidth := rest - nameWidth
+
+	row := func(device, name, value, unit, age, rate string) string {
+		return strings.Join([]string{
+			fit(device, deviceWidth),
+			fit(name, nameWidth),
+			fitRight(value, valueWidth),
+			fit(unit, unitWidth),
+			fitRight(age, ageWidth),
+			fitRight(rate, rateWidth),
+		}, " ")
+	}
+
+	lines := []string{style(sgrBold, row("device", "signal", "value", "unit", "age", "rate"))}
+	for i := offset; i < len(t.signals) && len(lines) < height; i++ {
+		s := t.signals[i]
+		value := s.FormatValue()
+		if s.Value.State == cancoder.StateTimeout {
+			value = s.Value.State.String()
+		}
+		line := row(s.Device, s.Name(), value, s.Value.CanValueDef.Unit,
+			formatAge(now.Sub(s.Updated)), formatRate(s.Rate(now)))
+		if i == selected {
+			line = style(sgrReverse, line)
+		} else if s.Value.State == cancoder.StateStale || s.Value.State == cancoder.StateTimeout {
+			line = style(sgrDim, line)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
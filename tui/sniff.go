@@ -0,0 +1,211 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/sniffer"
+)
+
+var snifferCommands = []string{"mark", "ignore", "unignore", "changing", "reset", "window", "candidates"}
+
+// shows the sniffer instead of signals and frames. ctrl-k marks a moment
+func (a *App) EnableSniffer(s *sniffer.Sniffer) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.sniffer = s
+}
+
+func (a *App) mark() {
+	n := a.sniffer.Mark(time.Now())
+	a.message = fmt.Sprintf("mark %d", n)
+}
+
+// sniffer commands, handled is false for other commands
+func (a *App) snifferCommand(line string) (handled bool, output []string, err error) {
+	fields := strings.Fields(line)
+	if a.sniffer == nil || len(fields) == 0 {
+		return false, nil, nil
+	}
+	args := strings.Join(fields[1:], ",")
+
+	switch fields[0] {
+	case "mark":
+		a.mark()
+	case "ignore":
+		if args == "changing" {
+			a.message = fmt.Sprintf("ignoring %d changing ids", a.sniffer.IgnoreChanging())
+			return true, nil, nil
+		}
+		ids, err := sniffer.ParseIDs(args)
+		if err != nil {
+			return true, nil, err
+		}
+		for _, id := range ids {
+			a.sniffer.Ignore(id)
+		}
+		if len(ids) == 0 {
+			output = []string{"ignored: " + formatIDs(a.sniffer.Ignored())}
+		}
+	case "unignore":
+		ids := a.sniffer.Ignored()
+		if args != "all" {
+			ids, err = sniffer.ParseIDs(args)
+			if err != nil {
+				return true, nil, err
+			}
+		}
+		for _, id := range ids {
+			a.sniffer.Unignore(id)
+		}
+	case "reset":
+		a.sniffer.Reset()
+	case "window":
+		window, err := time.ParseDuration(args)
+		if err != nil {
+			return true, nil, err
+		}
+		a.sniffer.SetWindow(window)
+	case "candidates":
+		output = []string{fmt.Sprintf("bits changed only within %v around %d marks:",
+			a.sniffer.Window(), len(a.sniffer.Marks()))}
+		for _, candidate := range a.sniffer.Candidates() {
+			output = append(output, fmt.Sprintf("  %-8s %s  bits %s", candidate.Device,
+				formatID(candidate.ID.ID), sniffer.FormatBits(candidate.Bits)))
+		}
+	default:
+		return false, nil, nil
+	}
+	return true, output, nil
+}
+
+func formatIDs(ids []uint32) string {
+	names := []string{}
+	for _, id := range ids {
+		names = append(names, formatID(id))
+	}
+	return strings.Join(names, ",")
+}
+
+// bits of a byte, msb first, styled by state
+func (a *App) formatBits(entry *sniffer.ID, b int, now time.Time) string {
+	var bits strings.Builder
+	for bit := 7; bit >= 0; bit-- {
+		text := "-"
+		if b < int(entry.DLC) {
+			text = fmt.Sprint(entry.Data[b] >> bit & 1)
+		}
+		i := b*8 + bit
+		switch a.sniffer.State(entry, i) {
+		case sniffer.Marked:
+			text = style(sgrMarked, text)
+		case sniffer.Changed:
+			if now.Sub(entry.Bits[i].Changed) < ChangeHighlight {
+				text = style(sgrChanged, text)
+			}
+		default:
+			text = style(sgrDim, text)
+		}
+		bits.WriteString(text)
+	}
+	return bits.String()
+}
+
+func (a *App) renderSniffer(width int, height int, now time.Time) []string {
+	// keep the selection visible
+	if a.selected < a.offset {
+		a.offset = a.selected
+	}
+	if rows := height - 1; rows > 0 && a.selected >= a.offset+rows {
+		a.offset = a.selected - rows + 1
+	}
+
+	header := fmt.Sprintf("%-8s %-8s %3s %-71s %8s %8s", "device", "id", "dlc",
+		"bits (byte 0 msb first)  green: changed only around marks", "count", "changes")
+	lines := []string{style(sgrBold, fit(header, width))}
+	for i := a.offset; i < a.sniffer.Len() && len(lines) < height; i++ {
+		entry := a.sniffer.Get(i)
+		bytes := []string{}
+		changes := uint64(0)
+		for b := 0; b < 8; b++ {
+			bytes = append(bytes, a.formatBits(entry, b, now))
+			for bit := 0; bit < 8; bit++ {
+				changes += entry.Bits[b*8+bit].Changes
+			}
+		}
+		prefix := fit(entry.Device, 8) + " " + fit(formatID(entry.ID), 8) + " " +
+			fitRight(fmt.Sprint(entry.DLC), 3) + " "
+		if i == a.selected {
+			prefix = style(sgrReverse, prefix)
+		}
+		lines = append(lines, prefix+strings.Join(bytes, " ")+" "+
+			fitRight(fmt.Sprint(entry.Count), 8)+" "+fitRight(fmt.Sprint(changes), 8))
+	}
+	return lines
+}
+
+// change count and last change of every bit of the selected id
+func (a *App) renderSnifferDetail(width int, height int, now time.Time) []string {
+	entry := a.sniffer.Get(a.selected)
+	if entry == nil {
+		return []string{"no id selected"}
+	}
+	lines := []string{
+		style(sgrBold, fmt.Sprintf("%s %s", entry.Device, formatID(entry.ID))) +
+			fmt.Sprintf("  %d frames since %s, marks %d, window %v", entry.Count,
+				entry.First.Format("15:04:05"), len(a.sniffer.Marks()), a.sniffer.Window()),
+		style(sgrBold, "byte  "+fmt.Sprintf("%-18s", "changes bit 7..0")+strings.Repeat(" ", 44)+"last change bit 7..0"),
+	}
+	for b := 0; b < 8; b++ {
+		counts := ""
+		ages := ""
+		for bit := 7; bit >= 0; bit-- {
+			state := &entry.Bits[b*8+bit]
+			count := fitRight(fmt.Sprint(state.Changes), 7)
+			switch a.sniffer.State(entry, b*8+bit) {
+			case sniffer.Marked:
+				count = style(sgrMarked, count)
+			case sniffer.Unchanged:
+				count = style(sgrDim, count)
+			}
+			counts += count + " "
+			age := "-"
+			if !state.Changed.IsZero() {
+				age = formatAge(now.Sub(state.Changed))
+			}
+			ages += fitRight(age, 6)
+		}
+		lines = append(lines, fmt.Sprintf("%4d  ", b)+counts+" "+ages)
+	}
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return lines
+}
@@ -0,0 +1,155 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ansi select graphic rendition
+const (
+	sgrReset   = "\x1b[0m"
+	sgrBold    = "\x1b[1m"
+	sgrDim     = "\x1b[2m"
+	sgrReverse = "\x1b[7m"
+	sgrChanged = "\x1b[30;43m" // black on yellow
+	sgrMarked  = "\x1b[30;42m" // black on green
+)
+
+func style(sgr string, text string) string {
+	return sgr + text + sgrReset
+}
+
+// text padded or cut to width runes. control characters are replaced,
+// they would break the layout
+func fit(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := make([]rune, 0, width)
+	for _, r := range text {
+		if r < 32 || r == 127 {
+			r = '·'
+		}
+		runes = append(runes, r)
+	}
+	if len(runes) > width {
+		if width > 1 {
+			return string(runes[:width-1]) + "…"
+		}
+		return string(runes[:width])
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// like fit, but aligned right
+func fitRight(text string, width int) string {
+	n := utf8.RuneCountInString(text)
+	if n >= width {
+		return fit(text, width)
+	}
+	return strings.Repeat(" ", width-n) + text
+}
+
+func formatAge(age time.Duration) string {
+	switch {
+	case age < 0:
+		return "0.0s"
+	case age < 10*time.Second:
+		return fmt.Sprintf("%.1fs", age.Seconds())
+	case age < 2*time.Minute:
+		return fmt.Sprintf("%.0fs", age.Seconds())
+	case age < 2*time.Hour:
+		return fmt.Sprintf("%.0fm", age.Minutes())
+	}
+	return fmt.Sprintf("%.0fh", age.Hours())
+}
+
+func formatRate(rate float64) string {
+	if rate <= 0 {
+		return "-"
+	}
+	if rate < 10 {
+		return fmt.Sprintf("%.1f/s", rate)
+	}
+	return fmt.Sprintf("%.0f/s", rate)
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// values as bar chart of width characters, the last values if there are more
+func sparkline(values []float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	line := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if high > low {
+			level = int((v - low) / (high - low) * float64(len(sparks)-1))
+		}
+		line[i] = sparks[level]
+	}
+	return string(line)
+}
+
+// cuts a styled line to width visible runes. escape sequences are kept
+func clip(line string, width int) string {
+	var (
+		out     strings.Builder
+		visible int
+		escape  bool
+	)
+	for _, r := range line {
+		switch {
+		case escape:
+			out.WriteRune(r)
+			escape = !(r >= 0x40 && r <= 0x7e && r != '[')
+		case r == 27:
+			out.WriteRune(r)
+			escape = true
+		case visible < width:
+			out.WriteRune(r)
+			visible++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,176 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tui
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-can-coder/canbus"
+	"github.com/ChrIgiSta/go-can-coder/cancoder"
+)
+
+func TestReadKeys(t *testing.T) {
+	input := strings.NewReader("a\x1b[A\x1b[5~\x1b[1;5B\t\x7f\x03\r")
+	keys := make(chan Key, 16)
+	readKeys(terminalInput{
+		read: func() (rune, error) {
+			r, _, err := input.ReadRune()
+			return r, err
+		},
+		buffered: func() bool { return input.Len() > 0 },
+	}, keys)
+
+	expected := []Key{
+		{Code: KeyRune, Rune: 'a'},
+		{Code: KeyUp},
+		{Code: KeyPageUp},
+		{Code: KeyDown},
+		{Code: KeyTab, Rune: '\t'},
+		{Code: KeyBackspace, Rune: 127},
+		{Code: KeyCtrl, Rune: 'c'},
+		{Code: KeyEnter, Rune: '\r'},
+	}
+	i := 0
+	for key := range keys {
+		if i >= len(expected) || key != expected[i] {
+			t.Errorf("key %d: %+v", i, key)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("%d keys", i)
+	}
+
+	// a lone escape
+	input = strings.NewReader("\x1b")
+	keys = make(chan Key, 1)
+	readKeys(terminalInput{
+		read: func() (rune, error) {
+			r, _, err := input.ReadRune()
+			if err != nil {
+				return 0, io.EOF
+			}
+			return r, nil
+		},
+		buffered: func() bool { return input.Len() > 0 },
+	}, keys)
+	if key := <-keys; key.Code != KeyEscape {
+		t.Errorf("escape: %+v", key)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	editor := NewLineEditor(func() []string {
+		return []string{"dooropen", "doorclose", "help", "can0"}
+	})
+
+	for _, r := range "do" {
+		editor.Insert(r)
+	}
+	if matches := editor.Complete(); len(matches) != 2 || editor.String() != "door" {
+		t.Errorf("complete: %v %q", matches, editor.String())
+	}
+	editor.Insert('o')
+	editor.Complete()
+	if line := editor.Submit(); line != "dooropen" {
+		t.Errorf("submit: %q", line)
+	}
+
+	for _, r := range "can0 he" {
+		editor.Insert(r)
+	}
+	editor.Complete()
+	if line := editor.Submit(); line != "can0 help" {
+		t.Errorf("complete last word: %q", line)
+	}
+
+	editor.Insert('x')
+	editor.Previous()
+	if editor.String() != "can0 help" {
+		t.Errorf("previous: %q", editor.String())
+	}
+	editor.Previous()
+	editor.Previous()
+	if editor.String() != "dooropen" {
+		t.Errorf("first: %q", editor.String())
+	}
+	editor.Next()
+	editor.Next()
+	if editor.String() != "x" {
+		t.Errorf("draft: %q", editor.String())
+	}
+}
+
+func TestTables(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	signals := NewSignalTable()
+	for i, device := range []string{"can1", "can0", "can1"} {
+		signals.Update(device, &cancoder.CanValueMap{
+			CanValueDef: cancoder.CanValueDef{Name: cancoder.EngineSpeedRPM, Value: float64(800 + i)},
+		}, now.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	if signals.Len() != 2 || signals.Get(0).Device != "can0" || signals.Get(1).Count() != 2 {
+		t.Fatal("signal table")
+	}
+	if rate := signals.Get(1).Rate(now.Add(200 * time.Millisecond)); rate != 5 {
+		t.Errorf("rate %f", rate)
+	}
+	if value := signals.Get(1).FormatValue(); value != "802" {
+		t.Errorf("value %s", value)
+	}
+
+	frames := NewFrameTable()
+	frame := &canbus.Frame{}
+	frame.ArbitrationID = 0x108
+	frame.DLC = 2
+	frame.Data = [8]byte{0x13, 0x0c}
+	frames.Update("can1", frame, now)
+	frame.Data[1] = 0x0d
+	entry := frames.Update("can1", frame, now.Add(time.Second))
+	if !entry.Changed[0].IsZero() || !entry.Changed[1].Equal(now.Add(time.Second)) {
+		t.Errorf("changes: %v", entry.Changed)
+	}
+	data := formatData(entry, now.Add(time.Second))
+	if !strings.HasPrefix(data, "13 "+sgrChanged+"0D"+sgrReset) {
+		t.Errorf("highlight: %q", data)
+	}
+	if frames.Find("can1", 0x108) != entry || frames.Find("can0", 0x108) != nil {
+		t.Error("find")
+	}
+}
+
+func TestClip(t *testing.T) {
+	line := "ab" + style(sgrChanged, "cd") + "ef"
+	if clipped := clip(line, 3); clipped != "ab"+sgrChanged+"c"+sgrReset {
+		t.Errorf("clip: %q", clipped)
+	}
+	if fit("abcdef", 4) != "abc…" || fit("ab", 4) != "ab  " || fitRight("ab", 4) != "  ab" {
+		t.Error("fit")
+	}
+}